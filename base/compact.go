@@ -0,0 +1,1231 @@
+package base
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CompactOptions controls how a model is written
+// with the compact encoding (see MarshalModelCompact)
+type CompactOptions struct {
+	// Float32 quantizes every non-integer number of
+	// the model's data to a float32, halving the size
+	// of large parameter arrays at the cost of some
+	// precision. Integers (counts, labels, etc.) are
+	// always stored exactly.
+	Float32 bool
+
+	// Compress deflates the encoded model (using
+	// compress/flate, so no external dependencies
+	// are needed)
+	Compress bool
+}
+
+// compactMagic is written at the start of every
+// compactly encoded model so it can be told apart
+// from JSON envelopes (and legacy models) when
+// restoring
+var compactMagic = []byte("GOMLC")
+
+// CompactVersion is the current version of the
+// compact encoding written by this package
+const CompactVersion = 1
+
+// flags of the compact encoding header
+const (
+	compactFloat32 byte = 1 << iota
+	compactDeflate
+)
+
+// tags of the values within the compact encoding.
+// Packed arrays are used for arrays holding only
+// numbers, which is what model parameters are.
+const (
+	tagNull byte = iota
+	tagFalse
+	tagTrue
+	tagInt
+	tagFloat64
+	tagFloat32
+	tagNumber
+	tagString
+	tagArray
+	tagObject
+	tagInts
+	tagFloat64s
+	tagFloat32s
+)
+
+// IsCompact returns whether the given bytes start
+// with the header of a compactly encoded model
+func IsCompact(data []byte) bool {
+	return bytes.HasPrefix(data, compactMagic)
+}
+
+// MarshalModelCompact returns the model's envelope
+// in the compact encoding: a small binary header
+// followed by the envelope's metadata and the model's
+// data, where numbers are stored as little-endian
+// binary (varints for integers) instead of text. The
+// data can optionally be quantized to float32 and/or
+// deflated with opts.
+//
+// Compact models are restored by the same functions
+// as JSON ones (RestoreModel, UnmarshalModel, Load,
+// and the models' RestoreFromFile, ReadFrom, etc.)
+// which detect the encoding on their own.
+//
+// Because the numbers are re-encoded, the envelope's
+// checksum is computed over the data as it will be
+// decoded (after quantization) so restoring verifies
+// exactly what was written.
+func MarshalModelCompact(p Persistable, opts CompactOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := WriteModelCompact(&buf, p, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteModelCompact writes the model's envelope in
+// the compact encoding (see MarshalModelCompact) to
+// w, returning the number of bytes written.
+func WriteModelCompact(w io.Writer, p Persistable, opts CompactOptions) (int64, error) {
+	env, err := p.MarshalEnvelope()
+	if err != nil {
+		return 0, err
+	}
+
+	// parse the data keeping the order of object
+	// keys so the encoding is deterministic
+	dec := json.NewDecoder(bytes.NewReader(env.Data))
+	dec.UseNumber()
+	data, err := parseValue(dec)
+	if err != nil {
+		return 0, err
+	}
+
+	var body bytes.Buffer
+	enc := &compactEncoder{w: &body, float32: opts.Float32}
+	err = enc.value(data)
+	if err != nil {
+		return 0, err
+	}
+
+	// recompute the checksum over the data as it
+	// will be decoded
+	decoded, err := newCompactDecoder(bytes.NewReader(body.Bytes())).data(env.Hyperparameters)
+	if err != nil {
+		return 0, err
+	}
+
+	header := *env
+	header.Data = nil
+	header.Checksum = decoded.checksum
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return 0, err
+	}
+
+	var flags byte
+	if opts.Float32 {
+		flags |= compactFloat32
+	}
+	if opts.Compress {
+		flags |= compactDeflate
+	}
+
+	counter := &countingWriter{w: w}
+	_, err = counter.Write(append(append([]byte{}, compactMagic...), CompactVersion, flags))
+	if err != nil {
+		return counter.n, err
+	}
+
+	var out io.Writer = counter
+	var deflate *flate.Writer
+	if opts.Compress {
+		deflate, err = flate.NewWriter(counter, flate.BestCompression)
+		if err != nil {
+			return counter.n, err
+		}
+		out = deflate
+	}
+
+	var length [binary.MaxVarintLen64]byte
+	_, err = out.Write(length[:binary.PutUvarint(length[:], uint64(len(headerBytes)))])
+	if err != nil {
+		return counter.n, err
+	}
+	_, err = out.Write(headerBytes)
+	if err != nil {
+		return counter.n, err
+	}
+	_, err = out.Write(body.Bytes())
+	if err != nil {
+		return counter.n, err
+	}
+
+	if deflate != nil {
+		err = deflate.Close()
+	}
+
+	return counter.n, err
+}
+
+// PersistModelCompact saves the model's envelope in
+// the compact encoding (see MarshalModelCompact) to
+// the file at path. Like PersistModel, the file is
+// written atomically with PersistFileMode permissions.
+//
+//     // save the model with float32 parameters, deflated
+//     err := base.PersistModelCompact("/tmp/.goml/Softmax.goml", model, base.CompactOptions{
+//         Float32:  true,
+//         Compress: true,
+//     })
+func PersistModelCompact(path string, p Persistable, opts CompactOptions) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := MarshalModelCompact(p, opts)
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(path, bytes, PersistFileMode)
+}
+
+// ReadEnvelope reads a persisted model from r into an
+// envelope, returning the number of bytes read. Models
+// in the compact encoding are decoded as they are read
+// (so neither the compressed file nor the JSON the data
+// stands for is ever held in memory, and numeric arrays
+// are copied straight into the model's slices by
+// Decode,) while JSON envelopes and legacy models are
+// read until EOF and parsed with ParseEnvelope.
+func ReadEnvelope(r io.Reader) (*Envelope, int64, error) {
+	counter := &countingReader{r: r}
+	buffered := bufio.NewReader(counter)
+
+	magic, err := buffered.Peek(len(compactMagic))
+	if err != nil && err != io.EOF {
+		return nil, counter.n, err
+	}
+
+	if !IsCompact(magic) {
+		data, err := ioutil.ReadAll(buffered)
+		if err != nil {
+			return nil, counter.n, err
+		}
+
+		env, err := ParseEnvelope(data)
+		return env, counter.n, err
+	}
+
+	env, err := readCompact(buffered)
+	if err != nil {
+		return nil, counter.n, err
+	}
+
+	// drain anything after the model so the byte
+	// count matches what was written
+	_, err = io.Copy(ioutil.Discard, buffered)
+	return env, counter.n, err
+}
+
+// readCompact decodes a compactly encoded envelope
+// from r. The data is kept decoded (see compactData)
+// rather than turned back into JSON.
+func readCompact(r *bufio.Reader) (*Envelope, error) {
+	header := make([]byte, len(compactMagic)+2)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: compact model header is truncated: %v", err)
+	}
+
+	version, flags := header[len(compactMagic)], header[len(compactMagic)+1]
+	if version > CompactVersion {
+		return nil, fmt.Errorf("ERROR: compact encoding version %v is newer than the newest supported version (%v)", version, CompactVersion)
+	}
+
+	var body io.Reader = r
+	if flags&compactDeflate != 0 {
+		inflate := flate.NewReader(r)
+		defer inflate.Close()
+		body = inflate
+	}
+
+	dec := newCompactDecoder(body)
+
+	length, err := binary.ReadUvarint(dec.r)
+	if err != nil {
+		return nil, err
+	}
+
+	var envBytes bytes.Buffer
+	_, err = io.CopyN(&envBytes, dec.r, int64(length))
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: compact model envelope is truncated: %v", err)
+	}
+
+	env := &Envelope{}
+	err = json.Unmarshal(envBytes.Bytes(), env)
+	if err != nil {
+		return nil, err
+	}
+	if env.Version < 1 {
+		return nil, fmt.Errorf("ERROR: envelope has invalid version %v", env.Version)
+	}
+
+	// the header is written without data
+	env.Data = nil
+	env.compact, err = dec.data(env.Hyperparameters)
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// parseValue parses the next JSON value of dec into
+// nil, bool, json.Number, string, []interface{} or
+// *orderedObject values
+func parseValue(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	switch delim {
+	case '[':
+		arr := []interface{}{}
+		for dec.More() {
+			val, err := parseValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, val)
+		}
+		_, err = dec.Token()
+		return arr, err
+
+	case '{':
+		obj := &orderedObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			val, err := parseValue(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			obj.keys = append(obj.keys, key.(string))
+			obj.values = append(obj.values, val)
+		}
+		_, err = dec.Token()
+		return obj, err
+	}
+
+	return nil, fmt.Errorf("ERROR: unexpected JSON delimiter %v", delim)
+}
+
+// orderedObject is a JSON object which keeps the
+// order of its keys
+type orderedObject struct {
+	keys   []string
+	values []interface{}
+}
+
+// compactEncoder writes values in the compact encoding
+type compactEncoder struct {
+	w       *bytes.Buffer
+	float32 bool
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *compactEncoder) uvarint(x uint64) {
+	e.w.Write(e.scratch[:binary.PutUvarint(e.scratch[:], x)])
+}
+
+func (e *compactEncoder) varint(x int64) {
+	e.w.Write(e.scratch[:binary.PutVarint(e.scratch[:], x)])
+}
+
+func (e *compactEncoder) float(f float64) {
+	if e.float32 {
+		binary.LittleEndian.PutUint32(e.scratch[:4], math.Float32bits(float32(f)))
+		e.w.Write(e.scratch[:4])
+		return
+	}
+
+	binary.LittleEndian.PutUint64(e.scratch[:8], math.Float64bits(f))
+	e.w.Write(e.scratch[:8])
+}
+
+func (e *compactEncoder) str(s string) {
+	e.uvarint(uint64(len(s)))
+	e.w.WriteString(s)
+}
+
+func (e *compactEncoder) value(v interface{}) error {
+	switch val := v.(type) {
+	case nil:
+		e.w.WriteByte(tagNull)
+
+	case bool:
+		if val {
+			e.w.WriteByte(tagTrue)
+		} else {
+			e.w.WriteByte(tagFalse)
+		}
+
+	case json.Number:
+		if i, ok := integer(val); ok {
+			e.w.WriteByte(tagInt)
+			e.varint(i)
+			return nil
+		}
+
+		f, err := val.Float64()
+		if err != nil {
+			// keep numbers that don't fit a float64
+			// (or an int64) as they were written
+			e.w.WriteByte(tagNumber)
+			e.str(val.String())
+			return nil
+		}
+
+		if e.float32 {
+			e.w.WriteByte(tagFloat32)
+		} else {
+			e.w.WriteByte(tagFloat64)
+		}
+		e.float(f)
+
+	case string:
+		e.w.WriteByte(tagString)
+		e.str(val)
+
+	case []interface{}:
+		return e.array(val)
+
+	case *orderedObject:
+		e.w.WriteByte(tagObject)
+		e.uvarint(uint64(len(val.keys)))
+		for i := range val.keys {
+			e.str(val.keys[i])
+			err := e.value(val.values[i])
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("ERROR: can't encode value of type %T", v)
+	}
+
+	return nil
+}
+
+// array writes arrays holding only numbers as packed
+// arrays of varints or floats, and other arrays value
+// by value
+func (e *compactEncoder) array(arr []interface{}) error {
+	ints := make([]int64, 0, len(arr))
+	floats := make([]float64, 0, len(arr))
+	packed := len(arr) != 0
+
+	for _, v := range arr {
+		num, ok := v.(json.Number)
+		if !ok {
+			packed = false
+			break
+		}
+
+		f, err := num.Float64()
+		if err != nil {
+			packed = false
+			break
+		}
+		floats = append(floats, f)
+
+		if ints != nil {
+			if i, ok := integer(num); ok {
+				ints = append(ints, i)
+			} else {
+				ints = nil
+			}
+		}
+	}
+
+	switch {
+	case packed && ints != nil:
+		e.w.WriteByte(tagInts)
+		e.uvarint(uint64(len(ints)))
+		for _, i := range ints {
+			e.varint(i)
+		}
+
+	case packed:
+		if e.float32 {
+			e.w.WriteByte(tagFloat32s)
+		} else {
+			e.w.WriteByte(tagFloat64s)
+		}
+		e.uvarint(uint64(len(floats)))
+		for _, f := range floats {
+			e.float(f)
+		}
+
+	default:
+		e.w.WriteByte(tagArray)
+		e.uvarint(uint64(len(arr)))
+		for _, v := range arr {
+			err := e.value(v)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// integer returns the number as an int64 if it is
+// written as an integer which fits one
+func integer(num json.Number) (int64, bool) {
+	if strings.ContainsAny(num.String(), ".eE") {
+		return 0, false
+	}
+
+	i, err := strconv.ParseInt(num.String(), 10, 64)
+	return i, err == nil
+}
+
+// compactData holds the data of an envelope read in
+// the compact encoding, decoded into nil, bool, int64,
+// float64, json.Number, string, []interface{},
+// []int64, []float64 or *orderedObject values (numeric
+// arrays stay packed,) along with the checksum of the
+// envelope computed over the JSON the data stands for
+type compactData struct {
+	value    interface{}
+	checksum string
+}
+
+// compactDecoder reads values in the compact encoding,
+// writing them out to w as JSON as they're read so the
+// checksum can be computed without holding the JSON
+type compactDecoder struct {
+	r       *bufio.Reader
+	w       *bufio.Writer
+	scratch [8]byte
+	num     []byte
+}
+
+func newCompactDecoder(r io.Reader) *compactDecoder {
+	if buffered, ok := r.(*bufio.Reader); ok {
+		return &compactDecoder{r: buffered}
+	}
+
+	return &compactDecoder{r: bufio.NewReader(r)}
+}
+
+// data decodes the data of an envelope with the
+// given hyperparameters, computing the checksum of
+// the envelope along the way
+func (d *compactDecoder) data(hyperparameters json.RawMessage) (*compactData, error) {
+	sum := sha256.New()
+	err := writeChecksumSection(sum, hyperparameters)
+	if err != nil {
+		return nil, err
+	}
+
+	d.w = bufio.NewWriter(sum)
+	value, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+
+	d.w.Flush()
+	endChecksumSection(sum)
+
+	return &compactData{value: value, checksum: checksumOf(sum)}, nil
+}
+
+func (d *compactDecoder) length() (int, error) {
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return 0, err
+	}
+	if n > math.MaxInt32 {
+		return 0, fmt.Errorf("ERROR: compact model holds an invalid length %v! The model is probably corrupted", n)
+	}
+
+	return int(n), nil
+}
+
+// capacity returns the capacity to allocate for an
+// array of length n, so a corrupted length can't make
+// the decoder allocate more than the data holds
+func capacity(n int) int {
+	if n > 1<<16 {
+		return 1 << 16
+	}
+
+	return n
+}
+
+func (d *compactDecoder) str() (string, error) {
+	n, err := d.length()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	_, err = io.CopyN(&buf, d.r, int64(n))
+	return buf.String(), err
+}
+
+func (d *compactDecoder) float(size int) (float64, error) {
+	_, err := io.ReadFull(d.r, d.scratch[:size])
+	if err != nil {
+		return 0, err
+	}
+
+	var f float64
+	if size == 4 {
+		f = float64(math.Float32frombits(binary.LittleEndian.Uint32(d.scratch[:4])))
+	} else {
+		f = math.Float64frombits(binary.LittleEndian.Uint64(d.scratch[:8]))
+	}
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("ERROR: compact model holds an invalid number %v", f)
+	}
+
+	// format float32s with the shortest text that
+	// reads back as the same float32, and decode them
+	// as that text, so they restore the same as the
+	// JSON they stand for
+	d.num = strconv.AppendFloat(d.num[:0], f, 'g', -1, size*8)
+	d.w.Write(d.num)
+
+	if size == 4 {
+		return strconv.ParseFloat(string(d.num), 64)
+	}
+
+	return f, nil
+}
+
+func (d *compactDecoder) int() (int64, error) {
+	i, err := binary.ReadVarint(d.r)
+	if err != nil {
+		return 0, err
+	}
+
+	d.num = strconv.AppendInt(d.num[:0], i, 10)
+	d.w.Write(d.num)
+	return i, nil
+}
+
+// array decodes the n values of an array with elem,
+// writing the brackets and commas around them
+func (d *compactDecoder) array(n int, elem func() error) error {
+	d.w.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i != 0 {
+			d.w.WriteByte(',')
+		}
+
+		err := elem()
+		if err != nil {
+			return err
+		}
+	}
+	d.w.WriteByte(']')
+
+	return nil
+}
+
+// value decodes the next value (see compactData)
+func (d *compactDecoder) value() (interface{}, error) {
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: compact model is truncated: %v", err)
+	}
+
+	switch tag {
+	case tagNull:
+		d.w.WriteString("null")
+		return nil, nil
+	case tagFalse:
+		d.w.WriteString("false")
+		return false, nil
+	case tagTrue:
+		d.w.WriteString("true")
+		return true, nil
+	case tagInt:
+		return d.int()
+	case tagFloat64:
+		return d.float(8)
+	case tagFloat32:
+		return d.float(4)
+
+	case tagNumber:
+		s, err := d.str()
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid([]byte(s)) {
+			return nil, fmt.Errorf("ERROR: compact model holds an invalid number %q", s)
+		}
+		d.w.WriteString(s)
+		return json.Number(s), nil
+
+	case tagString:
+		s, err := d.str()
+		if err != nil {
+			return nil, err
+		}
+		quoted, err := json.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+		d.w.Write(quoted)
+		return s, nil
+
+	case tagArray:
+		n, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+
+		arr := make([]interface{}, 0, capacity(n))
+		err = d.array(n, func() error {
+			v, err := d.value()
+			arr = append(arr, v)
+			return err
+		})
+		return arr, err
+
+	case tagInts:
+		n, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+
+		ints := make([]int64, 0, capacity(n))
+		err = d.array(n, func() error {
+			i, err := d.int()
+			ints = append(ints, i)
+			return err
+		})
+		return ints, err
+
+	case tagFloat64s, tagFloat32s:
+		n, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+
+		size := 8
+		if tag == tagFloat32s {
+			size = 4
+		}
+
+		floats := make([]float64, 0, capacity(n))
+		err = d.array(n, func() error {
+			f, err := d.float(size)
+			floats = append(floats, f)
+			return err
+		})
+		return floats, err
+
+	case tagObject:
+		n, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+
+		obj := &orderedObject{
+			keys:   make([]string, 0, capacity(n)),
+			values: make([]interface{}, 0, capacity(n)),
+		}
+
+		d.w.WriteByte('{')
+		for i := 0; i < n; i++ {
+			if i != 0 {
+				d.w.WriteByte(',')
+			}
+
+			key, err := d.str()
+			if err != nil {
+				return nil, err
+			}
+			quoted, err := json.Marshal(key)
+			if err != nil {
+				return nil, err
+			}
+			d.w.Write(quoted)
+			d.w.WriteByte(':')
+
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+
+			obj.keys = append(obj.keys, key)
+			obj.values = append(obj.values, v)
+		}
+		d.w.WriteByte('}')
+
+		return obj, nil
+	}
+
+	return nil, fmt.Errorf("ERROR: compact model holds an unknown value tag %v! The model is probably corrupted", tag)
+}
+
+// writeCompactJSON writes the decoded data of a
+// compact envelope (see compactData) to buf as JSON
+func writeCompactJSON(buf *bytes.Buffer, v interface{}) error {
+	var num []byte
+
+	switch val := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(val))
+	case int64:
+		buf.Write(strconv.AppendInt(num, val, 10))
+	case float64:
+		buf.Write(strconv.AppendFloat(num, val, 'g', -1, 64))
+	case json.Number:
+		buf.WriteString(val.String())
+
+	case string:
+		quoted, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		buf.Write(quoted)
+
+	case []interface{}, []int64, []float64:
+		n, _ := compactLen(val)
+
+		buf.WriteByte('[')
+		for i := 0; i < n; i++ {
+			if i != 0 {
+				buf.WriteByte(',')
+			}
+
+			err := writeCompactJSON(buf, compactIndex(val, i))
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+
+	case *orderedObject:
+		buf.WriteByte('{')
+		for i := range val.keys {
+			if i != 0 {
+				buf.WriteByte(',')
+			}
+
+			err := writeCompactJSON(buf, val.keys[i])
+			if err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+
+			err = writeCompactJSON(buf, val.values[i])
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+
+	default:
+		return fmt.Errorf("ERROR: can't write value of type %T as JSON", v)
+	}
+
+	return nil
+}
+
+// compactLen returns the length of a decoded array,
+// or false if the value isn't an array
+func compactLen(v interface{}) (int, bool) {
+	switch arr := v.(type) {
+	case []interface{}:
+		return len(arr), true
+	case []int64:
+		return len(arr), true
+	case []float64:
+		return len(arr), true
+	}
+
+	return 0, false
+}
+
+// compactIndex returns the i-th value of a decoded
+// array
+func compactIndex(v interface{}, i int) interface{} {
+	switch arr := v.(type) {
+	case []interface{}:
+		return arr[i]
+	case []int64:
+		return arr[i]
+	case []float64:
+		return arr[i]
+	}
+
+	return nil
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	float64Type         = reflect.TypeOf(float64(0))
+)
+
+// unmarshalCompact sets the value v points to from the
+// decoded data of a compact envelope, the same way
+// json.Unmarshal sets it from the JSON of the data.
+// Numeric arrays are copied straight into slices, so
+// large parameter arrays are never written out as
+// text. Values json.Unmarshal can't set as simply (like
+// types with their own UnmarshalJSON, interfaces, or
+// structs with embedded fields) are set from JSON.
+func unmarshalCompact(data interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &json.InvalidUnmarshalError{Type: reflect.TypeOf(v)}
+	}
+
+	return setCompact(data, rv.Elem())
+}
+
+// customJSON returns whether values of type t decode
+// JSON on their own
+func customJSON(t reflect.Type) bool {
+	p := reflect.PtrTo(t)
+	return p.Implements(jsonUnmarshalerType) || p.Implements(textUnmarshalerType)
+}
+
+// setCompact sets v (which must be addressable) from
+// decoded data (see unmarshalCompact)
+func setCompact(data interface{}, v reflect.Value) error {
+	t := v.Type()
+	if customJSON(t) {
+		return setJSON(data, v)
+	}
+
+	// null only clears pointers, interfaces,
+	// maps and slices, like in JSON
+	if data == nil {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(t))
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return setCompact(data, v.Elem())
+
+	case reflect.Struct:
+		obj, ok := data.(*orderedObject)
+		fields := structFieldsOf(t)
+		if !ok || fields == nil {
+			break
+		}
+
+		for i, key := range obj.keys {
+			field, ok := fields.find(key)
+			if !ok {
+				continue
+			}
+
+			err := setCompact(obj.values[i], v.Field(field))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		obj, ok := data.(*orderedObject)
+		if !ok || t.Key().Kind() != reflect.String || customJSON(t.Key()) {
+			break
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(t, len(obj.keys)))
+		}
+		for i, key := range obj.keys {
+			elem := reflect.New(t.Elem()).Elem()
+			err := setCompact(obj.values[i], elem)
+			if err != nil {
+				return err
+			}
+
+			v.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), elem)
+		}
+		return nil
+
+	case reflect.Slice, reflect.Array:
+		n, ok := compactLen(data)
+		if !ok {
+			break
+		}
+
+		// slices take every value, and arrays the ones
+		// which fit, zeroing the rest
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, n, n))
+		}
+		for i := n; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(t.Elem()))
+		}
+		if n > v.Len() {
+			n = v.Len()
+		}
+
+		return setElements(data, v, n)
+
+	case reflect.Bool:
+		if b, ok := data.(bool); ok {
+			v.SetBool(b)
+			return nil
+		}
+
+	case reflect.String:
+		if s, ok := data.(string); ok {
+			v.SetString(s)
+			return nil
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := data.(int64); ok && !v.OverflowInt(i) {
+			v.SetInt(i)
+			return nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if i, ok := data.(int64); ok && i >= 0 && !v.OverflowUint(uint64(i)) {
+			v.SetUint(uint64(i))
+			return nil
+		}
+
+	case reflect.Float64:
+		switch f := data.(type) {
+		case int64:
+			v.SetFloat(float64(f))
+			return nil
+		case float64:
+			v.SetFloat(f)
+			return nil
+		}
+	}
+
+	// leave anything else (including errors)
+	// to json.Unmarshal
+	return setJSON(data, v)
+}
+
+// setElements sets the first n elements of the slice
+// or array v from a decoded array, copying numeric
+// arrays without going through setCompact for every
+// number
+func setElements(data interface{}, v reflect.Value, n int) error {
+	elem := v.Type().Elem()
+	simple := !customJSON(elem)
+
+	switch arr := data.(type) {
+	case []float64:
+		if elem == float64Type {
+			reflect.Copy(v, reflect.ValueOf(arr[:n]))
+			return nil
+		}
+		if simple && elem.Kind() == reflect.Float64 {
+			for i := 0; i < n; i++ {
+				v.Index(i).SetFloat(arr[i])
+			}
+			return nil
+		}
+
+	case []int64:
+		if simple && elem.Kind() == reflect.Float64 {
+			for i := 0; i < n; i++ {
+				v.Index(i).SetFloat(float64(arr[i]))
+			}
+			return nil
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		err := setCompact(compactIndex(data, i), v.Index(i))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setJSON sets v (which must be addressable) by
+// unmarshalling the JSON of decoded data
+func setJSON(data interface{}, v reflect.Value) error {
+	var buf bytes.Buffer
+	err := writeCompactJSON(&buf, data)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buf.Bytes(), v.Addr().Interface())
+}
+
+// structFields maps the JSON names of the fields of
+// a struct to their index
+type structFields struct {
+	names   []string
+	indexes []int
+}
+
+// find returns the index of the field with the given
+// JSON name, matching it case insensitively if no
+// name matches exactly (like json.Unmarshal)
+func (f *structFields) find(name string) (int, bool) {
+	for i := range f.names {
+		if f.names[i] == name {
+			return f.indexes[i], true
+		}
+	}
+	for i := range f.names {
+		if strings.EqualFold(f.names[i], name) {
+			return f.indexes[i], true
+		}
+	}
+
+	return 0, false
+}
+
+// structFieldsCache holds the structFields of every
+// struct type decoded so far
+var structFieldsCache sync.Map
+
+// structFieldsOf returns the fields of the struct type
+// t, or nil if t has fields (embedded ones, fields
+// decoded from strings, or fields sharing a name) which
+// only json.Unmarshal should resolve
+func structFieldsOf(t reflect.Type) *structFields {
+	if cached, ok := structFieldsCache.Load(t); ok {
+		return cached.(*structFields)
+	}
+
+	fields := &structFields{}
+	seen := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			fields = nil
+			break
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options := tag, ""
+		if comma := strings.Index(tag, ","); comma != -1 {
+			name, options = tag[:comma], tag[comma:]
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if strings.Contains(options+",", ",string,") || seen[name] {
+			fields = nil
+			break
+		}
+		seen[name] = true
+
+		fields.names = append(fields.names, name)
+		fields.indexes = append(fields.indexes, i)
+	}
+
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// readEnvelopeFile opens the file at path and reads
+// the envelope of the model persisted there (see
+// ReadEnvelope)
+func readEnvelopeFile(path string) (*Envelope, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	env, _, err := ReadEnvelope(f)
+	return env, err
+}
@@ -0,0 +1,223 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactRoundTripShouldPass1(t *testing.T) {
+	model := &testModel{
+		Rate:   0.125,
+		Params: []float64{1, -2.5, 3e-7, 1.0 / 3, 12345678.9},
+	}
+
+	for _, opts := range []CompactOptions{
+		{},
+		{Compress: true},
+	} {
+		data, err := MarshalModelCompact(model, opts)
+		assert.Nil(t, err, "Marshal error should be nil")
+		assert.True(t, IsCompact(data), "Compact model should start with the compact header")
+
+		restored := &testModel{}
+		assert.Nil(t, UnmarshalModel(data, restored), "Unmarshal error should be nil")
+		assert.Equal(t, model, restored, "Model should be restored exactly without quantization (options %+v)", opts)
+	}
+}
+
+func TestCompactFloat32ShouldPass1(t *testing.T) {
+	params := make([]float64, 1000)
+	for i := range params {
+		params[i] = float64(i)/7 - 50
+	}
+	model := &testModel{
+		Rate:   0.5,
+		Params: params,
+	}
+
+	full, err := MarshalModel(model)
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	compact, err := MarshalModelCompact(model, CompactOptions{Float32: true})
+	assert.Nil(t, err, "Marshal error should be nil")
+	assert.True(t, len(compact) < len(full)/3, "Float32 model should be much smaller than JSON (%v vs %v bytes)", len(compact), len(full))
+
+	restored := &testModel{}
+	assert.Nil(t, UnmarshalModel(compact, restored), "Unmarshal error should be nil")
+	assert.Equal(t, model.Rate, restored.Rate, "Hyperparameters should be restored exactly")
+	assert.Len(t, restored.Params, len(params), "Every parameter should be restored")
+	for i := range params {
+		assert.InDelta(t, params[i], restored.Params[i], 1e-5, "Parameter should be restored within float32 precision")
+	}
+}
+
+func TestCompactPersistShouldPass1(t *testing.T) {
+	model := &testModel{
+		Rate:   2,
+		Params: []float64{-1, 0, 1, 2},
+	}
+
+	opts := CompactOptions{Float32: true, Compress: true}
+	assert.Nil(t, PersistModelCompact("/tmp/.goml/TestModel.goml", model, opts), "Persist error should be nil")
+
+	loaded, err := Load("/tmp/.goml/TestModel.goml")
+	assert.Nil(t, err, "Load error should be nil")
+	assert.Equal(t, model, loaded, "Loaded model should match the persisted one")
+
+	restored := &testModel{}
+	assert.Nil(t, RestoreModel("/tmp/.goml/TestModel.goml", restored), "Restore error should be nil")
+	assert.Equal(t, model, restored, "Restored model should match the persisted one")
+
+	// stream decoding from a reader
+	var buf bytes.Buffer
+	n, err := WriteModelCompact(&buf, model, opts)
+	assert.Nil(t, err, "Write error should be nil")
+	assert.EqualValues(t, buf.Len(), n, "Written byte count should match the buffer length")
+
+	restored = &testModel{}
+	read, err := ReadModel(&buf, restored)
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, n, read, "Read byte count should match the written byte count")
+	assert.Equal(t, model, restored, "Read model should match the written one")
+}
+
+func TestCompactShouldFail1(t *testing.T) {
+	model := &testModel{
+		Params: []float64{1, 2, 3},
+	}
+
+	data, err := MarshalModelCompact(model, CompactOptions{})
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	// truncated data
+	assert.NotNil(t, UnmarshalModel(data[:len(data)-4], &testModel{}), "Restoring a truncated model should return an error")
+
+	// tampered data (the last parameter)
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-2] ^= 0xff
+	assert.NotNil(t, UnmarshalModel(tampered, &testModel{}), "Restoring a tampered model should return an error")
+
+	// newer encoding version
+	newer := append([]byte{}, data...)
+	newer[len(compactMagic)] = CompactVersion + 1
+	assert.NotNil(t, UnmarshalModel(newer, &testModel{}), "Restoring a newer compact version should return an error")
+}
+
+// compactTestData holds every kind of value models
+// persist, along with some only json.Unmarshal sets
+type compactTestData struct {
+	Params  [][]float64          `json:"params"`
+	Ints    []float64            `json:"ints"`
+	Labels  []int                `json:"labels"`
+	Fixed   [2]float64           `json:"fixed"`
+	Counts  map[string]uint32    `json:"counts"`
+	Words   map[string]*testWord `json:"words"`
+	Name    string               `json:"name"`
+	Rate    *float64             `json:"rate"`
+	Small   float32              `json:"small"`
+	Empty   []float64            `json:"empty"`
+	Missing []float64            `json:"missing,omitempty"`
+	SavedAt time.Time            `json:"saved_at"`
+	Raw     json.RawMessage      `json:"raw"`
+	Any     interface{}          `json:"any"`
+	Nested  struct {
+		testWord
+		Extra string
+	} `json:"nested"`
+	Upper bool
+}
+
+type testWord struct {
+	Count uint64  `json:"count"`
+	Prob  float64 `json:"prob"`
+}
+
+func TestCompactDecodeShouldPass1(t *testing.T) {
+	rate := 0.01
+	data := compactTestData{
+		Params:  [][]float64{{0.1, -2.5, 1e-9}, {3, 1.0 / 3, 12345678.9}},
+		Ints:    []float64{1, 2, 3},
+		Labels:  []int{0, 2, -1},
+		Fixed:   [2]float64{0.5, 1.5},
+		Counts:  map[string]uint32{"a": 1, "b": 20},
+		Words:   map[string]*testWord{"x": {Count: 3, Prob: 0.2}, "y": nil},
+		Name:    "model",
+		Rate:    &rate,
+		Small:   0.1,
+		Empty:   []float64{},
+		SavedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Raw:     json.RawMessage(`{"a":[1,2]}`),
+		Any:     []interface{}{1.5, "two"},
+		Upper:   true,
+	}
+	data.Nested.Count = 7
+	data.Nested.Extra = "extra"
+
+	raw, err := json.Marshal(data)
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	for _, opts := range []CompactOptions{{}, {Float32: true}} {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		parsed, err := parseValue(dec)
+		assert.Nil(t, err, "Parse error should be nil")
+
+		var body bytes.Buffer
+		assert.Nil(t, (&compactEncoder{w: &body, float32: opts.Float32}).value(parsed), "Encode error should be nil")
+
+		decoded, err := newCompactDecoder(&body).data(nil)
+		assert.Nil(t, err, "Decode error should be nil")
+
+		// setting the values directly should match
+		// unmarshalling the JSON they stand for
+		var text bytes.Buffer
+		assert.Nil(t, writeCompactJSON(&text, decoded.value), "Writing JSON should not return an error")
+
+		var expected, restored compactTestData
+		assert.Nil(t, json.Unmarshal(text.Bytes(), &expected), "Unmarshal error should be nil")
+		assert.Nil(t, unmarshalCompact(decoded.value, &restored), "Decode error should be nil")
+		assert.Equal(t, expected, restored, "Compact data should decode like its JSON (options %+v)", opts)
+
+		if !opts.Float32 {
+			assert.Equal(t, data, restored, "Compact data should decode exactly without quantization")
+		}
+
+		// decoding into values which already hold
+		// data replaces slices but keeps map entries
+		restored.Counts = map[string]uint32{"c": 3}
+		restored.Params = [][]float64{{1}}
+		assert.Nil(t, unmarshalCompact(decoded.value, &restored), "Decode error should be nil")
+		assert.Equal(t, map[string]uint32{"a": 1, "b": 20, "c": 3}, restored.Counts, "Decoding into a map should keep its entries")
+		assert.Equal(t, expected.Params, restored.Params, "Decoding into a slice should replace it")
+	}
+}
+
+func TestCompactDecodeShouldPass2(t *testing.T) {
+	model := &testModel{
+		Rate:   0.5,
+		Params: []float64{1, -2.5, 3e-7},
+	}
+
+	data, err := MarshalModelCompact(model, CompactOptions{})
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	env, err := ParseEnvelope(data)
+	assert.Nil(t, err, "Parse error should be nil")
+	assert.Empty(t, env.Data, "Compact envelopes should hold their data decoded rather than as JSON")
+
+	raw, err := env.DataJSON()
+	assert.Nil(t, err, "Writing the data as JSON should not return an error")
+
+	var params []float64
+	assert.Nil(t, json.Unmarshal(raw, &params), "The data should be valid JSON")
+	assert.Equal(t, model.Params, params, "The JSON data should hold the model's data")
+
+	// decoding into the wrong type fails like JSON
+	var names []string
+	assert.NotNil(t, env.Decode("base.testModel", nil, &names), "Decoding numbers into strings should return an error")
+	assert.NotNil(t, env.Decode("base.testModel", nil, params), "Decoding into a non pointer should return an error")
+}
@@ -1,6 +1,9 @@
 package base
 
-import "math"
+import (
+	"fmt"
+	"math"
+)
 
 // DistanceMeasure is any function that
 // maps two vectors of float64s to a
@@ -64,11 +67,402 @@ func ManhattanDistance(u []float64, v []float64) float64 {
 // computation speed in, say, KNN.) Make
 // sure you pass in same-length vectors.
 func LNorm(p int) DistanceMeasure {
+	return MinkowskiDistance(float64(p))
+}
+
+// MinkowskiDistance returns a DistanceMeasure of the
+// Minkowski distance of order p, which is the l-p norm
+// of the difference between two vectors for any real
+// p >= 1 (LNorm is the same for integer p.) Smaller
+// values of p (0 < p < 1) still work, but the result
+// doesn't satisfy the triangle inequality. A p of
+// math.Inf(1) returns the ChebyshevDistance.
+//
+//     Σ|u[i] - v[i]|^p ^ (1/p)
+//
+// NOTE that this function does not check that
+// the vectors are different lengths (to improve
+// computation speed in, say, KNN.) Make
+// sure you pass in same-length vectors.
+func MinkowskiDistance(p float64) DistanceMeasure {
+	switch {
+	case math.IsInf(p, 1):
+		return ChebyshevDistance
+	case p == 1:
+		return ManhattanDistance
+	case p == 2:
+		return EuclideanDistance
+	}
+
+	return func(u []float64, v []float64) float64 {
+		var sum float64
+		for i := range u {
+			sum += math.Pow(math.Abs(u[i]-v[i]), p)
+		}
+		return math.Pow(sum, 1/p)
+	}
+}
+
+// ChebyshevDistance returns the largest
+// difference between any single dimension of
+// two float64 vectors (the l-∞ norm of their
+// difference.)
+//
+// NOTE that this function does not check that
+// the vectors are different lengths (to improve
+// computation speed in, say, KNN.) Make
+// sure you pass in same-length vectors.
+func ChebyshevDistance(u []float64, v []float64) float64 {
+	var max float64
+	for i := range u {
+		diff := math.Abs(u[i] - v[i])
+		if diff > max {
+			max = diff
+		}
+	}
+	return max
+}
+
+// CosineDistance returns 1 minus the cosine
+// similarity of two float64 vectors, so vectors
+// pointing in the same direction have distance 0,
+// orthogonal vectors 1, and opposite vectors 2. The
+// length of the vectors doesn't matter. If either
+// vector is the zero vector the distance is 1 (or 0
+// if both are.)
+//
+// NOTE that this function does not check that
+// the vectors are different lengths (to improve
+// computation speed in, say, KNN.) Make
+// sure you pass in same-length vectors.
+func CosineDistance(u []float64, v []float64) float64 {
+	var dot, normU, normV float64
+	for i := range u {
+		dot += u[i] * v[i]
+		normU += u[i] * u[i]
+		normV += v[i] * v[i]
+	}
+
+	if normU == 0 || normV == 0 {
+		if normU == normV {
+			return 0
+		}
+		return 1
+	}
+
+	similarity := dot / (math.Sqrt(normU) * math.Sqrt(normV))
+
+	// rounding can push the similarity
+	// just outside of [-1, 1]
+	if similarity > 1 {
+		similarity = 1
+	} else if similarity < -1 {
+		similarity = -1
+	}
+
+	return 1 - similarity
+}
+
+// WeightedEuclideanDistance returns a DistanceMeasure
+// of the Euclidean distance where the squared difference
+// of each dimension is scaled by the given weight. This
+// lets you make some features matter more than others
+// without rescaling your data. Weights should be >= 0
+// and have the same length as the vectors.
+//
+//     sqrt(Σ w[i]*(u[i] - v[i])²)
+//
+// NOTE that this function does not check that
+// the vectors are different lengths (to improve
+// computation speed in, say, KNN.) Make
+// sure you pass in same-length vectors.
+func WeightedEuclideanDistance(weights []float64) DistanceMeasure {
+	return func(u []float64, v []float64) float64 {
+		var sum float64
+		for i := range u {
+			sum += weights[i] * (u[i] - v[i]) * (u[i] - v[i])
+		}
+		return math.Sqrt(sum)
+	}
+}
+
+// MahalanobisDistance returns a DistanceMeasure of the
+// Mahalanobis distance given the inverse of the
+// covariance matrix of the data (see
+// FitMahalanobisDistance to compute it from a dataset.)
+// This is the Euclidean distance after decorrelating and
+// rescaling the features, so it accounts for features
+// having different scales and being correlated.
+//
+//     sqrt((u - v)ᵀ S⁻¹ (u - v))
+//
+// https://en.wikipedia.org/wiki/Mahalanobis_distance
+//
+// NOTE that this function does not check that
+// the vectors are different lengths (to improve
+// computation speed in, say, KNN.) Make
+// sure you pass in same-length vectors.
+func MahalanobisDistance(inverseCovariance [][]float64) DistanceMeasure {
 	return func(u []float64, v []float64) float64 {
 		var sum float64
 		for i := range u {
-			sum += math.Pow(u[i]-v[i], float64(p))
+			var row float64
+			for j := range v {
+				row += inverseCovariance[i][j] * (u[j] - v[j])
+			}
+			sum += (u[i] - v[i]) * row
+		}
+
+		// rounding can make the (non-negative)
+		// quadratic form slightly negative
+		if sum < 0 {
+			return 0
+		}
+		return math.Sqrt(sum)
+	}
+}
+
+// FitMahalanobisDistance computes the covariance
+// matrix of the given dataset (one example per row)
+// and returns the MahalanobisDistance using its
+// inverse. An error is returned if the dataset has
+// less than 2 examples, rows of different lengths, or
+// if the covariance matrix is singular (for example
+// when a feature is constant, or is a linear
+// combination of other features.)
+func FitMahalanobisDistance(data [][]float64) (DistanceMeasure, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("ERROR: need at least 2 examples to fit a Mahalanobis distance - given %v", len(data))
+	}
+
+	features := len(data[0])
+	if features == 0 {
+		return nil, fmt.Errorf("ERROR: can't fit a Mahalanobis distance to examples with no features")
+	}
+
+	mean := make([]float64, features)
+	for i := range data {
+		if len(data[i]) != features {
+			return nil, fmt.Errorf("ERROR: example %v has %v features, but the first example has %v", i, len(data[i]), features)
+		}
+		for j := range data[i] {
+			mean[j] += data[i][j]
+		}
+	}
+	for j := range mean {
+		mean[j] /= float64(len(data))
+	}
+
+	// sample covariance
+	covariance := make([][]float64, features)
+	for j := range covariance {
+		covariance[j] = make([]float64, features)
+	}
+	for i := range data {
+		for j := 0; j < features; j++ {
+			dj := data[i][j] - mean[j]
+			for k := j; k < features; k++ {
+				covariance[j][k] += dj * (data[i][k] - mean[k])
+			}
 		}
-		return math.Pow(sum, 1/float64(p))
+	}
+	for j := 0; j < features; j++ {
+		for k := j; k < features; k++ {
+			covariance[j][k] /= float64(len(data) - 1)
+			covariance[k][j] = covariance[j][k]
+		}
+	}
+
+	inverse, err := invert(covariance)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: can't fit a Mahalanobis distance: %v", err)
+	}
+
+	return MahalanobisDistance(inverse), nil
+}
+
+// invert returns the inverse of the given square
+// matrix using Gauss-Jordan elimination with partial
+// pivoting. The given matrix isn't modified.
+func invert(matrix [][]float64) ([][]float64, error) {
+	n := len(matrix)
+
+	// augment the matrix with the identity
+	a := make([][]float64, n)
+	var scale float64
+	for i := range matrix {
+		a[i] = make([]float64, 2*n)
+		copy(a[i], matrix[i])
+		a[i][n+i] = 1
+
+		for j := range matrix[i] {
+			scale = math.Max(scale, math.Abs(matrix[i][j]))
+		}
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) <= 1e-12*scale {
+			return nil, fmt.Errorf("matrix is singular")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+
+		div := a[col][col]
+		for j := range a[col] {
+			a[col][j] /= div
+		}
+
+		for row := 0; row < n; row++ {
+			if row == col || a[row][col] == 0 {
+				continue
+			}
+
+			factor := a[row][col]
+			for j := range a[row] {
+				a[row][j] -= factor * a[col][j]
+			}
+		}
+	}
+
+	inverse := make([][]float64, n)
+	for i := range a {
+		inverse[i] = a[i][n:]
+	}
+
+	return inverse, nil
+}
+
+// HammingDistance returns the number of
+// dimensions in which two float64 vectors
+// differ. Useful for categorical or binary
+// features.
+//
+// NOTE that this function does not check that
+// the vectors are different lengths (to improve
+// computation speed in, say, KNN.) Make
+// sure you pass in same-length vectors.
+func HammingDistance(u []float64, v []float64) float64 {
+	var count float64
+	for i := range u {
+		if u[i] != v[i] {
+			count++
+		}
+	}
+	return count
+}
+
+// JaccardDistance returns the Jaccard distance
+// between two binary vectors, where any non-zero
+// value is treated as 'true' (as in a set
+// membership vector.) This is 1 minus the size of
+// the intersection over the size of the union of
+// the two sets. Two empty sets have distance 0.
+//
+// NOTE that this function does not check that
+// the vectors are different lengths (to improve
+// computation speed in, say, KNN.) Make
+// sure you pass in same-length vectors.
+func JaccardDistance(u []float64, v []float64) float64 {
+	var intersection, union float64
+	for i := range u {
+		a, b := u[i] != 0, v[i] != 0
+		if a && b {
+			intersection++
+		}
+		if a || b {
+			union++
+		}
+	}
+
+	if union == 0 {
+		return 0
+	}
+	return 1 - intersection/union
+}
+
+// CanberraDistance returns the Canberra distance
+// between two float64 vectors, a weighted version
+// of the Manhattan distance which is very sensitive
+// to differences near zero. Dimensions where both
+// values are 0 are skipped.
+//
+//     Σ |u[i] - v[i]| / (|u[i]| + |v[i]|)
+//
+// NOTE that this function does not check that
+// the vectors are different lengths (to improve
+// computation speed in, say, KNN.) Make
+// sure you pass in same-length vectors.
+func CanberraDistance(u []float64, v []float64) float64 {
+	var sum float64
+	for i := range u {
+		denom := math.Abs(u[i]) + math.Abs(v[i])
+		if denom == 0 {
+			continue
+		}
+		sum += math.Abs(u[i]-v[i]) / denom
+	}
+	return sum
+}
+
+// BrayCurtisDistance returns the Bray-Curtis
+// dissimilarity between two float64 vectors, which
+// is commonly used with counts (abundances) and lies
+// within [0, 1] for non-negative vectors. Two zero
+// vectors have distance 0.
+//
+//     Σ|u[i] - v[i]| / Σ|u[i] + v[i]|
+//
+// NOTE that this function does not check that
+// the vectors are different lengths (to improve
+// computation speed in, say, KNN.) Make
+// sure you pass in same-length vectors.
+func BrayCurtisDistance(u []float64, v []float64) float64 {
+	var diff, sum float64
+	for i := range u {
+		diff += math.Abs(u[i] - v[i])
+		sum += math.Abs(u[i] + v[i])
+	}
+
+	if sum == 0 {
+		return 0
+	}
+	return diff / sum
+}
+
+// SafeDistanceMeasure is a DistanceMeasure which
+// returns an error (rather than panicking, or
+// silently ignoring extra dimensions) when given
+// vectors of the wrong length
+type SafeDistanceMeasure func([]float64, []float64) (float64, error)
+
+// SafeDistance wraps a DistanceMeasure so that it
+// checks the dimensions of the vectors it's given.
+// The vectors must have the same length and, if
+// dimensions is given, that many dimensions (which
+// is what you want for measures holding per-feature
+// data, like WeightedEuclideanDistance and
+// MahalanobisDistance.)
+//
+//     distance := base.SafeDistance(base.CosineDistance)
+//
+//     d, err := distance([]float64{1, 2}, []float64{3})
+//     if err != nil {
+//         panic("THOSE VECTORS DON'T MATCH!!")
+//     }
+func SafeDistance(distance DistanceMeasure, dimensions ...int) SafeDistanceMeasure {
+	return func(u []float64, v []float64) (float64, error) {
+		if len(u) != len(v) {
+			return 0, fmt.Errorf("ERROR: vectors should have the same length to find the distance between them - given %v and %v", len(u), len(v))
+		}
+		if len(dimensions) != 0 && len(u) != dimensions[0] {
+			return 0, fmt.Errorf("ERROR: vectors should have %v dimensions - given %v", dimensions[0], len(u))
+		}
+
+		return distance(u, v), nil
 	}
 }
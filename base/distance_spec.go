@@ -0,0 +1,309 @@
+package base
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Names of the distances which can be described with
+// a DistanceSpec by default
+const (
+	EuclideanDistanceName         = "euclidean"
+	ManhattanDistanceName         = "manhattan"
+	MinkowskiDistanceName         = "minkowski"
+	ChebyshevDistanceName         = "chebyshev"
+	CosineDistanceName            = "cosine"
+	WeightedEuclideanDistanceName = "weighted_euclidean"
+	MahalanobisDistanceName       = "mahalanobis"
+	HammingDistanceName           = "hamming"
+	JaccardDistanceName           = "jaccard"
+	CanberraDistanceName          = "canberra"
+	BrayCurtisDistanceName        = "bray_curtis"
+)
+
+// DistanceSpec is a declarative description of a
+// distance measure: the name of the distance and the
+// parameters used to build it. Unlike DistanceMeasure
+// functions, a DistanceSpec can be marshalled to JSON,
+// which is what lets distance based models (like KNN)
+// persist and restore their distance. It's the
+// distance equivalent of a KernelSpec.
+//
+//     spec := base.MinkowskiDistanceSpec(3)
+//
+//     // {"name":"minkowski","parameters":{"p":3}}
+//     bytes, err := json.Marshal(spec)
+//
+//     distance, err := spec.Distance()
+//
+// You can describe your own distances too by
+// registering a builder for them with RegisterDistance.
+type DistanceSpec struct {
+	Name       string             `json:"name"`
+	Parameters map[string]float64 `json:"parameters,omitempty"`
+
+	// Vectors holds parameters which have one
+	// value per feature (like the weights of the
+	// weighted Euclidean distance)
+	Vectors map[string][]float64 `json:"vectors,omitempty"`
+
+	// Matrices holds parameters which have one
+	// row per feature (like the inverse covariance
+	// matrix of the Mahalanobis distance)
+	Matrices map[string][][]float64 `json:"matrices,omitempty"`
+}
+
+// DistanceBuilder builds a distance measure from a
+// DistanceSpec, returning an error if the spec's
+// parameters aren't valid for the distance
+type DistanceBuilder func(DistanceSpec) (DistanceMeasure, error)
+
+var (
+	distancesMu sync.RWMutex
+	distances   = map[string]DistanceBuilder{
+		EuclideanDistanceName: func(spec DistanceSpec) (DistanceMeasure, error) {
+			return EuclideanDistance, nil
+		},
+		ManhattanDistanceName: func(spec DistanceSpec) (DistanceMeasure, error) {
+			return ManhattanDistance, nil
+		},
+		MinkowskiDistanceName: func(spec DistanceSpec) (DistanceMeasure, error) {
+			p := spec.Parameters["p"]
+			if p <= 0 {
+				return nil, fmt.Errorf("ERROR: Minkowski distance order p must be greater than 0 - given %v", p)
+			}
+
+			return MinkowskiDistance(p), nil
+		},
+		ChebyshevDistanceName: func(spec DistanceSpec) (DistanceMeasure, error) {
+			return ChebyshevDistance, nil
+		},
+		CosineDistanceName: func(spec DistanceSpec) (DistanceMeasure, error) {
+			return CosineDistance, nil
+		},
+		WeightedEuclideanDistanceName: func(spec DistanceSpec) (DistanceMeasure, error) {
+			weights := spec.Vectors["weights"]
+			if len(weights) == 0 {
+				return nil, fmt.Errorf("ERROR: weighted Euclidean distance needs weights")
+			}
+
+			return WeightedEuclideanDistance(weights), nil
+		},
+		MahalanobisDistanceName: func(spec DistanceSpec) (DistanceMeasure, error) {
+			inverse := spec.Matrices["inverse_covariance"]
+			if len(inverse) == 0 {
+				return nil, fmt.Errorf("ERROR: Mahalanobis distance needs an inverse_covariance matrix")
+			}
+			for i := range inverse {
+				if len(inverse[i]) != len(inverse) {
+					return nil, fmt.Errorf("ERROR: Mahalanobis distance inverse_covariance matrix must be square")
+				}
+			}
+
+			return MahalanobisDistance(inverse), nil
+		},
+		HammingDistanceName: func(spec DistanceSpec) (DistanceMeasure, error) {
+			return HammingDistance, nil
+		},
+		JaccardDistanceName: func(spec DistanceSpec) (DistanceMeasure, error) {
+			return JaccardDistance, nil
+		},
+		CanberraDistanceName: func(spec DistanceSpec) (DistanceMeasure, error) {
+			return CanberraDistance, nil
+		},
+		BrayCurtisDistanceName: func(spec DistanceSpec) (DistanceMeasure, error) {
+			return BrayCurtisDistance, nil
+		},
+	}
+)
+
+// RegisterDistance registers a builder for distances
+// with the given name, so DistanceSpecs with that name
+// can build (and models persisted with them can
+// restore) your own distances. Registering a name
+// twice replaces the previous builder.
+func RegisterDistance(name string, builder DistanceBuilder) {
+	distancesMu.Lock()
+	defer distancesMu.Unlock()
+
+	distances[name] = builder
+}
+
+// RegisteredDistances returns the (sorted) names of
+// all distances a DistanceSpec can describe
+func RegisteredDistances() []string {
+	distancesMu.RLock()
+	defer distancesMu.RUnlock()
+
+	names := make([]string, 0, len(distances))
+	for name := range distances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Distance builds the distance measure described by
+// the spec. An error is returned if the distance name
+// isn't registered or the parameters are invalid.
+func (s DistanceSpec) Distance() (DistanceMeasure, error) {
+	distancesMu.RLock()
+	builder, ok := distances[s.Name]
+	distancesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("ERROR: distance %q is not registered", s.Name)
+	}
+
+	return builder(s)
+}
+
+// String implements the fmt interface for clean
+// printing, as in 'euclidean()' or 'minkowski(p=3)'
+func (s DistanceSpec) String() string {
+	keys := make([]string, 0, len(s.Parameters))
+	for key := range s.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("%v=%v", key, s.Parameters[key]))
+	}
+
+	keys = keys[:0]
+	for key := range s.Vectors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("%v=%v", key, s.Vectors[key]))
+	}
+
+	keys = keys[:0]
+	for key := range s.Matrices {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("%v=%v", key, s.Matrices[key]))
+	}
+
+	return s.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// EuclideanDistanceSpec returns the spec of
+// EuclideanDistance
+func EuclideanDistanceSpec() DistanceSpec {
+	return DistanceSpec{
+		Name: EuclideanDistanceName,
+	}
+}
+
+// ManhattanDistanceSpec returns the spec of
+// ManhattanDistance
+func ManhattanDistanceSpec() DistanceSpec {
+	return DistanceSpec{
+		Name: ManhattanDistanceName,
+	}
+}
+
+// MinkowskiDistanceSpec returns the spec of the
+// distance returned by MinkowskiDistance(p). As with
+// MinkowskiDistance, a p of math.Inf(1) describes the
+// ChebyshevDistance (which is also how it's saved,
+// because JSON has no infinity.)
+func MinkowskiDistanceSpec(p float64) DistanceSpec {
+	if math.IsInf(p, 1) {
+		return ChebyshevDistanceSpec()
+	}
+
+	return DistanceSpec{
+		Name: MinkowskiDistanceName,
+		Parameters: map[string]float64{
+			"p": p,
+		},
+	}
+}
+
+// ChebyshevDistanceSpec returns the spec of
+// ChebyshevDistance
+func ChebyshevDistanceSpec() DistanceSpec {
+	return DistanceSpec{
+		Name: ChebyshevDistanceName,
+	}
+}
+
+// CosineDistanceSpec returns the spec of
+// CosineDistance
+func CosineDistanceSpec() DistanceSpec {
+	return DistanceSpec{
+		Name: CosineDistanceName,
+	}
+}
+
+// WeightedEuclideanDistanceSpec returns the spec of
+// the distance returned by WeightedEuclideanDistance(weights)
+func WeightedEuclideanDistanceSpec(weights []float64) DistanceSpec {
+	return DistanceSpec{
+		Name: WeightedEuclideanDistanceName,
+		Vectors: map[string][]float64{
+			"weights": append([]float64{}, weights...),
+		},
+	}
+}
+
+// MahalanobisDistanceSpec returns the spec of the
+// distance returned by MahalanobisDistance(inverseCovariance)
+func MahalanobisDistanceSpec(inverseCovariance [][]float64) DistanceSpec {
+	inverse := make([][]float64, len(inverseCovariance))
+	for i := range inverseCovariance {
+		inverse[i] = append([]float64{}, inverseCovariance[i]...)
+	}
+
+	return DistanceSpec{
+		Name: MahalanobisDistanceName,
+		Matrices: map[string][][]float64{
+			"inverse_covariance": inverse,
+		},
+	}
+}
+
+// HammingDistanceSpec returns the spec of
+// HammingDistance
+func HammingDistanceSpec() DistanceSpec {
+	return DistanceSpec{
+		Name: HammingDistanceName,
+	}
+}
+
+// JaccardDistanceSpec returns the spec of
+// JaccardDistance
+func JaccardDistanceSpec() DistanceSpec {
+	return DistanceSpec{
+		Name: JaccardDistanceName,
+	}
+}
+
+// CanberraDistanceSpec returns the spec of
+// CanberraDistance
+func CanberraDistanceSpec() DistanceSpec {
+	return DistanceSpec{
+		Name: CanberraDistanceName,
+	}
+}
+
+// BrayCurtisDistanceSpec returns the spec of
+// BrayCurtisDistance
+func BrayCurtisDistanceSpec() DistanceSpec {
+	return DistanceSpec{
+		Name: BrayCurtisDistanceName,
+	}
+}
@@ -0,0 +1,102 @@
+package base
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistanceSpecShouldPass1(t *testing.T) {
+	x := []float64{1, 0, 2.5, 3}
+	y := []float64{0, 1, 1, 2}
+
+	inverse := [][]float64{
+		{2, 0, 0, 0},
+		{0, 1, 0.5, 0},
+		{0, 0.5, 1, 0},
+		{0, 0, 0, 3},
+	}
+
+	specs := []DistanceSpec{
+		EuclideanDistanceSpec(),
+		ManhattanDistanceSpec(),
+		MinkowskiDistanceSpec(3),
+		ChebyshevDistanceSpec(),
+		CosineDistanceSpec(),
+		WeightedEuclideanDistanceSpec([]float64{1, 2, 3, 4}),
+		MahalanobisDistanceSpec(inverse),
+		HammingDistanceSpec(),
+		JaccardDistanceSpec(),
+		CanberraDistanceSpec(),
+		BrayCurtisDistanceSpec(),
+	}
+	distances := []DistanceMeasure{
+		EuclideanDistance,
+		ManhattanDistance,
+		MinkowskiDistance(3),
+		ChebyshevDistance,
+		CosineDistance,
+		WeightedEuclideanDistance([]float64{1, 2, 3, 4}),
+		MahalanobisDistance(inverse),
+		HammingDistance,
+		JaccardDistance,
+		CanberraDistance,
+		BrayCurtisDistance,
+	}
+
+	for i, spec := range specs {
+		bytes, err := json.Marshal(spec)
+		assert.Nil(t, err, "Marshal error should be nil")
+
+		var restored DistanceSpec
+		assert.Nil(t, json.Unmarshal(bytes, &restored), "Unmarshal error should be nil")
+		assert.Equal(t, spec, restored, "Spec should round-trip through JSON")
+
+		d, err := restored.Distance()
+		assert.Nil(t, err, "Distance error should be nil for %v", spec)
+		assert.InDelta(t, distances[i](x, y), d(x, y), 1e-12, "Distance built from %v should match the distance function", spec)
+	}
+
+	assert.Equal(t, ChebyshevDistanceSpec(), MinkowskiDistanceSpec(math.Inf(1)), "An infinite order Minkowski distance should be the Chebyshev distance")
+	assert.Equal(t, "minkowski(p=3)", MinkowskiDistanceSpec(3).String(), "Spec should print cleanly")
+	assert.Equal(t, "weighted_euclidean(weights=[1 2])", WeightedEuclideanDistanceSpec([]float64{1, 2}).String(), "Spec should print cleanly")
+}
+
+func TestDistanceSpecShouldFail1(t *testing.T) {
+	_, err := DistanceSpec{Name: "not registered"}.Distance()
+	assert.NotNil(t, err, "Building an unregistered distance should return an error")
+
+	_, err = MinkowskiDistanceSpec(0).Distance()
+	assert.NotNil(t, err, "Building a Minkowski distance of order 0 should return an error")
+
+	_, err = DistanceSpec{Name: WeightedEuclideanDistanceName}.Distance()
+	assert.NotNil(t, err, "Weighted Euclidean distance without weights should return an error")
+
+	_, err = MahalanobisDistanceSpec([][]float64{{1, 0}, {0}}).Distance()
+	assert.NotNil(t, err, "Mahalanobis distance with a ragged matrix should return an error")
+}
+
+func TestRegisterDistanceShouldPass1(t *testing.T) {
+	RegisterDistance("base.testDistance", func(spec DistanceSpec) (DistanceMeasure, error) {
+		scale := spec.Parameters["scale"]
+		return func(u []float64, v []float64) float64 {
+			return scale * ManhattanDistance(u, v)
+		}, nil
+	})
+
+	assert.Contains(t, RegisteredDistances(), "base.testDistance", "Custom distance should be registered")
+	assert.Contains(t, RegisteredDistances(), EuclideanDistanceName, "Default distances should be registered")
+
+	spec := DistanceSpec{
+		Name: "base.testDistance",
+		Parameters: map[string]float64{
+			"scale": 2,
+		},
+	}
+
+	d, err := spec.Distance()
+	assert.Nil(t, err, "Distance error should be nil")
+	assert.Equal(t, 8.0, d([]float64{1, 2}, []float64{3, 4}), "Custom distance should use the spec's parameters")
+}
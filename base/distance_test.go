@@ -1,6 +1,7 @@
 package base
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,3 +34,104 @@ func TestDistanceManhattanShouldPass2(t *testing.T) {
 
 	assert.InDelta(t, 213.0522, ManhattanDistance(u, v), 1e-3, "Distance should match")
 }
+
+func TestDistanceLNormShouldPass1(t *testing.T) {
+	u := []float64{0, 2.5, 1.23, -10.013, 1.3}
+	v := []float64{3, 3.1, 2, 1.2, 1.2}
+
+	assert.InDelta(t, ManhattanDistance(u, v), LNorm(1)(u, v), 1e-9, "L1 norm should be the Manhattan distance")
+	assert.InDelta(t, EuclideanDistance(u, v), LNorm(2)(u, v), 1e-9, "L2 norm should be the Euclidean distance")
+
+	// odd p used to sum signed differences
+	assert.InDelta(t, 2, LNorm(3)([]float64{0, 0}, []float64{-2, 0}), 1e-9, "L3 norm should use absolute differences")
+	assert.InDelta(t, math.Pow(1+8, 1.0/3), LNorm(3)([]float64{1, 0}, []float64{0, 2}), 1e-9, "L3 norm should match")
+}
+
+func TestDistanceMinkowskiShouldPass1(t *testing.T) {
+	u := []float64{1, -2, 3}
+	v := []float64{-1, 2, 3.5}
+
+	assert.InDelta(t, math.Pow(math.Pow(2, 1.5)+math.Pow(4, 1.5)+math.Pow(0.5, 1.5), 1/1.5), MinkowskiDistance(1.5)(u, v), 1e-9, "Distance should match")
+	assert.InDelta(t, 4, MinkowskiDistance(math.Inf(1))(u, v), 1e-9, "Infinite order should be the Chebyshev distance")
+	assert.InDelta(t, 4, ChebyshevDistance(u, v), 1e-9, "Distance should match")
+}
+
+func TestDistanceCosineShouldPass1(t *testing.T) {
+	assert.InDelta(t, 0, CosineDistance([]float64{1, 2}, []float64{2, 4}), 1e-9, "Parallel vectors should have distance 0")
+	assert.InDelta(t, 1, CosineDistance([]float64{1, 0}, []float64{0, 3}), 1e-9, "Orthogonal vectors should have distance 1")
+	assert.InDelta(t, 2, CosineDistance([]float64{1, 1}, []float64{-1, -1}), 1e-9, "Opposite vectors should have distance 2")
+	assert.InDelta(t, 1, CosineDistance([]float64{0, 0}, []float64{1, 1}), 1e-9, "Distance to the zero vector should be 1")
+	assert.InDelta(t, 0, CosineDistance([]float64{0, 0}, []float64{0, 0}), 1e-9, "Zero vectors should have distance 0")
+}
+
+func TestDistanceWeightedEuclideanShouldPass1(t *testing.T) {
+	distance := WeightedEuclideanDistance([]float64{1, 4, 0})
+
+	assert.InDelta(t, math.Sqrt(1+4*4), distance([]float64{1, 2, 100}, []float64{0, 0, -100}), 1e-9, "Distance should match")
+}
+
+func TestDistanceMahalanobisShouldPass1(t *testing.T) {
+	// features with variances 4 and 1 which
+	// aren't correlated
+	data := [][]float64{
+		{2, 1},
+		{-2, 1},
+		{2, -1},
+		{-2, -1},
+	}
+
+	distance, err := FitMahalanobisDistance(data)
+	assert.Nil(t, err, "Fit error should be nil")
+
+	// the sample variances are 16/3 and 4/3
+	assert.InDelta(t, math.Sqrt(16/(16.0/3)), distance([]float64{0, 0}, []float64{4, 0}), 1e-9, "Distance should be scaled by the variance")
+	assert.InDelta(t, math.Sqrt(4/(4.0/3)), distance([]float64{0, 0}, []float64{0, 2}), 1e-9, "Distance should be scaled by the variance")
+
+	// identity covariance is the Euclidean distance
+	identity := MahalanobisDistance([][]float64{{1, 0}, {0, 1}})
+	assert.InDelta(t, 5, identity([]float64{0, 0}, []float64{3, 4}), 1e-9, "Distance should match")
+}
+
+func TestDistanceMahalanobisShouldFail1(t *testing.T) {
+	_, err := FitMahalanobisDistance([][]float64{{1, 2}})
+	assert.NotNil(t, err, "Fitting one example should return an error")
+
+	_, err = FitMahalanobisDistance([][]float64{{1, 2}, {2}})
+	assert.NotNil(t, err, "Fitting examples of different lengths should return an error")
+
+	// the second feature is twice the first
+	_, err = FitMahalanobisDistance([][]float64{{1, 2}, {2, 4}, {3, 6}})
+	assert.NotNil(t, err, "Fitting correlated features should return an error")
+}
+
+func TestDistanceSetsShouldPass1(t *testing.T) {
+	u := []float64{1, 0, 1, 1, 0}
+	v := []float64{1, 1, 0, 1, 0}
+
+	assert.Equal(t, 2.0, HammingDistance(u, v), "Distance should match")
+	assert.InDelta(t, 0.5, JaccardDistance(u, v), 1e-9, "Distance should match")
+	assert.Equal(t, 0.0, JaccardDistance([]float64{0, 0}, []float64{0, 0}), "Empty sets should have distance 0")
+}
+
+func TestDistanceCanberraBrayCurtisShouldPass1(t *testing.T) {
+	u := []float64{1, 2, 0, 4}
+	v := []float64{3, 2, 0, 1}
+
+	assert.InDelta(t, 2.0/4+0+3.0/5, CanberraDistance(u, v), 1e-9, "Distance should match")
+	assert.InDelta(t, 5.0/13, BrayCurtisDistance(u, v), 1e-9, "Distance should match")
+	assert.Equal(t, 0.0, BrayCurtisDistance([]float64{0}, []float64{0}), "Zero vectors should have distance 0")
+}
+
+func TestSafeDistanceShouldFail1(t *testing.T) {
+	distance := SafeDistance(EuclideanDistance)
+
+	d, err := distance([]float64{0, 0}, []float64{3, 4})
+	assert.Nil(t, err, "Distance error should be nil")
+	assert.InDelta(t, 5, d, 1e-9, "Distance should match")
+
+	_, err = distance([]float64{0, 0}, []float64{3})
+	assert.NotNil(t, err, "Vectors of different lengths should return an error")
+
+	_, err = SafeDistance(WeightedEuclideanDistance([]float64{1, 1}), 2)([]float64{1, 2, 3}, []float64{1, 2, 3})
+	assert.NotNil(t, err, "Vectors of the wrong dimension should return an error")
+}
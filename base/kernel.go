@@ -172,3 +172,271 @@ func TanhKernel(k float64, constants ...float64) func([]float64, []float64) floa
 		return math.Tanh(dot + c)
 	}
 }
+
+// LaplacianKernel takes in a parameter for sigma (σ)
+// and returns a valid Laplacian Kernel. It's like the
+// GaussianKernel, but uses the Manhattan distance
+// between the vectors, which makes it less smooth (and
+// often better with sparse or noisy features.) If the
+// input dimensions aren't valid, the kernel will return
+// 0.0 (as if the vectors are orthogonal)
+//
+//     K(x, x`) = exp( -1 * |x - x`|₁ / σ)
+//
+// Sigma (σ) will default to 1 if given 0.0
+func LaplacianKernel(sigma float64) func([]float64, []float64) float64 {
+	if sigma == 0 {
+		sigma = 1.0
+	}
+
+	return func(X []float64, x []float64) float64 {
+		// don't throw error but fail peacefully
+		//
+		// returning "not at all similar", basically
+		if len(X) != len(x) {
+			return 0.0
+		}
+
+		var diff float64
+
+		for i := range X {
+			diff += math.Abs(X[i] - x[i])
+		}
+
+		return math.Exp(-1 * diff / sigma)
+	}
+}
+
+// ARDGaussianKernel takes in one length scale (l) per
+// feature and returns a valid Gaussian Radial Basis
+// Function Kernel where each feature is scaled by its
+// own length scale (Automatic Relevance Determination.)
+// Features with large length scales matter less to the
+// kernel than features with small ones. If the input
+// dimensions aren't valid (including not matching the
+// number of length scales,) the kernel will return 0.0
+//
+//     K(x, x`) = exp( -1 * Σ(x[i] - x`[i])^2 / 2l[i]^2)
+//
+// Length scales of 0.0 will default to 1
+func ARDGaussianKernel(lengthScales []float64) func([]float64, []float64) float64 {
+	denoms := make([]float64, len(lengthScales))
+	for i, l := range lengthScales {
+		if l == 0 {
+			l = 1.0
+		}
+		denoms[i] = 2 * l * l
+	}
+
+	return func(X []float64, x []float64) float64 {
+		// don't throw error but fail peacefully
+		//
+		// returning "not at all similar", basically
+		if len(X) != len(x) || len(X) != len(denoms) {
+			return 0.0
+		}
+
+		var diff float64
+
+		for i := range X {
+			diff += (X[i] - x[i]) * (X[i] - x[i]) / denoms[i]
+		}
+
+		return math.Exp(-1 * diff)
+	}
+}
+
+// RationalQuadraticKernel takes in a scale mixture
+// parameter alpha (α) and a length scale (l) and returns
+// a valid Rational Quadratic Kernel, which is the same
+// as adding together Gaussian kernels of many different
+// length scales. As α grows, the kernel approaches the
+// GaussianKernel with σ = l. If the input dimensions
+// aren't valid, the kernel will return 0.0
+//
+//     K(x, x`) = (1 + |x - x`|^2 / 2αl^2)^-α
+//
+// Alpha (α) and the length scale will default to 1 if
+// given 0.0
+func RationalQuadraticKernel(alpha, lengthScale float64) func([]float64, []float64) float64 {
+	if alpha == 0 {
+		alpha = 1.0
+	}
+	if lengthScale == 0 {
+		lengthScale = 1.0
+	}
+
+	denom := 2 * alpha * lengthScale * lengthScale
+
+	return func(X []float64, x []float64) float64 {
+		// don't throw error but fail peacefully
+		//
+		// returning "not at all similar", basically
+		if len(X) != len(x) {
+			return 0.0
+		}
+
+		var diff float64
+
+		for i := range X {
+			diff += (X[i] - x[i]) * (X[i] - x[i])
+		}
+
+		return math.Pow(1+diff/denom, -1*alpha)
+	}
+}
+
+// PeriodicKernel takes in a period (p) and a length
+// scale (l) and returns a valid Periodic (Exp-Sine-Squared)
+// Kernel, which is useful for data that repeats itself,
+// like seasonal time series. Points a whole number of
+// periods apart are considered identical. If the input
+// dimensions aren't valid, the kernel will return 0.0
+//
+//     K(x, x`) = exp( -2 * sin^2(π|x - x`| / p) / l^2)
+//
+// The period and length scale will default to 1 if
+// given 0.0
+func PeriodicKernel(period, lengthScale float64) func([]float64, []float64) float64 {
+	if period == 0 {
+		period = 1.0
+	}
+	if lengthScale == 0 {
+		lengthScale = 1.0
+	}
+
+	return func(X []float64, x []float64) float64 {
+		// don't throw error but fail peacefully
+		//
+		// returning "not at all similar", basically
+		if len(X) != len(x) {
+			return 0.0
+		}
+
+		var diff float64
+
+		for i := range X {
+			diff += (X[i] - x[i]) * (X[i] - x[i])
+		}
+
+		sin := math.Sin(math.Pi * math.Sqrt(diff) / period)
+
+		return math.Exp(-2 * sin * sin / (lengthScale * lengthScale))
+	}
+}
+
+// ChiSquaredKernel takes in a parameter gamma (γ) and
+// returns a valid (exponential) Chi-Squared Kernel,
+// which is commonly used with histograms and other
+// non-negative features (like bag of words counts.)
+// Dimensions where both values are 0 are skipped. If
+// the input dimensions aren't valid, the kernel will
+// return 0.0
+//
+//     K(x, x`) = exp( -γ * Σ(x[i] - x`[i])^2 / (x[i] + x`[i]))
+//
+// Gamma (γ) will default to 1 if given 0.0
+func ChiSquaredKernel(gamma float64) func([]float64, []float64) float64 {
+	if gamma == 0 {
+		gamma = 1.0
+	}
+
+	return func(X []float64, x []float64) float64 {
+		// don't throw error but fail peacefully
+		//
+		// returning "not at all similar", basically
+		if len(X) != len(x) {
+			return 0.0
+		}
+
+		var sum float64
+
+		for i := range X {
+			if X[i]+x[i] == 0 {
+				continue
+			}
+			sum += (X[i] - x[i]) * (X[i] - x[i]) / (X[i] + x[i])
+		}
+
+		return math.Exp(-1 * gamma * sum)
+	}
+}
+
+// HistogramIntersectionKernel returns a valid
+// Histogram Intersection (Min) Kernel for non-negative
+// features, which is the amount two histograms overlap.
+// If the input dimensions aren't valid, the kernel will
+// return 0.0
+//
+//     K(x, x`) = Σ min(x[i], x`[i])
+func HistogramIntersectionKernel() func([]float64, []float64) float64 {
+	return func(X []float64, x []float64) float64 {
+		// don't throw error but fail peacefully
+		//
+		// returning "not at all similar", basically
+		if len(X) != len(x) {
+			return 0.0
+		}
+
+		var sum float64
+
+		for i := range X {
+			sum += math.Min(X[i], x[i])
+		}
+
+		return sum
+	}
+}
+
+// SumKernel returns the kernel which adds the
+// given kernels together. The sum of valid kernels
+// is always a valid kernel, so this is an easy way
+// to combine kernels that each capture part of your
+// data (like a periodic trend on top of a smooth one.)
+//
+//     K(x, x`) = K₁(x, x`) + K₂(x, x`) + ...
+func SumKernel(kernels ...func([]float64, []float64) float64) func([]float64, []float64) float64 {
+	return func(X []float64, x []float64) float64 {
+		var sum float64
+		for _, kernel := range kernels {
+			sum += kernel(X, x)
+		}
+
+		return sum
+	}
+}
+
+// ProductKernel returns the kernel which multiplies
+// the given kernels together. The product of valid
+// kernels is always a valid kernel.
+//
+//     K(x, x`) = K₁(x, x`) * K₂(x, x`) * ...
+//
+// The product of no kernels is 1 for every input.
+func ProductKernel(kernels ...func([]float64, []float64) float64) func([]float64, []float64) float64 {
+	return func(X []float64, x []float64) float64 {
+		product := 1.0
+		for _, kernel := range kernels {
+			product *= kernel(X, x)
+		}
+
+		return product
+	}
+}
+
+// ScaleKernel returns the given kernel multiplied
+// by a constant scale (c.) The scale must be greater
+// than 0 for the result to be a valid kernel.
+//
+//     K(x, x`) = c * K₁(x, x`)
+//
+// The scale will default to 1 if given 0.0 or less
+func ScaleKernel(scale float64, kernel func([]float64, []float64) float64) func([]float64, []float64) float64 {
+	if !(scale > 0) {
+		scale = 1.0
+	}
+
+	return func(X []float64, x []float64) float64 {
+		return scale * kernel(X, x)
+	}
+}
@@ -0,0 +1,223 @@
+package base
+
+import (
+	"container/list"
+	"sync"
+)
+
+// KernelMatrix gives the kernel value between any
+// two examples of a training set, addressed by their
+// index within the training set. Kernel models use it
+// during batch training so kernel values are computed
+// once and reused instead of recomputed every time a
+// pair of examples is compared.
+//
+// There are two implementations: GramMatrix, which
+// precomputes every kernel value up front (fastest,
+// but needs memory for n² floats,) and KernelCache,
+// which computes rows of the matrix when they are
+// first needed and keeps the most recently used ones.
+// NewKernelMatrix picks one for you.
+type KernelMatrix interface {
+	// At returns K(x[i], x[j])
+	At(i, j int) float64
+
+	// Row returns K(x[i], x[j]) for every j. The
+	// returned slice may be shared, so don't modify it.
+	Row(i int) []float64
+
+	// Len returns the number of examples
+	Len() int
+}
+
+// NewKernelMatrix returns a KernelMatrix of the given
+// kernel over the given training set. If rows is 0
+// (or at least the size of the training set) the full
+// GramMatrix is precomputed. Otherwise a KernelCache
+// holding at most that many rows is returned.
+func NewKernelMatrix(kernel func([]float64, []float64) float64, trainingSet [][]float64, rows int) KernelMatrix {
+	if rows <= 0 || rows >= len(trainingSet) {
+		return NewGramMatrix(kernel, trainingSet)
+	}
+
+	return NewKernelCache(kernel, trainingSet, rows)
+}
+
+// GramMatrix is a KernelMatrix holding every kernel
+// value of a training set, computed up front. Kernels
+// are symmetric, so each value is only computed once.
+type GramMatrix struct {
+	values [][]float64
+}
+
+// NewGramMatrix computes the Gram matrix of the given
+// kernel over the given training set
+func NewGramMatrix(kernel func([]float64, []float64) float64, trainingSet [][]float64) *GramMatrix {
+	n := len(trainingSet)
+
+	values := make([][]float64, n)
+	for i := range values {
+		values[i] = make([]float64, n)
+	}
+
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			k := kernel(trainingSet[i], trainingSet[j])
+			values[i][j] = k
+			values[j][i] = k
+		}
+	}
+
+	return &GramMatrix{
+		values: values,
+	}
+}
+
+// At returns K(x[i], x[j])
+func (g *GramMatrix) At(i, j int) float64 {
+	return g.values[i][j]
+}
+
+// Row returns K(x[i], x[j]) for every j. The row is
+// the matrix's own, so don't modify it.
+func (g *GramMatrix) Row(i int) []float64 {
+	return g.values[i]
+}
+
+// Len returns the number of examples
+func (g *GramMatrix) Len() int {
+	return len(g.values)
+}
+
+// KernelCache is a KernelMatrix which computes rows
+// of the kernel matrix of a training set when they're
+// first needed and keeps the most recently used rows
+// (up to a fixed number) in memory, evicting the least
+// recently used row when it's full. This is the same
+// strategy SVM solvers use to train on datasets whose
+// full Gram matrix doesn't fit in memory.
+//
+// KernelCache is safe for concurrent use.
+type KernelCache struct {
+	kernel      func([]float64, []float64) float64
+	trainingSet [][]float64
+	capacity    int
+
+	mu    sync.Mutex
+	rows  map[int]*list.Element
+	order *list.List
+
+	hits   int
+	misses int
+}
+
+// cachedRow is a row held by a KernelCache
+type cachedRow struct {
+	index  int
+	values []float64
+}
+
+// NewKernelCache returns a KernelCache of the given
+// kernel over the given training set, holding at most
+// the given number of rows (at least 1.)
+func NewKernelCache(kernel func([]float64, []float64) float64, trainingSet [][]float64, rows int) *KernelCache {
+	if rows < 1 {
+		rows = 1
+	}
+
+	return &KernelCache{
+		kernel:      kernel,
+		trainingSet: trainingSet,
+		capacity:    rows,
+
+		rows:  make(map[int]*list.Element, rows),
+		order: list.New(),
+	}
+}
+
+// At returns K(x[i], x[j]), using row i or row j
+// if either is cached and computing (and caching)
+// row i otherwise
+func (c *KernelCache) At(i, j int) float64 {
+	c.mu.Lock()
+	if elem, ok := c.rows[i]; ok {
+		c.hits++
+		c.order.MoveToFront(elem)
+		k := elem.Value.(*cachedRow).values[j]
+		c.mu.Unlock()
+		return k
+	}
+	if elem, ok := c.rows[j]; ok {
+		c.hits++
+		c.order.MoveToFront(elem)
+		k := elem.Value.(*cachedRow).values[i]
+		c.mu.Unlock()
+		return k
+	}
+	k := c.row(i)[j]
+	c.mu.Unlock()
+
+	return k
+}
+
+// Row returns K(x[i], x[j]) for every j, computing
+// the row if it isn't cached. The memory of cached
+// rows is reused once they're evicted, so Row returns
+// a copy of the row.
+func (c *KernelCache) Row(i int) []float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]float64{}, c.row(i)...)
+}
+
+// row returns the cached row i, computing (and
+// caching) it if it isn't cached. The caller must
+// hold the lock.
+func (c *KernelCache) row(i int) []float64 {
+	if elem, ok := c.rows[i]; ok {
+		c.hits++
+		c.order.MoveToFront(elem)
+		return elem.Value.(*cachedRow).values
+	}
+	c.misses++
+
+	var values []float64
+	if c.order.Len() >= c.capacity {
+		// reuse the memory of the least
+		// recently used row
+		oldest := c.order.Back()
+		row := oldest.Value.(*cachedRow)
+		delete(c.rows, row.index)
+		c.order.Remove(oldest)
+		values = row.values
+	} else {
+		values = make([]float64, len(c.trainingSet))
+	}
+
+	for j := range c.trainingSet {
+		values[j] = c.kernel(c.trainingSet[i], c.trainingSet[j])
+	}
+
+	c.rows[i] = c.order.PushFront(&cachedRow{
+		index:  i,
+		values: values,
+	})
+
+	return values
+}
+
+// Len returns the number of examples
+func (c *KernelCache) Len() int {
+	return len(c.trainingSet)
+}
+
+// Stats returns the number of lookups which were
+// answered from the cache (hits) and the number of
+// rows which had to be computed (misses)
+func (c *KernelCache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hits, c.misses
+}
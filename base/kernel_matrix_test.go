@@ -0,0 +1,101 @@
+package base
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKernelMatrixShouldPass1(t *testing.T) {
+	data := [][]float64{
+		{0, 0},
+		{0, 1},
+		{1, 0},
+		{1, 1},
+		{-2, 3},
+	}
+	kernel := GaussianKernel(1)
+
+	gram := NewKernelMatrix(kernel, data, 0)
+	_, ok := gram.(*GramMatrix)
+	assert.True(t, ok, "A cache size of 0 should precompute the Gram matrix")
+
+	cache := NewKernelMatrix(kernel, data, 2)
+	_, ok = cache.(*KernelCache)
+	assert.True(t, ok, "A cache size smaller than the training set should return a KernelCache")
+
+	assert.Equal(t, len(data), gram.Len(), "Gram matrix should have one row per example")
+	assert.Equal(t, len(data), cache.Len(), "Kernel cache should have one row per example")
+
+	for i := range data {
+		for j := range data {
+			expected := kernel(data[i], data[j])
+			assert.InDelta(t, expected, gram.At(i, j), 1e-12, "Gram matrix should hold K(x[%v], x[%v])", i, j)
+			assert.InDelta(t, expected, cache.At(i, j), 1e-12, "Kernel cache should return K(x[%v], x[%v])", i, j)
+			assert.InDelta(t, expected, cache.Row(i)[j], 1e-12, "Kernel cache row %v should hold K(x[%v], x[%v])", i, i, j)
+		}
+	}
+}
+
+func TestKernelCacheShouldPass1(t *testing.T) {
+	data := [][]float64{{1}, {2}, {3}, {4}}
+
+	var evaluations int
+	kernel := func(X, x []float64) float64 {
+		evaluations++
+		return X[0] * x[0]
+	}
+
+	cache := NewKernelCache(kernel, data, 2)
+
+	assert.Equal(t, 2.0, cache.At(0, 1), "K(x[0], x[1]) should be 2")
+	assert.Equal(t, len(data), evaluations, "Computing a row should evaluate the kernel once per example")
+
+	// symmetric lookups are answered by the cached row
+	assert.Equal(t, 4.0, cache.At(3, 0), "K(x[3], x[0]) should be 4")
+	assert.Equal(t, len(data), evaluations, "K(x[3], x[0]) should come from the cached row 0")
+
+	cache.Row(1)
+	cache.Row(0)
+
+	// row 1 is now the least recently used, so
+	// computing row 2 should evict it
+	cache.Row(2)
+	assert.Equal(t, 3*len(data), evaluations, "Three rows should have been computed")
+
+	cache.Row(0)
+	assert.Equal(t, 3*len(data), evaluations, "Row 0 should still be cached")
+
+	cache.Row(1)
+	assert.Equal(t, 4*len(data), evaluations, "Row 1 should have been evicted")
+
+	hits, misses := cache.Stats()
+	assert.Equal(t, 3, hits, "Cache should have been hit 3 times")
+	assert.Equal(t, 4, misses, "Cache should have missed 4 times")
+}
+
+func TestKernelCacheShouldPass2(t *testing.T) {
+	data := [][]float64{{1}, {2}, {3}, {4}}
+	kernel := func(X, x []float64) float64 {
+		return X[0] * x[0]
+	}
+
+	// with room for a single row, every row evicts
+	// the last one, whose memory is reused
+	cache := NewKernelCache(kernel, data, 1)
+
+	rows := make([][]float64, len(data))
+	for i := range rows {
+		rows[i] = cache.Row(i)
+	}
+
+	for i := range rows {
+		for j := range data {
+			assert.Equal(t, data[i][0]*data[j][0], rows[i][j], "Row %v should keep its values after later rows are computed", i)
+		}
+	}
+
+	// modifying a returned row doesn't touch the cache
+	rows[3][0] = -1
+	assert.Equal(t, 4.0, cache.At(3, 0), "Modifying a returned row should not change the cached row")
+}
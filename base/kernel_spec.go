@@ -0,0 +1,408 @@
+package base
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Names of the kernels which can be described with
+// a KernelSpec by default
+const (
+	GaussianKernelName              = "gaussian"
+	LinearKernelName                = "linear"
+	PolynomialKernelName            = "polynomial"
+	TanhKernelName                  = "tanh"
+	LaplacianKernelName             = "laplacian"
+	ARDGaussianKernelName           = "ard_gaussian"
+	RationalQuadraticKernelName     = "rational_quadratic"
+	PeriodicKernelName              = "periodic"
+	ChiSquaredKernelName            = "chi_squared"
+	HistogramIntersectionKernelName = "histogram_intersection"
+	SumKernelName                   = "sum"
+	ProductKernelName               = "product"
+	ScaleKernelName                 = "scale"
+)
+
+// KernelSpec is a declarative description of a
+// kernel: the name of the kernel family and the
+// parameters used to build it. Unlike the kernel
+// functions themselves, a KernelSpec can be
+// marshalled to JSON, which is what lets kernel
+// models (like the KernelPerceptron) persist and
+// restore their kernel.
+//
+//     spec := base.GaussianKernelSpec(50)
+//
+//     // {"name":"gaussian","parameters":{"sigma":50}}
+//     bytes, err := json.Marshal(spec)
+//
+//     kernel, err := spec.Kernel()
+//
+// Composite kernels (sums, products and scaled
+// kernels) hold the specs of the kernels they
+// combine in Kernels:
+//
+//     // {"name":"sum","kernels":[{"name":"periodic",...},{"name":"gaussian",...}]}
+//     spec := base.SumKernelSpec(base.PeriodicKernelSpec(12, 1), base.GaussianKernelSpec(50))
+//
+// You can describe your own kernels too by
+// registering a builder for them with RegisterKernel.
+type KernelSpec struct {
+	Name       string             `json:"name"`
+	Parameters map[string]float64 `json:"parameters,omitempty"`
+
+	// Vectors holds parameters which have one
+	// value per feature (like the length scales
+	// of the ARD Gaussian kernel)
+	Vectors map[string][]float64 `json:"vectors,omitempty"`
+
+	// Kernels holds the specs of the kernels
+	// combined by composite kernels
+	Kernels []KernelSpec `json:"kernels,omitempty"`
+}
+
+// KernelBuilder builds a kernel function from a
+// KernelSpec, returning an error if the spec's
+// parameters aren't valid for the kernel
+type KernelBuilder func(KernelSpec) (func([]float64, []float64) float64, error)
+
+var (
+	kernelsMu sync.RWMutex
+	kernels   = map[string]KernelBuilder{
+		GaussianKernelName: func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+			return GaussianKernel(spec.Parameters["sigma"]), nil
+		},
+		LinearKernelName: func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+			return LinearKernel(), nil
+		},
+		PolynomialKernelName: func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+			d := spec.Parameters["degree"]
+			if d != float64(int(d)) {
+				return nil, fmt.Errorf("ERROR: polynomial kernel degree must be an integer - given %v", d)
+			}
+
+			return PolynomialKernel(int(d), spec.Parameters["constant"]), nil
+		},
+		TanhKernelName: func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+			return TanhKernel(spec.Parameters["kappa"], spec.Parameters["constant"]), nil
+		},
+		LaplacianKernelName: func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+			return LaplacianKernel(spec.Parameters["sigma"]), nil
+		},
+		ARDGaussianKernelName: func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+			scales := spec.Vectors["length_scales"]
+			if len(scales) == 0 {
+				return nil, fmt.Errorf("ERROR: ARD Gaussian kernel needs length_scales")
+			}
+
+			return ARDGaussianKernel(scales), nil
+		},
+		RationalQuadraticKernelName: func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+			return RationalQuadraticKernel(spec.Parameters["alpha"], spec.Parameters["length_scale"]), nil
+		},
+		PeriodicKernelName: func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+			return PeriodicKernel(spec.Parameters["period"], spec.Parameters["length_scale"]), nil
+		},
+		ChiSquaredKernelName: func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+			return ChiSquaredKernel(spec.Parameters["gamma"]), nil
+		},
+		HistogramIntersectionKernelName: func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+			return HistogramIntersectionKernel(), nil
+		},
+	}
+)
+
+// composite kernels build their kernels from
+// the registry, so they're registered here to
+// avoid an initialization cycle
+func init() {
+	kernels[SumKernelName] = func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+		built, err := spec.subKernels()
+		if err != nil {
+			return nil, err
+		}
+
+		return SumKernel(built...), nil
+	}
+	kernels[ProductKernelName] = func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+		built, err := spec.subKernels()
+		if err != nil {
+			return nil, err
+		}
+
+		return ProductKernel(built...), nil
+	}
+	kernels[ScaleKernelName] = func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+		if len(spec.Kernels) != 1 {
+			return nil, fmt.Errorf("ERROR: scale kernel should scale exactly one kernel - given %v", len(spec.Kernels))
+		}
+
+		scale := spec.Parameters["scale"]
+		if !(scale > 0) {
+			return nil, fmt.Errorf("ERROR: scale kernel scale must be greater than 0 to be a valid kernel - given %v", scale)
+		}
+
+		built, err := spec.subKernels()
+		if err != nil {
+			return nil, err
+		}
+
+		return ScaleKernel(scale, built[0]), nil
+	}
+}
+
+// subKernels builds the kernels combined by a
+// composite kernel spec
+func (s KernelSpec) subKernels() ([]func([]float64, []float64) float64, error) {
+	if len(s.Kernels) == 0 {
+		return nil, fmt.Errorf("ERROR: %v kernel needs at least one kernel to combine", s.Name)
+	}
+
+	kernels := make([]func([]float64, []float64) float64, len(s.Kernels))
+	for i := range s.Kernels {
+		kernel, err := s.Kernels[i].Kernel()
+		if err != nil {
+			return nil, err
+		}
+		kernels[i] = kernel
+	}
+
+	return kernels, nil
+}
+
+// RegisterKernel registers a builder for kernels
+// with the given name, so KernelSpecs with that
+// name can build (and models persisted with them
+// can restore) your own kernels.
+//
+// RegisterKernel panics if the same name is registered
+// twice, or if the builder is nil.
+func RegisterKernel(name string, builder KernelBuilder) {
+	kernelsMu.Lock()
+	defer kernelsMu.Unlock()
+
+	if builder == nil {
+		panic("goml: RegisterKernel builder is nil for kernel " + name)
+	}
+	if _, exists := kernels[name]; exists {
+		panic("goml: RegisterKernel called twice for kernel " + name)
+	}
+
+	kernels[name] = builder
+}
+
+// RegisteredKernels returns the (sorted) names of
+// all kernels a KernelSpec can describe
+func RegisteredKernels() []string {
+	kernelsMu.RLock()
+	defer kernelsMu.RUnlock()
+
+	names := make([]string, 0, len(kernels))
+	for name := range kernels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Kernel builds the kernel function described by
+// the spec. An error is returned if the kernel name
+// isn't registered or the parameters are invalid.
+func (s KernelSpec) Kernel() (func([]float64, []float64) float64, error) {
+	kernelsMu.RLock()
+	builder, ok := kernels[s.Name]
+	kernelsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("ERROR: kernel %q is not registered", s.Name)
+	}
+
+	return builder(s)
+}
+
+// String implements the fmt interface for clean
+// printing, as in 'gaussian(sigma=50)' or
+// 'sum(linear(), gaussian(sigma=50))'
+func (s KernelSpec) String() string {
+	keys := make([]string, 0, len(s.Parameters))
+	for key := range s.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("%v=%v", key, s.Parameters[key]))
+	}
+
+	keys = keys[:0]
+	for key := range s.Vectors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("%v=%v", key, s.Vectors[key]))
+	}
+
+	for _, kernel := range s.Kernels {
+		args = append(args, kernel.String())
+	}
+
+	return s.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// GaussianKernelSpec returns the spec of the kernel
+// returned by GaussianKernel(sigma)
+func GaussianKernelSpec(sigma float64) KernelSpec {
+	return KernelSpec{
+		Name: GaussianKernelName,
+		Parameters: map[string]float64{
+			"sigma": sigma,
+		},
+	}
+}
+
+// LinearKernelSpec returns the spec of the kernel
+// returned by LinearKernel()
+func LinearKernelSpec() KernelSpec {
+	return KernelSpec{
+		Name: LinearKernelName,
+	}
+}
+
+// PolynomialKernelSpec returns the spec of the kernel
+// returned by PolynomialKernel(d, constants...). As
+// with PolynomialKernel, the constants are summed.
+func PolynomialKernelSpec(d int, constants ...float64) KernelSpec {
+	var c float64
+	for _, val := range constants {
+		c += val
+	}
+
+	return KernelSpec{
+		Name: PolynomialKernelName,
+		Parameters: map[string]float64{
+			"degree":   float64(d),
+			"constant": c,
+		},
+	}
+}
+
+// TanhKernelSpec returns the spec of the kernel
+// returned by TanhKernel(k, constants...). As
+// with TanhKernel, the constants are summed.
+func TanhKernelSpec(k float64, constants ...float64) KernelSpec {
+	var c float64
+	for _, val := range constants {
+		c += val
+	}
+
+	return KernelSpec{
+		Name: TanhKernelName,
+		Parameters: map[string]float64{
+			"kappa":    k,
+			"constant": c,
+		},
+	}
+}
+
+// LaplacianKernelSpec returns the spec of the kernel
+// returned by LaplacianKernel(sigma)
+func LaplacianKernelSpec(sigma float64) KernelSpec {
+	return KernelSpec{
+		Name: LaplacianKernelName,
+		Parameters: map[string]float64{
+			"sigma": sigma,
+		},
+	}
+}
+
+// ARDGaussianKernelSpec returns the spec of the kernel
+// returned by ARDGaussianKernel(lengthScales)
+func ARDGaussianKernelSpec(lengthScales []float64) KernelSpec {
+	return KernelSpec{
+		Name: ARDGaussianKernelName,
+		Vectors: map[string][]float64{
+			"length_scales": append([]float64{}, lengthScales...),
+		},
+	}
+}
+
+// RationalQuadraticKernelSpec returns the spec of the
+// kernel returned by RationalQuadraticKernel(alpha, lengthScale)
+func RationalQuadraticKernelSpec(alpha, lengthScale float64) KernelSpec {
+	return KernelSpec{
+		Name: RationalQuadraticKernelName,
+		Parameters: map[string]float64{
+			"alpha":        alpha,
+			"length_scale": lengthScale,
+		},
+	}
+}
+
+// PeriodicKernelSpec returns the spec of the kernel
+// returned by PeriodicKernel(period, lengthScale)
+func PeriodicKernelSpec(period, lengthScale float64) KernelSpec {
+	return KernelSpec{
+		Name: PeriodicKernelName,
+		Parameters: map[string]float64{
+			"period":       period,
+			"length_scale": lengthScale,
+		},
+	}
+}
+
+// ChiSquaredKernelSpec returns the spec of the kernel
+// returned by ChiSquaredKernel(gamma)
+func ChiSquaredKernelSpec(gamma float64) KernelSpec {
+	return KernelSpec{
+		Name: ChiSquaredKernelName,
+		Parameters: map[string]float64{
+			"gamma": gamma,
+		},
+	}
+}
+
+// HistogramIntersectionKernelSpec returns the spec of
+// the kernel returned by HistogramIntersectionKernel()
+func HistogramIntersectionKernelSpec() KernelSpec {
+	return KernelSpec{
+		Name: HistogramIntersectionKernelName,
+	}
+}
+
+// SumKernelSpec returns the spec of the sum of the
+// kernels described by the given specs (see SumKernel)
+func SumKernelSpec(kernels ...KernelSpec) KernelSpec {
+	return KernelSpec{
+		Name:    SumKernelName,
+		Kernels: kernels,
+	}
+}
+
+// ProductKernelSpec returns the spec of the product of
+// the kernels described by the given specs (see
+// ProductKernel)
+func ProductKernelSpec(kernels ...KernelSpec) KernelSpec {
+	return KernelSpec{
+		Name:    ProductKernelName,
+		Kernels: kernels,
+	}
+}
+
+// ScaleKernelSpec returns the spec of the kernel
+// described by the given spec, multiplied by scale
+// (see ScaleKernel)
+func ScaleKernelSpec(scale float64, kernel KernelSpec) KernelSpec {
+	return KernelSpec{
+		Name: ScaleKernelName,
+		Parameters: map[string]float64{
+			"scale": scale,
+		},
+		Kernels: []KernelSpec{kernel},
+	}
+}
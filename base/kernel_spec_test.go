@@ -0,0 +1,135 @@
+package base
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKernelSpecShouldPass1(t *testing.T) {
+	x := []float64{1, -2, 0.5, 3}
+	y := []float64{0, 4, -1, 2}
+
+	specs := []KernelSpec{
+		GaussianKernelSpec(50),
+		LinearKernelSpec(),
+		PolynomialKernelSpec(3, 1),
+		TanhKernelSpec(0.5, 1),
+	}
+	kernels := []func([]float64, []float64) float64{
+		GaussianKernel(50),
+		LinearKernel(),
+		PolynomialKernel(3, 1),
+		TanhKernel(0.5, 1),
+	}
+
+	for i, spec := range specs {
+		bytes, err := json.Marshal(spec)
+		assert.Nil(t, err, "Marshal error should be nil")
+
+		var restored KernelSpec
+		assert.Nil(t, json.Unmarshal(bytes, &restored), "Unmarshal error should be nil")
+
+		k, err := restored.Kernel()
+		assert.Nil(t, err, "Kernel error should be nil for %v", spec)
+		assert.InDelta(t, kernels[i](x, y), k(x, y), 1e-12, "Kernel built from %v should match the kernel function", spec)
+	}
+
+	assert.Equal(t, "polynomial(constant=1, degree=3)", PolynomialKernelSpec(3, 1).String(), "Spec should print cleanly")
+}
+
+func TestKernelSpecShouldFail1(t *testing.T) {
+	_, err := KernelSpec{Name: "not registered"}.Kernel()
+	assert.NotNil(t, err, "Building an unregistered kernel should return an error")
+
+	spec := PolynomialKernelSpec(2)
+	spec.Parameters["degree"] = 2.5
+
+	_, err = spec.Kernel()
+	assert.NotNil(t, err, "Building a polynomial kernel with a fractional degree should return an error")
+}
+
+func TestRegisterKernelShouldPass1(t *testing.T) {
+	RegisterKernel("base.testKernel", func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+		scale := spec.Parameters["scale"]
+		return func(X []float64, x []float64) float64 {
+			return scale * LinearKernel()(X, x)
+		}, nil
+	})
+
+	assert.Contains(t, RegisteredKernels(), "base.testKernel", "Custom kernel should be registered")
+
+	spec := KernelSpec{
+		Name: "base.testKernel",
+		Parameters: map[string]float64{
+			"scale": 2,
+		},
+	}
+
+	k, err := spec.Kernel()
+	assert.Nil(t, err, "Kernel error should be nil")
+	assert.Equal(t, 22.0, k([]float64{1, 2}, []float64{3, 4}), "Custom kernel should use the spec's parameters")
+
+	assert.Panics(t, func() {
+		RegisterKernel("base.testKernel", func(spec KernelSpec) (func([]float64, []float64) float64, error) {
+			return LinearKernel(), nil
+		})
+	}, "Registering a kernel name twice should panic")
+	assert.Panics(t, func() { RegisterKernel(GaussianKernelName, nil) }, "Registering a nil builder should panic")
+	assert.Panics(t, func() { RegisterKernel("base.nilKernel", nil) }, "Registering a nil builder should panic")
+}
+
+func TestCompositeKernelSpecShouldPass1(t *testing.T) {
+	x := []float64{1, 4, 0.5}
+	y := []float64{2, 0, 1.5}
+
+	spec := ScaleKernelSpec(2, SumKernelSpec(
+		PeriodicKernelSpec(12, 1),
+		ProductKernelSpec(
+			LaplacianKernelSpec(3),
+			ARDGaussianKernelSpec([]float64{1, 2, 3}),
+		),
+		RationalQuadraticKernelSpec(0.5, 2),
+		ChiSquaredKernelSpec(1),
+		HistogramIntersectionKernelSpec(),
+	))
+
+	expected := ScaleKernel(2, SumKernel(
+		PeriodicKernel(12, 1),
+		ProductKernel(
+			LaplacianKernel(3),
+			ARDGaussianKernel([]float64{1, 2, 3}),
+		),
+		RationalQuadraticKernel(0.5, 2),
+		ChiSquaredKernel(1),
+		HistogramIntersectionKernel(),
+	))
+
+	bytes, err := json.Marshal(spec)
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	var restored KernelSpec
+	assert.Nil(t, json.Unmarshal(bytes, &restored), "Unmarshal error should be nil")
+	assert.Equal(t, spec, restored, "Spec should round-trip through JSON")
+
+	k, err := restored.Kernel()
+	assert.Nil(t, err, "Kernel error should be nil")
+	assert.InDelta(t, expected(x, y), k(x, y), 1e-12, "Kernel built from the spec should match the kernel function")
+
+	assert.Equal(t, "sum(linear(), ard_gaussian(length_scales=[1 2]))", SumKernelSpec(LinearKernelSpec(), ARDGaussianKernelSpec([]float64{1, 2})).String(), "Spec should print cleanly")
+}
+
+func TestCompositeKernelSpecShouldFail1(t *testing.T) {
+	_, err := SumKernelSpec().Kernel()
+	assert.NotNil(t, err, "Sum of no kernels should return an error")
+
+	_, err = ScaleKernelSpec(-1, LinearKernelSpec()).Kernel()
+	assert.NotNil(t, err, "Negative scale should return an error")
+
+	_, err = ProductKernelSpec(LinearKernelSpec(), KernelSpec{Name: "not registered"}).Kernel()
+	assert.NotNil(t, err, "Invalid sub kernel should return an error")
+
+	_, err = KernelSpec{Name: ARDGaussianKernelName}.Kernel()
+	assert.NotNil(t, err, "ARD Gaussian kernel without length scales should return an error")
+}
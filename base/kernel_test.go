@@ -233,3 +233,67 @@ func TestTanhKernelShouldPass3(t *testing.T) {
 		1.0, 1.0, 100.0, 0.0,
 	}), 5e-4, "Dot product should be valid")
 }
+
+func TestLaplacianKernelShouldPass1(t *testing.T) {
+	k := LaplacianKernel(2.0)
+
+	assert.InDelta(t, math.Exp(-1*4.0/2), k([]float64{1, -1, 0}, []float64{0, 1, 1}), 1e-9, "Kernel value should match")
+	assert.InDelta(t, 1.0, k([]float64{1, 2}, []float64{1, 2}), 1e-9, "Kernel of a vector with itself should be 1")
+	assert.Equal(t, 0.0, k([]float64{1, 2}, []float64{1}), "Kernel of vectors with different lengths should be 0")
+}
+
+func TestARDGaussianKernelShouldPass1(t *testing.T) {
+	k := ARDGaussianKernel([]float64{1, 10})
+
+	assert.InDelta(t, math.Exp(-1*(4.0/2+100.0/200)), k([]float64{0, 0}, []float64{2, 10}), 1e-9, "Kernel value should match")
+
+	// equal length scales are the Gaussian kernel
+	assert.InDelta(t, GaussianKernel(3)([]float64{1, 5}, []float64{-2, 0}), ARDGaussianKernel([]float64{3, 3})([]float64{1, 5}, []float64{-2, 0}), 1e-9, "Kernel value should match the Gaussian kernel")
+
+	assert.Equal(t, 0.0, k([]float64{1, 2, 3}, []float64{1, 2, 3}), "Kernel of vectors without a length scale per feature should be 0")
+}
+
+func TestRationalQuadraticKernelShouldPass1(t *testing.T) {
+	k := RationalQuadraticKernel(2, 1.5)
+
+	assert.InDelta(t, math.Pow(1+5.0/(2*2*1.5*1.5), -2), k([]float64{0, 0}, []float64{1, 2}), 1e-9, "Kernel value should match")
+
+	// a large alpha approaches the Gaussian kernel
+	assert.InDelta(t, GaussianKernel(1.5)([]float64{0, 0}, []float64{1, 2}), RationalQuadraticKernel(1e6, 1.5)([]float64{0, 0}, []float64{1, 2}), 1e-5, "Kernel value should approach the Gaussian kernel")
+}
+
+func TestPeriodicKernelShouldPass1(t *testing.T) {
+	k := PeriodicKernel(12, 1)
+
+	assert.InDelta(t, 1.0, k([]float64{3}, []float64{27}), 1e-9, "Points a number of periods apart should be identical")
+	assert.InDelta(t, math.Exp(-2), k([]float64{0}, []float64{6}), 1e-9, "Points half a period apart should be least similar")
+}
+
+func TestChiSquaredKernelShouldPass1(t *testing.T) {
+	k := ChiSquaredKernel(0.5)
+
+	assert.InDelta(t, math.Exp(-0.5*(1.0/3+0+4.0/4)), k([]float64{1, 0, 3}, []float64{2, 0, 1}), 1e-9, "Kernel value should match")
+}
+
+func TestHistogramIntersectionKernelShouldPass1(t *testing.T) {
+	k := HistogramIntersectionKernel()
+
+	assert.InDelta(t, 1+0+1, k([]float64{1, 0, 3}, []float64{2, 0, 1}), 1e-9, "Kernel value should match")
+}
+
+func TestKernelCompositionShouldPass1(t *testing.T) {
+	x := []float64{1, 2}
+	y := []float64{-1, 0.5}
+
+	linear := LinearKernel()(x, y)
+	gaussian := GaussianKernel(2)(x, y)
+
+	assert.InDelta(t, linear+gaussian, SumKernel(LinearKernel(), GaussianKernel(2))(x, y), 1e-9, "Sum kernel should add the kernels")
+	assert.InDelta(t, linear*gaussian, ProductKernel(LinearKernel(), GaussianKernel(2))(x, y), 1e-9, "Product kernel should multiply the kernels")
+	assert.InDelta(t, 3*gaussian, ScaleKernel(3, GaussianKernel(2))(x, y), 1e-9, "Scale kernel should scale the kernel")
+	assert.Equal(t, 1.0, ProductKernel()(x, y), "Product of no kernels should be 1")
+
+	for _, scale := range []float64{0, -2, math.NaN()} {
+		assert.InDelta(t, gaussian, ScaleKernel(scale, GaussianKernel(2))(x, y), 1e-9, "Scale kernel should default a scale of %v to 1", scale)
+	}
+}
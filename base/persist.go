@@ -0,0 +1,598 @@
+package base
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PersistFileMode is the file mode models are
+// written with by PersistModel (read/write for the
+// owner, read only for everyone else)
+const PersistFileMode os.FileMode = 0644
+
+// EnvelopeVersion is the current version of the
+// model envelope format written by this package.
+// Envelopes written with a newer version than this
+// will be rejected when restoring, while files
+// written before envelopes existed (bare JSON of the
+// model's parameters) are treated as version 0.
+const EnvelopeVersion = 1
+
+// Envelope is the common, self-describing container
+// that every persistable model in goml is saved in.
+// Rather than writing just the exported parameters of
+// a model, the envelope records which model wrote the
+// data, the hyperparameters the model was built with
+// (learning rate, regularization, kernels, etc.,) the
+// shape of the inputs it expects, some metadata about
+// the training, and a checksum so corrupted files are
+// detected instead of silently loaded.
+//
+// Hyperparameters and Data are stored as raw JSON so
+// each model can decide its own layout. Data always
+// holds the same layout that the model used to write
+// on its own before envelopes were introduced, so old
+// files can still be restored.
+//
+// Example Envelope (for a LeastSquares model):
+//
+//     {
+//         "type": "linear.LeastSquares",
+//         "version": 1,
+//         "hyperparameters": {"alpha":0.0001,"regularization":6,"max_iterations":800,"method":"Batch Gradient Ascent"},
+//         "schema": {"features":2},
+//         "metadata": {"examples":400,"saved_at":"2016-01-01T00:00:00Z"},
+//         "checksum": "sha256:...",
+//         "data": [0.1,1.97,-3.2]
+//     }
+type Envelope struct {
+	// Type is the name the model is registered
+	// under (see RegisterModel)
+	Type string `json:"type"`
+
+	// Version is the version of the envelope format
+	Version int `json:"version"`
+
+	Hyperparameters json.RawMessage  `json:"hyperparameters,omitempty"`
+	Schema          FeatureSchema    `json:"schema"`
+	Metadata        TrainingMetadata `json:"metadata"`
+
+	// Checksum is a SHA-256 hash of the hyperparameters
+	// and data, prefixed with "sha256:"
+	Checksum string `json:"checksum"`
+
+	// Data is empty for envelopes read in the compact
+	// encoding (see MarshalModelCompact,) which hold
+	// their data decoded into Go values instead, so
+	// Decode can copy numeric arrays straight into the
+	// model. Use DataJSON to get the data of any
+	// envelope as JSON.
+	Data json.RawMessage `json:"data"`
+
+	compact *compactData
+}
+
+// FeatureSchema describes the inputs a model expects.
+// Features is the length of the input vector (not
+// including any constant term) and Names optionally
+// holds a name for each of those features.
+type FeatureSchema struct {
+	Features int      `json:"features"`
+	Names    []string `json:"names,omitempty"`
+}
+
+// TrainingMetadata holds information about how the
+// model was trained that isn't needed for prediction
+// but is helpful to have when looking at a persisted
+// model later.
+type TrainingMetadata struct {
+	// Examples is the number of training examples the
+	// model held when it was saved (0 for models that
+	// only learn online)
+	Examples int `json:"examples"`
+
+	// SavedAt is the (UTC) time the envelope was created
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// Persistable is implemented by every model that can
+// be saved within an Envelope. Models use the helper
+// functions in this package (PersistModel, RestoreModel,
+// etc.) to implement PersistToFile and RestoreFromFile
+// on top of these two methods.
+type Persistable interface {
+	// MarshalEnvelope returns an Envelope holding
+	// everything needed to recreate the model
+	MarshalEnvelope() (*Envelope, error)
+
+	// UnmarshalEnvelope sets the model's state to
+	// that held within the given Envelope
+	UnmarshalEnvelope(*Envelope) error
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]func() Persistable{}
+)
+
+// RegisterModel registers a factory function which
+// returns a new, empty model of the given type. Model
+// packages call this within init() so Load can return
+// the right concrete model. This means the package
+// holding the model must be imported (even if only for
+// side effects) before calling Load.
+//
+// RegisterModel panics if the same type is registered
+// twice, or if the factory is nil.
+func RegisterModel(modelType string, factory func() Persistable) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("goml: RegisterModel factory is nil for model type " + modelType)
+	}
+	if _, exists := registry[modelType]; exists {
+		panic("goml: RegisterModel called twice for model type " + modelType)
+	}
+
+	registry[modelType] = factory
+}
+
+// RegisteredModels returns the (sorted) names of all
+// model types which have been registered
+func RegisteredModels() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for modelType := range registry {
+		types = append(types, modelType)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// checksum returns the checksum of the given
+// hyperparameters and data. Both are compacted first
+// so whitespace doesn't change the result.
+func checksum(hyperparameters, data []byte) (string, error) {
+	hash := sha256.New()
+
+	for _, raw := range [][]byte{hyperparameters, data} {
+		err := writeChecksumSection(hash, raw)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return checksumOf(hash), nil
+}
+
+// writeChecksumSection writes the compacted JSON of
+// a section of the checksum to hash
+func writeChecksumSection(h hash.Hash, raw []byte) error {
+	var buf bytes.Buffer
+	if len(raw) != 0 {
+		err := json.Compact(&buf, raw)
+		if err != nil {
+			return err
+		}
+	}
+
+	h.Write(buf.Bytes())
+	endChecksumSection(h)
+	return nil
+}
+
+// endChecksumSection separates the sections of the
+// checksum, so moving bytes from one to the other
+// changes it
+func endChecksumSection(h hash.Hash) {
+	h.Write([]byte{0})
+}
+
+// checksumOf formats the sum of hash as a checksum
+func checksumOf(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Encode marshals the given hyperparameters and
+// data into the envelope, setting the envelope
+// version and checksum (as well as SavedAt if it
+// hasn't been set.) hyperparameters can be nil if
+// the model doesn't have any.
+func (e *Envelope) Encode(hyperparameters, data interface{}) error {
+	var err error
+
+	e.Hyperparameters = nil
+	if hyperparameters != nil {
+		e.Hyperparameters, err = json.Marshal(hyperparameters)
+		if err != nil {
+			return err
+		}
+	}
+
+	e.Data, err = json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	e.Version = EnvelopeVersion
+	if e.Metadata.SavedAt.IsZero() {
+		e.Metadata.SavedAt = time.Now().UTC()
+	}
+
+	e.Checksum, err = checksum(e.Hyperparameters, e.Data)
+	return err
+}
+
+// Legacy returns whether the envelope was created
+// from a file written before envelopes existed. In
+// that case only Data is set.
+func (e *Envelope) Legacy() bool {
+	return e.Version == 0
+}
+
+// Verify checks that the envelope was written for
+// the given model type, by a version of the format
+// this package understands, and that the checksum
+// matches the contents.
+func (e *Envelope) Verify(modelType string) error {
+	if e.Legacy() {
+		return nil
+	}
+
+	if e.Type != modelType {
+		return fmt.Errorf("ERROR: envelope holds a %v model, not a %v model", e.Type, modelType)
+	}
+	if e.Version > EnvelopeVersion {
+		return fmt.Errorf("ERROR: envelope version %v is newer than the newest supported version (%v)", e.Version, EnvelopeVersion)
+	}
+
+	// the checksum of compact envelopes is
+	// computed while their data is decoded
+	var sum string
+	var err error
+	if e.compact != nil {
+		sum = e.compact.checksum
+	} else {
+		sum, err = checksum(e.Hyperparameters, e.Data)
+		if err != nil {
+			return err
+		}
+	}
+	if sum != e.Checksum {
+		return fmt.Errorf("ERROR: envelope checksum does not match its contents! The model is probably corrupted\n\tExpected: %v\n\tFound: %v", e.Checksum, sum)
+	}
+
+	return nil
+}
+
+// Decode verifies the envelope (see Verify) and then
+// unmarshals the hyperparameters and data into the
+// given values. Either can be nil to skip it. The
+// hyperparameters are left untouched when restoring
+// a legacy envelope, because they weren't saved.
+func (e *Envelope) Decode(modelType string, hyperparameters, data interface{}) error {
+	err := e.Verify(modelType)
+	if err != nil {
+		return err
+	}
+
+	if hyperparameters != nil && len(e.Hyperparameters) != 0 {
+		err = json.Unmarshal(e.Hyperparameters, hyperparameters)
+		if err != nil {
+			return err
+		}
+	}
+
+	if data != nil && e.compact != nil {
+		return unmarshalCompact(e.compact.value, data)
+	}
+
+	if data != nil {
+		if len(e.Data) == 0 {
+			return fmt.Errorf("ERROR: envelope for %v model holds no data", modelType)
+		}
+
+		err = json.Unmarshal(e.Data, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DataJSON returns the data of the envelope as JSON.
+// This is Data, unless the envelope was read in the
+// compact encoding, in which case the JSON is written
+// from the decoded data.
+func (e *Envelope) DataJSON() (json.RawMessage, error) {
+	if e.compact == nil {
+		return e.Data, nil
+	}
+
+	var buf bytes.Buffer
+	err := writeCompactJSON(&buf, e.compact.value)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.RawMessage(buf.Bytes()), nil
+}
+
+// ParseEnvelope parses the bytes of a persisted
+// model, which can be either a JSON envelope or a
+// compactly encoded one (see MarshalModelCompact.) If
+// the bytes aren't an envelope (they were written
+// before envelopes existed) a legacy envelope (version
+// 0) is returned with the bytes as its Data.
+func ParseEnvelope(data []byte) (*Envelope, error) {
+	if IsCompact(data) {
+		return readCompact(bufio.NewReader(bytes.NewReader(data)))
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("ERROR: attempting to parse an empty model")
+	}
+
+	if data[0] == '{' {
+		// check for the fields every envelope has
+		// without assuming anything about the data
+		var fields map[string]json.RawMessage
+		err := json.Unmarshal(data, &fields)
+		if err != nil {
+			return nil, err
+		}
+
+		_, hasType := fields["type"]
+		_, hasVersion := fields["version"]
+		_, hasData := fields["data"]
+		if hasType && hasVersion && hasData {
+			env := &Envelope{}
+			err = json.Unmarshal(data, env)
+			if err != nil {
+				return nil, err
+			}
+			if env.Version < 1 {
+				return nil, fmt.Errorf("ERROR: envelope has invalid version %v", env.Version)
+			}
+
+			return env, nil
+		}
+	}
+
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("ERROR: persisted model is neither an envelope nor valid JSON")
+	}
+
+	return &Envelope{
+		Data: json.RawMessage(data),
+	}, nil
+}
+
+// MarshalModel returns the JSON encoded envelope
+// of the given model
+func MarshalModel(p Persistable) ([]byte, error) {
+	env, err := p.MarshalEnvelope()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(env)
+}
+
+// UnmarshalModel parses the given bytes (which can
+// be either an envelope or a legacy persisted model)
+// and restores the model from them
+func UnmarshalModel(data []byte, p Persistable) error {
+	env, err := ParseEnvelope(data)
+	if err != nil {
+		return err
+	}
+
+	return p.UnmarshalEnvelope(env)
+}
+
+// WriteModel writes the envelope of the given model
+// to w, returning the number of bytes written. Models
+// use this to implement io.WriterTo so they can be
+// persisted to any io.Writer (object stores, network
+// connections, etc.) and not only to files.
+func WriteModel(w io.Writer, p Persistable) (int64, error) {
+	bytes, err := MarshalModel(p)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(bytes)
+	return int64(n), err
+}
+
+// ReadModel reads a persisted model from r (until EOF)
+// into the given model, returning the number of bytes
+// read. Models use this to implement io.ReaderFrom.
+func ReadModel(r io.Reader, p Persistable) (int64, error) {
+	env, n, err := ReadEnvelope(r)
+	if err != nil {
+		return n, err
+	}
+
+	return n, p.UnmarshalEnvelope(env)
+}
+
+// WriteFileAtomic writes data to the file at path by
+// first writing it to a temporary file within the same
+// directory and then renaming the temporary file to
+// path. This means a crash (or an error) while writing
+// never leaves a partially written model behind, and
+// readers see either the old file or the new one.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+name+".tmp")
+	if err != nil {
+		return err
+	}
+
+	// clean up the temporary file if anything fails
+	// before the rename
+	renamed := false
+	defer func() {
+		if !renamed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), perm)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return err
+	}
+
+	renamed = true
+	return nil
+}
+
+// PersistModel saves the envelope of the given model
+// to the file at path, which can be restored later
+// with RestoreModel or Load. The file is written
+// atomically (see WriteFileAtomic) with PersistFileMode
+// permissions.
+func PersistModel(path string, p Persistable) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := MarshalModel(p)
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(path, bytes, PersistFileMode)
+}
+
+// RestoreModel reads the model persisted at path
+// (as JSON or in the compact encoding) into the
+// given model.
+func RestoreModel(path string, p Persistable) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	env, err := readEnvelopeFile(path)
+	if err != nil {
+		return err
+	}
+
+	return p.UnmarshalEnvelope(env)
+}
+
+// Load reads the model persisted at path and returns
+// a new model of the concrete type recorded within
+// the envelope, so you don't need to know the type
+// of a model before loading it. Type assert the
+// result to use it:
+//
+//     import (
+//         "github.com/admpub/goml/base"
+//         "github.com/admpub/goml/linear"
+//     )
+//
+//     model, err := base.Load("/tmp/.goml/LeastSquares.json")
+//     if err != nil {
+//         panic("EGATZ!! I FOUND AN ERROR!")
+//     }
+//
+//     leastSquares := model.(*linear.LeastSquares)
+//
+// The package holding the model has to be imported
+// so the model type is registered. Legacy files
+// (written before envelopes existed) can't be loaded
+// this way because they don't record their type; use
+// the model's RestoreFromFile instead.
+func Load(path string) (Persistable, error) {
+	if path == "" {
+		return nil, fmt.Errorf("ERROR: you just tried to load a model from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	env, err := readEnvelopeFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadEnvelope(env)
+}
+
+// LoadFrom is the same as Load, but it reads the
+// persisted model from r (until EOF) rather than
+// from a file.
+func LoadFrom(r io.Reader) (Persistable, error) {
+	env, _, err := ReadEnvelope(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadEnvelope(env)
+}
+
+// LoadEnvelope returns a new model of the type
+// recorded in the envelope, restored from it.
+func LoadEnvelope(env *Envelope) (Persistable, error) {
+	if env.Legacy() {
+		return nil, fmt.Errorf("ERROR: model was persisted without an envelope so its type is unknown. Use the model's RestoreFromFile instead")
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[env.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("ERROR: model type %v is not registered. Did you import the package holding the model?", env.Type)
+	}
+
+	model := factory()
+	err := model.UnmarshalEnvelope(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return model, nil
+}
@@ -0,0 +1,265 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testModel is a minimal Persistable used to test
+// envelopes without depending on the model packages
+type testModel struct {
+	Rate   float64
+	Params []float64
+}
+
+type testHyperparameters struct {
+	Rate float64 `json:"rate"`
+}
+
+func (m *testModel) MarshalEnvelope() (*Envelope, error) {
+	env := &Envelope{
+		Type: "base.testModel",
+		Schema: FeatureSchema{
+			Features: len(m.Params),
+		},
+	}
+
+	err := env.Encode(testHyperparameters{Rate: m.Rate}, m.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+func (m *testModel) UnmarshalEnvelope(env *Envelope) error {
+	hyper := testHyperparameters{Rate: m.Rate}
+	err := env.Decode("base.testModel", &hyper, &m.Params)
+	if err != nil {
+		return err
+	}
+
+	m.Rate = hyper.Rate
+	return nil
+}
+
+func init() {
+	// create the /tmp/.goml/ dir for persistance testing
+	// if it doesn't already exist!
+	err := os.MkdirAll("/tmp/.goml", os.ModePerm)
+	if err != nil {
+		panic(fmt.Sprintf("You should be able to create the directory for goml model persistance testing.\n\tError returned: %v\n", err.Error()))
+	}
+
+	RegisterModel("base.testModel", func() Persistable {
+		return &testModel{}
+	})
+}
+
+func TestEnvelopeRoundTripShouldPass1(t *testing.T) {
+	model := &testModel{
+		Rate:   0.25,
+		Params: []float64{1, -2.5, 3e-7},
+	}
+
+	bytes, err := MarshalModel(model)
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	env, err := ParseEnvelope(bytes)
+	assert.Nil(t, err, "Parse error should be nil")
+	assert.Equal(t, "base.testModel", env.Type, "Envelope type should match")
+	assert.Equal(t, EnvelopeVersion, env.Version, "Envelope version should match")
+	assert.Equal(t, 3, env.Schema.Features, "Envelope schema should match")
+	assert.False(t, env.Metadata.SavedAt.IsZero(), "SavedAt should be set")
+	assert.Contains(t, env.Checksum, "sha256:", "Checksum should be a sha256 hash")
+
+	restored := &testModel{}
+	assert.Nil(t, UnmarshalModel(bytes, restored), "Unmarshal error should be nil")
+	assert.Equal(t, model.Rate, restored.Rate, "Hyperparameters should be restored")
+	assert.Equal(t, model.Params, restored.Params, "Data should be restored")
+}
+
+func TestEnvelopeChecksumShouldFail1(t *testing.T) {
+	model := &testModel{
+		Rate:   0.25,
+		Params: []float64{1, 2, 3},
+	}
+
+	env, err := model.MarshalEnvelope()
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	// tamper with the data
+	env.Data = json.RawMessage(`[1,2,4]`)
+
+	restored := &testModel{}
+	assert.NotNil(t, restored.UnmarshalEnvelope(env), "Checksum mismatch should return an error")
+}
+
+func TestEnvelopeTypeShouldFail1(t *testing.T) {
+	model := &testModel{
+		Params: []float64{1, 2, 3},
+	}
+
+	env, err := model.MarshalEnvelope()
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	assert.NotNil(t, env.Verify("linear.LeastSquares"), "Verifying with the wrong type should return an error")
+}
+
+func TestEnvelopeVersionShouldFail1(t *testing.T) {
+	model := &testModel{
+		Params: []float64{1, 2, 3},
+	}
+
+	env, err := model.MarshalEnvelope()
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	env.Version = EnvelopeVersion + 1
+	assert.NotNil(t, env.Verify("base.testModel"), "Verifying a newer envelope version should return an error")
+}
+
+func TestEnvelopeLegacyShouldPass1(t *testing.T) {
+	restored := &testModel{
+		Rate: 0.5,
+	}
+
+	// bare parameters, as written before envelopes
+	assert.Nil(t, UnmarshalModel([]byte("[4,5,6]\n"), restored), "Unmarshal error should be nil")
+	assert.Equal(t, []float64{4, 5, 6}, restored.Params, "Legacy data should be restored")
+	assert.Equal(t, 0.5, restored.Rate, "Hyperparameters should be untouched when restoring legacy data")
+
+	env, err := ParseEnvelope([]byte(`{"words":{},"count":[1,2]}`))
+	assert.Nil(t, err, "Parsing a legacy object should not return an error")
+	assert.True(t, env.Legacy(), "Envelope should be legacy")
+}
+
+func TestEnvelopeParseShouldFail1(t *testing.T) {
+	_, err := ParseEnvelope([]byte(""))
+	assert.NotNil(t, err, "Parsing empty bytes should return an error")
+
+	_, err = ParseEnvelope([]byte("not json"))
+	assert.NotNil(t, err, "Parsing invalid JSON should return an error")
+}
+
+func TestLoadShouldPass1(t *testing.T) {
+	model := &testModel{
+		Rate:   1e-4,
+		Params: []float64{0.1, 0.2},
+	}
+
+	assert.Nil(t, PersistModel("/tmp/.goml/TestModel.json", model), "Persist error should be nil")
+
+	loaded, err := Load("/tmp/.goml/TestModel.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*testModel)
+	assert.True(t, ok, "Loaded model should be a *testModel")
+	assert.Equal(t, model, restored, "Loaded model should match the persisted one")
+
+	assert.Contains(t, RegisteredModels(), "base.testModel", "Test model should be registered")
+}
+
+func TestLoadShouldFail1(t *testing.T) {
+	_, err := Load("")
+	assert.NotNil(t, err, "Loading an empty path should return an error")
+
+	// legacy files don't know their type
+	err = ioutil.WriteFile("/tmp/.goml/TestModelLegacy.json", []byte("[1,2,3]"), 0644)
+	assert.Nil(t, err, "Write error should be nil")
+
+	_, err = Load("/tmp/.goml/TestModelLegacy.json")
+	assert.NotNil(t, err, "Loading a legacy model should return an error")
+
+	// unregistered types can't be loaded
+	env := &Envelope{Type: "base.notRegistered"}
+	assert.Nil(t, env.Encode(nil, []float64{1}), "Encode error should be nil")
+
+	_, err = LoadEnvelope(env)
+	assert.NotNil(t, err, "Loading an unregistered model should return an error")
+}
+
+func TestRegisterModelShouldFail1(t *testing.T) {
+	assert.Panics(t, func() {
+		RegisterModel("base.testModel", func() Persistable {
+			return &testModel{}
+		})
+	}, "Registering a model type twice should panic")
+}
+
+func TestWriteModelShouldPass1(t *testing.T) {
+	model := &testModel{
+		Rate:   0.75,
+		Params: []float64{-1, 0, 1},
+	}
+
+	var buf bytes.Buffer
+	n, err := WriteModel(&buf, model)
+	assert.Nil(t, err, "Write error should be nil")
+	assert.EqualValues(t, buf.Len(), n, "Written byte count should match the buffer length")
+
+	restored := &testModel{}
+	read, err := ReadModel(bytes.NewReader(buf.Bytes()), restored)
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, n, read, "Read byte count should match the written byte count")
+	assert.Equal(t, model, restored, "Restored model should match the written one")
+
+	loaded, err := LoadFrom(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err, "Load error should be nil")
+	assert.Equal(t, model, loaded, "Loaded model should match the written one")
+}
+
+func TestWriteFileAtomicShouldPass1(t *testing.T) {
+	dir, err := ioutil.TempDir("/tmp/.goml", "atomic")
+	assert.Nil(t, err, "Temp dir error should be nil")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "model.json")
+
+	assert.Nil(t, WriteFileAtomic(path, []byte("first"), PersistFileMode), "Write error should be nil")
+	assert.Nil(t, WriteFileAtomic(path, []byte("second"), PersistFileMode), "Overwrite error should be nil")
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, "second", string(data), "File should hold the last write")
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err, "Stat error should be nil")
+	assert.Equal(t, PersistFileMode, info.Mode().Perm(), "File should be written with PersistFileMode")
+
+	// no temporary files should be left behind
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err, "Read dir error should be nil")
+	assert.Len(t, files, 1, "Only the model file should be in the directory")
+}
+
+func TestWriteFileAtomicShouldFail1(t *testing.T) {
+	err := WriteFileAtomic("/tmp/.goml/does/not/exist/model.json", []byte("data"), PersistFileMode)
+	assert.NotNil(t, err, "Writing into a missing directory should return an error")
+
+	// a failed rename shouldn't leave the temporary
+	// file behind
+	dir, err := ioutil.TempDir("/tmp/.goml", "atomic")
+	assert.Nil(t, err, "Temp dir error should be nil")
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "target")
+	assert.Nil(t, os.Mkdir(target, os.ModePerm), "Mkdir error should be nil")
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(target, "file"), []byte("x"), 0644), "Write error should be nil")
+
+	err = WriteFileAtomic(target, []byte("data"), PersistFileMode)
+	assert.NotNil(t, err, "Replacing a non-empty directory should return an error")
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err, "Read dir error should be nil")
+	for _, file := range files {
+		assert.False(t, strings.Contains(file.Name(), ".tmp"), "Temporary files should be removed")
+	}
+}
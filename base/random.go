@@ -0,0 +1,56 @@
+package base
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Randomized is implemented by models whose learning
+// is randomized (like the k-means++ instantiation of
+// K-Means or the shuffled passes of the Perceptron.)
+// Models never touch the global math/rand source:
+// each one draws from its own, which is seeded from
+// the current time unless you seed it yourself to
+// make learning reproducible.
+//
+//     model := cluster.NewKMeans(4, 15, data)
+//
+//     // every call to Learn with the same seed
+//     // and data finds the same clusters
+//     model.UpdateSeed(42)
+//     err := model.Learn()
+//
+// Sources aren't safe for concurrent use, so models
+// shouldn't share one with UpdateRandom while learning
+// in different goroutines.
+type Randomized interface {
+	// UpdateSeed replaces the model's source of
+	// randomness with a new one seeded with the
+	// given seed
+	UpdateSeed(int64)
+
+	// UpdateRandom replaces the model's source
+	// of randomness with the given one
+	UpdateRandom(*rand.Rand)
+}
+
+// seeds counts the time seeded sources created so
+// sources created within the same clock tick still
+// get different seeds
+var seeds int64
+
+// NewRandom returns a new source of randomness seeded
+// with the given seed
+func NewRandom(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
+
+// NewTimeSeededRandom returns a new source of randomness
+// seeded from the current time. Every call returns a
+// source with a different seed, even when called within
+// the same clock tick. Randomized models use one until
+// they're given a seed.
+func NewTimeSeededRandom() *rand.Rand {
+	return NewRandom(time.Now().UnixNano() + atomic.AddInt64(&seeds, 1)*1e9)
+}
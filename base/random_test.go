@@ -0,0 +1,18 @@
+package base
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomShouldPass1(t *testing.T) {
+	r1, r2 := NewRandom(42), NewRandom(42)
+	assert.Equal(t, r1.Perm(100), r2.Perm(100), "Sources with the same seed should draw the same numbers")
+	assert.Equal(t, r1.Float64(), r2.Float64(), "Sources with the same seed should draw the same numbers")
+
+	// sources created back to back (within the
+	// same clock tick) still get different seeds
+	r1, r2 = NewTimeSeededRandom(), NewTimeSeededRandom()
+	assert.NotEqual(t, r1.Perm(100), r2.Perm(100), "Time seeded sources should draw different numbers")
+}
@@ -0,0 +1,282 @@
+package cluster
+
+import (
+	"math"
+
+	"github.com/admpub/goml/base"
+)
+
+// BallTree is a SpatialIndex which recursively splits
+// the points in two groups, each bounded by a ball (a
+// center and the distance to its furthest point.) By the
+// triangle inequality no point in a ball can be nearer
+// to the query point than the distance to the center
+// minus the radius, so a query skips every ball which
+// is further than the neighbors found so far.
+//
+// https://en.wikipedia.org/wiki/Ball_tree
+//
+// The tree is exact for any metric (any distance
+// following the triangle inequality,) and holds up
+// better than a KDTree as the number of dimensions
+// grows.
+type BallTree struct {
+	Distance base.DistanceMeasure
+
+	points [][]float64
+	root   *ballNode
+
+	// nodes is the number of nodes of the tree
+	nodes int
+}
+
+// ballNode is a node of a BallTree. Every node knows
+// the ball bounding its points, and leaves hold the
+// indices of their points. Nodes are numbered by id,
+// in the order they're built.
+type ballNode struct {
+	id int
+
+	center []float64
+	radius float64
+
+	left  *ballNode
+	right *ballNode
+
+	indices []int
+}
+
+// NewBallTree builds a BallTree over the given points,
+// splitting nodes until they hold at most leafSize
+// points (DefaultLeafSize if leafSize < 1)
+func NewBallTree(points [][]float64, distance base.DistanceMeasure, leafSize int) *BallTree {
+	if leafSize < 1 {
+		leafSize = DefaultLeafSize
+	}
+
+	indices := make([]int, len(points))
+	for i := range indices {
+		indices[i] = i
+	}
+
+	tree := &BallTree{
+		Distance: distance,
+		points:   points,
+	}
+	if len(points) != 0 {
+		tree.root = tree.build(indices, leafSize)
+	}
+
+	return tree
+}
+
+// build returns the subtree holding the given points
+func (t *BallTree) build(indices []int, leafSize int) *ballNode {
+	// the center of the ball is the mean of its
+	// points, and its radius the distance to the
+	// furthest one
+	center := make([]float64, len(t.points[indices[0]]))
+	for _, i := range indices {
+		for j := range center {
+			center[j] += t.points[i][j]
+		}
+	}
+	for j := range center {
+		center[j] /= float64(len(indices))
+	}
+
+	node := &ballNode{
+		id:     t.nodes,
+		center: center,
+	}
+	t.nodes++
+
+	furthest := indices[0]
+	for _, i := range indices {
+		d := t.Distance(center, t.points[i])
+		if d > node.radius {
+			node.radius = d
+			furthest = i
+		}
+	}
+
+	if len(indices) <= leafSize || node.radius == 0 {
+		node.indices = indices
+		return node
+	}
+
+	// split the points between the point furthest from
+	// the center (a) and the point furthest from a (b,)
+	// each point going to the closest of the two
+	a := furthest
+	b := a
+	distancesToA := make([]float64, len(indices))
+	var furthestDistance float64
+	for s, i := range indices {
+		distancesToA[s] = t.Distance(t.points[a], t.points[i])
+		if distancesToA[s] > furthestDistance {
+			furthestDistance = distancesToA[s]
+			b = i
+		}
+	}
+
+	var left, right []int
+	for s, i := range indices {
+		if distancesToA[s] <= t.Distance(t.points[b], t.points[i]) {
+			left = append(left, i)
+		} else {
+			right = append(right, i)
+		}
+	}
+
+	// the split can only be one sided if the distance
+	// isn't a metric, so fall back to a leaf
+	if len(left) == 0 || len(right) == 0 {
+		node.indices = indices
+		return node
+	}
+
+	node.left = t.build(left, leafSize)
+	node.right = t.build(right, leafSize)
+
+	return node
+}
+
+// lowerBound returns the smallest distance a point
+// within the ball of node could be from x, given the
+// distance d from x to the center of the ball
+func (node *ballNode) lowerBound(d float64) float64 {
+	return math.Max(0, d-node.radius)
+}
+
+// KNearest returns the k points nearest to x
+func (t *BallTree) KNearest(x []float64, k int) []Neighbor {
+	h := newNeighborHeap(k)
+	if t.root != nil && k > 0 {
+		t.kNearest(t.root, x, t.Distance(x, t.root.center), h)
+	}
+
+	return h.sorted()
+}
+
+// kNearest searches the subtree at node, given the
+// distance d from x to the center of node
+func (t *BallTree) kNearest(node *ballNode, x []float64, d float64, h *neighborHeap) {
+	if node.lowerBound(d) > h.bound() {
+		return
+	}
+
+	if node.indices != nil {
+		for _, i := range node.indices {
+			h.offer(i, t.Distance(x, t.points[i]))
+		}
+		return
+	}
+
+	// search the child whose center is closest first
+	dLeft := t.Distance(x, node.left.center)
+	dRight := t.Distance(x, node.right.center)
+	if dLeft <= dRight {
+		t.kNearest(node.left, x, dLeft, h)
+		t.kNearest(node.right, x, dRight, h)
+	} else {
+		t.kNearest(node.right, x, dRight, h)
+		t.kNearest(node.left, x, dLeft, h)
+	}
+}
+
+// Radius returns every point within distance r of x
+func (t *BallTree) Radius(x []float64, r float64) []Neighbor {
+	var neighbors []Neighbor
+	if t.root != nil {
+		neighbors = t.radius(t.root, x, r, neighbors)
+	}
+
+	sortNeighbors(neighbors)
+	return neighbors
+}
+
+func (t *BallTree) radius(node *ballNode, x []float64, r float64, neighbors []Neighbor) []Neighbor {
+	d := t.Distance(x, node.center)
+	if node.lowerBound(d) > r {
+		return neighbors
+	}
+
+	if node.indices != nil {
+		for _, i := range node.indices {
+			d := t.Distance(x, t.points[i])
+			if d <= r {
+				neighbors = append(neighbors, Neighbor{Index: i, Distance: d})
+			}
+		}
+		return neighbors
+	}
+
+	neighbors = t.radius(node.left, x, r, neighbors)
+	return t.radius(node.right, x, r, neighbors)
+}
+
+// Len returns the number of indexed points
+func (t *BallTree) Len() int {
+	return len(t.points)
+}
+
+// labelNodes labels every node of the tree for the
+// searches of Borůvka's algorithm (see componentIndex)
+func (t *BallTree) labelNodes(s *componentSearch) {
+	s.resizeNodes(t.nodes)
+	if t.root != nil {
+		t.label(t.root, s)
+	}
+}
+
+func (t *BallTree) label(node *ballNode, s *componentSearch) {
+	s.startNode(node.id)
+	if node.indices != nil {
+		for _, i := range node.indices {
+			s.addPoint(node.id, i)
+		}
+		return
+	}
+
+	t.label(node.left, s)
+	t.label(node.right, s)
+	s.addChild(node.id, node.left.id)
+	s.addChild(node.id, node.right.id)
+}
+
+// nearestOutside searches for the lightest edge from x
+// out of its component (see componentIndex)
+func (t *BallTree) nearestOutside(x []float64, s *componentSearch) {
+	if t.root != nil {
+		t.outside(t.root, x, t.Distance(x, t.root.center), s)
+	}
+}
+
+// outside searches the subtree at node, given the
+// distance d from x to the center of node
+func (t *BallTree) outside(node *ballNode, x []float64, d float64, s *componentSearch) {
+	if s.prune(node.id, node.lowerBound(d)) {
+		return
+	}
+
+	if node.indices != nil {
+		for _, i := range node.indices {
+			if s.candidate(i) {
+				s.offer(i, t.Distance(x, t.points[i]))
+			}
+		}
+		return
+	}
+
+	// search the child whose center is closest first
+	dLeft := t.Distance(x, node.left.center)
+	dRight := t.Distance(x, node.right.center)
+	if dLeft <= dRight {
+		t.outside(node.left, x, dLeft, s)
+		t.outside(node.right, x, dRight, s)
+	} else {
+		t.outside(node.right, x, dRight, s)
+		t.outside(node.left, x, dLeft, s)
+	}
+}
@@ -0,0 +1,34 @@
+package cluster
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBallTreeShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(83))
+	points := randomPoints(r, 1000, 12)
+
+	for _, leafSize := range []int{0, 1, 5, 50} {
+		tree := NewBallTree(points, base.EuclideanDistance, leafSize)
+		assertSameQueries(t, tree, points, base.EuclideanDistance, r, "Ball tree")
+	}
+
+	tree := NewBallTree(points, base.MinkowskiDistance(3), 10)
+	assertSameQueries(t, tree, points, base.MinkowskiDistance(3), r, "Ball tree (Minkowski)")
+}
+
+func TestBallTreeShouldPass2(t *testing.T) {
+	points := [][]float64{}
+	for i := 0; i < 100; i++ {
+		points = append(points, []float64{3, 3})
+	}
+
+	tree := NewBallTree(points, base.EuclideanDistance, 4)
+	assert.Len(t, tree.KNearest([]float64{0, 0}, 7), 7, "Ball tree should handle duplicate points")
+	assert.Len(t, tree.Radius([]float64{3, 4}, 1), 100, "Ball tree should handle duplicate points")
+}
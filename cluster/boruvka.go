@@ -0,0 +1,255 @@
+package cluster
+
+import (
+	"math"
+)
+
+// mstEdge is an edge of a minimum spanning tree: the
+// two points it joins and its weight
+type mstEdge struct {
+	a, b     int
+	distance float64
+}
+
+// less orders edges by weight, ties going to the edge
+// with the lowest points. The order is total, so every
+// graph has a single minimum spanning tree under it,
+// whichever algorithm finds it.
+func (e mstEdge) less(o mstEdge) bool {
+	if e.distance != o.distance {
+		return e.distance < o.distance
+	}
+
+	eLow, eHigh := e.a, e.b
+	if eLow > eHigh {
+		eLow, eHigh = eHigh, eLow
+	}
+	oLow, oHigh := o.a, o.b
+	if oLow > oHigh {
+		oLow, oHigh = oHigh, oLow
+	}
+
+	if eLow != oLow {
+		return eLow < oLow
+	}
+
+	return eHigh < oHigh
+}
+
+// componentIndex is a SpatialIndex which can search for
+// the nearest point outside of a component of points,
+// skipping the parts of the index holding only points
+// of that component. Borůvka's algorithm builds minimum
+// spanning trees with it (see boruvka.)
+type componentIndex interface {
+	SpatialIndex
+
+	// labelNodes labels every node of the index with
+	// the component of its points and their smallest
+	// weight (see componentSearch)
+	labelNodes(s *componentSearch)
+
+	// nearestOutside offers s every point outside of
+	// the component of x which could be joined to x by
+	// an edge lighter than the best one found so far
+	nearestOutside(x []float64, s *componentSearch)
+}
+
+// node components which aren't the component of
+// any point
+const (
+	// mixedComponent labels nodes holding points
+	// of several components
+	mixedComponent = -1
+
+	// emptyComponent labels nodes holding no points
+	emptyComponent = -2
+)
+
+// componentSearch holds the state of the searches of
+// Borůvka's algorithm over a componentIndex. The weight
+// of the edge between points a and b is the largest of
+// their distance, weight[a] and weight[b] (their core
+// distances, for the mutual reachability distance.)
+type componentSearch struct {
+	component []int
+	weight    []float64
+
+	// nodeComponent holds the component of the
+	// points of every node of the index (or one of
+	// the labels above,) and nodeWeight their
+	// smallest weight
+	nodeComponent []int
+	nodeWeight    []float64
+
+	// point is the point searched from, and best
+	// the lightest edge out of its component found
+	// so far (if found)
+	point int
+	best  mstEdge
+	found bool
+}
+
+// resizeNodes makes room for the labels of the given
+// number of nodes
+func (s *componentSearch) resizeNodes(nodes int) {
+	if len(s.nodeComponent) != nodes {
+		s.nodeComponent = make([]int, nodes)
+		s.nodeWeight = make([]float64, nodes)
+	}
+}
+
+// startNode clears the label of the node, before its
+// points and children are added
+func (s *componentSearch) startNode(node int) {
+	s.nodeComponent[node] = emptyComponent
+	s.nodeWeight[node] = math.Inf(1)
+}
+
+// addLabel adds points of the given component and
+// smallest weight to the label of the node
+func (s *componentSearch) addLabel(node, component int, weight float64) {
+	switch s.nodeComponent[node] {
+	case emptyComponent:
+		s.nodeComponent[node] = component
+	case component:
+	default:
+		if component != emptyComponent {
+			s.nodeComponent[node] = mixedComponent
+		}
+	}
+
+	s.nodeWeight[node] = math.Min(s.nodeWeight[node], weight)
+}
+
+// addPoint adds the point to the label of the node
+func (s *componentSearch) addPoint(node, i int) {
+	s.addLabel(node, s.component[i], s.weight[i])
+}
+
+// addChild adds the points of the child node to the
+// label of the node
+func (s *componentSearch) addChild(node, child int) {
+	s.addLabel(node, s.nodeComponent[child], s.nodeWeight[child])
+}
+
+// prune returns whether a node (given the smallest
+// distance its points could be from the searched point)
+// can't hold a point joined to it by a lighter edge
+func (s *componentSearch) prune(node int, lowerBound float64) bool {
+	if s.nodeComponent[node] == s.component[s.point] {
+		return true
+	}
+
+	return s.found && math.Max(lowerBound, math.Max(s.weight[s.point], s.nodeWeight[node])) > s.best.distance
+}
+
+// candidate returns whether the point could be joined
+// to the searched point by a lighter edge, before its
+// distance is computed
+func (s *componentSearch) candidate(i int) bool {
+	if s.component[i] == s.component[s.point] {
+		return false
+	}
+
+	return !s.found || s.weight[i] <= s.best.distance
+}
+
+// offer keeps the edge to the point at the given
+// distance if it's the lightest found so far
+func (s *componentSearch) offer(i int, distance float64) {
+	if !s.candidate(i) {
+		return
+	}
+
+	edge := mstEdge{
+		a:        s.point,
+		b:        i,
+		distance: math.Max(distance, math.Max(s.weight[s.point], s.weight[i])),
+	}
+	if !s.found || edge.less(s.best) {
+		s.best = edge
+		s.found = true
+	}
+}
+
+// boruvka returns the edges of the minimum spanning
+// tree of the points of the index, where the weight of
+// the edge between points a and b is the largest of
+// their distance, weight[a] and weight[b]. Every round
+// of Borůvka's algorithm adds the lightest edge out of
+// every component, at least halving the number of
+// components, and the searches for those edges skip
+// every node of the index holding only points of the
+// component searched from.
+//
+// The second value is false if the points couldn't be
+// joined (only possible with distances the index isn't
+// exact for.)
+func boruvka(index componentIndex, points [][]float64, weight []float64) ([]mstEdge, bool) {
+	n := len(points)
+
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	s := &componentSearch{
+		component: make([]int, n),
+		weight:    weight,
+	}
+	best := make([]mstEdge, n)
+	found := make([]bool, n)
+
+	edges := make([]mstEdge, 0, n-1)
+	for len(edges) < n-1 {
+		for i := range s.component {
+			s.component[i] = find(i)
+			found[i] = false
+		}
+		index.labelNodes(s)
+
+		// find the lightest edge out of every component,
+		// starting every search from the lightest edge
+		// out of the component found so far
+		for i, x := range points {
+			c := s.component[i]
+			s.point = i
+			s.best, s.found = best[c], found[c]
+			index.nearestOutside(x, s)
+
+			best[c], found[c] = s.best, s.found
+		}
+
+		joined := false
+		for c := range best {
+			if !found[c] {
+				continue
+			}
+
+			// both components of an edge can pick it
+			a, b := find(best[c].a), find(best[c].b)
+			if a == b {
+				continue
+			}
+
+			parent[b] = a
+			edges = append(edges, best[c])
+			joined = true
+		}
+
+		if !joined {
+			return edges, false
+		}
+	}
+
+	return edges, true
+}
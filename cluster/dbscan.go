@@ -0,0 +1,599 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/admpub/goml/base"
+)
+
+// Noise is the label density based models (DBSCAN and
+// HDBSCAN) give points which don't belong to any
+// cluster. The clustering metrics leave it out.
+const Noise = -1
+
+/*
+DBSCAN implements Density-Based Spatial Clustering of
+Applications with Noise. Unlike K-Means it doesn't need
+the number of clusters, finds clusters of any shape, and
+leaves points in sparse regions out of every cluster
+(labelling them as Noise) instead of forcing them into
+the nearest one.
+
+A point is a core point if at least minPoints points
+(itself included) are within distance ε of it. Clusters
+are grown from core points: every point within ε of a
+core point joins its cluster, and core points joining
+a cluster grow it further. Points within ε of a core
+point which aren't core points themselves are border
+points, and points which aren't within ε of any core
+point are noise.
+
+The ε-neighborhoods are found with a spatial index (see
+UpdateIndex,) so any base.DistanceMeasure can be used.
+
+Paper: https://www.aaai.org/Papers/KDD/1996/KDD96-037.pdf
+
+Example DBSCAN Model Usage:
+
+	model := NewDBSCAN(0.5, 5, data, base.EuclideanDistance)
+
+	// search a KD-tree for neighborhoods instead of
+	// comparing every pair of points
+	err := model.UpdateIndex(KDTreeIndex)
+	if err != nil {
+		panic("index error")
+	}
+
+	err = model.Learn()
+	if err != nil {
+		panic("learning error")
+	}
+
+	// cluster labels, with Noise (-1) for noise
+	labels := model.Guesses()
+
+	// whether every point is a core point
+	core := model.Core()
+
+	// new points join the cluster of a core point
+	// within ε of them, or are noise
+	guess, err := model.Predict([]float64{4.2, -1.3})
+*/
+type DBSCAN struct {
+	// Distance holds the distance
+	// measure between points
+	Distance base.DistanceMeasure
+
+	// DistanceSpec describes the distance of the
+	// model when it was created from (or updated
+	// with) a base.DistanceSpec. Models with a
+	// DistanceSpec persist their distance, so
+	// restored models don't need it set again.
+	DistanceSpec *base.DistanceSpec `json:"distance,omitempty"`
+
+	// epsilon is the radius of the neighborhoods,
+	// and minPoints the number of points within
+	// epsilon of a point for it to be a core point
+	epsilon   float64
+	minPoints int
+
+	// trainingSet holds the points to cluster,
+	// guesses the label of every point and core
+	// whether every point is a core point
+	trainingSet [][]float64
+	guesses     []int
+	core        []bool
+
+	// corePoints and coreLabels hold the core
+	// points found while learning, which is all
+	// Predict needs, and coreIndex the spatial
+	// index built over them
+	corePoints [][]float64
+	coreLabels []int
+	coreIndex  SpatialIndex
+
+	// indexType is the kind of spatial index
+	// searched for neighborhoods
+	indexType IndexType
+
+	// Output is the io.Writer to write
+	// logging to. Defaults to os.Stdout
+	// but can be changed to any io.Writer
+	Output io.Writer
+}
+
+// NewDBSCAN returns a pointer to a DBSCAN model with
+// neighborhoods of radius epsilon under the given
+// distance, in which a point needs minPoints points
+// (itself included) to be a core point. Neighborhoods
+// are found by comparing points with every point
+// (BruteForceIndex.) Use UpdateIndex to search a tree
+// built over the training set instead.
+func NewDBSCAN(epsilon float64, minPoints int, trainingSet [][]float64, distance base.DistanceMeasure) *DBSCAN {
+	return &DBSCAN{
+		Distance: distance,
+
+		epsilon:   epsilon,
+		minPoints: minPoints,
+
+		trainingSet: trainingSet,
+
+		indexType: BruteForceIndex,
+
+		Output: os.Stdout,
+	}
+}
+
+// NewDBSCANFromSpec returns a new model using the
+// distance described by the given spec, which is
+// persisted with the model. An error is returned if the
+// spec doesn't describe a valid distance.
+func NewDBSCANFromSpec(epsilon float64, minPoints int, trainingSet [][]float64, spec base.DistanceSpec) (*DBSCAN, error) {
+	distance, err := spec.Distance()
+	if err != nil {
+		return nil, err
+	}
+
+	model := NewDBSCAN(epsilon, minPoints, trainingSet, distance)
+	model.DistanceSpec = &spec
+
+	return model, nil
+}
+
+// UpdateDistance sets the distance of the model to the
+// one described by the given spec. Learn again to
+// cluster with the new distance.
+func (d *DBSCAN) UpdateDistance(spec base.DistanceSpec) error {
+	distance, err := spec.Distance()
+	if err != nil {
+		return err
+	}
+
+	d.Distance = distance
+	d.DistanceSpec = &spec
+
+	return d.buildCoreIndex()
+}
+
+// UpdateTrainingSet takes in a new training set (variable x.)
+//
+// Will reset the labels of the model until it learns
+// again.
+func (d *DBSCAN) UpdateTrainingSet(trainingSet [][]float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("ERROR: length of given training set is 0! Need data!")
+	}
+
+	d.trainingSet = trainingSet
+	d.guesses = nil
+	d.core = nil
+
+	return nil
+}
+
+// UpdateIndex sets the kind of spatial index searched
+// for neighborhoods, while learning and predicting. The
+// tree indexes find the exact neighborhoods, while the
+// approximate HNSWIndex and LSHIndex may miss some
+// neighbors of a point.
+func (d *DBSCAN) UpdateIndex(indexType IndexType) error {
+	switch indexType {
+	case BruteForceIndex, KDTreeIndex, BallTreeIndex, VPTreeIndex, HNSWIndex, LSHIndex:
+	default:
+		return fmt.Errorf("ERROR: Unknown spatial index type '%v'", indexType)
+	}
+
+	old := d.indexType
+	d.indexType = indexType
+
+	err := d.buildCoreIndex()
+	if err != nil {
+		d.indexType = old
+		return err
+	}
+
+	return nil
+}
+
+// Index returns the kind of spatial index searched
+// for neighborhoods
+func (d *DBSCAN) Index() IndexType {
+	return d.indexType
+}
+
+// Epsilon returns the radius of the neighborhoods
+func (d *DBSCAN) Epsilon() float64 {
+	return d.epsilon
+}
+
+// MinPoints returns the number of points (itself
+// included) within ε of a point for it to be a core
+// point
+func (d *DBSCAN) MinPoints() int {
+	return d.minPoints
+}
+
+// Examples returns the number of training examples (m)
+// that the model currently is training from.
+func (d *DBSCAN) Examples() int {
+	return len(d.trainingSet)
+}
+
+// buildCoreIndex builds the spatial index over the core
+// points Predict searches, if there are any
+func (d *DBSCAN) buildCoreIndex() error {
+	d.coreIndex = nil
+	if len(d.corePoints) == 0 || d.Distance == nil {
+		return nil
+	}
+
+	index, err := NewIndex(d.indexType, d.corePoints, d.Distance)
+	if err != nil {
+		return err
+	}
+
+	d.coreIndex = index
+
+	return nil
+}
+
+// validateDensity checks density based models have a
+// distance and a training set of points with the same
+// number of features
+func validateDensity(trainingSet [][]float64, distance base.DistanceMeasure) error {
+	if distance == nil {
+		return fmt.Errorf("ERROR: Attempting to learn without a distance measure!")
+	}
+
+	if len(trainingSet) == 0 || len(trainingSet[0]) == 0 {
+		return fmt.Errorf("ERROR: Attempting to learn with no training examples!")
+	}
+
+	for i := range trainingSet {
+		if len(trainingSet[i]) != len(trainingSet[0]) {
+			return fmt.Errorf("ERROR: training example %v has %v features - expected %v", i, len(trainingSet[i]), len(trainingSet[0]))
+		}
+	}
+
+	return nil
+}
+
+// Learn clusters the training set. Points are visited in
+// order, so a border point within ε of core points of
+// different clusters joins the cluster found first.
+func (d *DBSCAN) Learn() error {
+	err := validateDensity(d.trainingSet, d.Distance)
+	if err == nil && (d.epsilon <= 0 || d.minPoints < 1) {
+		err = fmt.Errorf("ERROR: DBSCAN needs ε > 0 and at least 1 point per neighborhood - given ε = %v and %v points", d.epsilon, d.minPoints)
+	}
+	if err != nil {
+		fmt.Fprintf(d.Output, err.Error()+"\n")
+		return err
+	}
+
+	examples := len(d.trainingSet)
+
+	fmt.Fprintf(d.Output, "Training:\n\tModel: DBSCAN Clustering\n\tTraining Examples: %v\n\tFeatures: %v\n\tε: %v\n\tMin Points: %v\n\tIndex: %v\n...\n\n", examples, len(d.trainingSet[0]), d.epsilon, d.minPoints, d.indexType)
+
+	index, err := NewIndex(d.indexType, d.trainingSet, d.Distance)
+	if err != nil {
+		fmt.Fprintf(d.Output, err.Error()+"\n")
+		return err
+	}
+
+	// find every neighborhood once, to tell the
+	// core points apart before growing clusters
+	neighborhoods := make([][]Neighbor, examples)
+	core := make([]bool, examples)
+	for i, x := range d.trainingSet {
+		neighborhoods[i] = index.Radius(x, d.epsilon)
+		core[i] = len(neighborhoods[i]) >= d.minPoints
+	}
+
+	guesses := make([]int, examples)
+	for i := range guesses {
+		guesses[i] = Noise
+	}
+
+	clusters := 0
+	for i := range d.trainingSet {
+		if !core[i] || guesses[i] != Noise {
+			continue
+		}
+
+		// grow a new cluster from the core point with
+		// a breadth first search over core points
+		guesses[i] = clusters
+		queue := []int{i}
+		for len(queue) != 0 {
+			p := queue[0]
+			queue = queue[1:]
+
+			for _, neighbor := range neighborhoods[p] {
+				if guesses[neighbor.Index] != Noise {
+					continue
+				}
+
+				guesses[neighbor.Index] = clusters
+				if core[neighbor.Index] {
+					queue = append(queue, neighbor.Index)
+				}
+			}
+		}
+
+		clusters++
+	}
+
+	d.guesses = guesses
+	d.core = core
+
+	d.corePoints = nil
+	d.coreLabels = nil
+	for i := range core {
+		if core[i] {
+			d.corePoints = append(d.corePoints, d.trainingSet[i])
+			d.coreLabels = append(d.coreLabels, guesses[i])
+		}
+	}
+
+	err = d.buildCoreIndex()
+	if err != nil {
+		fmt.Fprintf(d.Output, err.Error()+"\n")
+		return err
+	}
+
+	fmt.Fprintf(d.Output, "Training Completed.\n%v\n", d)
+
+	return nil
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns the cluster of the nearest core point if it's
+// within ε of x (so x would have been in that cluster had
+// it been in the training set,) or Noise otherwise
+//
+// if normalize is given as true, then the input will
+// first be normalized to unit length. Only use this if
+// you trained off of normalized inputs and are feeding
+// an un-normalized input
+func (d *DBSCAN) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if d.coreIndex == nil {
+		if d.Distance == nil {
+			return nil, fmt.Errorf("ERROR: Attempting to predict without a distance measure!")
+		}
+		if len(d.corePoints) == 0 {
+			return []float64{Noise}, nil
+		}
+
+		err := d.buildCoreIndex()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(x) != len(d.corePoints[0]) {
+		return nil, fmt.Errorf("ERROR: input vector should have %v features - given %v", len(d.corePoints[0]), len(x))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	nearest := d.coreIndex.KNearest(x, 1)
+	if len(nearest) == 0 || nearest[0].Distance > d.epsilon {
+		return []float64{Noise}, nil
+	}
+
+	return []float64{float64(d.coreLabels[nearest[0].Index])}, nil
+}
+
+// Guesses returns the cluster of every training
+// example found while learning, with Noise (-1) for
+// noise
+func (d *DBSCAN) Guesses() []int {
+	return d.guesses
+}
+
+// Core returns whether every training example is a
+// core point
+func (d *DBSCAN) Core() []bool {
+	return d.core
+}
+
+// Clusters returns the number of clusters found
+// while learning
+func (d *DBSCAN) Clusters() int {
+	clusters := 0
+	for _, label := range d.coreLabels {
+		if label+1 > clusters {
+			clusters = label + 1
+		}
+	}
+
+	return clusters
+}
+
+// String implements the fmt interface for clean printing
+func (d *DBSCAN) String() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("DBSCAN:\n")
+	buffer.WriteString(fmt.Sprintf("\tε: %v\n", d.epsilon))
+	buffer.WriteString(fmt.Sprintf("\tMin Points: %v\n", d.minPoints))
+	if d.DistanceSpec != nil {
+		buffer.WriteString(fmt.Sprintf("\tDistance: %v\n", d.DistanceSpec))
+	}
+	buffer.WriteString(fmt.Sprintf("\tClusters: %v\n", d.Clusters()))
+	buffer.WriteString(fmt.Sprintf("\tCore Points: %v\n", len(d.corePoints)))
+
+	var noise int
+	for _, label := range d.guesses {
+		if label == Noise {
+			noise++
+		}
+	}
+	buffer.WriteString(fmt.Sprintf("\tNoise Points: %v\n", noise))
+
+	return buffer.String()
+}
+
+// dbscanHyperparameters holds the hyperparameters
+// of DBSCAN models as saved in their envelopes
+type dbscanHyperparameters struct {
+	Epsilon   float64            `json:"epsilon"`
+	MinPoints int                `json:"min_points"`
+	Distance  *base.DistanceSpec `json:"distance,omitempty"`
+	Index     IndexType          `json:"index"`
+}
+
+// dbscanData holds the core points of DBSCAN models
+// and their clusters, which is all they need to predict
+type dbscanData struct {
+	CorePoints [][]float64 `json:"core_points"`
+	CoreLabels []int       `json:"core_labels"`
+}
+
+// dbscanType is the name DBSCAN models are
+// registered and persisted under
+const dbscanType = "cluster.DBSCAN"
+
+func init() {
+	base.RegisterModel(dbscanType, func() base.Persistable {
+		return NewDBSCAN(0, 0, nil, nil)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// hyperparameters, wrapped in a base.Envelope. The data
+// of the envelope is the core points and their clusters.
+// The distance is only saved if the model has a
+// DistanceSpec.
+func (d *DBSCAN) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(d.corePoints) != 0 {
+		features = len(d.corePoints[0])
+	}
+
+	env := &base.Envelope{
+		Type: dbscanType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+		Metadata: base.TrainingMetadata{
+			Examples: len(d.trainingSet),
+		},
+	}
+
+	err := env.Encode(dbscanHyperparameters{
+		Epsilon:   d.epsilon,
+		MinPoints: d.minPoints,
+		Distance:  d.DistanceSpec,
+		Index:     d.indexType,
+	}, dbscanData{
+		CorePoints: d.corePoints,
+		CoreLabels: d.coreLabels,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's core points
+// and hyperparameters from the given base.Envelope. The
+// distance is restored if it was saved, otherwise the
+// model keeps its own (which must be set before
+// predicting.)
+func (d *DBSCAN) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := dbscanHyperparameters{
+		Index: d.indexType,
+	}
+	var data dbscanData
+	err := env.Decode(dbscanType, &hyper, &data)
+	if err != nil {
+		return err
+	}
+
+	if len(data.CorePoints) != len(data.CoreLabels) {
+		return fmt.Errorf("ERROR: DBSCAN has %v core points but %v core labels", len(data.CorePoints), len(data.CoreLabels))
+	}
+	for i := range data.CorePoints {
+		if len(data.CorePoints[i]) != len(data.CorePoints[0]) {
+			return fmt.Errorf("ERROR: DBSCAN core point %v doesn't match the dimensions of the other core points", i)
+		}
+		if data.CoreLabels[i] < 0 {
+			return fmt.Errorf("ERROR: DBSCAN core point %v has no cluster", i)
+		}
+	}
+	switch hyper.Index {
+	case BruteForceIndex, KDTreeIndex, BallTreeIndex, VPTreeIndex, HNSWIndex, LSHIndex:
+	default:
+		return fmt.Errorf("ERROR: Unknown spatial index type %v", hyper.Index)
+	}
+
+	distance := d.Distance
+	if hyper.Distance != nil {
+		distance, err = hyper.Distance.Distance()
+		if err != nil {
+			return err
+		}
+	}
+
+	d.Distance = distance
+	if hyper.Distance != nil {
+		d.DistanceSpec = hyper.Distance
+	}
+	d.epsilon = hyper.Epsilon
+	d.minPoints = hyper.MinPoints
+	d.indexType = hyper.Index
+
+	d.corePoints = data.CorePoints
+	d.coreLabels = data.CoreLabels
+	d.trainingSet = nil
+	d.guesses = nil
+	d.core = nil
+
+	return d.buildCoreIndex()
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// core points and hyperparameters of the model to the file,
+// which can be restored later
+func (d *DBSCAN) PersistToFile(path string) error {
+	return base.PersistModel(path, d)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and assigns the model it's operating on's core points
+// and hyperparameters to those persisted
+func (d *DBSCAN) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, d)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (d *DBSCAN) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, d)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (d *DBSCAN) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, d)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (d *DBSCAN) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(d)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (d *DBSCAN) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, d)
+}
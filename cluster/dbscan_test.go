@@ -0,0 +1,215 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// noisyBlobs returns the 4 blobs of blobs along with
+// outliers spread on a circle around them, labelled
+// as Noise
+func noisyBlobs(r *rand.Rand, n, outliers int) ([][]float64, []int) {
+	points, labels := blobs(r, n)
+	for i := 0; i < outliers; i++ {
+		angle := 2 * math.Pi * float64(i) / float64(outliers)
+		points = append(points, []float64{6000 * math.Cos(angle), 6000 * math.Sin(angle)})
+		labels = append(labels, Noise)
+	}
+
+	return points, labels
+}
+
+// rings returns points on two concentric rings, which
+// centroid based models can't tell apart
+func rings(r *rand.Rand, n int) ([][]float64, []int) {
+	points := make([][]float64, n)
+	labels := make([]int, n)
+	for i := range points {
+		labels[i] = r.Intn(2)
+		radius := 10 + 20*float64(labels[i]) + r.NormFloat64()*0.5
+		angle := r.Float64() * 2 * math.Pi
+		points[i] = []float64{radius * math.Cos(angle), radius * math.Sin(angle)}
+	}
+
+	return points, labels
+}
+
+func TestDBSCANShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(51))
+	points, labels := noisyBlobs(r, 800, 20)
+
+	var guesses []int
+	for _, index := range []IndexType{BruteForceIndex, KDTreeIndex, BallTreeIndex, VPTreeIndex} {
+		model := NewDBSCAN(25, 5, points, base.EuclideanDistance)
+		model.Output = ioutil.Discard
+		assert.Nil(t, model.UpdateIndex(index), "Index error should be nil")
+
+		err := model.Learn()
+		assert.Nil(t, err, "Learning error should be nil")
+		assert.Equal(t, 4, model.Clusters(), "DBSCAN should find the 4 blobs")
+
+		// the outliers are noise, and only a few points
+		// in the tails of the blobs are left out of them
+		var clustered [2][]int
+		var noise int
+		for i, guess := range model.Guesses() {
+			if labels[i] == Noise {
+				assert.Equal(t, Noise, guess, "Outliers should be noise")
+				continue
+			}
+			if guess == Noise {
+				noise++
+				continue
+			}
+			clustered[0] = append(clustered[0], labels[i])
+			clustered[1] = append(clustered[1], guess)
+		}
+		assert.True(t, noise < 20, "DBSCAN should put most points of the blobs in clusters with a %v index", index)
+		assertSameClustering(t, clustered[0], clustered[1])
+
+		ari, err := AdjustedRandIndex(labels, model.Guesses())
+		assert.Nil(t, err, "Metric error should be nil")
+		assert.True(t, ari > 0.95, "DBSCAN should find the blobs and the noise with a %v index", index)
+
+		// the clustering doesn't depend on the index
+		if guesses == nil {
+			guesses = model.Guesses()
+		}
+		assert.Equal(t, guesses, model.Guesses(), "Every exact index should give the same clustering")
+	}
+}
+
+func TestDBSCANShouldPass2(t *testing.T) {
+	r := rand.New(rand.NewSource(52))
+	points, labels := rings(r, 1000)
+
+	model := NewDBSCAN(3, 4, points, base.EuclideanDistance)
+	model.Output = ioutil.Discard
+
+	err := model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.Equal(t, 2, model.Clusters(), "DBSCAN should find both rings")
+	assertSameClustering(t, labels, model.Guesses())
+
+	// core points have at least minPoints
+	// points within ε of them
+	for i, x := range points {
+		var neighbors int
+		for _, y := range points {
+			if base.EuclideanDistance(x, y) <= model.Epsilon() {
+				neighbors++
+			}
+		}
+		assert.Equal(t, neighbors >= model.MinPoints(), model.Core()[i], "Core points should have at least %v neighbors", model.MinPoints())
+	}
+}
+
+func TestDBSCANPredictShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(53))
+	points, _ := noisyBlobs(r, 400, 10)
+
+	model := NewDBSCAN(25, 5, points, base.EuclideanDistance)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.UpdateIndex(KDTreeIndex), "Index error should be nil")
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	for i, x := range points {
+		guess, err := model.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		// core points and noise predict their own label,
+		// and border points a cluster within ε of them
+		if model.Core()[i] || model.Guesses()[i] == Noise {
+			assert.Equal(t, float64(model.Guesses()[i]), guess[0], "Core points and noise should predict their own label")
+		} else {
+			assert.NotEqual(t, float64(Noise), guess[0], "Border points should be in a cluster")
+		}
+	}
+
+	guess, err := model.Predict([]float64{1005, -990})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.NotEqual(t, float64(Noise), guess[0], "Points in a blob should be in its cluster")
+
+	guess, err = model.Predict([]float64{0, 0})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, float64(Noise), guess[0], "Points far from every blob should be noise")
+}
+
+func TestDBSCANShouldFail1(t *testing.T) {
+	points := [][]float64{{0}, {1}, {4}, {5}}
+
+	invalid := []*DBSCAN{
+		NewDBSCAN(1, 2, points, nil),
+		NewDBSCAN(0, 2, points, base.EuclideanDistance),
+		NewDBSCAN(1, 0, points, base.EuclideanDistance),
+		NewDBSCAN(1, 2, nil, base.EuclideanDistance),
+		NewDBSCAN(1, 2, [][]float64{{0}, {1, 2}, {4}, {5}}, base.EuclideanDistance),
+	}
+
+	for i, model := range invalid {
+		model.Output = ioutil.Discard
+		assert.NotNil(t, model.Learn(), "Learning with invalid model %v should return an error", i)
+	}
+
+	model := NewDBSCAN(1, 2, points, base.EuclideanDistance)
+	assert.NotNil(t, model.UpdateIndex("not an index"), "Unknown indexes should return an error")
+	assert.Equal(t, BruteForceIndex, model.Index(), "Failing to update the index should keep the old one")
+
+	_, err := NewDBSCAN(1, 2, points, nil).Predict([]float64{1})
+	assert.NotNil(t, err, "Predicting without a distance should return an error")
+
+	_, err = NewDBSCANFromSpec(1, 2, points, base.DistanceSpec{Name: "not registered"})
+	assert.NotNil(t, err, "Unknown distances should return an error")
+}
+
+func TestPersistDBSCANShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(54))
+	points, _ := noisyBlobs(r, 400, 10)
+
+	model, err := NewDBSCANFromSpec(30, 5, points, base.ManhattanDistanceSpec())
+	assert.Nil(t, err, "Creating the model should not return an error")
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.UpdateIndex(BallTreeIndex), "Index error should be nil")
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	err = model.PersistToFile("/tmp/.goml/DBSCAN.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/DBSCAN.json")
+	assert.Nil(t, err, "Loading the model should not return an error")
+
+	restored, ok := loaded.(*DBSCAN)
+	assert.True(t, ok, "The loaded model should be a DBSCAN model")
+	assert.Equal(t, 30.0, restored.Epsilon(), "The restored model should keep its hyperparameters")
+	assert.Equal(t, 5, restored.MinPoints(), "The restored model should keep its hyperparameters")
+	assert.Equal(t, BallTreeIndex, restored.Index(), "The restored model should keep its index type")
+	assert.Equal(t, model.Clusters(), restored.Clusters(), "The restored model should keep its clusters")
+
+	for _, x := range append(points, []float64{0, 0}, []float64{990, 1020}) {
+		g1, _ := model.Predict(x)
+		g2, err := restored.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, g1, g2, "The restored model should predict like the original")
+	}
+
+	env := &base.Envelope{Type: dbscanType}
+	err = env.Encode(dbscanHyperparameters{Epsilon: 1, MinPoints: 2}, dbscanData{
+		CorePoints: [][]float64{{1, 2}, {3}},
+		CoreLabels: []int{0, 0},
+	})
+	assert.Nil(t, err, "Encoding the envelope should not return an error")
+	assert.NotNil(t, restored.UnmarshalEnvelope(env), "Restoring ragged core points should return an error")
+
+	err = env.Encode(dbscanHyperparameters{Epsilon: 1, MinPoints: 2}, dbscanData{
+		CorePoints: [][]float64{{1, 2}, {3, 4}},
+		CoreLabels: []int{0},
+	})
+	assert.Nil(t, err, "Encoding the envelope should not return an error")
+	assert.NotNil(t, restored.UnmarshalEnvelope(env), "Restoring core points without labels should return an error")
+}
@@ -0,0 +1,345 @@
+package cluster
+
+import (
+	"fmt"
+	"math"
+)
+
+// The external metrics compare a clustering (like
+// the output of Guesses) with ground truth labels.
+// None of them depend on how the clusters or classes
+// are numbered. Unlike the internal metrics, every
+// label (negative ones too) is a cluster of its own,
+// so the noise of density based models counts as one
+// more cluster.
+
+// contingency holds the contingency table of two
+// labelings: the number of points with each pair of
+// labels, and the number of points with each label
+type contingency struct {
+	n       float64
+	table   [][]float64
+	classes []float64
+	guesses []float64
+}
+
+// newContingency returns the contingency table of
+// the truth labels (rows) and guessed labels (columns)
+func newContingency(truth, guesses []int) (*contingency, error) {
+	if len(truth) != len(guesses) {
+		return nil, fmt.Errorf("ERROR: number of true labels (%v) doesn't match the number of guesses (%v)", len(truth), len(guesses))
+	}
+
+	if len(truth) == 0 {
+		return nil, fmt.Errorf("ERROR: no labels to compare")
+	}
+
+	rows := make(map[int]int)
+	columns := make(map[int]int)
+	for i := range truth {
+		if _, ok := rows[truth[i]]; !ok {
+			rows[truth[i]] = len(rows)
+		}
+		if _, ok := columns[guesses[i]]; !ok {
+			columns[guesses[i]] = len(columns)
+		}
+	}
+
+	c := &contingency{
+		n:       float64(len(truth)),
+		table:   make([][]float64, len(rows)),
+		classes: make([]float64, len(rows)),
+		guesses: make([]float64, len(columns)),
+	}
+	for i := range c.table {
+		c.table[i] = make([]float64, len(columns))
+	}
+
+	for i := range truth {
+		row, column := rows[truth[i]], columns[guesses[i]]
+		c.table[row][column]++
+		c.classes[row]++
+		c.guesses[column]++
+	}
+
+	return c, nil
+}
+
+// entropy returns the entropy (in nats) of a labeling
+// with the given label counts out of n points
+func entropy(counts []float64, n float64) float64 {
+	var h float64
+	for _, count := range counts {
+		if count > 0 {
+			h -= count / n * math.Log(count/n)
+		}
+	}
+
+	return h
+}
+
+// mutualInformation returns the mutual information
+// (in nats) between the two labelings
+func (c *contingency) mutualInformation() float64 {
+	var mi float64
+	for i := range c.table {
+		for j, count := range c.table[i] {
+			if count > 0 {
+				mi += count / c.n * math.Log(c.n*count/(c.classes[i]*c.guesses[j]))
+			}
+		}
+	}
+
+	return mi
+}
+
+// expectedMutualInformation returns the expected
+// mutual information between two random labelings
+// with the same label counts as the table (under the
+// hypergeometric model of Vinh, Epps and Bailey)
+func (c *contingency) expectedMutualInformation() float64 {
+	lgamma := func(x float64) float64 {
+		v, _ := math.Lgamma(x)
+		return v
+	}
+
+	n := c.n
+	logN := lgamma(n + 1)
+
+	var emi float64
+	for _, a := range c.classes {
+		for _, b := range c.guesses {
+			start := math.Max(1, a+b-n)
+			end := math.Min(a, b)
+
+			// the log of the part of the hypergeometric
+			// probability which doesn't depend on nij
+			fixed := lgamma(a+1) + lgamma(b+1) + lgamma(n-a+1) + lgamma(n-b+1) - logN
+			for nij := start; nij <= end; nij++ {
+				p := fixed - lgamma(nij+1) - lgamma(a-nij+1) - lgamma(b-nij+1) - lgamma(n-a-b+nij+1)
+				emi += nij / n * math.Log(n*nij/(a*b)) * math.Exp(p)
+			}
+		}
+	}
+
+	return emi
+}
+
+// trivial reports whether both labelings put every
+// point in the same cluster, or every point in its
+// own cluster, in which case they agree perfectly
+// but most metrics are 0/0
+func (c *contingency) trivial() bool {
+	return len(c.classes) == len(c.guesses) && (len(c.classes) == 1 || float64(len(c.classes)) == c.n)
+}
+
+// pairs returns the number of pairs among n
+func pairs(n float64) float64 {
+	return n * (n - 1) / 2
+}
+
+// AdjustedRandIndex returns the Rand index of the
+// clustering given by guesses against the truth labels
+// (the share of pairs of points both put in the same
+// cluster, or both in different clusters,) adjusted
+// for chance: 1 means the clusterings are the same, 0
+// is the expected index of a random clustering, and it
+// can be negative for clusterings worse than random.
+//
+// Paper: https://link.springer.com/article/10.1007/BF01908075
+func AdjustedRandIndex(truth, guesses []int) (float64, error) {
+	c, err := newContingency(truth, guesses)
+	if err != nil {
+		return 0, err
+	}
+
+	// a single point has no pairs, and can only
+	// be clustered one way
+	if c.n < 2 {
+		return 1, nil
+	}
+
+	var index, classPairs, guessPairs float64
+	for i := range c.table {
+		for _, count := range c.table[i] {
+			index += pairs(count)
+		}
+	}
+	for _, count := range c.classes {
+		classPairs += pairs(count)
+	}
+	for _, count := range c.guesses {
+		guessPairs += pairs(count)
+	}
+
+	expected := classPairs * guessPairs / pairs(c.n)
+	max := (classPairs + guessPairs) / 2
+	if max == expected {
+		return 1, nil
+	}
+
+	return (index - expected) / (max - expected), nil
+}
+
+// MutualInformation returns the mutual information (in
+// nats) between the truth labels and the clustering
+// given by guesses
+func MutualInformation(truth, guesses []int) (float64, error) {
+	c, err := newContingency(truth, guesses)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.mutualInformation(), nil
+}
+
+// NormalizedMutualInformation returns the mutual
+// information between the truth labels and the
+// clustering given by guesses, divided by the mean of
+// their entropies. It ranges from 0 (the clustering
+// says nothing about the truth) to 1 (the clusterings
+// are the same.)
+func NormalizedMutualInformation(truth, guesses []int) (float64, error) {
+	c, err := newContingency(truth, guesses)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.trivial() {
+		return 1, nil
+	}
+
+	mean := (entropy(c.classes, c.n) + entropy(c.guesses, c.n)) / 2
+	if mean == 0 {
+		return 0, nil
+	}
+
+	return c.mutualInformation() / mean, nil
+}
+
+// AdjustedMutualInformation returns the mutual
+// information between the truth labels and the
+// clustering given by guesses, adjusted for chance
+// like the adjusted Rand index: 1 means the clusterings
+// are the same and 0 is the expected value for a random
+// clustering. Unlike the normalized mutual information,
+// it doesn't grow with the number of clusters.
+//
+// Paper: http://jmlr.csail.mit.edu/papers/volume11/vinh10a/vinh10a.pdf
+func AdjustedMutualInformation(truth, guesses []int) (float64, error) {
+	c, err := newContingency(truth, guesses)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.trivial() {
+		return 1, nil
+	}
+
+	mi := c.mutualInformation()
+	emi := c.expectedMutualInformation()
+	mean := (entropy(c.classes, c.n) + entropy(c.guesses, c.n)) / 2
+
+	// keep the sign of the denominator without
+	// dividing by (close to) 0
+	denominator := mean - emi
+	if denominator < 0 {
+		denominator = math.Min(denominator, -1e-15)
+	} else {
+		denominator = math.Max(denominator, 1e-15)
+	}
+
+	return (mi - emi) / denominator, nil
+}
+
+// Homogeneity returns how much every cluster of the
+// clustering given by guesses holds points of a single
+// class of the truth labels: 1 - H(C|K) / H(C), where
+// H(C) is the entropy of the classes and H(C|K) their
+// entropy given the clusters. It ranges from 0 to 1.
+//
+// Paper: http://aclweb.org/anthology/D/D07/D07-1043.pdf
+func Homogeneity(truth, guesses []int) (float64, error) {
+	c, err := newContingency(truth, guesses)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.homogeneity(), nil
+}
+
+// Completeness returns how much the points of every
+// class of the truth labels are in a single cluster of
+// the clustering given by guesses: 1 - H(K|C) / H(K).
+// It ranges from 0 to 1, and is the homogeneity with
+// the truth and guesses swapped.
+func Completeness(truth, guesses []int) (float64, error) {
+	c, err := newContingency(truth, guesses)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.completeness(), nil
+}
+
+// VMeasure returns the harmonic mean of the homogeneity
+// and completeness of the clustering given by guesses,
+// which is also its normalized mutual information with
+// the truth labels. It ranges from 0 to 1.
+func VMeasure(truth, guesses []int) (float64, error) {
+	c, err := newContingency(truth, guesses)
+	if err != nil {
+		return 0, err
+	}
+
+	h, k := c.homogeneity(), c.completeness()
+	if h+k == 0 {
+		return 0, nil
+	}
+
+	return 2 * h * k / (h + k), nil
+}
+
+// homogeneity returns 1 - H(C|K) / H(C)
+func (c *contingency) homogeneity() float64 {
+	h := entropy(c.classes, c.n)
+	if h == 0 {
+		return 1
+	}
+
+	return c.mutualInformation() / h
+}
+
+// completeness returns 1 - H(K|C) / H(K)
+func (c *contingency) completeness() float64 {
+	h := entropy(c.guesses, c.n)
+	if h == 0 {
+		return 1
+	}
+
+	return c.mutualInformation() / h
+}
+
+// Purity returns the share of points in the majority
+// class of their cluster, for the clustering given by
+// guesses. It ranges from 0 to 1, but putting every
+// point in its own cluster always gives a purity of 1,
+// so only compare the purity of clusterings with about
+// the same number of clusters.
+func Purity(truth, guesses []int) (float64, error) {
+	c, err := newContingency(truth, guesses)
+	if err != nil {
+		return 0, err
+	}
+
+	var sum float64
+	for j := range c.guesses {
+		var majority float64
+		for i := range c.table {
+			majority = math.Max(majority, c.table[i][j])
+		}
+		sum += majority
+	}
+
+	return sum / c.n, nil
+}
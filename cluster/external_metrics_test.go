@@ -0,0 +1,154 @@
+package cluster
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExternalMetricsShouldPass1(t *testing.T) {
+	truth := []int{0, 0, 1, 1}
+	guesses := []int{0, 0, 1, 2}
+
+	// 1 pair together in both, 2 pairs together in the
+	// truth, 1 in the guesses, out of 6 pairs
+	ari, err := AdjustedRandIndex(truth, guesses)
+	assert.Nil(t, err, "Adjusted Rand index error should be nil")
+	assert.InDelta(t, 4.0/7, ari, 1e-12, "Adjusted Rand index should match the hand computed one")
+
+	// every cluster holds one class, but class 1 is
+	// split over two clusters
+	h, err := Homogeneity(truth, guesses)
+	assert.Nil(t, err, "Homogeneity error should be nil")
+	assert.InDelta(t, 1.0, h, 1e-12, "Every cluster should hold a single class")
+
+	c, err := Completeness(truth, guesses)
+	assert.Nil(t, err, "Completeness error should be nil")
+	assert.InDelta(t, 2.0/3, c, 1e-12, "Completeness should match the hand computed one")
+
+	v, err := VMeasure(truth, guesses)
+	assert.Nil(t, err, "V-measure error should be nil")
+	assert.InDelta(t, 0.8, v, 1e-12, "V-measure should be the harmonic mean of homogeneity and completeness")
+
+	nmi, err := NormalizedMutualInformation(truth, guesses)
+	assert.Nil(t, err, "Normalized mutual information error should be nil")
+	assert.InDelta(t, v, nmi, 1e-12, "The normalized mutual information should be the V-measure")
+
+	mi, err := MutualInformation(truth, guesses)
+	assert.Nil(t, err, "Mutual information error should be nil")
+	assert.InDelta(t, math.Log(2), mi, 1e-12, "Mutual information should match the hand computed one")
+
+	p, err := Purity(truth, guesses)
+	assert.Nil(t, err, "Purity error should be nil")
+	assert.Equal(t, 1.0, p, "Every cluster holds a single class")
+
+	p, err = Purity([]int{0, 0, 1, 1, 1}, []int{0, 0, 0, 1, 1})
+	assert.Nil(t, err, "Purity error should be nil")
+	assert.InDelta(t, 0.8, p, 1e-12, "One point out of five is outside the majority class of its cluster")
+
+	// splitting every class completely is as good
+	// as random
+	ari, _ = AdjustedRandIndex([]int{0, 0, 0, 0}, []int{0, 1, 2, 3})
+	assert.Equal(t, 0.0, ari, "Splitting every point should have an adjusted Rand index of 0")
+	ami, err := AdjustedMutualInformation([]int{0, 0, 0, 0}, []int{0, 1, 2, 3})
+	assert.Nil(t, err, "Adjusted mutual information error should be nil")
+	assert.InDelta(t, 0.0, ami, 1e-12, "Splitting every point should have an adjusted mutual information of 0")
+}
+
+func TestExternalMetricsShouldPass2(t *testing.T) {
+	truth := []int{3, 3, 3, 7, 7, -1, -1, -1}
+	same := []int{1, 1, 1, 0, 0, 5, 5, 5}
+
+	metrics := []func([]int, []int) (float64, error){
+		AdjustedRandIndex,
+		NormalizedMutualInformation,
+		AdjustedMutualInformation,
+		Homogeneity,
+		Completeness,
+		VMeasure,
+		Purity,
+	}
+
+	for i, metric := range metrics {
+		score, err := metric(truth, same)
+		assert.Nil(t, err, "Metric %v error should be nil", i)
+		assert.InDelta(t, 1.0, score, 1e-12, "Metric %v should be 1 for the same clustering, numbered differently", i)
+
+		score, err = metric([]int{0, 0, 0}, []int{4, 4, 4})
+		assert.Nil(t, err, "Metric %v error should be nil", i)
+		assert.InDelta(t, 1.0, score, 1e-12, "Metric %v should be 1 for a single cluster in both", i)
+
+		score, err = metric([]int{2}, []int{0})
+		assert.Nil(t, err, "Metric %v error should be nil", i)
+		assert.Equal(t, 1.0, score, "Metric %v should be 1 for a single point", i)
+	}
+
+	// random clusterings score about 0 once adjusted
+	// for chance
+	r := rand.New(rand.NewSource(51))
+	a, b := make([]int, 5000), make([]int, 5000)
+	for i := range a {
+		a[i], b[i] = r.Intn(10), r.Intn(10)
+	}
+
+	ari, _ := AdjustedRandIndex(a, b)
+	ami, _ := AdjustedMutualInformation(a, b)
+	nmi, _ := NormalizedMutualInformation(a, b)
+	assert.InDelta(t, 0, ari, 0.01, "Random clusterings should have an adjusted Rand index close to 0")
+	assert.InDelta(t, 0, ami, 0.01, "Random clusterings should have an adjusted mutual information close to 0")
+	assert.True(t, nmi > ami, "The normalized mutual information isn't adjusted for chance")
+}
+
+func TestExpectedMutualInformationShouldPass1(t *testing.T) {
+	truth := []int{0, 0, 0, 1, 1, 2}
+	guesses := []int{0, 0, 1, 1, 2, 2}
+
+	// the expected mutual information is the mean
+	// mutual information over every permutation of
+	// the guesses
+	var sum float64
+	var count int
+	var permute func(int)
+	permute = func(i int) {
+		if i == len(guesses) {
+			mi, _ := MutualInformation(truth, guesses)
+			sum += mi
+			count++
+			return
+		}
+
+		for j := i; j < len(guesses); j++ {
+			guesses[i], guesses[j] = guesses[j], guesses[i]
+			permute(i + 1)
+			guesses[i], guesses[j] = guesses[j], guesses[i]
+		}
+	}
+	permute(0)
+
+	c, err := newContingency(truth, guesses)
+	assert.Nil(t, err, "Contingency table error should be nil")
+	assert.InDelta(t, sum/float64(count), c.expectedMutualInformation(), 1e-12, "Expected mutual information should be the mean over every permutation")
+}
+
+func TestExternalMetricsShouldFail1(t *testing.T) {
+	metrics := []func([]int, []int) (float64, error){
+		AdjustedRandIndex,
+		MutualInformation,
+		NormalizedMutualInformation,
+		AdjustedMutualInformation,
+		Homogeneity,
+		Completeness,
+		VMeasure,
+		Purity,
+	}
+
+	for i, metric := range metrics {
+		_, err := metric([]int{0, 1}, []int{0})
+		assert.NotNil(t, err, "Metric %v of labelings of different lengths should return an error", i)
+
+		_, err = metric(nil, nil)
+		assert.NotNil(t, err, "Metric %v without labels should return an error", i)
+	}
+}
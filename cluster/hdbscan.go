@@ -0,0 +1,924 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/admpub/goml/base"
+)
+
+// minLinkageDistance is the smallest distance at which
+// clusters are considered to split, so duplicate points
+// (at distance 0) give a very high but finite density
+const minLinkageDistance = 1e-300
+
+/*
+HDBSCAN implements Hierarchical DBSCAN, which finds
+clusters of varying density. Where DBSCAN cuts the
+data at a single density (given by ε,) HDBSCAN builds
+the whole hierarchy of DBSCAN clusterings over every ε
+and picks the most stable clusters out of it, so it
+only needs the smallest size of a cluster.
+
+The core distance of a point is the distance to its
+minSamples-th nearest neighbor (itself included,) and
+the mutual reachability distance between two points is
+the largest of their distance and both core distances.
+Single linkage clustering under the mutual reachability
+distance gives the hierarchy, which is condensed by
+treating splits cutting off fewer than minClusterSize
+points as points leaving the cluster rather than as new
+clusters. Each cluster of the condensed tree has a
+stability (how many points it holds over how wide a
+range of densities,) and the clusters picked are the
+ones more stable than all of their sub-clusters
+together (the excess of mass.)
+
+Points which don't belong to any picked cluster are
+labelled as Noise. Nearest neighbors (for the core
+distances and Predict) are found with a spatial index
+(see UpdateIndex.) With the tree indexes the minimum
+spanning tree is built with Borůvka's algorithm, whose
+searches skip the parts of the tree holding only points
+already joined to the point searched from. Trees prune
+less as the number of dimensions grows (a KDTree most
+of all,) so with many dimensions a BallTree or VPTree
+works best. The other indexes can't skip points that
+way, so Prim's algorithm builds the tree with O(n²)
+distances.
+
+Paper: https://link.springer.com/chapter/10.1007/978-3-642-37456-2_14
+
+Example HDBSCAN Model Usage:
+
+	model := NewHDBSCAN(15, data, base.EuclideanDistance)
+
+	err := model.Learn()
+	if err != nil {
+		panic("learning error")
+	}
+
+	// cluster labels, with Noise (-1) for noise
+	labels := model.Guesses()
+
+	// how strongly every point belongs to its cluster
+	probabilities := model.Probabilities()
+
+	// new points join the cluster they would have been
+	// in had they been in the training set, or are noise
+	guess, err := model.Predict([]float64{4.2, -1.3})
+*/
+type HDBSCAN struct {
+	// Distance holds the distance
+	// measure between points
+	Distance base.DistanceMeasure
+
+	// DistanceSpec describes the distance of the
+	// model when it was created from (or updated
+	// with) a base.DistanceSpec. Models with a
+	// DistanceSpec persist their distance, so
+	// restored models don't need it set again.
+	DistanceSpec *base.DistanceSpec `json:"distance,omitempty"`
+
+	// minClusterSize is the smallest number of
+	// points in a cluster, and minSamples the
+	// number of neighbors (itself included) giving
+	// the core distance of a point (minClusterSize
+	// if 0)
+	minClusterSize int
+	minSamples     int
+
+	// trainingSet holds the points to cluster, and
+	// index the spatial index built over them
+	trainingSet [][]float64
+	index       SpatialIndex
+
+	// indexType is the kind of spatial index
+	// searched for nearest neighbors
+	indexType IndexType
+
+	// coreDistances holds the core distance of
+	// every training example, guesses their
+	// clusters, probabilities how strongly they
+	// belong to them and core whether they stay in
+	// them at their densest
+	coreDistances []float64
+	guesses       []int
+	probabilities []float64
+	core          []bool
+
+	// clusterDistances holds the mutual reachability
+	// distance at which every picked cluster formed
+	clusterDistances []float64
+
+	// Output is the io.Writer to write
+	// logging to. Defaults to os.Stdout
+	// but can be changed to any io.Writer
+	Output io.Writer
+}
+
+// NewHDBSCAN returns a pointer to an HDBSCAN model
+// finding clusters of at least minClusterSize points
+// under the given distance. The core distance of a point
+// is the distance to its minClusterSize-th nearest
+// neighbor, unless changed with UpdateMinSamples. Nearest
+// neighbors are found by comparing points with every
+// point (BruteForceIndex.) Use UpdateIndex to search a
+// tree built over the training set instead.
+func NewHDBSCAN(minClusterSize int, trainingSet [][]float64, distance base.DistanceMeasure) *HDBSCAN {
+	return &HDBSCAN{
+		Distance: distance,
+
+		minClusterSize: minClusterSize,
+
+		trainingSet: trainingSet,
+
+		indexType: BruteForceIndex,
+
+		Output: os.Stdout,
+	}
+}
+
+// NewHDBSCANFromSpec returns a new model using the
+// distance described by the given spec, which is
+// persisted with the model. An error is returned if the
+// spec doesn't describe a valid distance.
+func NewHDBSCANFromSpec(minClusterSize int, trainingSet [][]float64, spec base.DistanceSpec) (*HDBSCAN, error) {
+	distance, err := spec.Distance()
+	if err != nil {
+		return nil, err
+	}
+
+	model := NewHDBSCAN(minClusterSize, trainingSet, distance)
+	model.DistanceSpec = &spec
+
+	return model, nil
+}
+
+// UpdateDistance sets the distance of the model to the
+// one described by the given spec. Learn again to
+// cluster with the new distance.
+func (h *HDBSCAN) UpdateDistance(spec base.DistanceSpec) error {
+	distance, err := spec.Distance()
+	if err != nil {
+		return err
+	}
+
+	h.Distance = distance
+	h.DistanceSpec = &spec
+	h.index = nil
+
+	return nil
+}
+
+// UpdateTrainingSet takes in a new training set (variable x.)
+//
+// Will reset the clusters of the model until it learns
+// again.
+func (h *HDBSCAN) UpdateTrainingSet(trainingSet [][]float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("ERROR: length of given training set is 0! Need data!")
+	}
+
+	h.trainingSet = trainingSet
+	h.index = nil
+	h.coreDistances = nil
+	h.guesses = nil
+	h.probabilities = nil
+	h.core = nil
+	h.clusterDistances = nil
+
+	return nil
+}
+
+// UpdateMinSamples sets the number of neighbors (the
+// point itself included) giving the core distance of a
+// point. Larger values make the clustering more
+// conservative, leaving more points as noise. 0 uses
+// the smallest cluster size.
+func (h *HDBSCAN) UpdateMinSamples(minSamples int) error {
+	if minSamples < 0 {
+		return fmt.Errorf("ERROR: minimum samples can't be negative - given %v", minSamples)
+	}
+
+	h.minSamples = minSamples
+
+	return nil
+}
+
+// UpdateIndex sets the kind of spatial index searched
+// for nearest neighbors, while learning and predicting.
+// The tree indexes find the exact neighbors and build
+// the minimum spanning tree with far fewer than O(n²)
+// distances, while the approximate HNSWIndex and
+// LSHIndex may miss some neighbors.
+func (h *HDBSCAN) UpdateIndex(indexType IndexType) error {
+	switch indexType {
+	case BruteForceIndex, KDTreeIndex, BallTreeIndex, VPTreeIndex, HNSWIndex, LSHIndex:
+	default:
+		return fmt.Errorf("ERROR: Unknown spatial index type '%v'", indexType)
+	}
+
+	h.indexType = indexType
+	h.index = nil
+
+	return nil
+}
+
+// Index returns the kind of spatial index searched
+// for nearest neighbors
+func (h *HDBSCAN) Index() IndexType {
+	return h.indexType
+}
+
+// MinClusterSize returns the smallest number of
+// points in a cluster
+func (h *HDBSCAN) MinClusterSize() int {
+	return h.minClusterSize
+}
+
+// MinSamples returns the number of neighbors (the
+// point itself included) giving the core distance of
+// a point
+func (h *HDBSCAN) MinSamples() int {
+	if h.minSamples == 0 {
+		return h.minClusterSize
+	}
+
+	return h.minSamples
+}
+
+// Examples returns the number of training examples (m)
+// that the model currently is training from.
+func (h *HDBSCAN) Examples() int {
+	return len(h.trainingSet)
+}
+
+// spatialIndex returns the spatial index over the
+// training set, building it if needed
+func (h *HDBSCAN) spatialIndex() (SpatialIndex, error) {
+	if h.index != nil {
+		return h.index, nil
+	}
+
+	index, err := NewIndex(h.indexType, h.trainingSet, h.Distance)
+	if err != nil {
+		return nil, err
+	}
+
+	h.index = index
+
+	return index, nil
+}
+
+// linkage is a merge of the single linkage tree: the
+// two nodes merged (points below n, and merges from n
+// on,) the distance they merged at and the number of
+// points below the merge
+type linkage struct {
+	left, right int
+	distance    float64
+	size        int
+}
+
+// condensedTree holds the clusters of the condensed
+// tree, cluster 0 being the root, and the cluster every
+// point leaves at which density (λ = 1 / distance)
+type condensedTree struct {
+	parent    []int
+	children  [][]int
+	birth     []float64
+	stability []float64
+
+	pointCluster []int
+	pointLambda  []float64
+}
+
+// lambda returns the density λ = 1 / distance at which
+// clusters split at the given distance
+func lambda(distance float64) float64 {
+	return 1 / math.Max(distance, minLinkageDistance)
+}
+
+// Learn clusters the training set
+func (h *HDBSCAN) Learn() error {
+	err := validateDensity(h.trainingSet, h.Distance)
+	if err == nil && h.minClusterSize < 2 {
+		err = fmt.Errorf("ERROR: HDBSCAN clusters need at least 2 points - given %v", h.minClusterSize)
+	}
+	if err != nil {
+		fmt.Fprintf(h.Output, err.Error()+"\n")
+		return err
+	}
+
+	examples := len(h.trainingSet)
+	minSamples := h.MinSamples()
+
+	fmt.Fprintf(h.Output, "Training:\n\tModel: HDBSCAN Clustering\n\tTraining Examples: %v\n\tFeatures: %v\n\tMin Cluster Size: %v\n\tMin Samples: %v\n\tIndex: %v\n...\n\n", examples, len(h.trainingSet[0]), h.minClusterSize, minSamples, h.indexType)
+
+	h.index = nil
+	index, err := h.spatialIndex()
+	if err != nil {
+		fmt.Fprintf(h.Output, err.Error()+"\n")
+		return err
+	}
+
+	// approximate indexes can miss every neighbor of
+	// a point (even itself,) whose neighbors are then
+	// found by comparing it against every example
+	var brute *BruteForce
+	coreDistances := make([]float64, examples)
+	for i, x := range h.trainingSet {
+		neighbors := index.KNearest(x, minSamples)
+		if len(neighbors) == 0 {
+			if brute == nil {
+				brute = NewBruteForce(h.trainingSet, h.Distance)
+			}
+			neighbors = brute.KNearest(x, minSamples)
+		}
+		coreDistances[i] = neighbors[len(neighbors)-1].Distance
+	}
+
+	tree := h.condense(h.singleLinkage(index, coreDistances))
+	selected := tree.selectClusters()
+
+	// number the picked clusters in order, and find
+	// the densest level points leave each of them at
+	labels := make(map[int]int)
+	var clusterDistances, maxLambda []float64
+	for c := range selected {
+		if selected[c] {
+			labels[c] = len(clusterDistances)
+			clusterDistances = append(clusterDistances, 1/tree.birth[c])
+			maxLambda = append(maxLambda, 0)
+		}
+	}
+
+	guesses := make([]int, examples)
+	for i := range guesses {
+		guesses[i] = Noise
+
+		for c := tree.pointCluster[i]; c > 0; c = tree.parent[c] {
+			if selected[c] {
+				guesses[i] = labels[c]
+				maxLambda[guesses[i]] = math.Max(maxLambda[guesses[i]], tree.pointLambda[i])
+				break
+			}
+		}
+	}
+
+	probabilities := make([]float64, examples)
+	core := make([]bool, examples)
+	for i, label := range guesses {
+		if label == Noise {
+			continue
+		}
+
+		probabilities[i] = math.Min(tree.pointLambda[i]/maxLambda[label], 1)
+		core[i] = tree.pointLambda[i] >= maxLambda[label]
+	}
+
+	h.coreDistances = coreDistances
+	h.guesses = guesses
+	h.probabilities = probabilities
+	h.core = core
+	h.clusterDistances = clusterDistances
+
+	fmt.Fprintf(h.Output, "Training Completed.\n%v\n", h)
+
+	return nil
+}
+
+// singleLinkage returns the single linkage tree of the
+// training set under the mutual reachability distance,
+// built from its minimum spanning tree
+func (h *HDBSCAN) singleLinkage(index SpatialIndex, coreDistances []float64) []linkage {
+	n := len(h.trainingSet)
+
+	var edges []mstEdge
+	if tree, ok := index.(componentIndex); ok {
+		edges, ok = boruvka(tree, h.trainingSet, coreDistances)
+		if !ok {
+			edges = nil
+		}
+	}
+	if edges == nil {
+		edges = h.prim(coreDistances)
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].less(edges[j])
+	})
+
+	// merge the points along the edges, shortest
+	// first (and lowest point first, so the tree
+	// doesn't depend on how the edges were found,)
+	// with a union find
+	parent := make([]int, n)
+	node := make([]int, n)
+	size := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+		node[i] = i
+		size[i] = 1
+	}
+
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	links := make([]linkage, len(edges))
+	for i, e := range edges {
+		if e.a > e.b {
+			e.a, e.b = e.b, e.a
+		}
+
+		a, b := find(e.a), find(e.b)
+		links[i] = linkage{
+			left:     node[a],
+			right:    node[b],
+			distance: e.distance,
+			size:     size[a] + size[b],
+		}
+
+		parent[b] = a
+		node[a] = n + i
+		size[a] += size[b]
+	}
+
+	return links
+}
+
+// prim returns the minimum spanning tree of the
+// training set under the mutual reachability distance,
+// found with Prim's algorithm by comparing every pair
+// of points
+func (h *HDBSCAN) prim(coreDistances []float64) []mstEdge {
+	n := len(h.trainingSet)
+	edges := make([]mstEdge, 0, n-1)
+
+	inTree := make([]bool, n)
+	nearest := make([]mstEdge, n)
+	for i := range nearest {
+		nearest[i] = mstEdge{a: i, b: i, distance: math.Inf(1)}
+	}
+
+	current := 0
+	for len(edges) < n-1 {
+		inTree[current] = true
+
+		next := -1
+		for j := range h.trainingSet {
+			if inTree[j] {
+				continue
+			}
+
+			d := h.Distance(h.trainingSet[current], h.trainingSet[j])
+			edge := mstEdge{
+				a:        current,
+				b:        j,
+				distance: math.Max(d, math.Max(coreDistances[current], coreDistances[j])),
+			}
+			if edge.less(nearest[j]) {
+				nearest[j] = edge
+			}
+
+			if next < 0 || nearest[j].less(nearest[next]) {
+				next = j
+			}
+		}
+
+		edges = append(edges, nearest[next])
+		current = next
+	}
+
+	return edges
+}
+
+// condense returns the condensed tree of the single
+// linkage tree, in which splits cutting off fewer than
+// minClusterSize points are points leaving the cluster
+func (h *HDBSCAN) condense(links []linkage) *condensedTree {
+	n := len(h.trainingSet)
+
+	tree := &condensedTree{
+		parent:    []int{-1},
+		children:  [][]int{nil},
+		birth:     []float64{0},
+		stability: []float64{0},
+
+		pointCluster: make([]int, n),
+		pointLambda:  make([]float64, n),
+	}
+
+	size := func(node int) int {
+		if node < n {
+			return 1
+		}
+		return links[node-n].size
+	}
+
+	// leave has every point below the node leave the
+	// cluster at the given density
+	leave := func(node, cluster int, lambda float64) {
+		stack := []int{node}
+		for len(stack) != 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if node < n {
+				tree.pointCluster[node] = cluster
+				tree.pointLambda[node] = lambda
+				continue
+			}
+			stack = append(stack, links[node-n].left, links[node-n].right)
+		}
+
+		tree.stability[cluster] += (lambda - tree.birth[cluster]) * float64(size(node))
+	}
+
+	type step struct {
+		node, cluster int
+	}
+
+	if len(links) == 0 {
+		leave(0, 0, lambda(0))
+		return tree
+	}
+
+	stack := []step{{n + len(links) - 1, 0}}
+	for len(stack) != 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		link := links[s.node-n]
+		l := lambda(link.distance)
+
+		if size(link.left) >= h.minClusterSize && size(link.right) >= h.minClusterSize {
+			for _, child := range []int{link.left, link.right} {
+				c := len(tree.parent)
+				tree.parent = append(tree.parent, s.cluster)
+				tree.children = append(tree.children, nil)
+				tree.birth = append(tree.birth, l)
+				tree.stability = append(tree.stability, 0)
+				tree.children[s.cluster] = append(tree.children[s.cluster], c)
+
+				tree.stability[s.cluster] += (l - tree.birth[s.cluster]) * float64(size(child))
+				stack = append(stack, step{child, c})
+			}
+			continue
+		}
+
+		for _, child := range []int{link.left, link.right} {
+			if size(child) < h.minClusterSize {
+				leave(child, s.cluster, l)
+			} else {
+				stack = append(stack, step{child, s.cluster})
+			}
+		}
+	}
+
+	return tree
+}
+
+// selectClusters picks the clusters of the condensed
+// tree more stable than all of their sub-clusters put
+// together, leaving out the root (which would put every
+// point in one cluster)
+func (t *condensedTree) selectClusters() []bool {
+	selected := make([]bool, len(t.parent))
+	subtree := make([]float64, len(t.parent))
+
+	var unselect func(c int)
+	unselect = func(c int) {
+		for _, child := range t.children[c] {
+			selected[child] = false
+			unselect(child)
+		}
+	}
+
+	// sub-clusters are always numbered after their
+	// parent, so going backwards visits them first
+	for c := len(t.parent) - 1; c > 0; c-- {
+		var children float64
+		for _, child := range t.children[c] {
+			children += subtree[child]
+		}
+
+		if len(t.children[c]) == 0 || t.stability[c] >= children {
+			selected[c] = true
+			subtree[c] = t.stability[c]
+			unselect(c)
+		} else {
+			subtree[c] = children
+		}
+	}
+
+	return selected
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns the cluster x would have been in had it been in
+// the training set (without changing the clustering,) or
+// Noise. x joins the cluster of the training example it
+// has the lowest mutual reachability distance to, if
+// that's below the distance the cluster formed at.
+//
+// if normalize is given as true, then the input will
+// first be normalized to unit length. Only use this if
+// you trained off of normalized inputs and are feeding
+// an un-normalized input
+func (h *HDBSCAN) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if h.guesses == nil {
+		return nil, fmt.Errorf("ERROR: Attempting to predict with an HDBSCAN model which hasn't learned!")
+	}
+	if h.Distance == nil {
+		return nil, fmt.Errorf("ERROR: Attempting to predict without a distance measure!")
+	}
+
+	if len(x) != len(h.trainingSet[0]) {
+		return nil, fmt.Errorf("ERROR: input vector should have %v features - given %v", len(h.trainingSet[0]), len(x))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	index, err := h.spatialIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	minSamples := h.MinSamples()
+	// approximate indexes can find no neighbors at
+	// all, leaving x far from every cluster
+	neighbors := index.KNearest(x, 2*minSamples)
+	if len(neighbors) == 0 {
+		return []float64{Noise}, nil
+	}
+
+	core := neighbors[len(neighbors)-1].Distance
+	if len(neighbors) >= minSamples {
+		core = neighbors[minSamples-1].Distance
+	}
+
+	nearest, reachability := -1, math.Inf(1)
+	for _, neighbor := range neighbors {
+		d := math.Max(neighbor.Distance, math.Max(core, h.coreDistances[neighbor.Index]))
+		if d < reachability {
+			nearest, reachability = neighbor.Index, d
+		}
+	}
+
+	label := h.guesses[nearest]
+	if label == Noise || reachability > h.clusterDistances[label] {
+		return []float64{Noise}, nil
+	}
+
+	return []float64{float64(label)}, nil
+}
+
+// Guesses returns the cluster of every training
+// example found while learning, with Noise (-1) for
+// noise
+func (h *HDBSCAN) Guesses() []int {
+	return h.guesses
+}
+
+// Probabilities returns how strongly every training
+// example belongs to its cluster, from 0 (noise) to 1:
+// the density the example leaves its cluster at, over
+// the highest density any example leaves it at
+func (h *HDBSCAN) Probabilities() []float64 {
+	return h.probabilities
+}
+
+// Core returns whether every training example is a core
+// point of its cluster: a point which stays in it until
+// the densest level of the cluster (with a probability
+// of 1)
+func (h *HDBSCAN) Core() []bool {
+	return h.core
+}
+
+// CoreDistances returns the core distance of every
+// training example: the distance to its minSamples-th
+// nearest neighbor (itself included)
+func (h *HDBSCAN) CoreDistances() []float64 {
+	return h.coreDistances
+}
+
+// Clusters returns the number of clusters found
+// while learning
+func (h *HDBSCAN) Clusters() int {
+	return len(h.clusterDistances)
+}
+
+// String implements the fmt interface for clean printing
+func (h *HDBSCAN) String() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("HDBSCAN:\n")
+	buffer.WriteString(fmt.Sprintf("\tMin Cluster Size: %v\n", h.minClusterSize))
+	buffer.WriteString(fmt.Sprintf("\tMin Samples: %v\n", h.MinSamples()))
+	if h.DistanceSpec != nil {
+		buffer.WriteString(fmt.Sprintf("\tDistance: %v\n", h.DistanceSpec))
+	}
+	buffer.WriteString(fmt.Sprintf("\tClusters: %v\n", h.Clusters()))
+
+	var noise int
+	for _, label := range h.guesses {
+		if label == Noise {
+			noise++
+		}
+	}
+	buffer.WriteString(fmt.Sprintf("\tNoise Points: %v\n", noise))
+
+	return buffer.String()
+}
+
+// hdbscanHyperparameters holds the hyperparameters
+// of HDBSCAN models as saved in their envelopes
+type hdbscanHyperparameters struct {
+	MinClusterSize int                `json:"min_cluster_size"`
+	MinSamples     int                `json:"min_samples"`
+	Distance       *base.DistanceSpec `json:"distance,omitempty"`
+	Index          IndexType          `json:"index"`
+}
+
+// hdbscanData holds what HDBSCAN models need to
+// predict: the training set, the core distance and
+// cluster of every example, and the distance every
+// cluster formed at
+type hdbscanData struct {
+	TrainingSet      [][]float64 `json:"training_set"`
+	CoreDistances    []float64   `json:"core_distances"`
+	Labels           []int       `json:"labels"`
+	ClusterDistances []float64   `json:"cluster_distances"`
+}
+
+// hdbscanType is the name HDBSCAN models are
+// registered and persisted under
+const hdbscanType = "cluster.HDBSCAN"
+
+func init() {
+	base.RegisterModel(hdbscanType, func() base.Persistable {
+		return NewHDBSCAN(0, nil, nil)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// hyperparameters, wrapped in a base.Envelope. The data
+// of the envelope is the training set along with its
+// core distances and clusters. The distance is only
+// saved if the model has a DistanceSpec.
+func (h *HDBSCAN) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(h.trainingSet) != 0 {
+		features = len(h.trainingSet[0])
+	}
+
+	env := &base.Envelope{
+		Type: hdbscanType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+		Metadata: base.TrainingMetadata{
+			Examples: len(h.trainingSet),
+		},
+	}
+
+	err := env.Encode(hdbscanHyperparameters{
+		MinClusterSize: h.minClusterSize,
+		MinSamples:     h.minSamples,
+		Distance:       h.DistanceSpec,
+		Index:          h.indexType,
+	}, hdbscanData{
+		TrainingSet:      h.trainingSet,
+		CoreDistances:    h.coreDistances,
+		Labels:           h.guesses,
+		ClusterDistances: h.clusterDistances,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model from the given
+// base.Envelope. The distance is restored if it was
+// saved, otherwise the model keeps its own (which must
+// be set before predicting.) The probabilities and core
+// points of the training set aren't saved, so they're
+// only available after learning again.
+func (h *HDBSCAN) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := hdbscanHyperparameters{
+		Index: h.indexType,
+	}
+	var data hdbscanData
+	err := env.Decode(hdbscanType, &hyper, &data)
+	if err != nil {
+		return err
+	}
+
+	// models saved before learning have a training
+	// set but no clusters
+	learned := len(data.Labels) != 0
+	if learned && (len(data.TrainingSet) != len(data.CoreDistances) || len(data.TrainingSet) != len(data.Labels)) {
+		return fmt.Errorf("ERROR: HDBSCAN has %v training examples but %v core distances and %v labels", len(data.TrainingSet), len(data.CoreDistances), len(data.Labels))
+	}
+	for i := range data.TrainingSet {
+		if len(data.TrainingSet[i]) != len(data.TrainingSet[0]) {
+			return fmt.Errorf("ERROR: HDBSCAN training example %v doesn't match the dimensions of the training set", i)
+		}
+		if learned && (data.Labels[i] < Noise || data.Labels[i] >= len(data.ClusterDistances)) {
+			return fmt.Errorf("ERROR: HDBSCAN training example %v has unknown cluster %v", i, data.Labels[i])
+		}
+	}
+	if hyper.MinSamples < 0 {
+		return fmt.Errorf("ERROR: minimum samples can't be negative - given %v", hyper.MinSamples)
+	}
+	switch hyper.Index {
+	case BruteForceIndex, KDTreeIndex, BallTreeIndex, VPTreeIndex, HNSWIndex, LSHIndex:
+	default:
+		return fmt.Errorf("ERROR: Unknown spatial index type %v", hyper.Index)
+	}
+
+	distance := h.Distance
+	if hyper.Distance != nil {
+		distance, err = hyper.Distance.Distance()
+		if err != nil {
+			return err
+		}
+	}
+
+	h.Distance = distance
+	if hyper.Distance != nil {
+		h.DistanceSpec = hyper.Distance
+	}
+	h.minClusterSize = hyper.MinClusterSize
+	h.minSamples = hyper.MinSamples
+	h.indexType = hyper.Index
+
+	h.trainingSet = data.TrainingSet
+	h.coreDistances = nil
+	h.guesses = nil
+	h.clusterDistances = nil
+	if learned {
+		h.coreDistances = data.CoreDistances
+		h.guesses = data.Labels
+		h.clusterDistances = data.ClusterDistances
+	}
+	h.probabilities = nil
+	h.core = nil
+	h.index = nil
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// training set, clusters and hyperparameters of the model
+// to the file, which can be restored later
+func (h *HDBSCAN) PersistToFile(path string) error {
+	return base.PersistModel(path, h)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and assigns the model it's operating on's training set,
+// clusters and hyperparameters to those persisted
+func (h *HDBSCAN) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, h)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (h *HDBSCAN) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, h)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (h *HDBSCAN) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, h)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (h *HDBSCAN) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(h)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (h *HDBSCAN) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, h)
+}
@@ -0,0 +1,324 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHDBSCANShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(61))
+	points, labels := noisyBlobs(r, 800, 20)
+
+	var guesses []int
+	for _, index := range []IndexType{BruteForceIndex, KDTreeIndex, BallTreeIndex, VPTreeIndex} {
+		model := NewHDBSCAN(15, points, base.EuclideanDistance)
+		model.Output = ioutil.Discard
+		assert.Nil(t, model.UpdateIndex(index), "Index error should be nil")
+
+		err := model.Learn()
+		assert.Nil(t, err, "Learning error should be nil")
+		assert.Equal(t, 4, model.Clusters(), "HDBSCAN should find the 4 blobs")
+
+		for i := range labels {
+			if labels[i] == Noise {
+				assert.Equal(t, Noise, model.Guesses()[i], "Outliers should be noise")
+			}
+		}
+
+		ari, err := AdjustedRandIndex(labels, model.Guesses())
+		assert.Nil(t, err, "Metric error should be nil")
+		assert.True(t, ari > 0.95, "HDBSCAN should find the blobs and the noise with a %v index", index)
+
+		// the clustering doesn't depend on the index
+		if guesses == nil {
+			guesses = model.Guesses()
+		}
+		assert.Equal(t, guesses, model.Guesses(), "Every exact index should give the same clustering")
+	}
+}
+
+func TestHDBSCANShouldPass2(t *testing.T) {
+	r := rand.New(rand.NewSource(62))
+
+	// a dense blob next to a sparse one, which no
+	// single ε separates from the noise around them
+	var points [][]float64
+	var labels []int
+	for i := 0; i < 300; i++ {
+		points = append(points, []float64{r.NormFloat64(), r.NormFloat64()})
+		labels = append(labels, 0)
+	}
+	for i := 0; i < 300; i++ {
+		points = append(points, []float64{100 + r.NormFloat64()*15, r.NormFloat64() * 15})
+		labels = append(labels, 1)
+	}
+
+	model := NewHDBSCAN(20, points, base.EuclideanDistance)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.UpdateMinSamples(5), "Updating the minimum samples should not return an error")
+	assert.Equal(t, 5, model.MinSamples(), "The minimum samples should be updated")
+
+	err := model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.Equal(t, 2, model.Clusters(), "HDBSCAN should find blobs of different densities")
+
+	ari, err := AdjustedRandIndex(labels, model.Guesses())
+	assert.Nil(t, err, "Metric error should be nil")
+	assert.True(t, ari > 0.9, "HDBSCAN should find blobs of different densities")
+
+	// the rings of DBSCAN are found too
+	points, labels = rings(r, 1000)
+
+	model = NewHDBSCAN(20, points, base.EuclideanDistance)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	assert.Equal(t, 2, model.Clusters(), "HDBSCAN should find both rings")
+
+	ari, err = AdjustedRandIndex(labels, model.Guesses())
+	assert.Nil(t, err, "Metric error should be nil")
+	assert.True(t, ari > 0.9, "HDBSCAN should find both rings")
+}
+
+func TestHDBSCANProbabilitiesShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(63))
+	points, _ := noisyBlobs(r, 400, 10)
+
+	model := NewHDBSCAN(10, points, base.EuclideanDistance)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	cores := make(map[int]int)
+	for i, label := range model.Guesses() {
+		p := model.Probabilities()[i]
+		assert.True(t, p >= 0 && p <= 1, "Probabilities should be between 0 and 1")
+		assert.True(t, model.CoreDistances()[i] >= 0, "Core distances can't be negative")
+
+		if label == Noise {
+			assert.Equal(t, 0.0, p, "Noise should have a probability of 0")
+			assert.False(t, model.Core()[i], "Noise can't be a core point")
+			continue
+		}
+
+		assert.True(t, p > 0, "Clustered points should have a positive probability")
+		assert.Equal(t, p == 1, model.Core()[i], "Core points should have a probability of 1")
+		if model.Core()[i] {
+			cores[label]++
+		}
+	}
+
+	for c := 0; c < model.Clusters(); c++ {
+		assert.True(t, cores[c] >= model.MinClusterSize(), "Every cluster should have core points")
+	}
+}
+
+func TestHDBSCANPredictShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(64))
+	points, _ := noisyBlobs(r, 400, 10)
+
+	model := NewHDBSCAN(10, points, base.EuclideanDistance)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.UpdateIndex(KDTreeIndex), "Index error should be nil")
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	for i, x := range points {
+		if model.Guesses()[i] == Noise {
+			continue
+		}
+
+		guess, err := model.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, float64(model.Guesses()[i]), guess[0], "Clustered points should predict their own cluster")
+	}
+
+	guess, err := model.Predict([]float64{-1010, 995})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.NotEqual(t, float64(Noise), guess[0], "Points in a blob should be in its cluster")
+
+	guess, err = model.Predict([]float64{0, 4000})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, float64(Noise), guess[0], "Points far from every blob should be noise")
+
+	_, err = model.Predict([]float64{0, 0, 0})
+	assert.NotNil(t, err, "Predicting with the wrong number of features should return an error")
+}
+
+func TestHDBSCANSpanningTreeShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(66))
+	points := randomPoints(r, 300, 3)
+
+	// sorted edges, lowest point first
+	sorted := func(edges []mstEdge) []mstEdge {
+		for i, e := range edges {
+			if e.a > e.b {
+				edges[i].a, edges[i].b = e.b, e.a
+			}
+		}
+		sort.Slice(edges, func(i, j int) bool {
+			return edges[i].less(edges[j])
+		})
+		return edges
+	}
+
+	for _, distance := range []base.DistanceMeasure{base.EuclideanDistance, base.ManhattanDistance, base.ChebyshevDistance} {
+		for _, minSamples := range []int{1, 5} {
+			model := NewHDBSCAN(10, points, distance)
+
+			coreDistances := make([]float64, len(points))
+			brute := NewBruteForce(points, distance)
+			for i, x := range points {
+				neighbors := brute.KNearest(x, minSamples)
+				coreDistances[i] = neighbors[len(neighbors)-1].Distance
+			}
+			expected := sorted(model.prim(coreDistances))
+
+			for _, indexType := range []IndexType{KDTreeIndex, BallTreeIndex, VPTreeIndex} {
+				index, err := NewIndex(indexType, points, distance)
+				assert.Nil(t, err, "Index error should be nil")
+
+				edges, ok := boruvka(index.(componentIndex), points, coreDistances)
+				assert.True(t, ok, "Borůvka's algorithm should join every point with a %v index", indexType)
+				assert.Equal(t, expected, sorted(edges), "Borůvka's algorithm should find the same tree as Prim's with a %v index", indexType)
+			}
+		}
+	}
+}
+
+func TestHDBSCANSpanningTreeShouldPass2(t *testing.T) {
+	r := rand.New(rand.NewSource(67))
+	points, _ := noisyBlobs(r, 2000, 20)
+
+	var count int
+	distance := func(x, y []float64) float64 {
+		count++
+		return base.EuclideanDistance(x, y)
+	}
+
+	model := NewHDBSCAN(15, points, distance)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.UpdateIndex(KDTreeIndex), "Index error should be nil")
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	assert.Equal(t, 4, model.Clusters(), "HDBSCAN should find the 4 blobs")
+
+	// Prim's algorithm alone compares all n²/2 pairs
+	n := len(points)
+	assert.True(t, count < n*n/4, "Learning with a tree index should take far fewer than O(n²) distances, took %v", count)
+}
+
+func TestHDBSCANPredictShouldPass2(t *testing.T) {
+	r := rand.New(rand.NewSource(68))
+	points := make([][]float64, 40)
+	for i := range points {
+		points[i] = make([]float64, 64)
+		for j := range points[i] {
+			points[i][j] = r.NormFloat64()
+		}
+	}
+
+	model := NewHDBSCAN(5, points, base.EuclideanDistance)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.UpdateIndex(LSHIndex), "Index error should be nil")
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	// the buckets of most random points hold none of
+	// the training examples, so they have no neighbors
+	var empty int
+	for i := 0; i < 100; i++ {
+		x := make([]float64, 64)
+		for j := range x {
+			x[j] = r.NormFloat64()
+		}
+
+		guess, err := model.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+		if len(model.index.KNearest(x, 10)) == 0 {
+			assert.Equal(t, float64(Noise), guess[0], "Points without neighbors should be noise")
+			empty++
+		}
+	}
+	assert.True(t, empty > 0, "Some queries should have no neighbors in the index")
+}
+
+func TestHDBSCANShouldFail1(t *testing.T) {
+	points := [][]float64{{0}, {1}, {4}, {5}}
+
+	invalid := []*HDBSCAN{
+		NewHDBSCAN(2, points, nil),
+		NewHDBSCAN(1, points, base.EuclideanDistance),
+		NewHDBSCAN(2, nil, base.EuclideanDistance),
+		NewHDBSCAN(2, [][]float64{{0}, {1, 2}, {4}, {5}}, base.EuclideanDistance),
+	}
+
+	for i, model := range invalid {
+		model.Output = ioutil.Discard
+		assert.NotNil(t, model.Learn(), "Learning with invalid model %v should return an error", i)
+	}
+
+	model := NewHDBSCAN(2, points, base.EuclideanDistance)
+	assert.NotNil(t, model.UpdateMinSamples(-1), "Negative minimum samples should return an error")
+	assert.NotNil(t, model.UpdateIndex("not an index"), "Unknown indexes should return an error")
+
+	_, err := model.Predict([]float64{1})
+	assert.NotNil(t, err, "Predicting before learning should return an error")
+
+	_, err = NewHDBSCANFromSpec(2, points, base.DistanceSpec{Name: "not registered"})
+	assert.NotNil(t, err, "Unknown distances should return an error")
+}
+
+func TestPersistHDBSCANShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(65))
+	points, _ := noisyBlobs(r, 400, 10)
+
+	model, err := NewHDBSCANFromSpec(10, points, base.ManhattanDistanceSpec())
+	assert.Nil(t, err, "Creating the model should not return an error")
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.UpdateMinSamples(5), "Updating the minimum samples should not return an error")
+	assert.Nil(t, model.UpdateIndex(VPTreeIndex), "Index error should be nil")
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	err = model.PersistToFile("/tmp/.goml/HDBSCAN.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/HDBSCAN.json")
+	assert.Nil(t, err, "Loading the model should not return an error")
+
+	restored, ok := loaded.(*HDBSCAN)
+	assert.True(t, ok, "The loaded model should be an HDBSCAN model")
+	assert.Equal(t, 10, restored.MinClusterSize(), "The restored model should keep its hyperparameters")
+	assert.Equal(t, 5, restored.MinSamples(), "The restored model should keep its hyperparameters")
+	assert.Equal(t, VPTreeIndex, restored.Index(), "The restored model should keep its index type")
+	assert.Equal(t, model.Guesses(), restored.Guesses(), "The restored model should keep its clusters")
+
+	for _, x := range append(points, []float64{0, 0}, []float64{990, 1020}) {
+		g1, _ := model.Predict(x)
+		g2, err := restored.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, g1, g2, "The restored model should predict like the original")
+	}
+
+	// models persisted before learning can be
+	// restored and learn later
+	model = NewHDBSCAN(10, points, base.EuclideanDistance)
+	bytes, err := model.MarshalBinary()
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	restored = NewHDBSCAN(0, nil, base.EuclideanDistance)
+	restored.Output = ioutil.Discard
+	assert.Nil(t, restored.UnmarshalBinary(bytes), "Restoring a model which hasn't learned should not return an error")
+	assert.Equal(t, len(points), restored.Examples(), "The restored model should keep its training set")
+	assert.Nil(t, restored.Learn(), "Learning error should be nil")
+
+	env := &base.Envelope{Type: hdbscanType}
+	err = env.Encode(hdbscanHyperparameters{MinClusterSize: 2}, hdbscanData{
+		TrainingSet:   [][]float64{{1, 2}, {3, 4}},
+		CoreDistances: []float64{1, 1},
+		Labels:        []int{0, 1},
+	})
+	assert.Nil(t, err, "Encoding the envelope should not return an error")
+	assert.NotNil(t, restored.UnmarshalEnvelope(env), "Restoring labels of unknown clusters should return an error")
+}
@@ -0,0 +1,603 @@
+package cluster
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+
+	"github.com/admpub/goml/base"
+)
+
+// HNSWParams holds the parameters of an HNSW graph,
+// which trade recall for speed
+type HNSWParams struct {
+	// M is the number of links every point makes on
+	// each layer of the graph (2M on the bottom layer.)
+	// More links give better recall, especially in high
+	// dimensions, but take more memory and slow down
+	// queries. Defaults to 16.
+	M int `json:"m"`
+
+	// EfConstruction is the number of candidates kept
+	// while searching for the neighbors of a point being
+	// inserted. Larger values build a better graph more
+	// slowly. Defaults to 200.
+	EfConstruction int `json:"ef_construction"`
+
+	// EfSearch is the number of candidates kept while
+	// searching (at least k.) This is the main recall
+	// knob at query time. Defaults to 50.
+	EfSearch int `json:"ef_search"`
+
+	// Seed seeds the random layer assignment of
+	// points, so building the same graph twice gives
+	// the same graph
+	Seed int64 `json:"seed"`
+}
+
+// DefaultHNSWParams returns the default parameters
+// of an HNSW graph
+func DefaultHNSWParams() HNSWParams {
+	return HNSWParams{
+		M:              16,
+		EfConstruction: 200,
+		EfSearch:       50,
+		Seed:           1,
+	}
+}
+
+// withDefaults returns the parameters with every
+// unset (non-positive) value set to its default
+func (p HNSWParams) withDefaults() HNSWParams {
+	defaults := DefaultHNSWParams()
+	if p.M < 2 {
+		p.M = defaults.M
+	}
+	if p.EfConstruction < 1 {
+		p.EfConstruction = defaults.EfConstruction
+	}
+	if p.EfSearch < 1 {
+		p.EfSearch = defaults.EfSearch
+	}
+
+	return p
+}
+
+// HNSW (Hierarchical Navigable Small World) is an
+// approximate SpatialIndex: a graph linking every point
+// to points near it, in layers which get sparser going
+// up. Queries greedily walk the graph from the top layer
+// down, so they only compute distances to a small part
+// of the points, even in high dimensions where the tree
+// indexes end up looking at most of them.
+//
+// https://arxiv.org/abs/1603.09320
+//
+// Results are approximate: some true neighbors may be
+// missed (raise EfSearch or M to find more of them.)
+// Points can be added at any time with Insert, and
+// removed with Remove, but an HNSW isn't safe to change
+// concurrently with other calls. Removed points stay in
+// the graph (queries still walk through them) but are
+// never returned, so rebuild a graph once most of its
+// points are removed.
+//
+// The graph (with its points) can be persisted like the
+// models. The distance measure isn't persisted, so set
+// Distance again after restoring a graph.
+type HNSW struct {
+	Distance base.DistanceMeasure
+
+	params HNSWParams
+
+	// points holds the indexed points, and links the
+	// neighbors of every point on every layer it's on
+	points [][]float64
+	links  [][][]int
+
+	// removed marks the points removed
+	// from the graph
+	removed []bool
+
+	// entry is the point queries start from, which
+	// is on the top layer of the graph
+	entry    int
+	maxLayer int
+
+	rng *rand.Rand
+}
+
+// NewHNSW builds an HNSW graph over the given points
+// with the given parameters (unset parameters take
+// their default value)
+func NewHNSW(points [][]float64, distance base.DistanceMeasure, params HNSWParams) *HNSW {
+	params = params.withDefaults()
+
+	h := &HNSW{
+		Distance: distance,
+		params:   params,
+
+		points: make([][]float64, 0, len(points)),
+		links:  make([][][]int, 0, len(points)),
+
+		entry:    -1,
+		maxLayer: -1,
+
+		rng: rand.New(rand.NewSource(params.Seed)),
+	}
+
+	for _, x := range points {
+		h.Insert(x)
+	}
+
+	return h
+}
+
+// Params returns the parameters of the graph
+func (h *HNSW) Params() HNSWParams {
+	return h.params
+}
+
+// UpdateEfSearch sets the number of candidates kept
+// while searching, which can be changed at any time
+func (h *HNSW) UpdateEfSearch(ef int) {
+	if ef < 1 {
+		ef = DefaultHNSWParams().EfSearch
+	}
+
+	h.params.EfSearch = ef
+}
+
+// Len returns the number of indexed points (removed
+// points included)
+func (h *HNSW) Len() int {
+	return len(h.points)
+}
+
+// Remove removes the point with the given index, so
+// queries don't return it anymore
+func (h *HNSW) Remove(i int) {
+	if i < 0 || i >= len(h.points) || h.removed[i] {
+		return
+	}
+
+	h.removed[i] = true
+}
+
+// maxLinks returns the most links a point can have
+// on the given layer
+func (h *HNSW) maxLinks(layer int) int {
+	if layer == 0 {
+		return 2 * h.params.M
+	}
+
+	return h.params.M
+}
+
+// randomLayer draws the top layer of a new point,
+// with exponentially fewer points on higher layers
+func (h *HNSW) randomLayer() int {
+	mL := 1 / math.Log(float64(h.params.M))
+	return int(math.Floor(-math.Log(1-h.rng.Float64()) * mL))
+}
+
+// Insert adds x to the graph, linking it to its
+// neighbors, and returns its index
+func (h *HNSW) Insert(x []float64) int {
+	id := len(h.points)
+	layer := h.randomLayer()
+
+	h.points = append(h.points, x)
+	h.links = append(h.links, make([][]int, layer+1))
+	h.removed = append(h.removed, false)
+
+	if h.entry == -1 {
+		h.entry = id
+		h.maxLayer = layer
+		return id
+	}
+
+	// walk down to the layer of the new point, then
+	// link it to its neighbors on every layer it's on
+	entry := []Neighbor{{Index: h.entry, Distance: h.Distance(x, h.points[h.entry])}}
+	for l := h.maxLayer; l > layer; l-- {
+		entry = h.searchLayer(x, entry, 1, l, false)
+	}
+
+	for l := minInt(layer, h.maxLayer); l >= 0; l-- {
+		candidates := h.searchLayer(x, entry, h.params.EfConstruction, l, false)
+		neighbors := h.selectNeighbors(candidates, h.params.M)
+
+		h.links[id][l] = make([]int, len(neighbors))
+		for s, n := range neighbors {
+			h.links[id][l][s] = n.Index
+			h.link(n.Index, id, n.Distance, l)
+		}
+
+		entry = candidates
+	}
+
+	if layer > h.maxLayer {
+		h.entry = id
+		h.maxLayer = layer
+	}
+
+	return id
+}
+
+// link adds a link from point a to point b (at the
+// given distance) on the layer, pruning the links of
+// a if it has too many
+func (h *HNSW) link(a, b int, distance float64, layer int) {
+	h.links[a][layer] = append(h.links[a][layer], b)
+
+	limit := h.maxLinks(layer)
+	if len(h.links[a][layer]) <= limit {
+		return
+	}
+
+	candidates := make([]Neighbor, len(h.links[a][layer]))
+	for s, n := range h.links[a][layer] {
+		d := distance
+		if n != b {
+			d = h.Distance(h.points[a], h.points[n])
+		}
+		candidates[s] = Neighbor{Index: n, Distance: d}
+	}
+	sortNeighbors(candidates)
+
+	neighbors := h.selectNeighbors(candidates, limit)
+
+	h.links[a][layer] = h.links[a][layer][:0]
+	for _, n := range neighbors {
+		h.links[a][layer] = append(h.links[a][layer], n.Index)
+	}
+}
+
+// selectNeighbors picks at most m neighbors from the
+// candidates (sorted nearest first) with the heuristic
+// of the HNSW paper: a candidate is preferred if it's
+// closer to the point than to every neighbor picked so
+// far, which keeps links spread out in every direction
+// instead of all going into one nearby cluster. Other
+// candidates fill in any remaining spots.
+func (h *HNSW) selectNeighbors(candidates []Neighbor, m int) []Neighbor {
+	if len(candidates) <= m {
+		return candidates
+	}
+
+	selected := make([]Neighbor, 0, m)
+	var skipped []Neighbor
+
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+
+		good := true
+		for _, s := range selected {
+			if h.Distance(h.points[c.Index], h.points[s.Index]) < c.Distance {
+				good = false
+				break
+			}
+		}
+
+		if good {
+			selected = append(selected, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+
+	for _, c := range skipped {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, c)
+	}
+
+	sortNeighbors(selected)
+	return selected
+}
+
+// searchLayer returns (up to) the ef points nearest to
+// x on the layer found by a best first search of the
+// graph from the entry points, nearest first. If
+// skipRemoved is true, removed points are searched
+// through but left out of the results.
+func (h *HNSW) searchLayer(x []float64, entry []Neighbor, ef, layer int, skipRemoved bool) []Neighbor {
+	visited := make(map[int]bool, ef*4)
+
+	candidates := &candidateHeap{}
+	results := newNeighborHeap(ef)
+
+	offer := func(n Neighbor) {
+		if !skipRemoved || !h.removed[n.Index] {
+			results.offer(n.Index, n.Distance)
+		}
+	}
+
+	for _, e := range entry {
+		visited[e.Index] = true
+		heap.Push(candidates, e)
+		offer(e)
+	}
+
+	for candidates.Len() != 0 {
+		c := heap.Pop(candidates).(Neighbor)
+		if c.Distance > results.bound() {
+			break
+		}
+
+		for _, n := range h.links[c.Index][layer] {
+			if visited[n] {
+				continue
+			}
+			visited[n] = true
+
+			d := h.Distance(x, h.points[n])
+			if d <= results.bound() {
+				heap.Push(candidates, Neighbor{Index: n, Distance: d})
+				offer(Neighbor{Index: n, Distance: d})
+			}
+		}
+	}
+
+	return results.sorted()
+}
+
+// search returns (up to) the ef points nearest to x
+// on the bottom layer of the graph, leaving out
+// removed points
+func (h *HNSW) search(x []float64, ef int) []Neighbor {
+	if h.entry == -1 {
+		return nil
+	}
+
+	entry := []Neighbor{{Index: h.entry, Distance: h.Distance(x, h.points[h.entry])}}
+	for l := h.maxLayer; l > 0; l-- {
+		entry = h.searchLayer(x, entry, 1, l, false)
+	}
+
+	return h.searchLayer(x, entry, ef, 0, true)
+}
+
+// KNearest returns (approximately) the k points
+// nearest to x
+func (h *HNSW) KNearest(x []float64, k int) []Neighbor {
+	if k <= 0 {
+		return []Neighbor{}
+	}
+
+	ef := h.params.EfSearch
+	if k > ef {
+		ef = k
+	}
+
+	neighbors := h.search(x, ef)
+	if len(neighbors) > k {
+		neighbors = neighbors[:k]
+	}
+
+	return neighbors
+}
+
+// Radius returns (approximately) every point within
+// distance r of x, by searching for more and more
+// neighbors until the furthest found is beyond r
+func (h *HNSW) Radius(x []float64, r float64) []Neighbor {
+	for ef := h.params.EfSearch; ; ef *= 2 {
+		neighbors := h.search(x, ef)
+
+		if len(neighbors) < ef || neighbors[len(neighbors)-1].Distance > r {
+			var within []Neighbor
+			for _, n := range neighbors {
+				if n.Distance <= r {
+					within = append(within, n)
+				}
+			}
+
+			return within
+		}
+	}
+}
+
+// removedIndexes returns the indexes of the points
+// marked as removed
+func removedIndexes(removed []bool) []int {
+	var indexes []int
+	for i := range removed {
+		if removed[i] {
+			indexes = append(indexes, i)
+		}
+	}
+
+	return indexes
+}
+
+// minInt returns the smaller of two ints
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// candidateHeap is a min heap of neighbors, so the
+// nearest candidate is always on top
+type candidateHeap []Neighbor
+
+func (c candidateHeap) Len() int { return len(c) }
+func (c candidateHeap) Less(i, j int) bool {
+	return further(c[j], c[i])
+}
+func (c candidateHeap) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c *candidateHeap) Push(x interface{}) {
+	*c = append(*c, x.(Neighbor))
+}
+func (c *candidateHeap) Pop() interface{} {
+	old := *c
+	last := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return last
+}
+
+// hnswHyperparameters holds the parameters of an
+// HNSW graph as saved in its envelope
+type hnswHyperparameters struct {
+	Params HNSWParams `json:"params"`
+}
+
+// hnswData is the data of an HNSW envelope
+type hnswData struct {
+	Points   [][]float64 `json:"points"`
+	Links    [][][]int   `json:"links"`
+	Entry    int         `json:"entry"`
+	MaxLayer int         `json:"max_layer"`
+	Removed  []int       `json:"removed,omitempty"`
+}
+
+// hnswType is the name HNSW graphs are registered
+// and persisted under
+const hnswType = "cluster.HNSW"
+
+func init() {
+	base.RegisterModel(hnswType, func() base.Persistable {
+		return NewHNSW(nil, nil, DefaultHNSWParams())
+	})
+}
+
+// MarshalEnvelope returns the graph, along with its
+// parameters, wrapped in a base.Envelope. The data of
+// the envelope is the points, their links and which of
+// them were removed.
+func (h *HNSW) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(h.points) != 0 {
+		features = len(h.points[0])
+	}
+
+	env := &base.Envelope{
+		Type: hnswType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+		Metadata: base.TrainingMetadata{
+			Examples: len(h.points),
+		},
+	}
+
+	err := env.Encode(hnswHyperparameters{
+		Params: h.params,
+	}, hnswData{
+		Points:   h.points,
+		Links:    h.links,
+		Entry:    h.entry,
+		MaxLayer: h.maxLayer,
+		Removed:  removedIndexes(h.removed),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the graph from the given
+// base.Envelope. The distance measure of the graph is
+// kept.
+func (h *HNSW) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := hnswHyperparameters{
+		Params: h.params,
+	}
+
+	var data hnswData
+	err := env.Decode(hnswType, &hyper, &data)
+	if err != nil {
+		return err
+	}
+
+	if len(data.Points) != len(data.Links) {
+		return fmt.Errorf("ERROR: HNSW has %v points but links for %v", len(data.Points), len(data.Links))
+	}
+	if len(data.Points) == 0 {
+		data.Entry = -1
+		data.MaxLayer = -1
+	} else if data.Entry < 0 || data.Entry >= len(data.Points) || len(data.Links[data.Entry]) != data.MaxLayer+1 {
+		return fmt.Errorf("ERROR: HNSW entry point %v isn't on the top layer (%v) of the graph", data.Entry, data.MaxLayer)
+	}
+	for i := range data.Links {
+		if len(data.Links[i]) == 0 || len(data.Links[i]) > data.MaxLayer+1 {
+			return fmt.Errorf("ERROR: HNSW point %v is on %v layers but the graph has %v", i, len(data.Links[i]), data.MaxLayer+1)
+		}
+		for l := range data.Links[i] {
+			for _, n := range data.Links[i][l] {
+				if n < 0 || n >= len(data.Points) || len(data.Links[n]) <= l {
+					return fmt.Errorf("ERROR: HNSW point %v links to %v, which isn't a point on layer %v", i, n, l)
+				}
+			}
+		}
+	}
+
+	removed := make([]bool, len(data.Points))
+	for _, i := range data.Removed {
+		if i < 0 || i >= len(data.Points) {
+			return fmt.Errorf("ERROR: HNSW removed point %v isn't a point of the graph", i)
+		}
+		removed[i] = true
+	}
+
+	params := hyper.Params.withDefaults()
+
+	h.params = params
+	h.points = data.Points
+	h.links = data.Links
+	h.entry = data.Entry
+	h.maxLayer = data.MaxLayer
+	h.removed = removed
+
+	// keep drawing layers from a different sequence
+	// than the one the graph was built with
+	h.rng = rand.New(rand.NewSource(params.Seed + int64(len(data.Points))))
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// graph to the file, which can be restored later.
+func (h *HNSW) PersistToFile(path string) error {
+	return base.PersistModel(path, h)
+}
+
+// RestoreFromFile takes in a path to a persisted graph
+// and restores the graph from it.
+func (h *HNSW) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, h)
+}
+
+// WriteTo writes the persisted graph (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (h *HNSW) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, h)
+}
+
+// ReadFrom restores the graph from a persisted graph
+// read from r until EOF, implementing io.ReaderFrom
+func (h *HNSW) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, h)
+}
+
+// MarshalBinary returns the persisted graph as bytes,
+// implementing encoding.BinaryMarshaler
+func (h *HNSW) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(h)
+}
+
+// UnmarshalBinary restores the graph from the bytes of
+// a persisted graph, implementing encoding.BinaryUnmarshaler
+func (h *HNSW) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, h)
+}
@@ -0,0 +1,162 @@
+package cluster
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recall returns the fraction of the true k nearest
+// neighbors of the queries the index finds
+func recall(index SpatialIndex, points, queries [][]float64, distance base.DistanceMeasure, k int) float64 {
+	brute := NewBruteForce(points, distance)
+
+	var found, total int
+	for _, q := range queries {
+		neighbors := make(map[int]bool)
+		for _, n := range index.KNearest(q, k) {
+			neighbors[n.Index] = true
+		}
+
+		for _, n := range brute.KNearest(q, k) {
+			total++
+			if neighbors[n.Index] {
+				found++
+			}
+		}
+	}
+
+	return float64(found) / float64(total)
+}
+
+// nearPoints returns n queries near randomly chosen
+// points
+func nearPoints(r *rand.Rand, points [][]float64, n int) [][]float64 {
+	queries := make([][]float64, n)
+	for i := range queries {
+		x := points[r.Intn(len(points))]
+		queries[i] = make([]float64, len(x))
+		for j := range x {
+			queries[i][j] = x[j] + r.NormFloat64()*0.5
+		}
+	}
+
+	return queries
+}
+
+func TestHNSWShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	points := randomPoints(r, 2000, 32)
+	queries := nearPoints(r, points, 50)
+
+	index := NewHNSW(points, base.EuclideanDistance, HNSWParams{})
+	assert.Equal(t, DefaultHNSWParams().M, index.Params().M, "Unset parameters should take their default")
+	assert.Equal(t, DefaultHNSWParams().EfSearch, index.Params().EfSearch, "Unset parameters should take their default")
+	assert.Equal(t, len(points), index.Len(), "HNSW should index every point")
+
+	assert.True(t, recall(index, points, queries, base.EuclideanDistance, 10) > 0.9, "HNSW should find most of the true neighbors")
+
+	// neighbors should be sorted, and an indexed point
+	// should be its own nearest neighbor
+	neighbors := index.KNearest(points[7], 10)
+	assert.Len(t, neighbors, 10, "HNSW should find k neighbors")
+	assert.Equal(t, 0.0, neighbors[0].Distance, "An indexed point should be its own nearest neighbor")
+	for i := 1; i < len(neighbors); i++ {
+		assert.True(t, neighbors[i-1].Distance <= neighbors[i].Distance, "Neighbors should be sorted by distance")
+	}
+
+	radius := neighbors[len(neighbors)-1].Distance
+	within := index.Radius(points[7], radius)
+	assert.True(t, len(within) >= len(neighbors), "Radius should find at least the neighbors within the radius")
+	for _, n := range within {
+		assert.True(t, n.Distance <= radius, "Radius should only return points within the radius")
+	}
+
+	assert.Empty(t, index.KNearest(points[0], 0), "Searching for 0 neighbors should find nothing")
+	assert.Empty(t, NewHNSW(nil, base.EuclideanDistance, HNSWParams{}).KNearest(points[0], 5), "An empty graph should find nothing")
+}
+
+func TestHNSWShouldPass2(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	points := randomPoints(r, 1500, 24)
+	queries := nearPoints(r, points, 50)
+
+	// inserting points one by one should index them
+	// just as well as building over all of them
+	index := NewHNSW(points[:500], base.EuclideanDistance, HNSWParams{M: 8, EfConstruction: 100})
+	for i, x := range points[500:] {
+		assert.Equal(t, 500+i, index.Insert(x), "Insert should return the index of the new point")
+	}
+	assert.Equal(t, len(points), index.Len(), "HNSW should index every inserted point")
+
+	index.UpdateEfSearch(10)
+	low := recall(index, points, queries, base.EuclideanDistance, 10)
+
+	index.UpdateEfSearch(200)
+	high := recall(index, points, queries, base.EuclideanDistance, 10)
+
+	assert.True(t, high >= low, "Searching more candidates should find more true neighbors")
+	assert.True(t, high > 0.9, "HNSW should find most of the true neighbors")
+
+	index.UpdateEfSearch(0)
+	assert.Equal(t, DefaultHNSWParams().EfSearch, index.Params().EfSearch, "An invalid EfSearch should be set to the default")
+}
+
+func TestPersistHNSWShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	points := randomPoints(r, 500, 8)
+
+	index := NewHNSW(points, base.EuclideanDistance, HNSWParams{M: 6, Seed: 11})
+
+	err := index.PersistToFile("/tmp/.goml/HNSW.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	model, err := base.Load("/tmp/.goml/HNSW.json")
+	assert.Nil(t, err, "Loading the index should not return an error")
+
+	restored, ok := model.(*HNSW)
+	assert.True(t, ok, "The loaded model should be an HNSW graph")
+	assert.Equal(t, index.Params(), restored.Params(), "The restored graph should keep its parameters")
+
+	// the distance isn't persisted
+	restored.Distance = base.EuclideanDistance
+
+	for _, q := range randomPoints(r, 20, 8) {
+		assert.Equal(t, index.KNearest(q, 5), restored.KNearest(q, 5), "The restored graph should find the same neighbors")
+	}
+
+	// the restored graph should keep growing
+	x := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+	assert.Equal(t, len(points), restored.Insert(x), "Insert should return the index of the new point")
+	assert.Equal(t, len(points), restored.KNearest(x, 1)[0].Index, "An inserted point should be its own nearest neighbor")
+
+	// removed points stay removed
+	for i := 0; i < len(points); i += 2 {
+		restored.Remove(i)
+	}
+	bytes, err := restored.MarshalBinary()
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	again := NewHNSW(nil, base.EuclideanDistance, HNSWParams{})
+	assert.Nil(t, again.UnmarshalBinary(bytes), "Restoring a graph with removed points should not return an error")
+	for _, q := range randomPoints(r, 20, 8) {
+		neighbors := again.KNearest(q, 5)
+		assert.Equal(t, restored.KNearest(q, 5), neighbors, "The restored graph should find the same neighbors")
+		for _, n := range neighbors {
+			assert.True(t, n.Index%2 == 1 || n.Index == len(points), "The restored graph shouldn't find removed points")
+		}
+	}
+
+	env := &base.Envelope{Type: hnswType}
+	err = env.Encode(hnswHyperparameters{Params: DefaultHNSWParams()}, hnswData{
+		Points: [][]float64{{1, 2}, {3, 4}},
+		Links:  [][][]int{{{1}}},
+	})
+	assert.Nil(t, err, "Encoding the envelope should not return an error")
+
+	err = restored.UnmarshalEnvelope(env)
+	assert.NotNil(t, err, "Restoring a graph without links for every point should return an error")
+}
@@ -0,0 +1,576 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/admpub/goml/base"
+)
+
+// KCriterion is a criterion for picking the best
+// number of clusters k out of a KSelection
+type KCriterion string
+
+const (
+	// ElbowCriterion picks the k at the knee of the
+	// distortion curve: the point furthest below the
+	// line joining the distortions of the smallest and
+	// largest k, after scaling both axes to [0, 1]
+	ElbowCriterion KCriterion = "elbow"
+
+	// SilhouetteCriterion picks the k with the highest
+	// mean silhouette
+	SilhouetteCriterion KCriterion = "silhouette"
+
+	// CalinskiHarabaszCriterion picks the k with the
+	// highest Calinski-Harabasz index
+	CalinskiHarabaszCriterion KCriterion = "calinski_harabasz"
+
+	// DaviesBouldinCriterion picks the k with the
+	// lowest Davies-Bouldin index
+	DaviesBouldinCriterion KCriterion = "davies_bouldin"
+
+	// GapCriterion picks the smallest k whose gap
+	// statistic is within one standard error of the
+	// gap of k + 1 (or the k with the biggest gap if
+	// there's no such k,) as described by Tibshirani,
+	// Walther and Hastie.
+	//
+	// https://statweb.stanford.edu/~gwalther/gap
+	GapCriterion KCriterion = "gap"
+)
+
+// DefaultGapReferences is the number of reference
+// datasets the gap statistic is computed from unless
+// changed with UpdateGapReferences
+const DefaultGapReferences = 10
+
+// KScore holds the clustering a KSelector found for
+// one number of clusters K, along with its quality
+// under every criterion. Criteria which aren't defined
+// for the clustering (the silhouette, Calinski-Harabasz
+// and Davies-Bouldin indexes when K is 1, or the gap
+// statistic when it's turned off or the distortion is
+// 0) are NaN.
+type KScore struct {
+	K int
+
+	// Distortion is the sum of the squared distances
+	// from every example to its centroid
+	Distortion float64
+
+	Silhouette       float64
+	CalinskiHarabasz float64
+	DaviesBouldin    float64
+
+	// Gap is the gap statistic of the clustering and
+	// GapError its standard error
+	Gap      float64
+	GapError float64
+
+	Centroids [][]float64
+	Guesses   []int
+}
+
+// KSelection holds the scores of every number of
+// clusters tried by a KSelector, in increasing
+// order of K
+type KSelection struct {
+	Scores []KScore
+}
+
+// Best returns the score of the number of clusters
+// picked by the given criterion. An error is returned
+// if the criterion is unknown or isn't defined for any
+// of the clusterings (the elbow needs at least 3 values
+// of K, for example.)
+func (s *KSelection) Best(criterion KCriterion) (KScore, error) {
+	best := -1
+
+	switch criterion {
+	case ElbowCriterion:
+		if len(s.Scores) < 3 {
+			return KScore{}, fmt.Errorf("ERROR: the elbow criterion needs at least 3 values of k - given %v", len(s.Scores))
+		}
+
+		first, last := s.Scores[0], s.Scores[len(s.Scores)-1]
+		span := first.Distortion - last.Distortion
+
+		// a flat curve has no knee, so the smallest
+		// k explains the data as well as any other
+		var furthest float64
+		best = 0
+		for i, score := range s.Scores {
+			if span <= 0 {
+				break
+			}
+
+			x := float64(score.K-first.K) / float64(last.K-first.K)
+			y := (score.Distortion - last.Distortion) / span
+			if below := 1 - x - y; below > furthest {
+				furthest = below
+				best = i
+			}
+		}
+
+	case SilhouetteCriterion:
+		best = s.extreme(func(score KScore) float64 { return score.Silhouette }, 1)
+
+	case CalinskiHarabaszCriterion:
+		best = s.extreme(func(score KScore) float64 { return score.CalinskiHarabasz }, 1)
+
+	case DaviesBouldinCriterion:
+		best = s.extreme(func(score KScore) float64 { return score.DaviesBouldin }, -1)
+
+	case GapCriterion:
+		for i := 0; i+1 < len(s.Scores); i++ {
+			next := s.Scores[i+1]
+			if !math.IsNaN(s.Scores[i].Gap) && s.Scores[i].Gap >= next.Gap-next.GapError {
+				best = i
+				break
+			}
+		}
+
+		if best < 0 {
+			best = s.extreme(func(score KScore) float64 { return score.Gap }, 1)
+		}
+
+	default:
+		return KScore{}, fmt.Errorf("ERROR: unknown k selection criterion %q", criterion)
+	}
+
+	if best < 0 {
+		return KScore{}, fmt.Errorf("ERROR: the %v criterion isn't defined for any of the clusterings", criterion)
+	}
+
+	return s.Scores[best], nil
+}
+
+// extreme returns the index of the score with the
+// highest value (or lowest, if sign is -1,) skipping
+// NaN values, or -1 if every value is NaN
+func (s *KSelection) extreme(value func(KScore) float64, sign float64) int {
+	best := -1
+	for i, score := range s.Scores {
+		v := value(score)
+		if !math.IsNaN(v) && (best < 0 || sign*v > sign*value(s.Scores[best])) {
+			best = i
+		}
+	}
+
+	return best
+}
+
+// String implements the fmt interface for clean
+// printing, as a table of the scores of every K
+func (s *KSelection) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "K\tDistortion\tSilhouette\tCalinski-Harabasz\tDavies-Bouldin\tGap\n")
+	for _, score := range s.Scores {
+		fmt.Fprintf(&buf, "%v\t%.6g\t%.4f\t%.6g\t%.4f\t%.4f ± %.4f\n", score.K, score.Distortion, score.Silhouette, score.CalinskiHarabasz, score.DaviesBouldin, score.Gap, score.GapError)
+	}
+
+	return buf.String()
+}
+
+/*
+KSelector clusters a training set with K-Means for
+every number of clusters K in a range (in parallel,)
+and scores every clustering so you can pick the
+number of clusters which fits the data best instead
+of guessing it up front. The scores are:
+
+    - the distortion, for finding the elbow of the
+      distortion curve
+    - the mean silhouette
+    - the Calinski-Harabasz index
+    - the Davies-Bouldin index
+    - the gap statistic, which compares the distortion
+      with the distortion of clustering reference
+      datasets drawn uniformly over the bounding box
+      of the training set
+
+Every K is clustered as many times as the number of
+restarts (from a different k-means++ instantiation,)
+keeping the clustering with the lowest distortion.
+
+Example K Selection:
+
+	selector := NewKSelector(1, 10, 25, data)
+	selector.UpdateSeed(42)
+
+	selection, err := selector.Select()
+	if err != nil {
+		panic("error selecting k")
+	}
+
+	best, err := selection.Best(SilhouetteCriterion)
+	if err != nil {
+		panic("no best k")
+	}
+
+	// best.K is the number of clusters, and best.Centroids
+	// and best.Guesses the clustering found for it
+	model := NewKMeans(best.K, 25, data)
+*/
+type KSelector struct {
+	minK, maxK    int
+	maxIterations int
+
+	trainingSet [][]float64
+
+	// restarts is the number of clusterings of
+	// every K, references the number of reference
+	// datasets of the gap statistic (0 turns it off)
+	// and silhouetteSample the number of examples
+	// the silhouette is averaged over (0 for all of
+	// them)
+	restarts         int
+	references       int
+	silhouetteSample int
+
+	// workers is the number of values of K
+	// clustered at the same time
+	workers int
+
+	// rng is the source of randomness the seeds of
+	// every clustering are drawn from. It's seeded
+	// from the current time unless the selector is
+	// given a seed with UpdateSeed.
+	rng *rand.Rand
+
+	// Output is the io.Writer to write
+	// logging to. Defaults to os.Stdout
+	// but can be changed to any io.Writer
+	Output io.Writer
+}
+
+// NewKSelector returns a pointer to a selector trying
+// every number of clusters from minK to maxK (both
+// included,) running K-Means for maxIterations
+// iterations on the training set for each one. By
+// default every K is clustered once, the gap statistic
+// uses DefaultGapReferences reference datasets and as
+// many values of K as there are CPUs are clustered at
+// once.
+func NewKSelector(minK, maxK, maxIterations int, trainingSet [][]float64) *KSelector {
+	return &KSelector{
+		minK:          minK,
+		maxK:          maxK,
+		maxIterations: maxIterations,
+
+		trainingSet: trainingSet,
+
+		restarts:   1,
+		references: DefaultGapReferences,
+		workers:    runtime.NumCPU(),
+
+		rng:    base.NewTimeSeededRandom(),
+		Output: os.Stdout,
+	}
+}
+
+// UpdateTrainingSet takes in a new training set (variable x.)
+func (s *KSelector) UpdateTrainingSet(trainingSet [][]float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("ERROR: length of given training set is 0! Need data!")
+	}
+
+	s.trainingSet = trainingSet
+
+	return nil
+}
+
+// UpdateRestarts sets the number of times every K is
+// clustered, keeping the clustering with the lowest
+// distortion
+func (s *KSelector) UpdateRestarts(restarts int) error {
+	if restarts < 1 {
+		return fmt.Errorf("ERROR: number of restarts must be at least 1 - given %v", restarts)
+	}
+
+	s.restarts = restarts
+
+	return nil
+}
+
+// UpdateGapReferences sets the number of reference
+// datasets the gap statistic is computed from. 0
+// turns the gap statistic off, which is much faster as
+// every reference is clustered for every K.
+func (s *KSelector) UpdateGapReferences(references int) error {
+	if references < 0 {
+		return fmt.Errorf("ERROR: number of gap references can't be negative - given %v", references)
+	}
+
+	s.references = references
+
+	return nil
+}
+
+// UpdateSilhouetteSample sets the number of examples
+// (drawn at random) the silhouette is averaged over.
+// The silhouette takes O(n²) distances over the whole
+// training set, so sampling it can save a lot of time
+// on large training sets. 0 uses every example.
+func (s *KSelector) UpdateSilhouetteSample(examples int) error {
+	if examples < 0 {
+		return fmt.Errorf("ERROR: silhouette sample size can't be negative - given %v", examples)
+	}
+
+	s.silhouetteSample = examples
+
+	return nil
+}
+
+// UpdateWorkers sets the number of values of K which
+// are clustered at the same time. The selection doesn't
+// depend on the number of workers.
+func (s *KSelector) UpdateWorkers(workers int) error {
+	if workers < 1 {
+		return fmt.Errorf("ERROR: number of workers must be at least 1 - given %v", workers)
+	}
+
+	s.workers = workers
+
+	return nil
+}
+
+// UpdateSeed seeds the selector's source of randomness
+// so selection is reproducible
+func (s *KSelector) UpdateSeed(seed int64) {
+	s.rng = base.NewRandom(seed)
+}
+
+// UpdateRandom replaces the selector's source of
+// randomness
+func (s *KSelector) UpdateRandom(r *rand.Rand) {
+	s.rng = r
+}
+
+// Examples returns the number of training examples (m)
+// that the selector is clustering
+func (s *KSelector) Examples() int {
+	return len(s.trainingSet)
+}
+
+// MaxIterations returns the number of iterations of
+// every K-Means clustering
+func (s *KSelector) MaxIterations() int {
+	return s.maxIterations
+}
+
+// validate checks the range of K and the training set
+func (s *KSelector) validate() error {
+	if s.minK < 1 || s.maxK < s.minK {
+		return fmt.Errorf("ERROR: k must range from at least 1 up - given %v to %v", s.minK, s.maxK)
+	}
+
+	if len(s.trainingSet) == 0 || len(s.trainingSet[0]) == 0 {
+		return fmt.Errorf("ERROR: Attempting to select k with no training examples!")
+	}
+
+	if s.maxK >= len(s.trainingSet) {
+		return fmt.Errorf("ERROR: k must be smaller than the number of training examples (%v) - given %v", len(s.trainingSet), s.maxK)
+	}
+
+	for i := range s.trainingSet {
+		if len(s.trainingSet[i]) != len(s.trainingSet[0]) {
+			return fmt.Errorf("ERROR: training example %v has %v features - expected %v", i, len(s.trainingSet[i]), len(s.trainingSet[0]))
+		}
+	}
+
+	return nil
+}
+
+// referenceSets returns the reference datasets of the
+// gap statistic, each drawn uniformly over the
+// bounding box of the training set
+func (s *KSelector) referenceSets() [][][]float64 {
+	features := len(s.trainingSet[0])
+
+	low := append([]float64{}, s.trainingSet[0]...)
+	high := append([]float64{}, s.trainingSet[0]...)
+	for _, x := range s.trainingSet {
+		for l := range x {
+			low[l] = math.Min(low[l], x[l])
+			high[l] = math.Max(high[l], x[l])
+		}
+	}
+
+	sets := make([][][]float64, s.references)
+	for b := range sets {
+		sets[b] = make([][]float64, len(s.trainingSet))
+		for i := range sets[b] {
+			sets[b][i] = make([]float64, features)
+			for l := range sets[b][i] {
+				sets[b][i][l] = low[l] + s.rng.Float64()*(high[l]-low[l])
+			}
+		}
+	}
+
+	return sets
+}
+
+// cluster runs K-Means with k clusters on the points
+// as many times as the number of restarts, returning
+// the centroids with the lowest distortion, the guesses
+// for every point (to those centroids) and the
+// distortion
+func (s *KSelector) cluster(points [][]float64, k int, r *rand.Rand) ([][]float64, []int, float64) {
+	var best [][]float64
+	bestDistortion := math.Inf(1)
+
+	for restart := 0; restart < s.restarts; restart++ {
+		model := NewKMeans(k, s.maxIterations, points)
+		model.Output = ioutil.Discard
+		model.UpdateSeed(r.Int63())
+
+		// the training set was validated already, so
+		// learning can't fail
+		model.Learn()
+
+		var distortion float64
+		for _, x := range points {
+			_, d := nearest(x, model.Centroids)
+			distortion += d
+		}
+
+		if distortion < bestDistortion {
+			best = model.Centroids
+			bestDistortion = distortion
+		}
+	}
+
+	guesses := make([]int, len(points))
+	for i, x := range points {
+		guesses[i], _ = nearest(x, best)
+	}
+
+	return best, guesses, bestDistortion
+}
+
+// score clusters the training set (and every reference
+// dataset) with k clusters and scores the clustering
+func (s *KSelector) score(k int, seed int64, references [][][]float64) KScore {
+	r := base.NewRandom(seed)
+
+	centroids, guesses, distortion := s.cluster(s.trainingSet, k, r)
+	score := KScore{
+		K:                k,
+		Distortion:       distortion,
+		Silhouette:       math.NaN(),
+		CalinskiHarabasz: math.NaN(),
+		DaviesBouldin:    math.NaN(),
+		Gap:              math.NaN(),
+		GapError:         math.NaN(),
+		Centroids:        centroids,
+		Guesses:          guesses,
+	}
+
+	// with k > 1 but every example in the same cluster
+	// (repeated examples, say) the metrics aren't
+	// defined, and stay NaN
+	index, clusters := clusterIndex(guesses)
+	if clusters > 1 {
+		indices := make([]int, len(s.trainingSet))
+		for i := range indices {
+			indices[i] = i
+		}
+		if s.silhouetteSample > 0 && s.silhouetteSample < len(indices) {
+			indices = r.Perm(len(indices))[:s.silhouetteSample]
+		}
+
+		var sum float64
+		for _, sample := range silhouette(s.trainingSet, index, clusters, base.EuclideanDistance, indices) {
+			sum += sample
+		}
+		score.Silhouette = sum / float64(len(indices))
+
+		score.CalinskiHarabasz, _ = CalinskiHarabasz(s.trainingSet, guesses)
+		score.DaviesBouldin, _ = DaviesBouldin(s.trainingSet, guesses)
+	}
+
+	// the log of a distortion of 0 (every example on
+	// a centroid) is -∞, so the gap isn't defined and
+	// stays NaN
+	if len(references) != 0 && distortion > 0 {
+		logs := make([]float64, len(references))
+
+		var mean float64
+		for b := range references {
+			_, _, w := s.cluster(references[b], k, r)
+			if w <= 0 {
+				return score
+			}
+
+			logs[b] = math.Log(w)
+			mean += logs[b] / float64(len(references))
+		}
+
+		var variance float64
+		for b := range logs {
+			variance += (logs[b] - mean) * (logs[b] - mean) / float64(len(logs))
+		}
+
+		score.Gap = mean - math.Log(distortion)
+		score.GapError = math.Sqrt(variance) * math.Sqrt(1+1/float64(len(references)))
+	}
+
+	return score
+}
+
+// Select clusters the training set with every number
+// of clusters in the range, and returns the scores of
+// every clustering. The seeds of every clustering are
+// drawn before clustering starts, so the selection
+// doesn't depend on the number of workers.
+func (s *KSelector) Select() (*KSelection, error) {
+	err := s.validate()
+	if err != nil {
+		fmt.Fprintf(s.Output, err.Error()+"\n")
+		return nil, err
+	}
+
+	fmt.Fprintf(s.Output, "Selecting K:\n\tModel: K-Means++ Classification\n\tTraining Examples: %v\n\tFeatures: %v\n\tK: %v to %v\n\tGap References: %v\n...\n\n", len(s.trainingSet), len(s.trainingSet[0]), s.minK, s.maxK, s.references)
+
+	references := s.referenceSets()
+
+	selection := &KSelection{
+		Scores: make([]KScore, s.maxK-s.minK+1),
+	}
+
+	seeds := make([]int64, len(selection.Scores))
+	for i := range seeds {
+		seeds[i] = s.rng.Int63()
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < s.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				selection.Scores[i] = s.score(s.minK+i, seeds[i], references)
+			}
+		}()
+	}
+
+	for i := range selection.Scores {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	fmt.Fprintf(s.Output, "Selection Completed.\n%v\n", selection)
+
+	return selection, nil
+}
@@ -0,0 +1,158 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKSelectorShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(21))
+	points, labels := blobs(r, 400)
+
+	selector := NewKSelector(1, 8, 20, points)
+	selector.Output = ioutil.Discard
+	selector.UpdateSeed(42)
+	assert.Nil(t, selector.UpdateRestarts(2), "Updating the restarts should not return an error")
+	assert.Nil(t, selector.UpdateGapReferences(5), "Updating the gap references should not return an error")
+
+	selection, err := selector.Select()
+	assert.Nil(t, err, "Selection error should be nil")
+	assert.Len(t, selection.Scores, 8, "Every k should be scored")
+
+	for i, score := range selection.Scores {
+		assert.Equal(t, i+1, score.K, "Scores should be in order of k")
+		assert.Len(t, score.Centroids, score.K, "Every score should hold its clustering")
+		assert.Len(t, score.Guesses, len(points), "Every score should hold its clustering")
+		assert.False(t, math.IsNaN(score.Gap), "The gap statistic should be computed for every k")
+		if i > 0 {
+			assert.True(t, score.Distortion <= selection.Scores[i-1].Distortion, "Distortion should shrink with k")
+		}
+	}
+	assert.True(t, math.IsNaN(selection.Scores[0].Silhouette), "The silhouette isn't defined for one cluster")
+
+	for _, criterion := range []KCriterion{ElbowCriterion, SilhouetteCriterion, CalinskiHarabaszCriterion, DaviesBouldinCriterion, GapCriterion} {
+		best, err := selection.Best(criterion)
+		assert.Nil(t, err, "Picking the best k should not return an error")
+		assert.Equal(t, 4, best.K, "The %v criterion should find the 4 blobs", criterion)
+	}
+
+	best, _ := selection.Best(SilhouetteCriterion)
+	assertSameClustering(t, labels, best.Guesses)
+
+	// the selection doesn't depend on the number
+	// of workers, given the same seed
+	for _, workers := range []int{1, 5} {
+		again := NewKSelector(1, 8, 20, points)
+		again.Output = ioutil.Discard
+		again.UpdateSeed(42)
+		again.UpdateRestarts(2)
+		again.UpdateGapReferences(5)
+		assert.Nil(t, again.UpdateWorkers(workers), "Updating the workers should not return an error")
+
+		other, err := again.Select()
+		assert.Nil(t, err, "Selection error should be nil")
+		for i := range other.Scores {
+			assert.Equal(t, selection.Scores[i].Centroids, other.Scores[i].Centroids, "Selections with the same seed should find the same clusterings")
+			assert.Equal(t, selection.Scores[i].Gap, other.Scores[i].Gap, "Selections with the same seed should compute the same gap")
+		}
+	}
+}
+
+func TestKSelectorShouldPass2(t *testing.T) {
+	r := rand.New(rand.NewSource(22))
+	points, _ := blobs(r, 600)
+
+	selector := NewKSelector(2, 6, 20, points)
+	selector.Output = ioutil.Discard
+	selector.UpdateSeed(7)
+	assert.Nil(t, selector.UpdateGapReferences(0), "Turning the gap statistic off should not return an error")
+	assert.Nil(t, selector.UpdateSilhouetteSample(100), "Updating the silhouette sample should not return an error")
+
+	selection, err := selector.Select()
+	assert.Nil(t, err, "Selection error should be nil")
+
+	for _, score := range selection.Scores {
+		assert.True(t, math.IsNaN(score.Gap), "The gap statistic should be turned off")
+	}
+
+	best, err := selection.Best(SilhouetteCriterion)
+	assert.Nil(t, err, "Picking the best k should not return an error")
+	assert.Equal(t, 4, best.K, "The sampled silhouette should find the 4 blobs")
+
+	_, err = selection.Best(GapCriterion)
+	assert.NotNil(t, err, "The gap criterion should return an error without the gap statistic")
+
+	_, err = selection.Best("bogus")
+	assert.NotNil(t, err, "An unknown criterion should return an error")
+
+	short := &KSelection{Scores: selection.Scores[:2]}
+	_, err = short.Best(ElbowCriterion)
+	assert.NotNil(t, err, "The elbow criterion should need 3 values of k")
+}
+
+func TestKSelectorShouldPass3(t *testing.T) {
+	// two distinct examples, so every k > 1
+	// puts each one on a centroid
+	points := [][]float64{{0, 0}, {0, 0}, {0, 0}, {5, 5}, {5, 5}, {5, 5}}
+
+	selector := NewKSelector(1, 3, 10, points)
+	selector.Output = ioutil.Discard
+	selector.UpdateSeed(3)
+
+	selection, err := selector.Select()
+	assert.Nil(t, err, "Selection error should be nil")
+
+	assert.False(t, math.IsNaN(selection.Scores[0].Gap), "The gap statistic should be computed for k = 1")
+	for _, score := range selection.Scores[1:] {
+		assert.Equal(t, 0.0, score.Distortion, "Every example should be on a centroid")
+		assert.True(t, math.IsNaN(score.Gap), "The gap statistic isn't defined for a distortion of 0")
+		assert.True(t, math.IsNaN(score.GapError), "The gap statistic isn't defined for a distortion of 0")
+	}
+}
+
+func TestKSelectorShouldFail1(t *testing.T) {
+	points := [][]float64{{0}, {1}, {4}, {5}}
+
+	invalid := []*KSelector{
+		NewKSelector(0, 2, 10, points),
+		NewKSelector(3, 2, 10, points),
+		NewKSelector(1, 4, 10, points),
+		NewKSelector(1, 2, 10, nil),
+		NewKSelector(1, 2, 10, [][]float64{{0}, {1, 2}, {4}, {5}}),
+	}
+
+	for i, selector := range invalid {
+		selector.Output = ioutil.Discard
+		_, err := selector.Select()
+		assert.NotNil(t, err, "Selecting with invalid selector %v should return an error", i)
+	}
+
+	selector := NewKSelector(1, 2, 10, points)
+	assert.NotNil(t, selector.UpdateRestarts(0), "0 restarts should return an error")
+	assert.NotNil(t, selector.UpdateGapReferences(-1), "Negative gap references should return an error")
+	assert.NotNil(t, selector.UpdateSilhouetteSample(-1), "A negative silhouette sample should return an error")
+	assert.NotNil(t, selector.UpdateWorkers(0), "0 workers should return an error")
+	assert.NotNil(t, selector.UpdateTrainingSet(nil), "An empty training set should return an error")
+}
+
+// assertSameClustering checks the guesses put points
+// in the same clusters as the labels, up to the
+// numbering of the clusters
+func assertSameClustering(t *testing.T, labels, guesses []int) {
+	mapping := make(map[int]int)
+	used := make(map[int]bool)
+	for i := range labels {
+		if c, ok := mapping[labels[i]]; ok {
+			assert.Equal(t, c, guesses[i], "Every point of a cluster should be in the same cluster")
+			continue
+		}
+
+		assert.False(t, used[guesses[i]], "Every cluster should be found once")
+		mapping[labels[i]] = guesses[i]
+		used[guesses[i]] = true
+	}
+}
@@ -0,0 +1,288 @@
+package cluster
+
+import (
+	"math"
+	"sort"
+
+	"github.com/admpub/goml/base"
+)
+
+// KDTree is a SpatialIndex which recursively splits
+// the points in two halves at the median of the axis
+// along which they're most spread out. A query only
+// looks into the far side of a split when the query
+// point is closer to the splitting plane than the
+// neighbors found so far.
+//
+// https://en.wikipedia.org/wiki/K-d_tree
+//
+// The distance to a splitting plane is measured with
+// the tree's distance measure itself (as the distance
+// to the query point moved onto the plane,) so the tree
+// is exact for any distance where moving a point closer
+// along one axis never takes it further away, which
+// includes Euclidean, Manhattan, Minkowski, Chebyshev
+// and weighted Euclidean distances. For other distances
+// use a BallTree or a VPTree.
+//
+// KD-trees work best on data with few dimensions (say
+// less than 20.)
+type KDTree struct {
+	Distance base.DistanceMeasure
+
+	points [][]float64
+	root   *kdNode
+
+	// nodes is the number of nodes of the tree
+	nodes int
+}
+
+// kdNode is a node of a KDTree. Leaves hold the
+// indices of their points, while inner nodes split
+// their points along axis at split: points with
+// x[axis] <= split go left, the others right. Nodes
+// are numbered by id, in the order they're built.
+type kdNode struct {
+	id int
+
+	axis  int
+	split float64
+
+	left  *kdNode
+	right *kdNode
+
+	indices []int
+}
+
+// NewKDTree builds a KDTree over the given points,
+// splitting nodes until they hold at most leafSize
+// points (DefaultLeafSize if leafSize < 1)
+func NewKDTree(points [][]float64, distance base.DistanceMeasure, leafSize int) *KDTree {
+	if leafSize < 1 {
+		leafSize = DefaultLeafSize
+	}
+
+	indices := make([]int, len(points))
+	for i := range indices {
+		indices[i] = i
+	}
+
+	tree := &KDTree{
+		Distance: distance,
+		points:   points,
+	}
+	if len(points) != 0 {
+		tree.root = tree.build(indices, leafSize)
+	}
+
+	return tree
+}
+
+// build returns the subtree holding the given points
+func (t *KDTree) build(indices []int, leafSize int) *kdNode {
+	id := t.nodes
+	t.nodes++
+
+	if len(indices) <= leafSize {
+		return &kdNode{id: id, indices: indices}
+	}
+
+	// split along the axis with the largest spread
+	axis := -1
+	var spread float64
+	for j := range t.points[indices[0]] {
+		low, high := t.points[indices[0]][j], t.points[indices[0]][j]
+		for _, i := range indices[1:] {
+			if t.points[i][j] < low {
+				low = t.points[i][j]
+			}
+			if t.points[i][j] > high {
+				high = t.points[i][j]
+			}
+		}
+
+		if high-low > spread {
+			spread = high - low
+			axis = j
+		}
+	}
+
+	// every point is the same
+	if axis == -1 {
+		return &kdNode{id: id, indices: indices}
+	}
+
+	sort.Slice(indices, func(a, b int) bool {
+		return t.points[indices[a]][axis] < t.points[indices[b]][axis]
+	})
+
+	// move the median past points equal to it so
+	// both sides are split cleanly by the plane
+	median := len(indices) / 2
+	split := t.points[indices[median-1]][axis]
+	for median < len(indices) && t.points[indices[median]][axis] == split {
+		median++
+	}
+	if median == len(indices) {
+		// the lower half is all equal to the max, so
+		// split below it instead
+		median = len(indices) / 2
+		for median > 0 && t.points[indices[median-1]][axis] == t.points[indices[median]][axis] {
+			median--
+		}
+		split = t.points[indices[median-1]][axis]
+	}
+
+	return &kdNode{
+		id:    id,
+		axis:  axis,
+		split: split,
+
+		left:  t.build(indices[:median], leafSize),
+		right: t.build(indices[median:], leafSize),
+	}
+}
+
+// planeDistance returns the distance from x to the
+// splitting plane of the node, measuring it as the
+// distance from x to the point on the plane straight
+// across from it. scratch must be a copy of x, and is
+// left as it was.
+func (t *KDTree) planeDistance(x, scratch []float64, node *kdNode) float64 {
+	scratch[node.axis] = node.split
+	d := t.Distance(x, scratch)
+	scratch[node.axis] = x[node.axis]
+
+	return d
+}
+
+// KNearest returns the k points nearest to x
+func (t *KDTree) KNearest(x []float64, k int) []Neighbor {
+	h := newNeighborHeap(k)
+	if t.root != nil && k > 0 {
+		t.kNearest(t.root, x, append([]float64{}, x...), h)
+	}
+
+	return h.sorted()
+}
+
+func (t *KDTree) kNearest(node *kdNode, x, scratch []float64, h *neighborHeap) {
+	if node.indices != nil {
+		for _, i := range node.indices {
+			h.offer(i, t.Distance(x, t.points[i]))
+		}
+		return
+	}
+
+	near, far := node.left, node.right
+	if x[node.axis] > node.split {
+		near, far = far, near
+	}
+
+	t.kNearest(near, x, scratch, h)
+	if t.planeDistance(x, scratch, node) <= h.bound() {
+		t.kNearest(far, x, scratch, h)
+	}
+}
+
+// Radius returns every point within distance r of x
+func (t *KDTree) Radius(x []float64, r float64) []Neighbor {
+	var neighbors []Neighbor
+	if t.root != nil {
+		neighbors = t.radius(t.root, x, append([]float64{}, x...), r, neighbors)
+	}
+
+	sortNeighbors(neighbors)
+	return neighbors
+}
+
+func (t *KDTree) radius(node *kdNode, x, scratch []float64, r float64, neighbors []Neighbor) []Neighbor {
+	if node.indices != nil {
+		for _, i := range node.indices {
+			d := t.Distance(x, t.points[i])
+			if d <= r {
+				neighbors = append(neighbors, Neighbor{Index: i, Distance: d})
+			}
+		}
+		return neighbors
+	}
+
+	near, far := node.left, node.right
+	if x[node.axis] > node.split {
+		near, far = far, near
+	}
+
+	neighbors = t.radius(near, x, scratch, r, neighbors)
+	if t.planeDistance(x, scratch, node) <= r {
+		neighbors = t.radius(far, x, scratch, r, neighbors)
+	}
+
+	return neighbors
+}
+
+// Len returns the number of indexed points
+func (t *KDTree) Len() int {
+	return len(t.points)
+}
+
+// labelNodes labels every node of the tree for the
+// searches of Borůvka's algorithm (see componentIndex)
+func (t *KDTree) labelNodes(s *componentSearch) {
+	s.resizeNodes(t.nodes)
+	if t.root != nil {
+		t.label(t.root, s)
+	}
+}
+
+func (t *KDTree) label(node *kdNode, s *componentSearch) {
+	s.startNode(node.id)
+	if node.indices != nil {
+		for _, i := range node.indices {
+			s.addPoint(node.id, i)
+		}
+		return
+	}
+
+	t.label(node.left, s)
+	t.label(node.right, s)
+	s.addChild(node.id, node.left.id)
+	s.addChild(node.id, node.right.id)
+}
+
+// nearestOutside searches for the lightest edge from x
+// out of its component (see componentIndex)
+func (t *KDTree) nearestOutside(x []float64, s *componentSearch) {
+	if t.root != nil {
+		t.outside(t.root, x, append([]float64{}, x...), 0, s)
+	}
+}
+
+// outside searches the subtree at node, given the
+// smallest distance its points could be from x
+func (t *KDTree) outside(node *kdNode, x, scratch []float64, lowerBound float64, s *componentSearch) {
+	if s.prune(node.id, lowerBound) {
+		return
+	}
+
+	if node.indices != nil {
+		for _, i := range node.indices {
+			if s.candidate(i) {
+				s.offer(i, t.Distance(x, t.points[i]))
+			}
+		}
+		return
+	}
+
+	near, far := node.left, node.right
+	if x[node.axis] > node.split {
+		near, far = far, near
+	}
+
+	t.outside(near, x, scratch, lowerBound, s)
+
+	// only measure the distance to the plane if
+	// the far side isn't all in the component
+	if s.nodeComponent[far.id] != s.component[s.point] {
+		t.outside(far, x, scratch, math.Max(lowerBound, t.planeDistance(x, scratch, node)), s)
+	}
+}
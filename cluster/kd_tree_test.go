@@ -0,0 +1,41 @@
+package cluster
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKDTreeShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(73))
+	points := randomPoints(r, 1000, 4)
+
+	// the distance to a splitting plane is measured
+	// with the distance itself, so weighted distances
+	// are exact as well
+	distance := base.WeightedEuclideanDistance([]float64{1, 10, 0.1, 3})
+
+	for _, leafSize := range []int{0, 1, 5, 50} {
+		tree := NewKDTree(points, distance, leafSize)
+		assertSameQueries(t, tree, points, distance, r, "KD-tree")
+	}
+}
+
+func TestKDTreeShouldPass2(t *testing.T) {
+	// many points sharing a coordinate shouldn't
+	// break the median split
+	var points [][]float64
+	for i := 0; i < 200; i++ {
+		points = append(points, []float64{1, float64(i % 3)})
+	}
+	points = append(points, []float64{2, 0}, []float64{0, 0})
+
+	tree := NewKDTree(points, base.EuclideanDistance, 2)
+	assertSameQueries(t, tree, points, base.EuclideanDistance, rand.New(rand.NewSource(79)), "KD-tree")
+
+	neighbors := tree.Radius([]float64{1, 1}, 0)
+	assert.Len(t, neighbors, 67, "Every copy of (1, 1) should be found")
+}
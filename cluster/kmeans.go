@@ -1,13 +1,10 @@
 package cluster
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math/rand"
 	"os"
-	"time"
 
 	"github.com/admpub/goml/base"
 )
@@ -135,6 +132,12 @@ type KMeans struct {
 
 	Centroids [][]float64 `json:"centroids"`
 
+	// rng is the model's source of randomness
+	// for instantiating centroids. It's seeded
+	// from the current time unless the model is
+	// given a seed with UpdateSeed.
+	rng *rand.Rand
+
 	// Output is the io.Writer to write
 	// logging to. Defaults to os.Stdout
 	// but can be changed to any io.Writer
@@ -178,16 +181,12 @@ func NewKMeans(k, maxIterations int, trainingSet [][]float64, params ...OnlinePa
 	var guesses []int
 	guesses = make([]int, len(trainingSet))
 
-	rand.Seed(time.Now().UTC().Unix())
 	centroids := make([][]float64, k)
 	for i := range centroids {
 		centroids[i] = make([]float64, features)
-		for j := range centroids[i] {
-			centroids[i][j] = 10 * (rand.Float64() - 0.5)
-		}
 	}
 
-	return &KMeans{
+	model := &KMeans{
 		maxIterations: maxIterations,
 
 		alpha: alpha,
@@ -196,8 +195,45 @@ func NewKMeans(k, maxIterations int, trainingSet [][]float64, params ...OnlinePa
 		guesses:     guesses,
 
 		Centroids: centroids,
+		rng:       base.NewTimeSeededRandom(),
 		Output:    os.Stdout,
 	}
+
+	return model
+}
+
+// randomizeCentroids sets every centroid to a random
+// vector if no centroids are set yet (every centroid
+// is still the zero vector NewKMeans starts with,)
+// which is where online learning starts from
+func (k *KMeans) randomizeCentroids() {
+	for i := range k.Centroids {
+		for j := range k.Centroids[i] {
+			if k.Centroids[i][j] != 0 {
+				return
+			}
+		}
+	}
+
+	for i := range k.Centroids {
+		for j := range k.Centroids[i] {
+			k.Centroids[i][j] = 10 * (k.rng.Float64() - 0.5)
+		}
+	}
+}
+
+// UpdateSeed seeds the model's source of randomness
+// so learning is reproducible. Learned (or restored)
+// centroids are kept, and the random centroids online
+// learning starts from are only drawn when it starts.
+func (k *KMeans) UpdateSeed(seed int64) {
+	k.UpdateRandom(base.NewRandom(seed))
+}
+
+// UpdateRandom replaces the model's source of
+// randomness, keeping the model's centroids
+func (k *KMeans) UpdateRandom(r *rand.Rand) {
+	k.rng = r
 }
 
 // UpdateTrainingSet takes in a new training set (variable x.)
@@ -298,8 +334,10 @@ func (k *KMeans) Learn() error {
 
 	fmt.Fprintf(k.Output, "Training:\n\tModel: K-Means++ Classification\n\tTraining Examples: %v\n\tFeatures: %v\n\tClasses: %v\n...\n\n", examples, features, centroids)
 
-	// instantiate the centroids using k-means++
-	k.Centroids[0] = k.trainingSet[rand.Intn(len(k.trainingSet))]
+	// instantiate the centroids using k-means++. The
+	// centroids are copies of the examples so updating
+	// them doesn't change the training set
+	k.Centroids[0] = append([]float64{}, k.trainingSet[k.rng.Intn(len(k.trainingSet))]...)
 
 	distances := make([]float64, len(k.trainingSet))
 	for i := 1; i < len(k.Centroids); i++ {
@@ -317,12 +355,12 @@ func (k *KMeans) Learn() error {
 			sum += distances[j]
 		}
 
-		target := rand.Float64() * sum
+		target := k.rng.Float64() * sum
 		j := 0
 		for sum = distances[0]; sum < target; sum += distances[j] {
 			j++
 		}
-		k.Centroids[i] = k.trainingSet[j]
+		k.Centroids[i] = append([]float64{}, k.trainingSet[j]...)
 
 	}
 
@@ -363,7 +401,7 @@ func (k *KMeans) Learn() error {
 			// reinitialize it to a random vector
 			if classCount[j] == 0 {
 				for l := range k.Centroids[j] {
-					k.Centroids[j][l] = 10 * (rand.Float64() - 0.5)
+					k.Centroids[j][l] = 10 * (k.rng.Float64() - 0.5)
 				}
 				continue
 			}
@@ -503,6 +541,10 @@ func (k *KMeans) OnlineLearn(errors chan error, dataset chan base.Datapoint, onU
 		return
 	}
 
+	// start from random centroids, unless the model
+	// already has some (learned or restored)
+	k.randomizeCentroids()
+
 	centroids := len(k.Centroids)
 	features := len(k.Centroids[0])
 
@@ -518,7 +560,8 @@ func (k *KMeans) OnlineLearn(errors chan error, dataset chan base.Datapoint, onU
 
 		if more {
 			if len(point.X) != features {
-				errors <- fmt.Errorf("ERROR: point.X must have the same dimensions as clusters (len %v). Point: %v", point)
+				errors <- fmt.Errorf("ERROR: point.X must have the same dimensions as clusters (len %v). Point: %v", features, point)
+				continue
 			}
 
 			minDiff := diff(point.X, k.Centroids[0])
@@ -592,56 +635,124 @@ func (k *KMeans) SaveClusteredData(filepath string) error {
 	return base.SaveDataToCSV(filepath, k.trainingSet, floatGuesses, true)
 }
 
-// PersistToFile takes in an absolute filepath and saves the
-// centroid vector to the file, which can be restored later.
-// The function will take paths from the current directory, but
-// functions
-//
-// The data is stored as JSON because it's one of the most
-// efficient storage method (you only need one comma extra
-// per feature + two brackets, total!) And it's extendable.
-func (k *KMeans) PersistToFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+// kmeansHyperparameters holds the hyperparameters
+// of the k-means models as saved in their envelopes.
+// Alpha is only used by the online version of KMeans.
+type kmeansHyperparameters struct {
+	MaxIterations int     `json:"max_iterations"`
+	Alpha         float64 `json:"alpha"`
+}
+
+// kmeansType is the name KMeans models are
+// registered and persisted under
+const kmeansType = "cluster.KMeans"
+
+func init() {
+	base.RegisterModel(kmeansType, func() base.Persistable {
+		return NewKMeans(0, 0, nil)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// hyperparameters, wrapped in a base.Envelope. The data
+// of the envelope is the centroid vector.
+func (k *KMeans) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(k.Centroids) != 0 {
+		features = len(k.Centroids[0])
 	}
 
-	bytes, err := json.Marshal(k.Centroids)
+	env := &base.Envelope{
+		Type: kmeansType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+		Metadata: base.TrainingMetadata{
+			Examples: len(k.trainingSet),
+		},
+	}
+
+	err := env.Encode(kmeansHyperparameters{
+		MaxIterations: k.maxIterations,
+		Alpha:         k.alpha,
+	}, k.Centroids)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's centroids,
+// as well as the hyperparameters if they were saved,
+// from the given base.Envelope
+func (k *KMeans) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := kmeansHyperparameters{
+		MaxIterations: k.maxIterations,
+		Alpha:         k.alpha,
 	}
 
-	err = ioutil.WriteFile(path, bytes, os.ModePerm)
+	var centroids [][]float64
+	err := env.Decode(kmeansType, &hyper, &centroids)
 	if err != nil {
 		return err
 	}
 
+	k.maxIterations = hyper.MaxIterations
+	k.alpha = hyper.Alpha
+	k.Centroids = centroids
+
 	return nil
 }
 
-// RestoreFromFile takes in a path to a centroid vector
-// and assigns the model it's operating on's parameter vector
-// to that.
+// PersistToFile takes in an absolute filepath and saves the
+// centroid vector to the file, which can be restored later.
+// The function will take paths from the current directory, but
+// functions
+//
+// The model is stored as a JSON base.Envelope holding the
+// centroids as well as the hyperparameters of the model.
+func (k *KMeans) PersistToFile(path string) error {
+	return base.PersistModel(path, k)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and assigns the model it's operating on's centroids
+// and hyperparameters to those persisted.
 //
 // The path must ba an absolute path or a path from the current
 // directory
 //
+// Files holding only the centroids (as persisted by older
+// versions of goml) can also be restored.
+//
 // This would be useful in persisting data between running
 // a model on data, or for graphing a dataset with a fit in
 // another framework like Julia/Gadfly.
 func (k *KMeans) RestoreFromFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
-	}
+	return base.RestoreModel(path, k)
+}
 
-	bytes, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
-	}
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (k *KMeans) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, k)
+}
 
-	err = json.Unmarshal(bytes, &k.Centroids)
-	if err != nil {
-		return err
-	}
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (k *KMeans) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, k)
+}
 
-	return nil
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (k *KMeans) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(k)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (k *KMeans) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, k)
 }
@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"testing"
@@ -540,3 +541,98 @@ func TestKMeansPersistToFileShouldPass1(t *testing.T) {
 	// save results to disk
 	assert.Nil(t, model.SaveClusteredData("/tmp/.goml/KMeansResults.csv"), "Save results error should be nil")
 }
+
+func TestLoadKMeansShouldPass1(t *testing.T) {
+	model := NewKMeans(2, 30, nil, OnlineParams{
+		Alpha:    0.25,
+		Features: 2,
+	})
+
+	assert.Nil(t, model.PersistToFile("/tmp/.goml/KMeansEnvelope.json"), "Persist error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/KMeansEnvelope.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*KMeans)
+	assert.True(t, ok, "Loaded model should be a *KMeans")
+	assert.Equal(t, model.Centroids, restored.Centroids, "Centroids should be restored")
+	assert.Equal(t, 0.25, restored.alpha, "Learning rate should be restored")
+	assert.Equal(t, 30, restored.maxIterations, "Max iterations should be restored")
+}
+
+// copyPoints returns a deep copy of points, so models
+// learning from the same data don't share centroids
+func copyPoints(points [][]float64) [][]float64 {
+	copied := make([][]float64, len(points))
+	for i := range points {
+		copied[i] = append([]float64{}, points[i]...)
+	}
+
+	return copied
+}
+
+func TestKMeansSeedShouldPass1(t *testing.T) {
+	var _ base.Randomized = NewKMeans(4, 2, nil)
+
+	models := make([]*KMeans, 2)
+	for i := range models {
+		models[i] = NewKMeans(4, 5, copyPoints(circles))
+		models[i].UpdateSeed(42)
+		assert.Nil(t, models[i].Learn(), "Learning error should be nil")
+	}
+	assert.Equal(t, models[0].Centroids, models[1].Centroids, "Models with the same seed should find the same clusters")
+	assert.Equal(t, models[0].Guesses(), models[1].Guesses(), "Models with the same seed should find the same clusters")
+
+	// online learning starts from random centroids,
+	// which are drawn from the seeded source too
+	start := func(model *KMeans) {
+		model.Output = ioutil.Discard
+		stream := make(chan base.Datapoint)
+		close(stream)
+		model.OnlineLearn(nil, stream, func([][]float64) {})
+	}
+
+	first := NewKMeans(4, 0, nil, OnlineParams{Alpha: 0.5, Features: 2})
+	second := NewKMeans(4, 0, nil, OnlineParams{Alpha: 0.5, Features: 2})
+	start(first)
+	start(second)
+	assert.NotEqual(t, first.Centroids, second.Centroids, "Models without a seed should start from different centroids")
+
+	first = NewKMeans(4, 0, nil, OnlineParams{Alpha: 0.5, Features: 2})
+	second = NewKMeans(4, 0, nil, OnlineParams{Alpha: 0.5, Features: 2})
+	first.UpdateSeed(7)
+	second.UpdateRandom(base.NewRandom(7))
+	start(first)
+	start(second)
+	assert.Equal(t, first.Centroids, second.Centroids, "Models with the same seed should start from the same centroids")
+}
+
+func TestKMeansSeedShouldPass2(t *testing.T) {
+	model := NewKMeans(4, 5, copyPoints(circles))
+	model.Output = ioutil.Discard
+	model.UpdateSeed(42)
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	err := model.PersistToFile("/tmp/.goml/KMeansSeed.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/KMeansSeed.json")
+	assert.Nil(t, err, "Loading the model should not return an error")
+
+	restored := loaded.(*KMeans)
+	centroids := copyPoints(restored.Centroids)
+
+	// seeding a learned (or restored) model keeps its
+	// centroids, even when it goes on learning online
+	restored.UpdateSeed(7)
+	assert.Equal(t, centroids, restored.Centroids, "Seeding a restored model should keep its centroids")
+
+	restored.UpdateRandom(base.NewRandom(8))
+	assert.Equal(t, centroids, restored.Centroids, "Seeding a restored model should keep its centroids")
+
+	restored.Output = ioutil.Discard
+	stream := make(chan base.Datapoint)
+	close(stream)
+	restored.OnlineLearn(nil, stream, func([][]float64) {})
+	assert.Equal(t, centroids, restored.Centroids, "Online learning should start from the restored centroids")
+}
@@ -1,8 +1,11 @@
 package cluster
 
 import (
+	"bytes"
 	"fmt"
-	"math"
+	"io"
+	"os"
+	"sort"
 
 	"github.com/admpub/goml/base"
 )
@@ -47,8 +50,28 @@ Example K-Nearest-Neighbors Model Usage:
 		panic("THERE WAS AN ERROR")
 	}
 
+	// get the probability of each class (in the
+	// order of model.Classes(),) weighting the
+	// votes of nearer neighbors more
+	err = model.UpdateWeighting(DistanceWeighting)
+	if err != nil {
+		panic("THERE WAS AN ERROR")
+	}
+
+	probabilities, err := model.PredictProbability([]float64{-10,1})
+	if err != nil {
+		panic("THERE WAS AN ERROR")
+	}
+
 	// update the K used (use 10 neighbors now)
 	model.K = 10
+
+	// search a KD-tree instead of every example
+	// (useful for large training sets)
+	err = model.UpdateIndex(KDTreeIndex)
+	if err != nil {
+		panic("THERE WAS AN ERROR")
+	}
 */
 type KNN struct {
 	// Distance holds the distance
@@ -58,6 +81,13 @@ type KNN struct {
 	// float64
 	Distance base.DistanceMeasure
 
+	// DistanceSpec describes the distance of the
+	// model when it was created from (or updated
+	// with) a base.DistanceSpec. Models with a
+	// DistanceSpec persist their distance, so
+	// restored models don't need it set again.
+	DistanceSpec *base.DistanceSpec `json:"distance,omitempty"`
+
 	// K is the number of nearest
 	// neighbors to classify based
 	// on in the KNN prediction
@@ -70,19 +100,89 @@ type KNN struct {
 	// corresponding example.
 	trainingSet     [][]float64
 	expectedResults []float64
-}
 
-// nn represents an encapsulation
-// of the Nearest Neighbor data for
-// each datapoint to facilitate easy
-// sorting
-type nn struct {
-	X []float64
-	Y float64
+	// classes holds the distinct expected
+	// results, sorted, and counts the number
+	// of examples of each
+	classes []float64
+	counts  map[float64]int
+
+	// window is the most examples the model
+	// keeps (0 for no limit,) the oldest being
+	// dropped first
+	window int
+
+	// mode is whether the model classifies or
+	// regresses, and weighting how much the
+	// neighbors count towards a prediction
+	mode      KNNMode
+	weighting NeighborWeighting
 
-	Distance float64
+	// indexType is the kind of spatial index
+	// searched for neighbors, and index the
+	// index built over the training set.
+	//
+	// hnswParams and lshParams are the parameters
+	// of the approximate indexes
+	indexType IndexType
+	index     SpatialIndex
+
+	// dropped is the number of examples dropped from
+	// the front of the training set (by the window)
+	// which are still in the index as removed points,
+	// so the example at i is the point at i + dropped
+	// in the index
+	dropped int
+
+	hnswParams HNSWParams
+	lshParams  LSHParams
+
+	// persistIndex is whether a built HNSW or
+	// LSH index is persisted with the model
+	persistIndex bool
+
+	// Output is the io.Writer to write
+	// logging to. Defaults to os.Stdout
+	// but can be changed to any io.Writer
+	Output io.Writer
 }
 
+// customIndex is the IndexType of a KNN model given
+// a SpatialIndex this package can't build
+const customIndex IndexType = "custom"
+
+// KNNMode is whether a KNN model predicts classes or
+// real values
+type KNNMode string
+
+// KNN modes
+const (
+	// ClassificationMode predicts the class with the
+	// most (weighted) votes among the neighbors. Ties go
+	// to the tied class with the nearest neighbor.
+	ClassificationMode KNNMode = "classification"
+
+	// RegressionMode predicts the (weighted) mean of
+	// the expected results of the neighbors
+	RegressionMode KNNMode = "regression"
+)
+
+// NeighborWeighting is how much each neighbor counts
+// towards a KNN prediction
+type NeighborWeighting string
+
+// Neighbor weightings
+const (
+	// UniformWeighting counts every neighbor the same
+	UniformWeighting NeighborWeighting = "uniform"
+
+	// DistanceWeighting weights every neighbor by the
+	// inverse of its distance, so nearer neighbors
+	// count more. Neighbors at distance 0 (if any) are
+	// the only ones counted.
+	DistanceWeighting NeighborWeighting = "distance"
+)
+
 // NewKNN returns a pointer to the k-means
 // model, which clusters given inputs in an
 // unsupervised manner. The algorithm only has
@@ -93,16 +193,82 @@ type nn struct {
 //
 // n is an optional parameter which (if given) assigns
 // the length of the input vector.
+//
+// Neighbors are found by comparing inputs with every
+// training example (BruteForceIndex.) Use UpdateIndex to
+// search a tree built over the training set instead.
+//
+// The model classifies by majority vote of the neighbors
+// (ClassificationMode with UniformWeighting.) Use
+// UpdateMode and UpdateWeighting to regress or weight
+// neighbors by distance.
 func NewKNN(k int, trainingSet [][]float64, expectedResults []float64, distanceMeasure base.DistanceMeasure) *KNN {
-	return &KNN{
+	model := &KNN{
 		Distance:        distanceMeasure,
 		K:               k,
 		trainingSet:     trainingSet,
 		expectedResults: expectedResults,
+
+		mode:      ClassificationMode,
+		weighting: UniformWeighting,
+
+		indexType: BruteForceIndex,
+
+		hnswParams: DefaultHNSWParams(),
+		lshParams:  DefaultLSHParams(),
+
+		Output: os.Stdout,
 	}
+	model.updateClasses()
+
+	// if the index can't be built yet it'll be
+	// built (or return the error) on Predict
+	model.buildIndex()
+
+	return model
 }
 
-// UpdateTrainingSet takes in a new training set (variable x.)
+// NewKNNFromSpec returns a new model using the distance
+// described by the given spec. Unlike models created
+// with NewKNN, the distance of these models is persisted
+// with the model, so you don't have to set it again
+// after restoring the model.
+//
+//     model, err := NewKNNFromSpec(3, x, y, base.EuclideanDistanceSpec())
+//
+// An error is returned if the spec doesn't describe a
+// valid distance.
+func NewKNNFromSpec(k int, trainingSet [][]float64, expectedResults []float64, spec base.DistanceSpec) (*KNN, error) {
+	distance, err := spec.Distance()
+	if err != nil {
+		return nil, err
+	}
+
+	model := NewKNN(k, trainingSet, expectedResults, distance)
+	model.DistanceSpec = &spec
+
+	return model, nil
+}
+
+// UpdateDistance sets the distance of the model to the
+// one described by the given spec, and rebuilds the
+// model's spatial index with it
+func (k *KNN) UpdateDistance(spec base.DistanceSpec) error {
+	distance, err := spec.Distance()
+	if err != nil {
+		return err
+	}
+
+	k.Distance = distance
+	k.DistanceSpec = &spec
+
+	return k.buildIndex()
+}
+
+// UpdateTrainingSet takes in a new training set (variable x,)
+// and builds the model's spatial index over it. If the
+// model has a window, only the newest examples that fit
+// within it are kept.
 func (k *KNN) UpdateTrainingSet(trainingSet [][]float64, expectedResults []float64) error {
 	if len(trainingSet) == 0 || len(expectedResults) == 0 {
 		return fmt.Errorf("Error: length of given data is 0! Need data!")
@@ -111,71 +277,541 @@ func (k *KNN) UpdateTrainingSet(trainingSet [][]float64, expectedResults []float
 		return fmt.Errorf("Datasets given do not match in length")
 	}
 
+	if k.window > 0 && len(trainingSet) > k.window {
+		trainingSet = trainingSet[len(trainingSet)-k.window:]
+		expectedResults = expectedResults[len(expectedResults)-k.window:]
+	}
+
 	k.trainingSet = trainingSet
 	k.expectedResults = expectedResults
+	k.updateClasses()
+
+	return k.buildIndex()
+}
+
+// updateClasses finds the distinct expected results
+// of the training set
+func (k *KNN) updateClasses() {
+	k.classes = nil
+	k.counts = make(map[float64]int)
+	for _, y := range k.expectedResults {
+		if k.counts[y] == 0 {
+			k.classes = append(k.classes, y)
+		}
+		k.counts[y]++
+	}
+
+	sort.Float64s(k.classes)
+}
+
+// UpdateWindow sets the most examples the model keeps.
+// Once the training set is full, every example added
+// (with Insert or OnlineLearn) drops the oldest one, so
+// the model slides over a stream of reference data. A
+// window of 0 (the default) keeps every example.
+//
+// Removable indexes (BruteForceIndex, HNSWIndex and
+// LSHIndex) remove dropped examples in place, and are
+// only rebuilt once they hold more removed examples than
+// examples, so sliding over a stream costs a rebuild every
+// window's worth of examples. Other indexes are rebuilt
+// the next time they're searched after examples are
+// dropped.
+func (k *KNN) UpdateWindow(size int) error {
+	if size < 0 {
+		return fmt.Errorf("ERROR: KNN window can't be negative - given %v", size)
+	}
+
+	k.window = size
+	if size > 0 && len(k.trainingSet) > size {
+		k.dropOldest(len(k.trainingSet) - size)
+	}
+
+	return nil
+}
+
+// Window returns the most examples the model keeps
+// (0 for no limit)
+func (k *KNN) Window() int {
+	return k.window
+}
+
+// dropOldest drops the n oldest examples of the
+// training set
+func (k *KNN) dropOldest(n int) {
+	for _, y := range k.expectedResults[:n] {
+		k.counts[y]--
+		if k.counts[y] == 0 {
+			delete(k.counts, y)
+
+			c := sort.SearchFloat64s(k.classes, y)
+			k.classes = append(k.classes[:c], k.classes[c+1:]...)
+		}
+	}
+
+	k.trainingSet = k.trainingSet[n:]
+	k.expectedResults = k.expectedResults[n:]
+
+	removable, ok := k.index.(RemovableIndex)
+	if !ok {
+		k.index = nil
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		removable.Remove(k.dropped + i)
+	}
+	k.dropped += n
+
+	// rebuild the index once most of it is removed
+	// examples, which can't be done for custom indexes
+	if k.dropped > len(k.trainingSet) && k.indexType != customIndex {
+		k.index = nil
+	}
+}
+
+// UpdateMode sets whether the model classifies
+// (ClassificationMode) or regresses (RegressionMode)
+func (k *KNN) UpdateMode(mode KNNMode) error {
+	if mode != ClassificationMode && mode != RegressionMode {
+		return fmt.Errorf("ERROR: Unknown KNN mode %v", mode)
+	}
+
+	k.mode = mode
+	return nil
+}
+
+// Mode returns whether the model classifies or
+// regresses
+func (k *KNN) Mode() KNNMode {
+	return k.mode
+}
+
+// UpdateWeighting sets how much each neighbor counts
+// towards predictions (UniformWeighting or
+// DistanceWeighting)
+func (k *KNN) UpdateWeighting(weighting NeighborWeighting) error {
+	if weighting != UniformWeighting && weighting != DistanceWeighting {
+		return fmt.Errorf("ERROR: Unknown neighbor weighting %v", weighting)
+	}
+
+	k.weighting = weighting
+	return nil
+}
+
+// Weighting returns how much each neighbor counts
+// towards predictions
+func (k *KNN) Weighting() NeighborWeighting {
+	return k.weighting
+}
+
+// Classes returns the distinct expected results of
+// the training set, sorted, which is the order of the
+// probabilities returned by PredictProbability
+func (k *KNN) Classes() []float64 {
+	return k.classes
+}
+
+// UpdateIndex sets the kind of spatial index the model
+// searches for neighbors, and builds it over the training
+// set. Also call it after changing the Distance of the
+// model so the index is rebuilt with the new distance.
+//
+// The tree indexes find the exact nearest neighbors, but
+// KDTreeIndex requires distances like Euclidean,
+// Manhattan, Minkowski or Chebyshev, while BallTreeIndex
+// and VPTreeIndex work with any metric. HNSWIndex and
+// LSHIndex find approximate neighbors (see
+// UpdateHNSWParams and UpdateLSHParams,) which is much
+// faster on large sets of many dimensions.
+func (k *KNN) UpdateIndex(indexType IndexType) error {
+	if indexType == customIndex {
+		return fmt.Errorf("ERROR: Use UpdateSpatialIndex to give the model a custom index")
+	}
+
+	old := k.indexType
+	k.indexType = indexType
+
+	err := k.buildIndex()
+	if err != nil {
+		k.indexType = old
+		return err
+	}
+
+	return nil
+}
+
+// UpdateHNSWParams sets the parameters used to build
+// HNSWIndex indexes, rebuilding the index if the model
+// uses one
+func (k *KNN) UpdateHNSWParams(params HNSWParams) error {
+	k.hnswParams = params.withDefaults()
+	if k.indexType == HNSWIndex {
+		return k.buildIndex()
+	}
+
+	return nil
+}
+
+// UpdateLSHParams sets the parameters used to build
+// LSHIndex indexes, rebuilding the index if the model
+// uses one
+func (k *KNN) UpdateLSHParams(params LSHParams) error {
+	k.lshParams = params.withDefaults()
+	if k.indexType == LSHIndex {
+		return k.buildIndex()
+	}
 
 	return nil
 }
 
+// UpdateSpatialIndex sets an index already built over
+// the training set (like a restored HNSW graph) as the
+// model's index, so it doesn't need to be built again.
+// The index must hold exactly the training examples,
+// in order.
+//
+// If the index isn't one of this package's (BruteForce,
+// KDTree, BallTree, VPTree, HNSW or LSH,) the model can't
+// rebuild it, so changing the training set returns an
+// error unless the index is an IncrementalIndex and
+// examples are only added with Insert (and, if the model
+// has a window, a RemovableIndex.)
+func (k *KNN) UpdateSpatialIndex(index SpatialIndex) error {
+	if index == nil {
+		return fmt.Errorf("ERROR: Attempting to use a nil spatial index!")
+	}
+	if index.Len() != len(k.trainingSet) {
+		return fmt.Errorf("ERROR: Spatial index holds %v points but the model has %v training examples", index.Len(), len(k.trainingSet))
+	}
+
+	switch i := index.(type) {
+	case *BruteForce:
+		k.indexType = BruteForceIndex
+	case *KDTree:
+		k.indexType = KDTreeIndex
+	case *BallTree:
+		k.indexType = BallTreeIndex
+	case *VPTree:
+		k.indexType = VPTreeIndex
+	case *HNSW:
+		k.indexType = HNSWIndex
+		k.hnswParams = i.Params()
+	case *LSH:
+		k.indexType = LSHIndex
+		k.lshParams = i.Params()
+	default:
+		k.indexType = customIndex
+	}
+
+	k.index = index
+	k.dropped = 0
+	return nil
+}
+
+// IndexType returns the kind of spatial index the
+// model searches for neighbors ("custom" for an index
+// given with UpdateSpatialIndex which this package
+// can't build)
+func (k *KNN) IndexType() IndexType {
+	return k.indexType
+}
+
+// SpatialIndex returns the spatial index the model
+// searches for neighbors (building it if needed,) for
+// example to persist a built HNSW graph. An index still
+// holding examples dropped by the window is rebuilt
+// first, so the index holds exactly the training set.
+func (k *KNN) SpatialIndex() (SpatialIndex, error) {
+	err := k.compactIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return k.spatialIndex()
+}
+
+// compactIndex rebuilds the model's index if it holds
+// examples dropped by the window (unless it's a custom
+// index, which can't be rebuilt)
+func (k *KNN) compactIndex() error {
+	if k.dropped == 0 || k.indexType == customIndex {
+		return nil
+	}
+
+	return k.buildIndex()
+}
+
+// Insert adds an example (and its expected result) to
+// the training set, dropping the oldest example if the
+// model's window is full (see UpdateWindow.) Incremental
+// indexes (BruteForceIndex, HNSWIndex and LSHIndex) add
+// it to the index as is, so streaming reference data in
+// is cheap. Other indexes are rebuilt the next time
+// they're searched.
+//
+// The model keeps a copy of x, so the caller can reuse
+// it.
+func (k *KNN) Insert(x []float64, y float64) error {
+	if len(k.trainingSet) != 0 && len(x) != len(k.trainingSet[0]) {
+		return fmt.Errorf("Given x (len %v) does not match dimensions of training set", len(x))
+	}
+
+	x = append([]float64{}, x...)
+
+	if k.window > 0 && len(k.trainingSet) >= k.window {
+		k.dropOldest(len(k.trainingSet) - k.window + 1)
+	}
+
+	k.trainingSet = append(k.trainingSet, x)
+	k.expectedResults = append(k.expectedResults, y)
+
+	if k.counts[y] == 0 {
+		c := sort.SearchFloat64s(k.classes, y)
+		k.classes = append(k.classes, 0)
+		copy(k.classes[c+1:], k.classes[c:])
+		k.classes[c] = y
+	}
+	k.counts[y]++
+
+	if incremental, ok := k.index.(IncrementalIndex); ok && incremental.Len()-k.dropped == len(k.trainingSet)-1 {
+		incremental.Insert(x)
+		return nil
+	}
+
+	k.index = nil
+	return nil
+}
+
+// buildIndex builds the model's spatial index over
+// the training set
+func (k *KNN) buildIndex() error {
+	k.index = nil
+	k.dropped = 0
+	if len(k.trainingSet) == 0 {
+		return nil
+	}
+
+	var index SpatialIndex
+	var err error
+
+	switch k.indexType {
+	case customIndex:
+		err = fmt.Errorf("ERROR: KNN can't rebuild the custom spatial index it was given! Give it a new index with UpdateSpatialIndex")
+	case HNSWIndex:
+		if k.Distance == nil {
+			err = fmt.Errorf("ERROR: Attempting to build a spatial index without a distance measure!")
+		} else {
+			index = NewHNSW(k.trainingSet, k.Distance, k.hnswParams)
+		}
+	case LSHIndex:
+		if k.Distance == nil {
+			err = fmt.Errorf("ERROR: Attempting to build a spatial index without a distance measure!")
+		} else {
+			index = NewLSH(k.trainingSet, k.Distance, k.lshParams)
+		}
+	default:
+		index, err = NewIndex(k.indexType, k.trainingSet, k.Distance)
+	}
+	if err != nil {
+		return err
+	}
+	k.index = index
+
+	return nil
+}
+
+// spatialIndex returns the model's spatial index,
+// building it if needed
+func (k *KNN) spatialIndex() (SpatialIndex, error) {
+	if k.index == nil {
+		err := k.buildIndex()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return k.index, nil
+}
+
 // Examples returns the number of training examples (m)
 // that the model currently is holding
 func (k *KNN) Examples() int {
 	return len(k.trainingSet)
 }
 
-// insertSorted takes a array v, and inserts u into
-// the list in the position such that the list is
-// sorted inversely. The function will not change the length
-// of v, though, such that if u would appear last
-// in the combined sorted list it would just be omitted.
+// Neighbors returns the K training examples nearest
+// to x (found with the model's spatial index,) nearest
+// first. The Index of each neighbor is the index of the
+// example in the training set. Approximate indexes can
+// return fewer than K neighbors.
 //
-// if the length of V is less than K, then u is inserted
-// without deleting the last element
-//
-// Assumes v has been sorted. Uses binary search.
-func insertSorted(u nn, v []nn, K int) []nn {
-	low := 0
-	high := len(v) - 1
-	for low <= high {
-		mid := (low + high) / 2
-		if u.Distance < v[mid].Distance {
-			high = mid - 1
-		} else if u.Distance >= v[mid].Distance {
-			low = mid + 1
-		}
+// if normalize is given as true, then the input will
+// first be normalized to unit length. Only use this if
+// you trained off of normalized inputs and are feeding
+// an un-normalized input
+func (k *KNN) Neighbors(x []float64, normalize ...bool) ([]Neighbor, error) {
+	if len(k.trainingSet) == 0 {
+		return nil, fmt.Errorf("ERROR: KNN has no training examples!")
+	}
+	if k.K < 1 {
+		return nil, fmt.Errorf("ERROR: K must be at least 1 - given %v", k.K)
+	}
+	if k.K > len(k.trainingSet) {
+		return nil, fmt.Errorf("Given K (%v) is greater than the length of the training set", k.K)
+	}
+	if len(x) != len(k.trainingSet[0]) {
+		return nil, fmt.Errorf("Given x (len %v) does not match dimensions of training set", len(x))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
 	}
 
-	if low >= len(v) && len(v) >= K {
-		return v
+	index, err := k.spatialIndex()
+	if err != nil {
+		return nil, err
 	}
 
-	sorted := append(v[:low], append([]nn{u}, v[low:]...)...)
+	neighbors := index.KNearest(x, k.K)
+	if len(neighbors) == 0 {
+		return nil, fmt.Errorf("ERROR: The spatial index didn't find any neighbors of x")
+	}
+
+	return k.trainingIndexes(neighbors), nil
+}
 
-	if len(v) < K {
-		return sorted
+// trainingIndexes shifts the indexes of neighbors found
+// in the model's index past the examples dropped by the
+// window, to their index in the training set
+func (k *KNN) trainingIndexes(neighbors []Neighbor) []Neighbor {
+	for i := range neighbors {
+		neighbors[i].Index -= k.dropped
 	}
-	return sorted[:len(v)]
+
+	return neighbors
 }
 
-// round rounds a float64
-func round(a float64) float64 {
-	if a < 0 {
-		return math.Ceil(a - 0.5)
+// weights returns how much each of the given
+// neighbors (sorted nearest first) counts towards a
+// prediction
+func (k *KNN) weights(neighbors []Neighbor) []float64 {
+	weights := make([]float64, len(neighbors))
+	if k.weighting != DistanceWeighting {
+		for i := range weights {
+			weights[i] = 1
+		}
+		return weights
+	}
+
+	// neighbors at distance 0 would have an infinite
+	// weight, so only they count
+	if neighbors[0].Distance == 0 {
+		for i := range neighbors {
+			if neighbors[i].Distance == 0 {
+				weights[i] = 1
+			}
+		}
+		return weights
 	}
-	return math.Floor(a + 0.5)
+
+	for i := range neighbors {
+		weights[i] = 1 / neighbors[i].Distance
+	}
+
+	return weights
 }
 
 // Predict takes in a variable x (an array of floats,) and
-// finds the value of the hypothesis function given the
-// current parameter vector θ
+// finds the K nearest training examples to predict its
+// class (the class with the most votes among them) in
+// ClassificationMode, or its value (the mean of their
+// expected results) in RegressionMode. Votes and means
+// are weighted as given by UpdateWeighting.
 //
 // if normalize is given as true, then the input will
 // first be normalized to unit length. Only use this if
 // you trained off of normalized inputs and are feeding
 // an un-normalized input
 func (k *KNN) Predict(x []float64, normalize ...bool) ([]float64, error) {
-	if k.K > len(k.trainingSet) {
-		return nil, fmt.Errorf("Given K (%v) is greater than the length of the training set", k.K)
+	neighbors, err := k.Neighbors(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	weights := k.weights(neighbors)
+
+	if k.mode == RegressionMode {
+		var sum, total float64
+		for i := range neighbors {
+			sum += weights[i] * k.expectedResults[neighbors[i].Index]
+			total += weights[i]
+		}
+
+		return []float64{sum / total}, nil
+	}
+
+	// take the (weighted) vote. Neighbors are sorted
+	// nearest first, so keeping the first class to reach
+	// the most votes breaks ties by the nearest neighbor
+	votes := make(map[float64]float64)
+	for i := range neighbors {
+		votes[k.expectedResults[neighbors[i].Index]] += weights[i]
+	}
+
+	var guess float64
+	best := -1.0
+	for i := range neighbors {
+		y := k.expectedResults[neighbors[i].Index]
+		if votes[y] > best {
+			best = votes[y]
+			guess = y
+		}
+	}
+
+	return []float64{guess}, nil
+}
+
+// PredictProbability takes in a variable x (an array of
+// floats,) and returns the probability of every class
+// (in the order of Classes,) which is the (weighted)
+// share of the votes of the K nearest training examples
+// it got.
+//
+// if normalize is given as true, then the input will
+// first be normalized to unit length. Only use this if
+// you trained off of normalized inputs and are feeding
+// an un-normalized input
+func (k *KNN) PredictProbability(x []float64, normalize ...bool) ([]float64, error) {
+	neighbors, err := k.Neighbors(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	weights := k.weights(neighbors)
+
+	var total float64
+	probabilities := make([]float64, len(k.classes))
+	for i := range neighbors {
+		c := sort.SearchFloat64s(k.classes, k.expectedResults[neighbors[i].Index])
+		probabilities[c] += weights[i]
+		total += weights[i]
+	}
+
+	for c := range probabilities {
+		probabilities[c] /= total
+	}
+
+	return probabilities, nil
+}
+
+// RadiusNeighbors returns every training example within
+// distance r of x (found with the model's spatial index,)
+// nearest first. The Index of each neighbor is the
+// index of the example in the training set.
+func (k *KNN) RadiusNeighbors(x []float64, r float64, normalize ...bool) ([]Neighbor, error) {
+	if len(k.trainingSet) == 0 {
+		return nil, fmt.Errorf("ERROR: KNN has no training examples!")
 	}
 	if len(x) != len(k.trainingSet[0]) {
 		return nil, fmt.Errorf("Given x (len %v) does not match dimensions of training set", len(x))
@@ -185,28 +821,390 @@ func (k *KNN) Predict(x []float64, normalize ...bool) ([]float64, error) {
 		base.NormalizePoint(x)
 	}
 
-	// initialize the neighbors as an empty
-	// slice of Neighbors. insertSorted will
-	// take care of capping the neighbors at
-	// K.
-	neighbors := []nn{}
+	index, err := k.spatialIndex()
+	if err != nil {
+		return nil, err
+	}
 
-	// calculate nearest neighbors
-	for i := range k.trainingSet {
-		dist := k.Distance(x, k.trainingSet[i])
-		neighbors = insertSorted(nn{
-			X: k.trainingSet[i],
-			Y: k.expectedResults[i],
+	return k.trainingIndexes(index.Radius(x, r)), nil
+}
 
-			Distance: dist,
-		}, neighbors, k.K)
+// OnlineLearn adds every example of the given datastream
+// to the model's training set (see Insert,) so the
+// model grows with the stream, or slides over it if the
+// model has a window (see UpdateWindow.) onUpdate is
+// called (in a new goroutine) with every added example,
+// with its expected result appended. Learning will stop
+// when the data channel is closed and all remaining
+// datapoints within the channel have been read.
+//
+// The errors channel will be closed when learning is
+// completed. Datapoints which don't match the
+// dimensions of the training set, or whose results (y)
+// don't have length 1, are skipped with an error. If
+// the model has no distance measure an error is sent
+// and learning stops immediately.
+//
+// Don't Predict while learning: the training set and
+// index are being changed.
+//
+// NOTE that there is an optional last parameter which,
+// when true, will normalize all data given on the
+// stream. Only use it if you'll normalize the inputs
+// you Predict too.
+//
+// Example Online KNN:
+//
+//     stream := make(chan base.Datapoint, 100)
+//     errors := make(chan error)
+//
+//     // keep (up to) the 1000 newest examples
+//     model := NewKNN(5, nil, nil, base.EuclideanDistance)
+//     model.UpdateWindow(1000)
+//
+//     go model.OnlineLearn(errors, stream, func(example [][]float64) {})
+//
+//     go func() {
+//         for _, x := range points {
+//             stream <- base.Datapoint{
+//                 X: x,
+//                 Y: []float64{label(x)},
+//             }
+//         }
+//
+//         close(stream)
+//     }()
+//
+//     for {
+//         err, more := <-errors
+//         if err != nil {
+//             panic("THERE WAS AN ERROR!!! RUN!!!!")
+//         }
+//         if !more {
+//             break
+//         }
+//     }
+func (k *KNN) OnlineLearn(errors chan error, dataset chan base.Datapoint, onUpdate func([][]float64), normalize ...bool) {
+	if errors == nil {
+		errors = make(chan error)
+	}
+	if dataset == nil {
+		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
+		close(errors)
+		return
+	}
+	if k.Distance == nil {
+		errors <- fmt.Errorf("ERROR: Attempting to learn without a distance measure!\n")
+		close(errors)
+		return
 	}
 
-	// take weighted vote
-	sum := 0.0
-	for i := range neighbors {
-		sum += neighbors[i].Y
+	fmt.Fprintf(k.Output, "Training:\n\tModel: K-Nearest Neighbors (%v)\n\tOptimization Method: Online Insertion\n\tK: %v\n\tWindow: %v\n...\n\n", k.mode, k.K, k.window)
+
+	norm := len(normalize) != 0 && normalize[0]
+
+	var point base.Datapoint
+	var more bool
+
+	for {
+		point, more = <-dataset
+
+		if more {
+			if norm {
+				base.NormalizePoint(point.X)
+			}
+
+			if len(point.Y) != 1 {
+				errors <- fmt.Errorf("The KNN model requires that the data results (y) have length 1 - given %v", len(point.Y))
+				continue
+			}
+
+			err := k.Insert(point.X, point.Y[0])
+			if err != nil {
+				errors <- err
+				continue
+			}
+
+			// call the OnUpdate callback with the point
+			// appended to a blank slice so the vector is
+			// passed by value and not by reference
+			go onUpdate([][]float64{append(append([]float64{}, point.X...), point.Y...)})
+		} else {
+			fmt.Fprintf(k.Output, "Training Completed.\n%v\n\n", k)
+			close(errors)
+			return
+		}
+	}
+}
+
+// String implements the fmt interface for clean printing
+func (k *KNN) String() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(fmt.Sprintf("K-Nearest Neighbors (K = %v, %v, %v weighting)\n", k.K, k.mode, k.weighting))
+	if k.DistanceSpec != nil {
+		buffer.WriteString(fmt.Sprintf("\tDistance: %v\n", k.DistanceSpec))
+	}
+	buffer.WriteString(fmt.Sprintf("\tIndex: %v\n", k.indexType))
+	buffer.WriteString(fmt.Sprintf("\tExamples: %v\n", len(k.trainingSet)))
+	if k.mode == ClassificationMode {
+		buffer.WriteString(fmt.Sprintf("\tClasses: %v\n", k.classes))
+	}
+
+	return buffer.String()
+}
+
+// UpdatePersistIndex sets whether a built HNSWIndex or
+// LSHIndex is persisted with the model. Restoring a
+// persisted index is faster than building it again over
+// a large training set, but the model takes more space.
+// Other indexes are always built again on restore.
+func (k *KNN) UpdatePersistIndex(persist bool) {
+	k.persistIndex = persist
+}
+
+// knnHyperparameters holds the hyperparameters of a
+// KNN model as saved in its envelope
+type knnHyperparameters struct {
+	K         int                `json:"k"`
+	Distance  *base.DistanceSpec `json:"distance,omitempty"`
+	Mode      KNNMode            `json:"mode"`
+	Weighting NeighborWeighting  `json:"weighting"`
+	Index     IndexType          `json:"index"`
+	HNSW      HNSWParams         `json:"hnsw"`
+	LSH       LSHParams          `json:"lsh"`
+	Window    int                `json:"window,omitempty"`
+
+	PersistIndex bool `json:"persist_index,omitempty"`
+}
+
+// knnData is the data of a KNN envelope. Index holds
+// the envelope of the built index, if it's persisted.
+type knnData struct {
+	TrainingSet     [][]float64    `json:"training_set"`
+	ExpectedResults []float64      `json:"expected_results"`
+	Index           *base.Envelope `json:"index,omitempty"`
+}
+
+// knnType is the name KNN models are registered
+// and persisted under
+const knnType = "cluster.KNN"
+
+func init() {
+	base.RegisterModel(knnType, func() base.Persistable {
+		return NewKNN(0, nil, nil, nil)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// hyperparameters (and the spec of its distance, if it
+// has one,) wrapped in a base.Envelope. The data of the
+// envelope is the training set and expected results,
+// along with the built index if it's persisted (see
+// UpdatePersistIndex.)
+//
+// Note that a distance function can't be saved on its
+// own, so if the model was created with a bare distance
+// function (and not a base.DistanceSpec) you'll have to
+// set the Distance of a restored model (and call
+// UpdateIndex) before predicting with it. An index given
+// with UpdateSpatialIndex which this package can't build
+// is saved as a BruteForceIndex.
+func (k *KNN) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(k.trainingSet) != 0 {
+		features = len(k.trainingSet[0])
+	}
+
+	env := &base.Envelope{
+		Type: knnType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+		Metadata: base.TrainingMetadata{
+			Examples: len(k.trainingSet),
+		},
+	}
+
+	indexType := k.indexType
+	if indexType == customIndex {
+		indexType = BruteForceIndex
+	}
+
+	data := knnData{
+		TrainingSet:     k.trainingSet,
+		ExpectedResults: k.expectedResults,
+	}
+
+	if k.persistIndex && (indexType == HNSWIndex || indexType == LSHIndex) {
+		index, err := k.SpatialIndex()
+		if err != nil {
+			return nil, err
+		}
+
+		if persistable, ok := index.(base.Persistable); ok && index.Len() != 0 {
+			data.Index, err = persistable.MarshalEnvelope()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err := env.Encode(knnHyperparameters{
+		K:            k.K,
+		Distance:     k.DistanceSpec,
+		Mode:         k.mode,
+		Weighting:    k.weighting,
+		Index:        indexType,
+		HNSW:         k.hnswParams,
+		LSH:          k.lshParams,
+		Window:       k.window,
+		PersistIndex: k.persistIndex,
+	}, data)
+	if err != nil {
+		return nil, err
 	}
 
-	return []float64{round(sum / float64(k.K))}, nil
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model from the given
+// base.Envelope. If the distance spec was saved, the
+// distance is rebuilt from it. Otherwise the current
+// distance is kept.
+//
+// A persisted index is restored as is (if the model has
+// a distance.) Otherwise the index is built again the
+// first time it's searched.
+func (k *KNN) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := knnHyperparameters{
+		K:            k.K,
+		Mode:         k.mode,
+		Weighting:    k.weighting,
+		Index:        k.indexType,
+		HNSW:         k.hnswParams,
+		LSH:          k.lshParams,
+		Window:       k.window,
+		PersistIndex: k.persistIndex,
+	}
+	var data knnData
+	err := env.Decode(knnType, &hyper, &data)
+	if err != nil {
+		return err
+	}
+
+	if len(data.TrainingSet) != len(data.ExpectedResults) {
+		return fmt.Errorf("ERROR: KNN has %v training examples but %v expected results", len(data.TrainingSet), len(data.ExpectedResults))
+	}
+	for i := range data.TrainingSet {
+		if len(data.TrainingSet[i]) != len(data.TrainingSet[0]) {
+			return fmt.Errorf("ERROR: KNN training example %v doesn't match the dimensions of the training set", i)
+		}
+	}
+	if hyper.Mode != ClassificationMode && hyper.Mode != RegressionMode {
+		return fmt.Errorf("ERROR: Unknown KNN mode %v", hyper.Mode)
+	}
+	if hyper.Weighting != UniformWeighting && hyper.Weighting != DistanceWeighting {
+		return fmt.Errorf("ERROR: Unknown neighbor weighting %v", hyper.Weighting)
+	}
+	switch hyper.Index {
+	case BruteForceIndex, KDTreeIndex, BallTreeIndex, VPTreeIndex, HNSWIndex, LSHIndex:
+	default:
+		return fmt.Errorf("ERROR: Unknown spatial index type %v", hyper.Index)
+	}
+	if hyper.Window < 0 {
+		return fmt.Errorf("ERROR: KNN window can't be negative - given %v", hyper.Window)
+	}
+
+	distance := k.Distance
+	if hyper.Distance != nil {
+		distance, err = hyper.Distance.Distance()
+		if err != nil {
+			return err
+		}
+	}
+
+	var index SpatialIndex
+	if data.Index != nil && distance != nil {
+		switch data.Index.Type {
+		case hnswType:
+			graph := NewHNSW(nil, distance, hyper.HNSW)
+			err = graph.UnmarshalEnvelope(data.Index)
+			index = graph
+		case lshType:
+			hashes := NewLSH(nil, distance, hyper.LSH)
+			err = hashes.UnmarshalEnvelope(data.Index)
+			index = hashes
+		default:
+			err = fmt.Errorf("ERROR: KNN can't restore a %v index", data.Index.Type)
+		}
+		if err != nil {
+			return err
+		}
+
+		if index.Len() != len(data.TrainingSet) {
+			return fmt.Errorf("ERROR: KNN index holds %v points but the model has %v training examples", index.Len(), len(data.TrainingSet))
+		}
+	}
+
+	k.Distance = distance
+	if hyper.Distance != nil {
+		k.DistanceSpec = hyper.Distance
+	}
+	k.K = hyper.K
+	k.mode = hyper.Mode
+	k.weighting = hyper.Weighting
+	k.indexType = hyper.Index
+	k.hnswParams = hyper.HNSW.withDefaults()
+	k.lshParams = hyper.LSH.withDefaults()
+	k.window = hyper.Window
+	k.persistIndex = hyper.PersistIndex
+
+	k.trainingSet = data.TrainingSet
+	k.expectedResults = data.ExpectedResults
+	k.updateClasses()
+	k.index = index
+	k.dropped = 0
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// model (its training set, hyperparameters and distance
+// spec, if it has one) to the file, which can be restored
+// later.
+//
+// The model is stored as a JSON base.Envelope.
+func (k *KNN) PersistToFile(path string) error {
+	return base.PersistModel(path, k)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores the model from it.
+func (k *KNN) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, k)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (k *KNN) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, k)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (k *KNN) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, k)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (k *KNN) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(k)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (k *KNN) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, k)
 }
@@ -2,6 +2,8 @@ package cluster
 
 import (
 	"fmt"
+	"io/ioutil"
+	"math/rand"
 	"os"
 	"testing"
 	"time"
@@ -70,117 +72,6 @@ func init() {
 	}
 }
 
-func TestInsertSortedShouldPass1(t *testing.T) {
-	sorted := insertSorted(nn{
-		Distance: 0.0,
-	}, []nn{nn{
-		Distance: -13.0,
-	}, nn{
-		Distance: -12.0,
-	}, nn{
-		Distance: -12.0,
-	}, nn{
-		Distance: -10.0,
-	}}, 4)
-
-	fmt.Printf("Sorted List: %v\n", sorted)
-
-	assert.Equal(t, 4, len(sorted), "Length of sorted array should not change")
-	assert.Equal(t, -13.0, sorted[0].Distance, "Sorted[0] should be the lowest distance given")
-	assert.Equal(t, -12.0, sorted[1].Distance, "Sorted[1] should match initial")
-	assert.Equal(t, -12.0, sorted[2].Distance, "Sorted[2] should match initial")
-	assert.Equal(t, -10.0, sorted[3].Distance, "Sorted[3] should match initial")
-}
-
-func TestInsertSortedShouldPass2(t *testing.T) {
-	sorted := insertSorted(nn{
-		Distance: 0.0,
-	}, []nn{nn{
-		Distance: 12.0,
-	}, nn{
-		Distance: 13.0,
-	}, nn{
-		Distance: 14.0,
-	}, nn{
-		Distance: 15.0,
-	}}, 4)
-
-	fmt.Printf("Sorted List: %v\n", sorted)
-
-	assert.Equal(t, 4, len(sorted), "Length of sorted array should not change")
-	assert.Equal(t, 0.0, sorted[0].Distance, "Sorted[0] should be the lowest distance given")
-	assert.Equal(t, 12.0, sorted[1].Distance, "Sorted[1] should match initial")
-	assert.Equal(t, 13.0, sorted[2].Distance, "Sorted[2] should match initial")
-	assert.Equal(t, 14.0, sorted[3].Distance, "Sorted[3] should match initial")
-}
-
-func TestInsertSortedShouldPass3(t *testing.T) {
-	sorted := insertSorted(nn{
-		Distance: 14.0,
-	}, []nn{nn{
-		Distance: 12.0,
-	}, nn{
-		Distance: 13.0,
-	}, nn{
-		Distance: 15.0,
-	}, nn{
-		Distance: 16.0,
-	}}, 4)
-
-	fmt.Printf("Sorted List: %v\n", sorted)
-
-	assert.Equal(t, 4, len(sorted), "Length of sorted array should not change")
-	assert.Equal(t, 12.0, sorted[0].Distance, "Sorted[0] should be the lowest distance given")
-	assert.Equal(t, 13.0, sorted[1].Distance, "Sorted[1] should match initial")
-	assert.Equal(t, 14.0, sorted[2].Distance, "Sorted[2] should match initial")
-	assert.Equal(t, 15.0, sorted[3].Distance, "Sorted[3] should match initial")
-}
-
-func TestInsertSortedShouldPass4(t *testing.T) {
-	sorted := insertSorted(nn{
-		Distance: 13.0,
-	}, []nn{nn{
-		Distance: 12.0,
-	}, nn{
-		Distance: 13.0,
-	}, nn{
-		Distance: 15.0,
-	}, nn{
-		Distance: 16.0,
-	}}, 4)
-
-	fmt.Printf("Sorted List: %v\n", sorted)
-
-	assert.Equal(t, 4, len(sorted), "Length of sorted array should not change")
-	assert.Equal(t, 12.0, sorted[0].Distance, "Sorted[0] should be the lowest distance given")
-	assert.Equal(t, 13.0, sorted[1].Distance, "Sorted[1] should match initial")
-	assert.Equal(t, 13.0, sorted[2].Distance, "Sorted[2] should match initial")
-	assert.Equal(t, 15.0, sorted[3].Distance, "Sorted[3] should match initial")
-}
-
-func TestInsertSortedShouldPass5(t *testing.T) {
-	sorted := insertSorted(nn{
-		Distance: 13.0,
-	}, []nn{nn{
-		Distance: 12.0,
-	}, nn{
-		Distance: 13.0,
-	}, nn{
-		Distance: 15.0,
-	}, nn{
-		Distance: 16.0,
-	}}, 6)
-
-	fmt.Printf("Sorted List: %v\n", sorted)
-
-	assert.Equal(t, 5, len(sorted), "Length of sorted array should allow entry")
-	assert.Equal(t, 12.0, sorted[0].Distance, "Sorted[0] should be the lowest distance given")
-	assert.Equal(t, 13.0, sorted[1].Distance, "Sorted[1] should match initial")
-	assert.Equal(t, 13.0, sorted[2].Distance, "Sorted[2] should match initial")
-	assert.Equal(t, 15.0, sorted[3].Distance, "Sorted[3] should match initial")
-	assert.Equal(t, 16.0, sorted[4].Distance, "Sorted[4] should match initial")
-}
-
 func TestKNNShouldPass1(t *testing.T) {
 	model := NewKNN(3, fourClusters, fourClustersY, base.EuclideanDistance)
 
@@ -352,3 +243,520 @@ func TestKNNShouldPass3(t *testing.T) {
 	assert.True(t, accuracy > 95, "Accuracy (%v) should be greater than 95 percent", accuracy)
 	fmt.Printf("Accuracy: %v percent\n\tPoints Tested: %v\n\tMisclassifications: %v\n\tAverage Prediction Time: %v\n", accuracy, count, wrong, duration/time.Duration(count))
 }
+
+func TestKNNIndexShouldPass1(t *testing.T) {
+	model := NewKNN(5, twoClusters, twoClustersY, base.EuclideanDistance)
+	assert.Equal(t, BruteForceIndex, model.IndexType(), "KNN should search every example by default")
+
+	var expected [][]float64
+	for i := -15.0; i < 15; i += 1.5 {
+		for j := -20.0; j < 20; j += 2.5 {
+			guess, err := model.Predict([]float64{i, j})
+			assert.Nil(t, err, "Prediction error should be nil")
+			expected = append(expected, guess)
+		}
+	}
+
+	for _, indexType := range []IndexType{KDTreeIndex, BallTreeIndex, VPTreeIndex} {
+		err := model.UpdateIndex(indexType)
+		assert.Nil(t, err, "Updating the index should not return an error")
+		assert.Equal(t, indexType, model.IndexType(), "KNN should use the given index")
+
+		var guesses [][]float64
+		for i := -15.0; i < 15; i += 1.5 {
+			for j := -20.0; j < 20; j += 2.5 {
+				guess, err := model.Predict([]float64{i, j})
+				assert.Nil(t, err, "Prediction error should be nil")
+				guesses = append(guesses, guess)
+			}
+		}
+
+		assert.Equal(t, expected, guesses, "KNN should predict the same with a %v", indexType)
+	}
+
+	err := model.UpdateIndex("octree")
+	assert.NotNil(t, err, "Updating to an unknown index should return an error")
+	assert.Equal(t, VPTreeIndex, model.IndexType(), "KNN should keep its index after an error")
+
+	// the index should be rebuilt over a new
+	// training set
+	err = model.UpdateTrainingSet([][]float64{{0, 0}, {1, 1}, {5, 5}}, []float64{1, 1, 0})
+	assert.Nil(t, err, "Updating the training set should not return an error")
+
+	neighbors, err := model.RadiusNeighbors([]float64{0.5, 0.5}, 1)
+	assert.Nil(t, err, "Radius query error should be nil")
+	assert.Len(t, neighbors, 2, "Two examples should be within 1 of (0.5, 0.5)")
+	assert.Equal(t, 0, neighbors[0].Index, "Ties should go to the first example")
+	assert.Equal(t, 1, neighbors[1].Index, "Ties should go to the first example")
+
+	_, err = model.RadiusNeighbors([]float64{0.5}, 1)
+	assert.NotNil(t, err, "Radius query with the wrong dimensions should return an error")
+
+	_, err = NewKNN(1, nil, nil, base.EuclideanDistance).Predict([]float64{1})
+	assert.NotNil(t, err, "Predicting without training examples should return an error")
+}
+
+func TestKNNApproximateIndexShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	points := randomPoints(r, 600, 4)
+
+	// label the points by their side of a plane
+	labels := make([]float64, len(points))
+	for i, x := range points {
+		if x[0]+x[1] > 0 {
+			labels[i] = 1
+		}
+	}
+
+	model := NewKNN(5, points[:300], labels[:300], base.EuclideanDistance)
+
+	err := model.UpdateHNSWParams(HNSWParams{M: 8, EfSearch: 100})
+	assert.Nil(t, err, "Updating the HNSW parameters should not return an error")
+
+	for _, indexType := range []IndexType{HNSWIndex, LSHIndex} {
+		err = model.UpdateIndex(indexType)
+		assert.Nil(t, err, "Updating the index should not return an error")
+		assert.Equal(t, indexType, model.IndexType(), "KNN should use the given index")
+
+		var wrong int
+		for i, x := range points[300:] {
+			guess, err := model.Predict(x)
+			assert.Nil(t, err, "Prediction error should be nil")
+			if guess[0] != labels[300+i] {
+				wrong++
+			}
+		}
+		assert.True(t, wrong < 30, "KNN should predict well with a %v (%v wrong)", indexType, wrong)
+	}
+
+	err = model.UpdateLSHParams(LSHParams{Tables: 12, Hashes: 3, Width: 3})
+	assert.Nil(t, err, "Updating the LSH parameters should rebuild the index")
+
+	index, err := model.SpatialIndex()
+	assert.Nil(t, err, "Getting the index should not return an error")
+	assert.Equal(t, 3, index.(*LSH).Params().Hashes, "The index should be rebuilt with the new parameters")
+
+	// inserted examples should go straight into
+	// incremental indexes
+	for i, x := range points[300:] {
+		err = model.Insert(x, labels[300+i])
+		assert.Nil(t, err, "Inserting an example should not return an error")
+	}
+	assert.Equal(t, index, mustIndex(t, model), "An incremental index should be kept as examples are inserted")
+	assert.Equal(t, len(points), index.Len(), "Inserted examples should be indexed")
+
+	err = model.Insert([]float64{1}, 0)
+	assert.NotNil(t, err, "Inserting an example with the wrong dimensions should return an error")
+
+	// a persisted graph can be given back to the model
+	graph := NewHNSW(points, base.EuclideanDistance, HNSWParams{M: 4})
+	err = model.UpdateSpatialIndex(graph)
+	assert.Nil(t, err, "Updating to a prebuilt index should not return an error")
+	assert.Equal(t, HNSWIndex, model.IndexType(), "KNN should know the type of a prebuilt index")
+	assert.Equal(t, graph, mustIndex(t, model), "KNN should search the prebuilt index")
+
+	err = model.UpdateSpatialIndex(NewHNSW(points[:10], base.EuclideanDistance, HNSWParams{}))
+	assert.NotNil(t, err, "An index over other points should return an error")
+
+	err = model.UpdateSpatialIndex(nil)
+	assert.NotNil(t, err, "A nil index should return an error")
+
+	// a tree index is rebuilt after an insert
+	err = model.UpdateIndex(KDTreeIndex)
+	assert.Nil(t, err, "Updating the index should not return an error")
+
+	err = model.Insert([]float64{100, 100, 100, 100}, 1)
+	assert.Nil(t, err, "Inserting an example should not return an error")
+
+	neighbors, err := model.RadiusNeighbors([]float64{99, 99, 99, 99}, 3)
+	assert.Nil(t, err, "Radius query error should be nil")
+	assert.Equal(t, []Neighbor{{Index: len(points), Distance: 2}}, neighbors, "KNN should find the inserted example")
+	assert.Equal(t, len(points)+1, mustIndex(t, model).Len(), "The rebuilt index should hold the inserted example")
+}
+
+// mustIndex returns the spatial index of the model
+func mustIndex(t *testing.T, model *KNN) SpatialIndex {
+	index, err := model.SpatialIndex()
+	assert.Nil(t, err, "Getting the index should not return an error")
+
+	return index
+}
+
+func TestKNNModesShouldPass1(t *testing.T) {
+	// three classes on a line, one of them only
+	// nearer the query point
+	x := [][]float64{{0}, {1}, {1.5}, {5}, {5.5}, {6}, {10}}
+	y := []float64{2, 0, 0, 1, 1, 1, 2}
+
+	model := NewKNN(3, x, y, base.EuclideanDistance)
+	assert.Equal(t, ClassificationMode, model.Mode(), "KNN should classify by default")
+	assert.Equal(t, UniformWeighting, model.Weighting(), "KNN should weight neighbors uniformly by default")
+	assert.Equal(t, []float64{0, 1, 2}, model.Classes(), "KNN should find the sorted classes")
+
+	// a majority of 3 classes isn't the rounded mean
+	guess, err := model.Predict([]float64{0.9})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, 0.0, guess[0], "KNN should predict the majority class")
+
+	probabilities, err := model.PredictProbability([]float64{0.9})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDeltaSlice(t, []float64{2.0 / 3, 0, 1.0 / 3}, probabilities, 1e-12, "Probabilities should be the share of the votes")
+
+	// ties go to the class of the nearest neighbor
+	model.K = 2
+	guess, err = model.Predict([]float64{0.2})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, 2.0, guess[0], "Ties should go to the nearest neighbor")
+
+	guess, err = model.Predict([]float64{9})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, 2.0, guess[0], "Ties should go to the nearest neighbor")
+
+	// distance weighting lets a near neighbor
+	// outvote further ones
+	model.K = 3
+	err = model.UpdateWeighting(DistanceWeighting)
+	assert.Nil(t, err, "Updating the weighting should not return an error")
+
+	guess, err = model.Predict([]float64{3.9})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, 1.0, guess[0], "The majority of neighbors should win")
+
+	model.K = 4
+	guess, err = model.Predict([]float64{0.1})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, 2.0, guess[0], "The nearest neighbor should outvote further ones")
+
+	probabilities, err = model.PredictProbability([]float64{0.1})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDelta(t, 1.0, probabilities[0]+probabilities[1]+probabilities[2], 1e-12, "Probabilities should sum to 1")
+	assert.True(t, probabilities[2] > 0.5, "The nearest neighbor should get most of the weight")
+
+	// exact matches are the only ones counted
+	probabilities, err = model.PredictProbability([]float64{5})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{0, 1, 0}, probabilities, "An exact match should take every vote")
+
+	neighbors, err := model.Neighbors([]float64{5.4})
+	assert.Nil(t, err, "Neighbors error should be nil")
+	assert.Len(t, neighbors, 4, "KNN should find K neighbors")
+	assert.Equal(t, 4, neighbors[0].Index, "The nearest neighbor should come first")
+	assert.InDelta(t, 0.1, neighbors[0].Distance, 1e-12, "Neighbors should hold their distance")
+
+	// new classes are added as examples are inserted
+	err = model.Insert([]float64{20}, -1)
+	assert.Nil(t, err, "Inserting an example should not return an error")
+	assert.Equal(t, []float64{-1, 0, 1, 2}, model.Classes(), "Inserting a new class should keep the classes sorted")
+
+	probabilities, err = model.PredictProbability([]float64{20})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{1, 0, 0, 0}, probabilities, "Probabilities should follow the order of the classes")
+}
+
+func TestKNNModesShouldPass2(t *testing.T) {
+	// y = 2x
+	var x [][]float64
+	var y []float64
+	for i := 0.0; i <= 10; i++ {
+		x = append(x, []float64{i})
+		y = append(y, 2*i)
+	}
+
+	model := NewKNN(2, x, y, base.EuclideanDistance)
+
+	err := model.UpdateMode(RegressionMode)
+	assert.Nil(t, err, "Updating the mode should not return an error")
+	assert.Equal(t, RegressionMode, model.Mode(), "KNN should regress")
+
+	guess, err := model.Predict([]float64{4.25})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDelta(t, 9.0, guess[0], 1e-12, "Regression should predict the unrounded mean")
+
+	err = model.UpdateWeighting(DistanceWeighting)
+	assert.Nil(t, err, "Updating the weighting should not return an error")
+
+	guess, err = model.Predict([]float64{4.25})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDelta(t, 8.5, guess[0], 1e-12, "Distance weighted regression should interpolate between the neighbors")
+
+	guess, err = model.Predict([]float64{7})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDelta(t, 14.0, guess[0], 1e-12, "An exact match should be predicted as is")
+}
+
+func TestKNNModesShouldFail1(t *testing.T) {
+	model := NewKNN(2, [][]float64{{0}, {1}}, []float64{0, 1}, base.EuclideanDistance)
+
+	err := model.UpdateMode("clustering")
+	assert.NotNil(t, err, "Updating to an unknown mode should return an error")
+	assert.Equal(t, ClassificationMode, model.Mode(), "KNN should keep its mode after an error")
+
+	err = model.UpdateWeighting("gaussian")
+	assert.NotNil(t, err, "Updating to an unknown weighting should return an error")
+	assert.Equal(t, UniformWeighting, model.Weighting(), "KNN should keep its weighting after an error")
+
+	model.K = 0
+	_, err = model.Neighbors([]float64{0})
+	assert.NotNil(t, err, "Finding 0 neighbors should return an error")
+
+	model.K = 3
+	_, err = model.PredictProbability([]float64{0})
+	assert.NotNil(t, err, "K greater than the training set should return an error")
+
+	model.K = 1
+	_, err = model.PredictProbability([]float64{0, 1})
+	assert.NotNil(t, err, "Predicting with the wrong dimensions should return an error")
+}
+
+func TestKNNOnlineLearnShouldPass1(t *testing.T) {
+	stream := make(chan base.Datapoint, 100)
+	errors := make(chan error)
+
+	model := NewKNN(3, nil, nil, base.EuclideanDistance)
+	model.Output = ioutil.Discard
+
+	err := model.UpdateWindow(50)
+	assert.Nil(t, err, "Updating the window should not return an error")
+	assert.Equal(t, 50, model.Window(), "KNN should have the given window")
+
+	go model.OnlineLearn(errors, stream, func(example [][]float64) {})
+
+	// the stream drifts from class 0 near the
+	// origin to class 1 near (10, 10)
+	go func() {
+		for i := 0; i < 100; i++ {
+			stream <- base.Datapoint{X: []float64{float64(i % 5), float64(i % 7)}, Y: []float64{0}}
+		}
+		for i := 0; i < 100; i++ {
+			stream <- base.Datapoint{X: []float64{10 + float64(i%5), 10 + float64(i%7)}, Y: []float64{1}}
+		}
+
+		close(stream)
+	}()
+
+	err, more := <-errors
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.False(t, more, "There should be no errors returned")
+
+	assert.Equal(t, 50, model.Examples(), "KNN should keep only the examples within its window")
+	assert.Equal(t, []float64{1}, model.Classes(), "Classes which slid out of the window should be forgotten")
+
+	guess, err := model.Predict([]float64{0, 0})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, 1.0, guess[0], "KNN should only know the newest examples")
+
+	// a growing window keeps every example
+	model.UpdateWindow(0)
+	for i := 0; i < 10; i++ {
+		err = model.Insert([]float64{0, float64(i)}, 0)
+		assert.Nil(t, err, "Inserting an example should not return an error")
+	}
+	assert.Equal(t, 60, model.Examples(), "KNN without a window should keep every example")
+
+	guess, err = model.Predict([]float64{0, 0})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, 0.0, guess[0], "KNN should know the inserted examples")
+
+	// shrinking the window drops the oldest examples,
+	// and the index is rebuilt over the rest
+	err = model.UpdateIndex(KDTreeIndex)
+	assert.Nil(t, err, "Updating the index should not return an error")
+
+	err = model.UpdateWindow(10)
+	assert.Nil(t, err, "Updating the window should not return an error")
+	assert.Equal(t, 10, model.Examples(), "Shrinking the window should drop examples")
+	assert.Equal(t, []float64{0}, model.Classes(), "Only the newest class should be left")
+
+	neighbors, err := model.Neighbors([]float64{0, 9})
+	assert.Nil(t, err, "Neighbors error should be nil")
+	assert.Equal(t, 9, neighbors[0].Index, "The index should be rebuilt over the kept examples")
+
+	err = model.UpdateWindow(-1)
+	assert.NotNil(t, err, "A negative window should return an error")
+}
+
+func TestKNNOnlineLearnShouldPass2(t *testing.T) {
+	r := rand.New(rand.NewSource(23))
+	points := randomPoints(r, 400, 4)
+	queries := nearPoints(r, points[300:], 30)
+
+	for _, indexType := range []IndexType{BruteForceIndex, HNSWIndex, LSHIndex} {
+		model := NewKNN(5, nil, nil, base.EuclideanDistance)
+		model.Output = ioutil.Discard
+		assert.Nil(t, model.UpdateIndex(indexType), "Updating the index should not return an error")
+		assert.Nil(t, model.UpdateWindow(100), "Updating the window should not return an error")
+
+		// the model keeps a copy of the inserted examples
+		x := make([]float64, 4)
+		var rebuilds int
+		var index SpatialIndex
+		for i, p := range points {
+			copy(x, p)
+			assert.Nil(t, model.Insert(x, float64(i%3)), "Inserting an example should not return an error")
+			if i < model.K {
+				continue
+			}
+
+			_, err := model.Neighbors(p)
+			assert.Nil(t, err, "Neighbors error should be nil")
+			if model.index != index {
+				rebuilds++
+				index = model.index
+			}
+		}
+		assert.Equal(t, 100, model.Examples(), "KNN should keep only the examples within its window")
+		assert.True(t, rebuilds <= 5, "Dropping examples from a %v index shouldn't rebuild it every time (rebuilt %v times)", indexType, rebuilds)
+
+		// the model finds the same neighbors as one
+		// built over the examples in its window
+		y := make([]float64, 100)
+		for i := range y {
+			y[i] = float64((300 + i) % 3)
+		}
+		expected := NewKNN(5, points[300:], y, base.EuclideanDistance)
+		for _, q := range queries {
+			neighbors, err := model.Neighbors(q)
+			assert.Nil(t, err, "Neighbors error should be nil")
+			for _, n := range neighbors {
+				assert.Equal(t, points[300+n.Index], model.trainingSet[n.Index], "Neighbors should be indexed in the training set")
+			}
+
+			if indexType == BruteForceIndex {
+				want, _ := expected.Neighbors(q)
+				assert.Equal(t, want, neighbors, "KNN should find the neighbors in its window")
+			}
+		}
+
+		// the persisted index holds exactly the window
+		persisted, err := model.SpatialIndex()
+		assert.Nil(t, err, "Getting the index should not return an error")
+		assert.Equal(t, 100, persisted.Len(), "The index should only hold the examples in the window")
+	}
+}
+
+func TestKNNOnlineLearnShouldFail1(t *testing.T) {
+	errors := make(chan error)
+	stream := make(chan base.Datapoint, 10)
+
+	model := NewKNN(1, [][]float64{{0, 0}}, []float64{0}, base.EuclideanDistance)
+	model.Output = ioutil.Discard
+
+	go model.OnlineLearn(errors, stream, func(example [][]float64) {})
+
+	stream <- base.Datapoint{X: []float64{1}, Y: []float64{1}}
+	stream <- base.Datapoint{X: []float64{1, 1}, Y: []float64{1, 2}}
+	stream <- base.Datapoint{X: []float64{1, 1}, Y: []float64{1}}
+	close(stream)
+
+	var count int
+	for err := range errors {
+		assert.NotNil(t, err, "Only errors should be sent")
+		count++
+	}
+	assert.Equal(t, 2, count, "Every invalid datapoint should return an error")
+	assert.Equal(t, 2, model.Examples(), "Valid datapoints should still be added")
+
+	errors = make(chan error)
+	go NewKNN(1, nil, nil, nil).OnlineLearn(errors, stream, func(example [][]float64) {})
+
+	err := <-errors
+	assert.NotNil(t, err, "Learning without a distance should return an error")
+}
+
+func TestPersistKNNShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(8))
+	points := randomPoints(r, 400, 6)
+	labels := make([]float64, len(points))
+	for i, x := range points {
+		if x[0] > 0 {
+			labels[i] = 1
+		}
+	}
+
+	model, err := NewKNNFromSpec(5, points, labels, base.MinkowskiDistanceSpec(3))
+	assert.Nil(t, err, "Creating the model from a spec should not return an error")
+
+	assert.Nil(t, model.UpdateWeighting(DistanceWeighting), "Updating the weighting should not return an error")
+	assert.Nil(t, model.UpdateHNSWParams(HNSWParams{M: 6, EfSearch: 30}), "Updating the HNSW parameters should not return an error")
+	assert.Nil(t, model.UpdateIndex(HNSWIndex), "Updating the index should not return an error")
+	assert.Nil(t, model.UpdateWindow(1000), "Updating the window should not return an error")
+	model.UpdatePersistIndex(true)
+
+	err = model.PersistToFile("/tmp/.goml/KNN.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/KNN.json")
+	assert.Nil(t, err, "Loading the model should not return an error")
+
+	restored, ok := loaded.(*KNN)
+	assert.True(t, ok, "The loaded model should be a KNN model")
+
+	assert.Equal(t, 5, restored.K, "The restored model should keep K")
+	assert.Equal(t, base.MinkowskiDistanceSpec(3), *restored.DistanceSpec, "The restored model should keep its distance spec")
+	assert.Equal(t, DistanceWeighting, restored.Weighting(), "The restored model should keep its weighting")
+	assert.Equal(t, HNSWIndex, restored.IndexType(), "The restored model should keep its index type")
+	assert.Equal(t, 1000, restored.Window(), "The restored model should keep its window")
+	assert.Equal(t, model.Classes(), restored.Classes(), "The restored model should keep its classes")
+
+	index, err := restored.SpatialIndex()
+	assert.Nil(t, err, "Getting the index should not return an error")
+	assert.Equal(t, 6, index.(*HNSW).Params().M, "The persisted index should be restored")
+
+	for _, x := range randomPoints(r, 50, 6) {
+		expected, err := model.PredictProbability(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		guess, err := restored.PredictProbability(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, guess, "The restored model should predict the same")
+	}
+
+	// models with a bare distance function keep their
+	// distance on restore, and rebuild their index
+	bare := NewKNN(3, points, labels, base.EuclideanDistance)
+	assert.Nil(t, bare.UpdateIndex(BallTreeIndex), "Updating the index should not return an error")
+
+	bytes, err := bare.MarshalBinary()
+	assert.Nil(t, err, "Marshalling the model should not return an error")
+
+	other := NewKNN(1, nil, nil, base.EuclideanDistance)
+	err = other.UnmarshalBinary(bytes)
+	assert.Nil(t, err, "Unmarshalling the model should not return an error")
+	assert.Nil(t, other.DistanceSpec, "A model without a distance spec shouldn't get one")
+	assert.Equal(t, BallTreeIndex, other.IndexType(), "The restored model should keep its index type")
+	assert.Equal(t, bare.Examples(), other.Examples(), "The restored model should keep its training set")
+
+	guess, err := other.Predict(points[0])
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, labels[0], guess[0], "The restored model should predict with the kept distance")
+}
+
+func TestPersistKNNShouldFail1(t *testing.T) {
+	_, err := NewKNNFromSpec(3, nil, nil, base.DistanceSpec{Name: "not registered"})
+	assert.NotNil(t, err, "Creating a model with an unregistered distance should return an error")
+
+	model := NewKNN(1, [][]float64{{0}}, []float64{0}, base.EuclideanDistance)
+	assert.NotNil(t, model.UpdateDistance(base.MinkowskiDistanceSpec(-1)), "Updating to an invalid distance should return an error")
+
+	invalid := []struct {
+		hyper knnHyperparameters
+		data  knnData
+	}{
+		{knnHyperparameters{K: 1, Mode: ClassificationMode, Weighting: UniformWeighting, Index: BruteForceIndex}, knnData{TrainingSet: [][]float64{{0}, {1}}, ExpectedResults: []float64{0}}},
+		{knnHyperparameters{K: 1, Mode: ClassificationMode, Weighting: UniformWeighting, Index: BruteForceIndex}, knnData{TrainingSet: [][]float64{{0}, {1, 2}}, ExpectedResults: []float64{0, 1}}},
+		{knnHyperparameters{K: 1, Mode: "clustering", Weighting: UniformWeighting, Index: BruteForceIndex}, knnData{TrainingSet: [][]float64{{0}}, ExpectedResults: []float64{0}}},
+		{knnHyperparameters{K: 1, Mode: ClassificationMode, Weighting: UniformWeighting, Index: "octree"}, knnData{TrainingSet: [][]float64{{0}}, ExpectedResults: []float64{0}}},
+		{knnHyperparameters{K: 1, Mode: ClassificationMode, Weighting: UniformWeighting, Index: BruteForceIndex, Distance: &base.DistanceSpec{Name: "not registered"}}, knnData{TrainingSet: [][]float64{{0}}, ExpectedResults: []float64{0}}},
+	}
+
+	for i := range invalid {
+		env := &base.Envelope{Type: knnType}
+		err = env.Encode(invalid[i].hyper, invalid[i].data)
+		assert.Nil(t, err, "Encoding the envelope should not return an error")
+
+		err = model.UnmarshalEnvelope(env)
+		assert.NotNil(t, err, "Restoring invalid model %v should return an error", i)
+	}
+
+	assert.Equal(t, 1, model.Examples(), "The model should be left as is after an error")
+}
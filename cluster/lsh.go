@@ -0,0 +1,439 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+
+	"github.com/admpub/goml/base"
+)
+
+// LSHParams holds the parameters of an LSH index,
+// which trade recall for speed
+type LSHParams struct {
+	// Tables is the number of hash tables. A point is a
+	// candidate neighbor if it shares a bucket with the
+	// query point in any table, so more tables find more
+	// true neighbors (and more candidates to check.)
+	// Defaults to 10.
+	Tables int `json:"tables"`
+
+	// Hashes is the number of random projections
+	// hashed together into each bucket key. More hashes
+	// make buckets smaller and queries faster, but find
+	// fewer true neighbors. Defaults to 8.
+	Hashes int `json:"hashes"`
+
+	// Width is the width of the buckets along each
+	// random projection, in the units of the data. If
+	// Width is 0 (the default,) projections are hashed
+	// by their sign instead (random hyperplanes,) which
+	// groups points by angle and suits the cosine
+	// distance (with data centered on the origin.)
+	// Set it (say, around the distance between
+	// neighbors) for the Euclidean distance.
+	Width float64 `json:"width"`
+
+	// Seed seeds the random projections
+	Seed int64 `json:"seed"`
+}
+
+// DefaultLSHParams returns the default parameters of
+// an LSH index
+func DefaultLSHParams() LSHParams {
+	return LSHParams{
+		Tables: 10,
+		Hashes: 8,
+		Seed:   1,
+	}
+}
+
+// withDefaults returns the parameters with every
+// unset (non-positive) value set to its default
+func (p LSHParams) withDefaults() LSHParams {
+	defaults := DefaultLSHParams()
+	if p.Tables < 1 {
+		p.Tables = defaults.Tables
+	}
+	if p.Hashes < 1 {
+		p.Hashes = defaults.Hashes
+	}
+	if p.Width < 0 {
+		p.Width = defaults.Width
+	}
+
+	return p
+}
+
+// LSH is an approximate SpatialIndex using locality
+// sensitive hashing with random projections: every
+// point is hashed into a bucket of each of several
+// tables by which side of (or which slice along) a few
+// random directions it falls on. Points near each other
+// usually share buckets, so queries only compute the
+// (exact) distance to points sharing a bucket with the
+// query point.
+//
+// https://en.wikipedia.org/wiki/Locality-sensitive_hashing
+//
+// Results are approximate: true neighbors which don't
+// share a bucket with the query point are missed (add
+// Tables, or use fewer Hashes, to find more of them,)
+// and fewer than k neighbors may be found. Points can
+// be added at any time with Insert, and removed with
+// Remove, but an LSH index isn't safe to change
+// concurrently with other calls.
+//
+// The index (with its points and projections) can be
+// persisted like the models. The distance measure isn't
+// persisted, so set Distance again after restoring.
+type LSH struct {
+	Distance base.DistanceMeasure
+
+	params LSHParams
+
+	points [][]float64
+
+	// removed marks the points removed
+	// from the index
+	removed []bool
+
+	// projections holds the random directions of
+	// every table, and offsets their random offsets
+	// (when hashing into slices of Width)
+	projections [][][]float64
+	offsets     [][]float64
+
+	tables []map[uint64][]int
+}
+
+// NewLSH builds an LSH index over the given points
+// with the given parameters (unset parameters take
+// their default value)
+func NewLSH(points [][]float64, distance base.DistanceMeasure, params LSHParams) *LSH {
+	l := &LSH{
+		Distance: distance,
+		params:   params.withDefaults(),
+	}
+
+	l.tables = make([]map[uint64][]int, l.params.Tables)
+	for t := range l.tables {
+		l.tables[t] = make(map[uint64][]int)
+	}
+
+	for _, x := range points {
+		l.Insert(x)
+	}
+
+	return l
+}
+
+// Params returns the parameters of the index
+func (l *LSH) Params() LSHParams {
+	return l.params
+}
+
+// Len returns the number of indexed points (removed
+// points included)
+func (l *LSH) Len() int {
+	return len(l.points)
+}
+
+// project draws the random projections for points
+// with the given number of dimensions
+func (l *LSH) project(dimensions int) {
+	r := rand.New(rand.NewSource(l.params.Seed))
+
+	l.projections = make([][][]float64, l.params.Tables)
+	l.offsets = make([][]float64, l.params.Tables)
+	for t := range l.projections {
+		l.projections[t] = make([][]float64, l.params.Hashes)
+		l.offsets[t] = make([]float64, l.params.Hashes)
+
+		for h := range l.projections[t] {
+			l.projections[t][h] = make([]float64, dimensions)
+			for j := range l.projections[t][h] {
+				l.projections[t][h][j] = r.NormFloat64()
+			}
+			l.offsets[t][h] = r.Float64() * l.params.Width
+		}
+	}
+}
+
+// hash returns the bucket key of x in table t
+func (l *LSH) hash(x []float64, t int) uint64 {
+	// FNV-1a over the hash of every projection
+	key := uint64(14695981039346656037)
+	for h, a := range l.projections[t] {
+		var dot float64
+		for j := range a {
+			dot += a[j] * x[j]
+		}
+
+		var bucket int64
+		if l.params.Width > 0 {
+			bucket = int64(math.Floor((dot + l.offsets[t][h]) / l.params.Width))
+		} else if dot >= 0 {
+			bucket = 1
+		}
+
+		for b := uint(0); b < 64; b += 8 {
+			key ^= uint64(bucket>>b) & 0xff
+			key *= 1099511628211
+		}
+	}
+
+	return key
+}
+
+// Insert adds x to the index and returns its index
+func (l *LSH) Insert(x []float64) int {
+	if l.projections == nil {
+		l.project(len(x))
+	}
+
+	id := len(l.points)
+	l.points = append(l.points, x)
+	l.removed = append(l.removed, false)
+
+	for t := range l.tables {
+		key := l.hash(x, t)
+		l.tables[t][key] = append(l.tables[t][key], id)
+	}
+
+	return id
+}
+
+// Remove removes the point with the given index from
+// its buckets, so queries don't return it anymore
+func (l *LSH) Remove(i int) {
+	if i < 0 || i >= len(l.points) || l.removed[i] {
+		return
+	}
+
+	l.removed[i] = true
+	for t := range l.tables {
+		key := l.hash(l.points[i], t)
+
+		bucket := l.tables[t][key]
+		for s := range bucket {
+			if bucket[s] == i {
+				bucket = append(bucket[:s], bucket[s+1:]...)
+				break
+			}
+		}
+
+		if len(bucket) == 0 {
+			delete(l.tables[t], key)
+		} else {
+			l.tables[t][key] = bucket
+		}
+	}
+}
+
+// candidates returns every point sharing a bucket with
+// x in any table, with its distance from x
+func (l *LSH) candidates(x []float64) []Neighbor {
+	if l.projections == nil || len(x) != len(l.projections[0][0]) {
+		return nil
+	}
+
+	seen := make(map[int]bool)
+	var candidates []Neighbor
+	for t := range l.tables {
+		for _, i := range l.tables[t][l.hash(x, t)] {
+			if seen[i] {
+				continue
+			}
+			seen[i] = true
+
+			candidates = append(candidates, Neighbor{Index: i, Distance: l.Distance(x, l.points[i])})
+		}
+	}
+
+	return candidates
+}
+
+// KNearest returns (approximately) the k points
+// nearest to x
+func (l *LSH) KNearest(x []float64, k int) []Neighbor {
+	h := newNeighborHeap(k)
+	for _, c := range l.candidates(x) {
+		h.offer(c.Index, c.Distance)
+	}
+
+	return h.sorted()
+}
+
+// Radius returns (approximately) every point within
+// distance r of x
+func (l *LSH) Radius(x []float64, r float64) []Neighbor {
+	var neighbors []Neighbor
+	for _, c := range l.candidates(x) {
+		if c.Distance <= r {
+			neighbors = append(neighbors, c)
+		}
+	}
+
+	sortNeighbors(neighbors)
+	return neighbors
+}
+
+// lshHyperparameters holds the parameters of an LSH
+// index as saved in its envelope
+type lshHyperparameters struct {
+	Params LSHParams `json:"params"`
+}
+
+// lshData is the data of an LSH envelope. The hash
+// tables are rebuilt from the points on restore.
+type lshData struct {
+	Points      [][]float64   `json:"points"`
+	Projections [][][]float64 `json:"projections"`
+	Offsets     [][]float64   `json:"offsets"`
+	Removed     []int         `json:"removed,omitempty"`
+}
+
+// lshType is the name LSH indexes are registered
+// and persisted under
+const lshType = "cluster.LSH"
+
+func init() {
+	base.RegisterModel(lshType, func() base.Persistable {
+		return NewLSH(nil, nil, DefaultLSHParams())
+	})
+}
+
+// MarshalEnvelope returns the index, along with its
+// parameters, wrapped in a base.Envelope. The data of
+// the envelope is the points (and which of them were
+// removed) and the random projections.
+func (l *LSH) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(l.points) != 0 {
+		features = len(l.points[0])
+	}
+
+	env := &base.Envelope{
+		Type: lshType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+		Metadata: base.TrainingMetadata{
+			Examples: len(l.points),
+		},
+	}
+
+	err := env.Encode(lshHyperparameters{
+		Params: l.params,
+	}, lshData{
+		Points:      l.points,
+		Projections: l.projections,
+		Offsets:     l.offsets,
+		Removed:     removedIndexes(l.removed),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the index from the given
+// base.Envelope, rehashing its points. The distance
+// measure of the index is kept.
+func (l *LSH) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := lshHyperparameters{
+		Params: l.params,
+	}
+
+	var data lshData
+	err := env.Decode(lshType, &hyper, &data)
+	if err != nil {
+		return err
+	}
+
+	params := hyper.Params.withDefaults()
+
+	if data.Projections != nil {
+		if len(data.Projections) != params.Tables || len(data.Offsets) != params.Tables {
+			return fmt.Errorf("ERROR: LSH has %v tables but %v projections and %v offsets", params.Tables, len(data.Projections), len(data.Offsets))
+		}
+		for t := range data.Projections {
+			if len(data.Projections[t]) != params.Hashes || len(data.Offsets[t]) != params.Hashes {
+				return fmt.Errorf("ERROR: LSH table %v should have %v projections and offsets", t, params.Hashes)
+			}
+			for _, a := range data.Projections[t] {
+				if len(a) != len(data.Projections[0][0]) {
+					return fmt.Errorf("ERROR: LSH projections should all have the same length")
+				}
+			}
+		}
+	}
+	for i, x := range data.Points {
+		if data.Projections == nil || len(x) != len(data.Projections[0][0]) {
+			return fmt.Errorf("ERROR: LSH point %v doesn't match the length of the projections", i)
+		}
+	}
+	for _, i := range data.Removed {
+		if i < 0 || i >= len(data.Points) {
+			return fmt.Errorf("ERROR: LSH removed point %v isn't a point of the index", i)
+		}
+	}
+
+	l.params = params
+	l.projections = data.Projections
+	l.offsets = data.Offsets
+	l.points = nil
+	l.removed = nil
+
+	l.tables = make([]map[uint64][]int, params.Tables)
+	for t := range l.tables {
+		l.tables[t] = make(map[uint64][]int)
+	}
+	for _, x := range data.Points {
+		l.Insert(x)
+	}
+	for _, i := range data.Removed {
+		l.Remove(i)
+	}
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// index to the file, which can be restored later.
+func (l *LSH) PersistToFile(path string) error {
+	return base.PersistModel(path, l)
+}
+
+// RestoreFromFile takes in a path to a persisted index
+// and restores the index from it.
+func (l *LSH) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, l)
+}
+
+// WriteTo writes the persisted index (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (l *LSH) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, l)
+}
+
+// ReadFrom restores the index from a persisted index
+// read from r until EOF, implementing io.ReaderFrom
+func (l *LSH) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, l)
+}
+
+// MarshalBinary returns the persisted index as bytes,
+// implementing encoding.BinaryMarshaler
+func (l *LSH) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(l)
+}
+
+// UnmarshalBinary restores the index from the bytes of
+// a persisted index, implementing encoding.BinaryUnmarshaler
+func (l *LSH) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, l)
+}
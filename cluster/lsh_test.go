@@ -0,0 +1,120 @@
+package cluster
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLSHShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	points := randomPoints(r, 2000, 16)
+	queries := nearPoints(r, points, 50)
+
+	index := NewLSH(points, base.EuclideanDistance, LSHParams{Tables: 20, Hashes: 4, Width: 8})
+	assert.Equal(t, len(points), index.Len(), "LSH should index every point")
+
+	assert.True(t, recall(index, points, queries, base.EuclideanDistance, 10) > 0.9, "LSH should find most of the true neighbors")
+
+	// more tables should find more neighbors
+	fewer := NewLSH(points, base.EuclideanDistance, LSHParams{Tables: 2, Hashes: 4, Width: 8})
+	assert.True(t, recall(index, points, queries, base.EuclideanDistance, 10) >= recall(fewer, points, queries, base.EuclideanDistance, 10), "More tables should find more true neighbors")
+
+	neighbors := index.KNearest(points[3], 10)
+	assert.Equal(t, 0.0, neighbors[0].Distance, "An indexed point should be its own nearest neighbor")
+	for i := 1; i < len(neighbors); i++ {
+		assert.True(t, neighbors[i-1].Distance <= neighbors[i].Distance, "Neighbors should be sorted by distance")
+	}
+
+	radius := neighbors[len(neighbors)-1].Distance
+	for _, n := range index.Radius(points[3], radius) {
+		assert.True(t, n.Distance <= radius, "Radius should only return points within the radius")
+	}
+
+	assert.Empty(t, index.KNearest([]float64{1, 2}, 5), "Querying with the wrong dimensions should find nothing")
+	assert.Empty(t, NewLSH(nil, base.EuclideanDistance, LSHParams{}).KNearest(points[0], 5), "An empty index should find nothing")
+}
+
+func TestLSHShouldPass2(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+
+	// points on two opposite rays should hash by angle
+	// with the default random hyperplanes
+	var points [][]float64
+	for i := 0; i < 200; i++ {
+		s := 1 + r.Float64()*10
+		if i%2 == 0 {
+			points = append(points, []float64{s, s + r.NormFloat64()*0.01, s})
+		} else {
+			points = append(points, []float64{-s, -s + r.NormFloat64()*0.01, -s})
+		}
+	}
+
+	index := NewLSH(points[:100], base.CosineDistance, LSHParams{})
+	assert.Equal(t, DefaultLSHParams().Tables, index.Params().Tables, "Unset parameters should take their default")
+	assert.Equal(t, DefaultLSHParams().Hashes, index.Params().Hashes, "Unset parameters should take their default")
+	for _, x := range points[100:] {
+		index.Insert(x)
+	}
+	assert.Equal(t, len(points), index.Len(), "LSH should index every inserted point")
+
+	for _, n := range index.KNearest([]float64{1, 1, 1}, 20) {
+		assert.Equal(t, 0, n.Index%2, "Points on the same ray should be nearest")
+	}
+	assert.Len(t, index.Radius([]float64{-1, -1, -1}, 0.01), 100, "Every point on the ray should share buckets with it")
+}
+
+func TestPersistLSHShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	points := randomPoints(r, 500, 8)
+
+	index := NewLSH(points, base.EuclideanDistance, LSHParams{Tables: 6, Hashes: 3, Width: 2, Seed: 5})
+
+	err := index.PersistToFile("/tmp/.goml/LSH.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	model, err := base.Load("/tmp/.goml/LSH.json")
+	assert.Nil(t, err, "Loading the index should not return an error")
+
+	restored, ok := model.(*LSH)
+	assert.True(t, ok, "The loaded model should be an LSH index")
+	assert.Equal(t, index.Params(), restored.Params(), "The restored index should keep its parameters")
+
+	// the distance isn't persisted
+	restored.Distance = base.EuclideanDistance
+
+	for _, q := range randomPoints(r, 20, 8) {
+		assert.Equal(t, index.KNearest(q, 5), restored.KNearest(q, 5), "The restored index should find the same neighbors")
+	}
+
+	// removed points stay removed
+	for i := 0; i < len(points); i += 2 {
+		restored.Remove(i)
+	}
+	bytes, err := restored.MarshalBinary()
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	again := NewLSH(nil, base.EuclideanDistance, LSHParams{})
+	assert.Nil(t, again.UnmarshalBinary(bytes), "Restoring an index with removed points should not return an error")
+	for _, q := range randomPoints(r, 20, 8) {
+		neighbors := again.KNearest(q, 5)
+		assert.Equal(t, restored.KNearest(q, 5), neighbors, "The restored index should find the same neighbors")
+		for _, n := range neighbors {
+			assert.Equal(t, 1, n.Index%2, "The restored index shouldn't find removed points")
+		}
+	}
+
+	env := &base.Envelope{Type: lshType}
+	err = env.Encode(lshHyperparameters{Params: LSHParams{Tables: 2, Hashes: 2}}, lshData{
+		Points:      [][]float64{{1, 2}},
+		Projections: [][][]float64{{{1, 0}, {0, 1}}},
+		Offsets:     [][]float64{{0, 0}},
+	})
+	assert.Nil(t, err, "Encoding the envelope should not return an error")
+
+	err = restored.UnmarshalEnvelope(env)
+	assert.NotNil(t, err, "Restoring an index without projections for every table should return an error")
+}
@@ -0,0 +1,289 @@
+package cluster
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/admpub/goml/base"
+)
+
+// clusterIndex maps the labels of a clustering (as
+// returned by Guesses) to dense cluster numbers
+// 0..k-1, in order of first appearance. Points with a
+// negative label (like the noise of density based
+// models) get -1 and are left out of every metric.
+func clusterIndex(guesses []int) ([]int, int) {
+	index := make([]int, len(guesses))
+	clusters := make(map[int]int)
+	for i, label := range guesses {
+		if label < 0 {
+			index[i] = -1
+			continue
+		}
+
+		c, ok := clusters[label]
+		if !ok {
+			c = len(clusters)
+			clusters[label] = c
+		}
+		index[i] = c
+	}
+
+	return index, len(clusters)
+}
+
+// validateClustering checks the points and their
+// labels line up, and that the clustering has at
+// least 2 clusters and fewer clusters than
+// clustered points
+func validateClustering(points [][]float64, guesses []int) ([]int, int, int, error) {
+	if len(points) != len(guesses) {
+		return nil, 0, 0, fmt.Errorf("ERROR: number of points (%v) doesn't match the number of labels (%v)", len(points), len(guesses))
+	}
+
+	index, k := clusterIndex(guesses)
+
+	var n int
+	for i := range index {
+		if index[i] < 0 {
+			continue
+		}
+		if len(points[i]) != len(points[0]) {
+			return nil, 0, 0, fmt.Errorf("ERROR: point %v has %v features - expected %v", i, len(points[i]), len(points[0]))
+		}
+		n++
+	}
+
+	if k < 2 || k >= n {
+		return nil, 0, 0, fmt.Errorf("ERROR: clustering metrics need between 2 and %v clusters - given %v", n-1, k)
+	}
+
+	return index, k, n, nil
+}
+
+// centers returns the mean of every cluster and
+// the number of points in it
+func centers(points [][]float64, index []int, k int) ([][]float64, []float64) {
+	means := make([][]float64, k)
+	counts := make([]float64, k)
+	for c := range means {
+		means[c] = make([]float64, len(points[0]))
+	}
+
+	for i, x := range points {
+		c := index[i]
+		if c < 0 {
+			continue
+		}
+
+		counts[c]++
+		for l := range x {
+			means[c][l] += x[l]
+		}
+	}
+
+	for c := range means {
+		for l := range means[c] {
+			means[c][l] /= counts[c]
+		}
+	}
+
+	return means, counts
+}
+
+// Silhouette returns the mean silhouette coefficient
+// of the clustering of points given by guesses (one
+// label per point, like the output of Guesses,) using
+// the given distance (base.EuclideanDistance if nil.)
+//
+// The silhouette of a point is (b - a) / max(a, b),
+// where a is its mean distance to the other points of
+// its cluster and b its mean distance to the points of
+// the nearest other cluster. It ranges from -1 (the
+// point is probably in the wrong cluster) to 1 (the
+// point is far from every other cluster,) so higher
+// is better. Points alone in their cluster have a
+// silhouette of 0.
+//
+// Points with negative labels (noise) are left out.
+// Computing the silhouette takes O(n²) distances.
+func Silhouette(points [][]float64, guesses []int, distance base.DistanceMeasure) (float64, error) {
+	samples, err := SilhouetteSamples(points, guesses, distance)
+	if err != nil {
+		return 0, err
+	}
+
+	var sum float64
+	var n int
+	for i := range samples {
+		if guesses[i] < 0 {
+			continue
+		}
+
+		sum += samples[i]
+		n++
+	}
+
+	return sum / float64(n), nil
+}
+
+// SilhouetteSamples returns the silhouette coefficient
+// of every point (0 for noise,) as described in
+// Silhouette
+func SilhouetteSamples(points [][]float64, guesses []int, distance base.DistanceMeasure) ([]float64, error) {
+	index, k, _, err := validateClustering(points, guesses)
+	if err != nil {
+		return nil, err
+	}
+
+	if distance == nil {
+		distance = base.EuclideanDistance
+	}
+
+	all := make([]int, len(points))
+	for i := range all {
+		all[i] = i
+	}
+
+	return silhouette(points, index, k, distance, all), nil
+}
+
+// silhouette returns the silhouette of the points
+// with the given indices (against every point) for
+// the clustering given by the dense cluster index
+func silhouette(points [][]float64, index []int, k int, distance base.DistanceMeasure, indices []int) []float64 {
+	_, counts := centers(points, index, k)
+
+	samples := make([]float64, len(indices))
+	sums := make([]float64, k)
+	for s, i := range indices {
+		c := index[i]
+		if c < 0 || counts[c] < 2 {
+			continue
+		}
+
+		for j := range sums {
+			sums[j] = 0
+		}
+		for j, y := range points {
+			if j == i || index[j] < 0 {
+				continue
+			}
+			sums[index[j]] += distance(points[i], y)
+		}
+
+		a := sums[c] / (counts[c] - 1)
+		b := math.Inf(1)
+		for j := range sums {
+			if j != c && sums[j]/counts[j] < b {
+				b = sums[j] / counts[j]
+			}
+		}
+
+		if max := math.Max(a, b); max > 0 {
+			samples[s] = (b - a) / max
+		}
+	}
+
+	return samples
+}
+
+// CalinskiHarabasz returns the Calinski-Harabasz index
+// (or variance ratio criterion) of the clustering of
+// points given by guesses: the ratio of the dispersion
+// between clusters to the dispersion within clusters,
+// each divided by its degrees of freedom
+//
+//     CH = [B / (k - 1)] / [W / (n - k)]
+//
+// where B is the sum of the squared distances from the
+// center of each cluster to the center of all points
+// (weighted by the size of the cluster) and W is the
+// sum of the squared distances from each point to the
+// center of its cluster. Higher is better.
+//
+// Points with negative labels (noise) are left out.
+func CalinskiHarabasz(points [][]float64, guesses []int) (float64, error) {
+	index, k, n, err := validateClustering(points, guesses)
+	if err != nil {
+		return 0, err
+	}
+
+	means, counts := centers(points, index, k)
+
+	mean := make([]float64, len(points[0]))
+	for c := range means {
+		for l := range mean {
+			mean[l] += means[c][l] * counts[c] / float64(n)
+		}
+	}
+
+	var between, within float64
+	for c := range means {
+		between += counts[c] * diff(means[c], mean)
+	}
+	for i, x := range points {
+		if index[i] >= 0 {
+			within += diff(x, means[index[i]])
+		}
+	}
+
+	if within == 0 {
+		return 1, nil
+	}
+
+	return between * float64(n-k) / (within * float64(k-1)), nil
+}
+
+// DaviesBouldin returns the Davies-Bouldin index of
+// the clustering of points given by guesses: the mean,
+// over every cluster, of its similarity to the cluster
+// most similar to it
+//
+//     DB = 1/k Σ max[j ≠ i] (s[i] + s[j]) / d(c[i], c[j])
+//
+// where s[i] is the mean (Euclidean) distance from the
+// points of cluster i to its center c[i]. Lower is
+// better, with 0 as the minimum.
+//
+// Points with negative labels (noise) are left out.
+func DaviesBouldin(points [][]float64, guesses []int) (float64, error) {
+	index, k, _, err := validateClustering(points, guesses)
+	if err != nil {
+		return 0, err
+	}
+
+	means, counts := centers(points, index, k)
+
+	scatter := make([]float64, k)
+	for i, x := range points {
+		if c := index[i]; c >= 0 {
+			scatter[c] += math.Sqrt(diff(x, means[c])) / counts[c]
+		}
+	}
+
+	var sum float64
+	for i := range means {
+		var worst float64
+		for j := range means {
+			if j == i {
+				continue
+			}
+
+			// clusters with the same center are left
+			// out, as they can't be told apart anyway
+			d := math.Sqrt(diff(means[i], means[j]))
+			if d == 0 {
+				continue
+			}
+
+			if similarity := (scatter[i] + scatter[j]) / d; similarity > worst {
+				worst = similarity
+			}
+		}
+
+		sum += worst
+	}
+
+	return sum / float64(k), nil
+}
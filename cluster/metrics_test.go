@@ -0,0 +1,107 @@
+package cluster
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsShouldPass1(t *testing.T) {
+	points := [][]float64{{0}, {1}, {4}, {5}}
+	guesses := []int{0, 0, 1, 1}
+
+	// a = 1 for every point, while b = 4.5 for the
+	// outer points and 3.5 for the inner ones
+	samples, err := SilhouetteSamples(points, guesses, nil)
+	assert.Nil(t, err, "Silhouette error should be nil")
+	assert.InDeltaSlice(t, []float64{1 - 1/4.5, 1 - 1/3.5, 1 - 1/3.5, 1 - 1/4.5}, samples, 1e-12, "Silhouettes should match the hand computed ones")
+
+	s, err := Silhouette(points, guesses, base.EuclideanDistance)
+	assert.Nil(t, err, "Silhouette error should be nil")
+	assert.InDelta(t, (2-1/4.5-1/3.5)/2, s, 1e-12, "Silhouette should be the mean silhouette")
+
+	// B = 2·2² + 2·2², W = 4·0.5²
+	ch, err := CalinskiHarabasz(points, guesses)
+	assert.Nil(t, err, "Calinski-Harabasz error should be nil")
+	assert.InDelta(t, 32.0, ch, 1e-12, "Calinski-Harabasz index should match the hand computed one")
+
+	// both clusters scatter 0.5 around centers 4 apart
+	db, err := DaviesBouldin(points, guesses)
+	assert.Nil(t, err, "Davies-Bouldin error should be nil")
+	assert.InDelta(t, 0.25, db, 1e-12, "Davies-Bouldin index should match the hand computed one")
+
+	// labels don't need to be 0..k-1, and noise
+	// (negative labels) is left out
+	noisy := [][]float64{{0}, {1}, {100}, {4}, {5}}
+	labels := []int{7, 7, -1, 3, 3}
+
+	s2, err := Silhouette(noisy, labels, nil)
+	assert.Nil(t, err, "Silhouette error should be nil")
+	assert.InDelta(t, s, s2, 1e-12, "Noise should be left out of the silhouette")
+
+	ch2, err := CalinskiHarabasz(noisy, labels)
+	assert.Nil(t, err, "Calinski-Harabasz error should be nil")
+	assert.InDelta(t, ch, ch2, 1e-12, "Noise should be left out of the Calinski-Harabasz index")
+
+	db2, err := DaviesBouldin(noisy, labels)
+	assert.Nil(t, err, "Davies-Bouldin error should be nil")
+	assert.InDelta(t, db, db2, 1e-12, "Noise should be left out of the Davies-Bouldin index")
+
+	// any distance can be used for the silhouette
+	s3, err := Silhouette([][]float64{{0, 0}, {1, 1}, {4, 4}, {5, 5}}, guesses, base.ManhattanDistance)
+	assert.Nil(t, err, "Silhouette error should be nil")
+	assert.InDelta(t, s, s3, 1e-12, "Scaling every distance shouldn't change the silhouette")
+}
+
+func TestMetricsShouldPass2(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	points, labels := blobs(r, 400)
+
+	shuffled := make([]int, len(labels))
+	for i := range shuffled {
+		shuffled[i] = r.Intn(4)
+	}
+
+	good, err := Silhouette(points, labels, nil)
+	assert.Nil(t, err, "Silhouette error should be nil")
+	bad, err := Silhouette(points, shuffled, nil)
+	assert.Nil(t, err, "Silhouette error should be nil")
+	assert.True(t, good > 0.9, "Well separated blobs should have a silhouette close to 1 - got %v", good)
+	assert.True(t, bad < 0.1, "Random labels should have a silhouette close to 0 - got %v", bad)
+
+	goodCH, _ := CalinskiHarabasz(points, labels)
+	badCH, _ := CalinskiHarabasz(points, shuffled)
+	assert.True(t, goodCH > 100*badCH, "The true clustering should have a much higher Calinski-Harabasz index")
+
+	goodDB, _ := DaviesBouldin(points, labels)
+	badDB, _ := DaviesBouldin(points, shuffled)
+	assert.True(t, goodDB < 0.1 && badDB > 1, "The true clustering should have a much lower Davies-Bouldin index")
+}
+
+func TestMetricsShouldFail1(t *testing.T) {
+	points := [][]float64{{0}, {1}, {4}, {5}}
+
+	invalid := [][]int{
+		{0, 0, 1},
+		{0, 0, 0, 0},
+		{0, 1, 2, 3},
+		{-1, -1, -1, -1},
+	}
+
+	for _, guesses := range invalid {
+		_, err := Silhouette(points, guesses, nil)
+		assert.NotNil(t, err, "Silhouette of %v should return an error", guesses)
+
+		_, err = CalinskiHarabasz(points, guesses)
+		assert.NotNil(t, err, "Calinski-Harabasz index of %v should return an error", guesses)
+
+		_, err = DaviesBouldin(points, guesses)
+		assert.NotNil(t, err, "Davies-Bouldin index of %v should return an error", guesses)
+	}
+
+	_, err := Silhouette([][]float64{{0}, {1, 2}, {4}, {5}}, []int{0, 0, 1, 1}, nil)
+	assert.NotNil(t, err, "Points with different dimensions should return an error")
+}
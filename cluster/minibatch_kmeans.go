@@ -0,0 +1,991 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+
+	"github.com/admpub/goml/base"
+)
+
+// SeedingMethod is how a MiniBatchKMeans model picks
+// its first centroids
+type SeedingMethod string
+
+// Seeding methods
+const (
+	// KMeansParallelSeeding seeds the centroids with
+	// k-means|| (scalable k-means++,) which oversamples
+	// candidate centroids in a few passes over the seed
+	// points and then picks k of them with k-means++.
+	//
+	// http://vldb.org/pvldb/vol5/p622_bahmanbahmani_vldb2012.pdf
+	KMeansParallelSeeding SeedingMethod = "k-means||"
+
+	// ReservoirSeeding keeps a uniform sample (a
+	// reservoir) of the seed points as they come, only
+	// holding batch size points at a time, and seeds
+	// the centroids with k-means++ over the sample.
+	//
+	// https://en.wikipedia.org/wiki/Reservoir_sampling
+	ReservoirSeeding SeedingMethod = "reservoir"
+)
+
+// Default hyperparameters of a MiniBatchKMeans model
+const (
+	// DefaultReassignmentRatio is the share of the
+	// count of the biggest cluster under which a
+	// cluster is considered dead
+	DefaultReassignmentRatio = 0.01
+
+	// kmeansParallelRounds is the number of
+	// oversampling passes of k-means||
+	kmeansParallelRounds = 5
+
+	// reassignmentInterval is the number of mini
+	// batches between checks for dead clusters
+	reassignmentInterval = 10
+)
+
+/*
+MiniBatchKMeans implements the mini-batch k-means
+algorithm of Sculley, which (rather than assigning
+every example to a cluster every iteration) updates
+the centroids from small random batches of examples.
+Every centroid moves towards the examples assigned to
+it with a learning rate of 1 over the number of
+examples it has been assigned so far, so centroids
+settle down as they see more data, and converge to
+the mean of their examples.
+
+https://www.eecs.tufts.edu/~dsculley/papers/fastkmeans.pdf
+
+Unlike the online version of KMeans, the centroids
+aren't started at random. They're seeded from the
+data with k-means|| or k-means++ over a reservoir
+sample (see SeedingMethod,) from the training set in
+batch learning, or from the first points of the
+stream in online learning, so the scale of the data
+doesn't matter.
+
+Clusters which end up (almost) without examples,
+because they were seeded badly or the stream moved
+away from them, are dead. Every few batches, dead
+clusters are reassigned to examples of the batch
+which are far from every centroid (see
+UpdateReassignmentRatio.)
+
+Example Mini-Batch K-Means Usage:
+
+	model := NewMiniBatchKMeans(4, 100, 200, data)
+
+	if model.Learn() != nil {
+		panic("Oh NO!!! There was an error learning!!")
+	}
+
+	guess, err := model.Predict([]float64{-3, 6})
+	if err != nil {
+		panic("prediction error")
+	}
+*/
+type MiniBatchKMeans struct {
+	// k is the number of clusters, batchSize the
+	// number of examples per mini batch, and
+	// maxIterations the number of mini batches
+	// drawn in batch learning
+	k             int
+	batchSize     int
+	maxIterations int
+
+	// seeding is how the centroids are seeded, and
+	// seedSize the number of points of a stream
+	// they're seeded from
+	seeding  SeedingMethod
+	seedSize int
+
+	// reassignmentRatio is the share of the count
+	// of the biggest cluster under which a cluster
+	// is reassigned
+	reassignmentRatio float64
+
+	// trainingSet and guesses are the
+	// 'x', and 'y' of the data. The guesses
+	// are set after batch learning.
+	trainingSet [][]float64
+	guesses     []int
+
+	// Counts holds the number of examples
+	// assigned to each centroid so far, which
+	// sets its learning rate
+	Centroids [][]float64 `json:"centroids"`
+	Counts    []float64   `json:"counts"`
+
+	// rng is the model's source of randomness
+	// for seeding and sampling batches. It's
+	// seeded from the current time unless the
+	// model is given a seed with UpdateSeed.
+	rng *rand.Rand
+
+	// Output is the io.Writer to write
+	// logging to. Defaults to os.Stdout
+	// but can be changed to any io.Writer
+	Output io.Writer
+}
+
+// NewMiniBatchKMeans returns a pointer to a mini-batch
+// k-means model with k clusters, learning from batches
+// of batchSize examples. Batch learning draws
+// maxIterations batches from the training set.
+//
+// The centroids are seeded with k-means|| by default,
+// online learning seeding them from the first 3 batches
+// of the stream (see UpdateSeeding.)
+func NewMiniBatchKMeans(k, batchSize, maxIterations int, trainingSet [][]float64) *MiniBatchKMeans {
+	return &MiniBatchKMeans{
+		k:             k,
+		batchSize:     batchSize,
+		maxIterations: maxIterations,
+
+		seeding:  KMeansParallelSeeding,
+		seedSize: 3 * batchSize,
+
+		reassignmentRatio: DefaultReassignmentRatio,
+
+		trainingSet: trainingSet,
+		guesses:     make([]int, len(trainingSet)),
+
+		rng: base.NewTimeSeededRandom(),
+
+		Output: os.Stdout,
+	}
+}
+
+// UpdateTrainingSet takes in a new training set (variable x.)
+//
+// Will reset the hidden 'guesses' param of the model.
+func (k *MiniBatchKMeans) UpdateTrainingSet(trainingSet [][]float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("Error: length of given training set is 0! Need data!")
+	}
+
+	k.trainingSet = trainingSet
+	k.guesses = make([]int, len(trainingSet))
+
+	return nil
+}
+
+// UpdateSeeding sets how the centroids are seeded, and
+// the number of points at the start of a stream they're
+// seeded from in online learning (at least k.) Batch
+// learning seeds from the whole training set.
+func (k *MiniBatchKMeans) UpdateSeeding(method SeedingMethod, points int) error {
+	if method != KMeansParallelSeeding && method != ReservoirSeeding {
+		return fmt.Errorf("ERROR: Unknown seeding method %v", method)
+	}
+	if points < k.k {
+		return fmt.Errorf("ERROR: Centroids must be seeded from at least k (%v) points - given %v", k.k, points)
+	}
+
+	k.seeding = method
+	k.seedSize = points
+
+	return nil
+}
+
+// Seeding returns how the centroids are seeded, and the
+// number of points of a stream they're seeded from
+func (k *MiniBatchKMeans) Seeding() (SeedingMethod, int) {
+	return k.seeding, k.seedSize
+}
+
+// UpdateSeed seeds the model's source of randomness
+// so learning is reproducible
+func (k *MiniBatchKMeans) UpdateSeed(seed int64) {
+	k.rng = base.NewRandom(seed)
+}
+
+// UpdateRandom replaces the model's source of
+// randomness
+func (k *MiniBatchKMeans) UpdateRandom(r *rand.Rand) {
+	k.rng = r
+}
+
+// UpdateReassignmentRatio sets the share of the count of
+// the biggest cluster under which a cluster is dead and
+// reassigned. 0 turns reassignment off.
+func (k *MiniBatchKMeans) UpdateReassignmentRatio(ratio float64) error {
+	if ratio < 0 || ratio >= 1 {
+		return fmt.Errorf("ERROR: Reassignment ratio must be within [0, 1) - given %v", ratio)
+	}
+
+	k.reassignmentRatio = ratio
+	return nil
+}
+
+// ReassignmentRatio returns the share of the count of
+// the biggest cluster under which a cluster is dead
+func (k *MiniBatchKMeans) ReassignmentRatio() float64 {
+	return k.reassignmentRatio
+}
+
+// BatchSize returns the number of examples per mini batch
+func (k *MiniBatchKMeans) BatchSize() int {
+	return k.batchSize
+}
+
+// Examples returns the number of training examples (m)
+// that the model currently is training from.
+func (k *MiniBatchKMeans) Examples() int {
+	return len(k.trainingSet)
+}
+
+// MaxIterations returns the number of mini batches
+// drawn in batch learning
+func (k *MiniBatchKMeans) MaxIterations() int {
+	return k.maxIterations
+}
+
+// validate checks the hyperparameters of the model
+func (k *MiniBatchKMeans) validate() error {
+	if k.k < 1 {
+		return fmt.Errorf("ERROR: MiniBatchKMeans needs at least 1 cluster - given %v\n", k.k)
+	}
+	if k.batchSize < 1 {
+		return fmt.Errorf("ERROR: MiniBatchKMeans batch size must be at least 1 - given %v\n", k.batchSize)
+	}
+	if k.seeding != KMeansParallelSeeding && k.seeding != ReservoirSeeding {
+		return fmt.Errorf("ERROR: Unknown seeding method %v\n", k.seeding)
+	}
+
+	return nil
+}
+
+// nearest returns the index of the centroid nearest
+// to x, and its squared distance from x
+func nearest(x []float64, centroids [][]float64) (int, float64) {
+	c := 0
+	minDiff := diff(x, centroids[0])
+	for j := 1; j < len(centroids); j++ {
+		difference := diff(x, centroids[j])
+		if difference < minDiff {
+			minDiff = difference
+			c = j
+		}
+	}
+
+	return c, minDiff
+}
+
+// sampleWeighted returns a random index, each index
+// being drawn with probability proportional to its
+// weight (uniformly if the weights are all 0)
+func sampleWeighted(weights []float64, r *rand.Rand) int {
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+	if sum <= 0 {
+		return r.Intn(len(weights))
+	}
+
+	target := r.Float64() * sum
+	for i, w := range weights {
+		target -= w
+		if target < 0 {
+			return i
+		}
+	}
+
+	// rounding can leave a tiny bit of the target
+	for i := len(weights) - 1; i > 0; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// seedPlusPlus picks k centroids among the given
+// points (each counting for its weight) with
+// k-means++: the first at random, and every other
+// with probability proportional to its squared
+// distance from the centroids picked so far. The
+// centroids are copies, so the points can't be
+// changed through them.
+//
+// http://ilpubs.stanford.edu:8090/778/1/2006-13.pdf
+func seedPlusPlus(points [][]float64, weights []float64, k int, r *rand.Rand) [][]float64 {
+	centroids := make([][]float64, 0, k)
+	centroids = append(centroids, append([]float64{}, points[sampleWeighted(weights, r)]...))
+
+	distances := make([]float64, len(points))
+	for i, x := range points {
+		distances[i] = diff(x, centroids[0])
+	}
+
+	probabilities := make([]float64, len(points))
+	for len(centroids) < k {
+		for i := range points {
+			probabilities[i] = weights[i] * distances[i]
+		}
+
+		c := append([]float64{}, points[sampleWeighted(probabilities, r)]...)
+		centroids = append(centroids, c)
+
+		for i, x := range points {
+			if d := diff(x, c); d < distances[i] {
+				distances[i] = d
+			}
+		}
+	}
+
+	return centroids
+}
+
+// seedParallel picks k centroids among the given points
+// with k-means||: starting from a random point, every
+// round samples each point with probability 2k times its
+// squared distance from the candidates over the total,
+// then the candidates (weighted by the number of points
+// nearest to them) are reduced to k with k-means++.
+func seedParallel(points [][]float64, k int, r *rand.Rand) [][]float64 {
+	candidates := [][]float64{points[r.Intn(len(points))]}
+
+	distances := make([]float64, len(points))
+	var cost float64
+	for i, x := range points {
+		distances[i] = diff(x, candidates[0])
+		cost += distances[i]
+	}
+
+	oversampling := 2 * float64(k)
+	for round := 0; round < kmeansParallelRounds && cost > 0; round++ {
+		var sampled [][]float64
+		for i, x := range points {
+			if r.Float64() < oversampling*distances[i]/cost {
+				sampled = append(sampled, x)
+			}
+		}
+
+		cost = 0
+		for i, x := range points {
+			for _, c := range sampled {
+				if d := diff(x, c); d < distances[i] {
+					distances[i] = d
+				}
+			}
+			cost += distances[i]
+		}
+
+		candidates = append(candidates, sampled...)
+	}
+
+	// with too few candidates (if the points have
+	// few distinct values) seed from every point
+	if len(candidates) < k {
+		weights := make([]float64, len(points))
+		for i := range weights {
+			weights[i] = 1
+		}
+
+		return seedPlusPlus(points, weights, k, r)
+	}
+
+	weights := make([]float64, len(candidates))
+	for _, x := range points {
+		c, _ := nearest(x, candidates)
+		weights[c]++
+	}
+
+	return seedPlusPlus(candidates, weights, k, r)
+}
+
+// reservoir keeps a uniform sample of the points it's
+// offered, holding at most size points
+type reservoir struct {
+	size   int
+	seen   int
+	points [][]float64
+}
+
+// offer adds x to the sample, replacing a random point
+// once the sample is full so every point seen so far is
+// kept with the same probability
+func (s *reservoir) offer(x []float64, r *rand.Rand) {
+	s.seen++
+	if len(s.points) < s.size {
+		s.points = append(s.points, x)
+		return
+	}
+
+	if i := r.Intn(s.seen); i < s.size {
+		s.points[i] = x
+	}
+}
+
+// seedFromReservoir seeds the centroids with k-means++
+// over the sampled points
+func seedFromReservoir(points [][]float64, k int, r *rand.Rand) [][]float64 {
+	weights := make([]float64, len(points))
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	return seedPlusPlus(points, weights, k, r)
+}
+
+// seed seeds the centroids from the given points
+// with the model's seeding method
+func (k *MiniBatchKMeans) seed(points [][]float64) {
+	if k.seeding == ReservoirSeeding {
+		sample := reservoir{size: k.batchSize}
+		if sample.size < k.k {
+			sample.size = k.k
+		}
+		for _, x := range points {
+			sample.offer(x, k.rng)
+		}
+
+		k.Centroids = seedFromReservoir(sample.points, k.k, k.rng)
+	} else {
+		k.Centroids = seedParallel(points, k.k, k.rng)
+	}
+
+	k.Counts = make([]float64, k.k)
+}
+
+// step updates the centroids with one mini batch: every
+// example is assigned to its nearest centroid, then
+// moves that centroid towards it with a learning rate
+// of 1 over the count of the centroid. Returns the
+// indices of the centroids which were updated.
+func (k *MiniBatchKMeans) step(batch [][]float64) []int {
+	assignments := make([]int, len(batch))
+	for i, x := range batch {
+		assignments[i], _ = nearest(x, k.Centroids)
+	}
+
+	updated := make([]bool, len(k.Centroids))
+	for i, x := range batch {
+		c := assignments[i]
+		k.Counts[c]++
+		updated[c] = true
+
+		eta := 1 / k.Counts[c]
+		for j := range x {
+			k.Centroids[c][j] += eta * (x[j] - k.Centroids[c][j])
+		}
+	}
+
+	var indices []int
+	for c := range updated {
+		if updated[c] {
+			indices = append(indices, c)
+		}
+	}
+
+	return indices
+}
+
+// reassign moves every dead centroid (whose count is
+// under the reassignment ratio of the biggest count) to
+// an example of the batch, drawn with probability
+// proportional to its squared distance from the nearest
+// centroid. Reassigned centroids get the smallest count
+// of the live centroids, so they aren't drowned out.
+// Returns the indices of the reassigned centroids.
+func (k *MiniBatchKMeans) reassign(batch [][]float64) []int {
+	if k.reassignmentRatio == 0 || len(batch) == 0 {
+		return nil
+	}
+
+	var biggest float64
+	for _, count := range k.Counts {
+		if count > biggest {
+			biggest = count
+		}
+	}
+
+	threshold := k.reassignmentRatio * biggest
+	var dead []int
+	smallest := biggest
+	for c, count := range k.Counts {
+		if count < threshold {
+			dead = append(dead, c)
+		} else if count < smallest {
+			smallest = count
+		}
+	}
+	if len(dead) == 0 {
+		return nil
+	}
+
+	distances := make([]float64, len(batch))
+	for i, x := range batch {
+		_, distances[i] = nearest(x, k.Centroids)
+	}
+
+	for _, c := range dead {
+		i := sampleWeighted(distances, k.rng)
+		k.Centroids[c] = append([]float64{}, batch[i]...)
+		k.Counts[c] = smallest
+
+		// don't reassign two centroids to the
+		// same example
+		distances[i] = 0
+	}
+
+	return dead
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns the index of the nearest centroid
+//
+// if normalize is given as true, then the input will
+// first be normalized to unit length. Only use this if
+// you trained off of normalized inputs and are feeding
+// an un-normalized input
+func (k *MiniBatchKMeans) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if len(k.Centroids) == 0 {
+		return nil, fmt.Errorf("ERROR: MiniBatchKMeans has no centroids! Learn before predicting")
+	}
+	if len(x) != len(k.Centroids[0]) {
+		return nil, fmt.Errorf("Error: Centroid vector should be the same length as input vector!\n\tLength of x given: %v\n\tLength of centroid: %v\n", len(x), len(k.Centroids[0]))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	c, _ := nearest(x, k.Centroids)
+
+	return []float64{float64(c)}, nil
+}
+
+// Learn seeds the centroids from the training set and
+// then updates them with maxIterations mini batches,
+// each drawn uniformly at random from the training set.
+// Every example is then assigned to its nearest
+// centroid (see Guesses.)
+func (k *MiniBatchKMeans) Learn() error {
+	examples := len(k.trainingSet)
+	if examples == 0 || len(k.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	err := k.validate()
+	if err != nil {
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+	if examples < k.k {
+		err := fmt.Errorf("ERROR: Attempting to find %v clusters in %v training examples!\n", k.k, examples)
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	features := len(k.trainingSet[0])
+	for i := range k.trainingSet {
+		if len(k.trainingSet[i]) != features {
+			err := fmt.Errorf("ERROR: Training example %v doesn't match the dimensions of the training set (%v)\n", i, features)
+			fmt.Fprintf(k.Output, err.Error())
+			return err
+		}
+	}
+
+	fmt.Fprintf(k.Output, "Training:\n\tModel: Mini-Batch K-Means Classification\n\tSeeding Method: %v\n\tTraining Examples: %v\n\tFeatures: %v\n\tClasses: %v\n\tBatch Size: %v\n...\n\n", k.seeding, examples, features, k.k, k.batchSize)
+
+	k.seed(k.trainingSet)
+
+	batch := make([][]float64, k.batchSize)
+	iter := 0
+	for ; iter < k.maxIterations; iter++ {
+		for i := range batch {
+			batch[i] = k.trainingSet[k.rng.Intn(examples)]
+		}
+
+		k.step(batch)
+		if (iter+1)%reassignmentInterval == 0 {
+			k.reassign(batch)
+		}
+	}
+
+	k.guesses = make([]int, examples)
+	for i, x := range k.trainingSet {
+		k.guesses[i], _ = nearest(x, k.Centroids)
+	}
+
+	fmt.Fprintf(k.Output, "Training Completed in %v iterations.\n%v\n", iter, k)
+
+	return nil
+}
+
+/*
+OnlineLearn runs mini-batch k-means off of a stream of
+data. The first points of the stream seed the centroids
+(see UpdateSeeding,) then every batch size points
+update them. Learning will stop when the data channel
+is closed and all remaining datapoints within the
+channel have been read, updating the centroids with
+the last (partial) batch.
+
+If the model already has centroids (it learned before,
+or was restored) they aren't seeded again, so learning
+picks up where it left off.
+
+The onUpdate callback will be called in a separate
+goroutine after every batch with a copy of the
+centroids.
+
+NOTE that this is an unsupervised model! You
+DO NOT need to pass in the Y param of the
+datapoints!
+
+The errors channel will be closed when learning is
+completed. Points which don't match the dimensions of
+the centroids (or the first point of the stream) are
+skipped with an error. If the stream closes before k
+points are read, an error is sent since the centroids
+can't be seeded.
+
+Example Online Mini-Batch K-Means Model:
+
+	model := NewMiniBatchKMeans(4, 50, 0, nil)
+
+	go model.OnlineLearn(errors, stream, func(centroids [][]float64) {})
+
+	// pass data to stream and close it, then
+	// wait for the errors channel to be closed
+	for {
+		err, more := <-errors
+		if err != nil {
+			panic("THERE WAS AN ERROR!!! RUN!!!!")
+		}
+		if !more {
+			break
+		}
+	}
+
+	guess, err = model.Predict([]float64{42, 6, 10, -32})
+*/
+func (k *MiniBatchKMeans) OnlineLearn(errors chan error, dataset chan base.Datapoint, onUpdate func([][]float64), normalize ...bool) {
+	if errors == nil {
+		errors = make(chan error)
+	}
+	if dataset == nil {
+		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
+		close(errors)
+		return
+	}
+
+	err := k.validate()
+	if err == nil && len(k.Centroids) == 0 && k.seedSize < k.k {
+		err = fmt.Errorf("ERROR: Centroids must be seeded from at least k (%v) points - given %v\n", k.k, k.seedSize)
+	}
+	if err != nil {
+		errors <- err
+		close(errors)
+		return
+	}
+
+	fmt.Fprintf(k.Output, "Training:\n\tModel: Online Mini-Batch K-Means Classification\n\tSeeding Method: %v\n\tClasses: %v\n\tBatch Size: %v\n...\n\n", k.seeding, k.k, k.batchSize)
+
+	norm := len(normalize) != 0 && normalize[0]
+
+	features := -1
+	if len(k.Centroids) != 0 {
+		features = len(k.Centroids[0])
+	}
+
+	// the seed points are all kept for k-means||,
+	// while reservoir seeding only keeps a sample
+	var seedPoints [][]float64
+	sample := reservoir{size: k.batchSize}
+	if sample.size < k.k {
+		sample.size = k.k
+	}
+
+	var batch [][]float64
+	var batches int
+
+	update := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		k.step(batch)
+		batches++
+		if batches%reassignmentInterval == 0 {
+			k.reassign(batch)
+		}
+		batch = batch[:0]
+
+		centroids := make([][]float64, len(k.Centroids))
+		for c := range centroids {
+			centroids[c] = append([]float64{}, k.Centroids[c]...)
+		}
+		go onUpdate(centroids)
+	}
+
+	seed := func() {
+		if k.seeding == ReservoirSeeding {
+			k.Centroids = seedFromReservoir(sample.points, k.k, k.rng)
+			k.Counts = make([]float64, k.k)
+
+			// the sample is the first batch
+			batch = append(batch, sample.points...)
+		} else {
+			k.seed(seedPoints)
+			batch = append(batch, seedPoints...)
+		}
+		seedPoints = nil
+		sample.points = nil
+
+		for len(batch) >= k.batchSize {
+			rest := append([][]float64{}, batch[k.batchSize:]...)
+			batch = batch[:k.batchSize]
+			update()
+			batch = rest
+		}
+	}
+
+	var point base.Datapoint
+	var more bool
+
+	for {
+		point, more = <-dataset
+
+		if more {
+			if norm {
+				base.NormalizePoint(point.X)
+			}
+
+			if features == -1 {
+				features = len(point.X)
+			}
+			if len(point.X) != features || features == 0 {
+				errors <- fmt.Errorf("ERROR: point.X must have the same dimensions as clusters (len %v). Point: %v", features, point)
+				continue
+			}
+
+			if len(k.Centroids) == 0 {
+				if k.seeding == ReservoirSeeding {
+					sample.offer(point.X, k.rng)
+				} else {
+					seedPoints = append(seedPoints, point.X)
+				}
+
+				if sample.seen+len(seedPoints) >= k.seedSize {
+					seed()
+				}
+				continue
+			}
+
+			batch = append(batch, point.X)
+			if len(batch) >= k.batchSize {
+				update()
+			}
+		} else {
+			if len(k.Centroids) == 0 {
+				if sample.seen+len(seedPoints) < k.k {
+					errors <- fmt.Errorf("ERROR: The stream closed after %v points, before the %v centroids could be seeded\n", sample.seen+len(seedPoints), k.k)
+					close(errors)
+					return
+				}
+				seed()
+			}
+			update()
+
+			fmt.Fprintf(k.Output, "Training Completed.\n%v\n\n", k)
+			close(errors)
+			return
+		}
+	}
+}
+
+// String implements the fmt interface for clean printing. Here
+// we're using it to print the model as the equation h(θ)=...
+// where h is the k-means hypothesis model
+func (k *MiniBatchKMeans) String() string {
+	return fmt.Sprintf("h(θ,x) = argmin_j | x[i] - μ[j] |^2\n\tμ = %v", k.Centroids)
+}
+
+// Guesses returns the hidden parameter for the
+// unsupervised classification assigned during
+// batch learning.
+//
+//    model.Guesses[i] = E[k.trainingSet[i]]
+func (k *MiniBatchKMeans) Guesses() []int {
+	return k.guesses
+}
+
+// Distortion returns the distortion of the clustering
+// of the training set given by the model, which is the
+// function the learning algorithm tries to minimize.
+//
+// Distorition() = Σ |x[i] - μ[c[i]]|^2
+// over all training examples
+func (k *MiniBatchKMeans) Distortion() float64 {
+	var sum float64
+	for _, x := range k.trainingSet {
+		_, d := nearest(x, k.Centroids)
+		sum += d
+	}
+
+	return sum
+}
+
+// miniBatchKMeansHyperparameters holds the hyperparameters
+// of a MiniBatchKMeans model as saved in its envelope
+type miniBatchKMeansHyperparameters struct {
+	K                 int           `json:"k"`
+	BatchSize         int           `json:"batch_size"`
+	MaxIterations     int           `json:"max_iterations"`
+	Seeding           SeedingMethod `json:"seeding"`
+	SeedSize          int           `json:"seed_size"`
+	ReassignmentRatio float64       `json:"reassignment_ratio"`
+}
+
+// miniBatchKMeansData is the data of a MiniBatchKMeans
+// envelope. The counts are saved along with the
+// centroids so online learning can pick up where it
+// left off.
+type miniBatchKMeansData struct {
+	Centroids [][]float64 `json:"centroids"`
+	Counts    []float64   `json:"counts"`
+}
+
+// miniBatchKMeansType is the name MiniBatchKMeans
+// models are registered and persisted under
+const miniBatchKMeansType = "cluster.MiniBatchKMeans"
+
+func init() {
+	base.RegisterModel(miniBatchKMeansType, func() base.Persistable {
+		return NewMiniBatchKMeans(0, 0, 0, nil)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// hyperparameters, wrapped in a base.Envelope. The data
+// of the envelope is the centroids and their counts.
+func (k *MiniBatchKMeans) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(k.Centroids) != 0 {
+		features = len(k.Centroids[0])
+	}
+
+	env := &base.Envelope{
+		Type: miniBatchKMeansType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+		Metadata: base.TrainingMetadata{
+			Examples: len(k.trainingSet),
+		},
+	}
+
+	err := env.Encode(miniBatchKMeansHyperparameters{
+		K:                 k.k,
+		BatchSize:         k.batchSize,
+		MaxIterations:     k.maxIterations,
+		Seeding:           k.seeding,
+		SeedSize:          k.seedSize,
+		ReassignmentRatio: k.reassignmentRatio,
+	}, miniBatchKMeansData{
+		Centroids: k.Centroids,
+		Counts:    k.Counts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's centroids and
+// hyperparameters from the given base.Envelope
+func (k *MiniBatchKMeans) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := miniBatchKMeansHyperparameters{
+		K:                 k.k,
+		BatchSize:         k.batchSize,
+		MaxIterations:     k.maxIterations,
+		Seeding:           k.seeding,
+		SeedSize:          k.seedSize,
+		ReassignmentRatio: k.reassignmentRatio,
+	}
+
+	var data miniBatchKMeansData
+	err := env.Decode(miniBatchKMeansType, &hyper, &data)
+	if err != nil {
+		return err
+	}
+
+	if len(data.Centroids) != hyper.K || len(data.Counts) != len(data.Centroids) {
+		return fmt.Errorf("ERROR: MiniBatchKMeans has %v clusters but %v centroids and %v counts", hyper.K, len(data.Centroids), len(data.Counts))
+	}
+	for c := range data.Centroids {
+		if len(data.Centroids[c]) != len(data.Centroids[0]) {
+			return fmt.Errorf("ERROR: MiniBatchKMeans centroids should all have the same length")
+		}
+	}
+	if hyper.Seeding != KMeansParallelSeeding && hyper.Seeding != ReservoirSeeding {
+		return fmt.Errorf("ERROR: Unknown seeding method %v", hyper.Seeding)
+	}
+	if hyper.ReassignmentRatio < 0 || hyper.ReassignmentRatio >= 1 {
+		return fmt.Errorf("ERROR: Reassignment ratio must be within [0, 1) - given %v", hyper.ReassignmentRatio)
+	}
+
+	k.k = hyper.K
+	k.batchSize = hyper.BatchSize
+	k.maxIterations = hyper.MaxIterations
+	k.seeding = hyper.Seeding
+	k.seedSize = hyper.SeedSize
+	k.reassignmentRatio = hyper.ReassignmentRatio
+	k.Centroids = data.Centroids
+	k.Counts = data.Counts
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// centroids (and their counts) along with the hyperparameters
+// of the model to the file, which can be restored later.
+//
+// The model is stored as a JSON base.Envelope.
+func (k *MiniBatchKMeans) PersistToFile(path string) error {
+	return base.PersistModel(path, k)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and assigns the model it's operating on's centroids
+// and hyperparameters to those persisted.
+func (k *MiniBatchKMeans) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, k)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (k *MiniBatchKMeans) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, k)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (k *MiniBatchKMeans) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, k)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (k *MiniBatchKMeans) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(k)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (k *MiniBatchKMeans) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, k)
+}
@@ -0,0 +1,327 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blobs returns n points from 4 well separated
+// gaussian blobs far from the origin, and the blob
+// each point came from
+func blobs(r *rand.Rand, n int) ([][]float64, []int) {
+	centers := [][]float64{{1000, 1000}, {1000, -1000}, {-1000, 1000}, {-1000, -1000}}
+
+	points := make([][]float64, n)
+	labels := make([]int, n)
+	for i := range points {
+		labels[i] = r.Intn(len(centers))
+		points[i] = []float64{
+			centers[labels[i]][0] + r.NormFloat64()*20,
+			centers[labels[i]][1] + r.NormFloat64()*20,
+		}
+	}
+
+	return points, labels
+}
+
+// assertBlobsClustered checks that every blob went to
+// its own cluster
+func assertBlobsClustered(t *testing.T, model *MiniBatchKMeans, points [][]float64, labels []int, name string) {
+	clusters := make(map[int]float64)
+	for i, x := range points {
+		guess, err := model.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		if c, ok := clusters[labels[i]]; ok {
+			assert.Equal(t, c, guess[0], "%v should put every point of a blob in the same cluster", name)
+		} else {
+			clusters[labels[i]] = guess[0]
+		}
+	}
+
+	seen := make(map[float64]bool)
+	for _, c := range clusters {
+		assert.False(t, seen[c], "%v should put every blob in its own cluster", name)
+		seen[c] = true
+	}
+}
+
+func TestMiniBatchKMeansShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	points, labels := blobs(r, 2000)
+
+	for _, seeding := range []SeedingMethod{KMeansParallelSeeding, ReservoirSeeding} {
+		model := NewMiniBatchKMeans(4, 50, 100, points)
+		model.Output = ioutil.Discard
+		model.UpdateSeed(2)
+
+		err := model.UpdateSeeding(seeding, 100)
+		assert.Nil(t, err, "Updating the seeding should not return an error")
+
+		err = model.Learn()
+		assert.Nil(t, err, "Learning error should be nil")
+
+		assertBlobsClustered(t, model, points, labels, string(seeding))
+
+		guesses := model.Guesses()
+		assert.Len(t, guesses, len(points), "Every example should get a guess")
+		for i := range points {
+			guess, _ := model.Predict(points[i])
+			assert.Equal(t, float64(guesses[i]), guess[0], "Guesses should match predictions")
+		}
+
+		// each centroid should be close to the mean of
+		// its blob, so the distortion is about the
+		// variance of the blobs
+		assert.True(t, model.Distortion()/float64(len(points)) < 2*2*20*20, "%v should find the centers of the blobs (distortion %v)", seeding, model.Distortion())
+
+		var total float64
+		for _, count := range model.Counts {
+			total += count
+		}
+		assert.Equal(t, float64(100*50), total, "Every example of every batch should be counted")
+	}
+}
+
+func TestMiniBatchKMeansShouldPass2(t *testing.T) {
+	model := NewMiniBatchKMeans(1, 10, 0, nil)
+	model.Centroids = [][]float64{{0, 0}}
+	model.Counts = []float64{0}
+
+	// the learning rate 1/count makes every centroid
+	// the mean of the examples assigned to it
+	batch := [][]float64{{1, 2}, {3, 4}, {5, 0}, {-1, 6}}
+	updated := model.step(batch)
+	assert.Equal(t, []int{0}, updated, "The assigned centroid should be updated")
+	assert.InDeltaSlice(t, []float64{2, 3}, model.Centroids[0], 1e-12, "The centroid should be the mean of its examples")
+
+	model.step([][]float64{{2, 3}, {2, 3}, {2, 3}, {2, 3}})
+	assert.InDeltaSlice(t, []float64{2, 3}, model.Centroids[0], 1e-12, "The centroid should stay the mean of its examples")
+	assert.Equal(t, []float64{8}, model.Counts, "Every example should be counted")
+
+	// a dead centroid is moved to an example far
+	// from every centroid
+	model = NewMiniBatchKMeans(3, 10, 0, nil)
+	model.UpdateSeed(3)
+	model.Centroids = [][]float64{{0, 0}, {10, 10}, {500, 500}}
+	model.Counts = []float64{100, 40, 0}
+
+	batch = [][]float64{{0, 0}, {10, 10}, {-50, 20}}
+	reassigned := model.reassign(batch)
+	assert.Equal(t, []int{2}, reassigned, "Only the dead centroid should be reassigned")
+	assert.Equal(t, []float64{-50, 20}, model.Centroids[2], "The dead centroid should move to the example far from the others")
+	assert.Equal(t, 40.0, model.Counts[2], "The reassigned centroid should get the smallest live count")
+
+	assert.Nil(t, model.reassign(batch), "Nothing should be reassigned without dead centroids")
+
+	model.Counts[1] = 0
+	assert.Nil(t, model.UpdateReassignmentRatio(0), "Updating the reassignment ratio should not return an error")
+	assert.Nil(t, model.reassign(batch), "Nothing should be reassigned with reassignment turned off")
+}
+
+func TestMiniBatchKMeansDeadClusterShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	points, labels := blobs(r, 1000)
+
+	// two centroids seeded in the same blob leave
+	// another blob without a centroid, until one of
+	// them dies and is reassigned
+	model := NewMiniBatchKMeans(4, 50, 200, points)
+	model.Output = ioutil.Discard
+	model.UpdateSeed(5)
+	model.Centroids = [][]float64{{1000, 1000}, {1000, -1000}, {-1000, 1000}, {-1001, 1001}}
+	model.Counts = make([]float64, 4)
+
+	batch := make([][]float64, 50)
+	for iter := 0; iter < 200; iter++ {
+		for i := range batch {
+			batch[i] = points[model.rng.Intn(len(points))]
+		}
+
+		model.step(batch)
+		if (iter+1)%reassignmentInterval == 0 {
+			model.reassign(batch)
+		}
+	}
+
+	assertBlobsClustered(t, model, points, labels, "Reassigning dead clusters")
+}
+
+func TestMiniBatchKMeansOnlineShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(6))
+	points, labels := blobs(r, 3000)
+
+	for _, seeding := range []SeedingMethod{KMeansParallelSeeding, ReservoirSeeding} {
+		stream := make(chan base.Datapoint, 100)
+		errors := make(chan error)
+
+		model := NewMiniBatchKMeans(4, 40, 0, nil)
+		model.Output = ioutil.Discard
+		model.UpdateSeed(7)
+
+		err := model.UpdateSeeding(seeding, 200)
+		assert.Nil(t, err, "Updating the seeding should not return an error")
+
+		go model.OnlineLearn(errors, stream, func(centroids [][]float64) {})
+
+		go func() {
+			for _, x := range points {
+				stream <- base.Datapoint{X: x}
+			}
+
+			close(stream)
+		}()
+
+		err, more := <-errors
+		assert.Nil(t, err, "Learning error should be nil")
+		assert.False(t, more, "There should be no errors returned")
+
+		assertBlobsClustered(t, model, points, labels, "Online "+string(seeding))
+
+		var total float64
+		for _, count := range model.Counts {
+			total += count
+		}
+		if seeding == KMeansParallelSeeding {
+			assert.Equal(t, float64(len(points)), total, "Every point of the stream should be counted")
+		} else {
+			assert.Equal(t, float64(len(points)-200+40), total, "Every point after the seed points, and the reservoir, should be counted")
+		}
+	}
+}
+
+func TestMiniBatchKMeansOnlineShouldFail1(t *testing.T) {
+	stream := make(chan base.Datapoint, 10)
+	errors := make(chan error)
+
+	model := NewMiniBatchKMeans(3, 10, 0, nil)
+	model.Output = ioutil.Discard
+
+	go model.OnlineLearn(errors, stream, func(centroids [][]float64) {})
+
+	stream <- base.Datapoint{X: []float64{1, 2}}
+	stream <- base.Datapoint{X: []float64{1}}
+	stream <- base.Datapoint{X: []float64{3, 4}}
+	close(stream)
+
+	var count int
+	for err := range errors {
+		assert.NotNil(t, err, "Only errors should be sent")
+		count++
+	}
+	assert.Equal(t, 2, count, "The invalid point and the failed seeding should return errors")
+	assert.Empty(t, model.Centroids, "The model shouldn't be seeded from too few points")
+
+	errors = make(chan error)
+	go NewMiniBatchKMeans(0, 10, 0, nil).OnlineLearn(errors, stream, func(centroids [][]float64) {})
+
+	err := <-errors
+	assert.NotNil(t, err, "Learning without clusters should return an error")
+
+	errors = make(chan error)
+	go model.OnlineLearn(errors, nil, func(centroids [][]float64) {})
+
+	err = <-errors
+	assert.NotNil(t, err, "Learning from a nil stream should return an error")
+}
+
+func TestMiniBatchKMeansShouldFail1(t *testing.T) {
+	invalid := []*MiniBatchKMeans{
+		NewMiniBatchKMeans(0, 10, 10, [][]float64{{1}, {2}}),
+		NewMiniBatchKMeans(2, 0, 10, [][]float64{{1}, {2}}),
+		NewMiniBatchKMeans(3, 10, 10, [][]float64{{1}, {2}}),
+		NewMiniBatchKMeans(2, 10, 10, [][]float64{{1}, {2, 3}}),
+		NewMiniBatchKMeans(2, 10, 10, nil),
+	}
+
+	for i, model := range invalid {
+		model.Output = ioutil.Discard
+		assert.NotNil(t, model.Learn(), "Learning with invalid model %v should return an error", i)
+	}
+
+	model := NewMiniBatchKMeans(2, 10, 10, nil)
+	_, err := model.Predict([]float64{1})
+	assert.NotNil(t, err, "Predicting without centroids should return an error")
+
+	assert.NotNil(t, model.UpdateSeeding("random", 100), "Unknown seeding should return an error")
+	assert.NotNil(t, model.UpdateSeeding(ReservoirSeeding, 1), "Seeding from fewer than k points should return an error")
+	assert.NotNil(t, model.UpdateReassignmentRatio(1), "A reassignment ratio of 1 should return an error")
+	assert.NotNil(t, model.UpdateTrainingSet(nil), "An empty training set should return an error")
+
+	method, points := model.Seeding()
+	assert.Equal(t, KMeansParallelSeeding, method, "The model should keep its seeding after an error")
+	assert.Equal(t, 30, points, "The model should seed from 3 batches by default")
+}
+
+func TestPersistMiniBatchKMeansShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(8))
+	points, labels := blobs(r, 1000)
+
+	model := NewMiniBatchKMeans(4, 50, 50, points)
+	model.Output = ioutil.Discard
+	model.UpdateSeed(9)
+
+	err := model.UpdateSeeding(ReservoirSeeding, 80)
+	assert.Nil(t, err, "Updating the seeding should not return an error")
+
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	err = model.PersistToFile("/tmp/.goml/MiniBatchKMeans.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/MiniBatchKMeans.json")
+	assert.Nil(t, err, "Loading the model should not return an error")
+
+	restored, ok := loaded.(*MiniBatchKMeans)
+	assert.True(t, ok, "The loaded model should be a MiniBatchKMeans model")
+	assert.Equal(t, model.Centroids, restored.Centroids, "The restored model should keep its centroids")
+	assert.Equal(t, model.Counts, restored.Counts, "The restored model should keep its counts")
+	assert.Equal(t, 50, restored.BatchSize(), "The restored model should keep its batch size")
+
+	method, seedSize := restored.Seeding()
+	assert.Equal(t, ReservoirSeeding, method, "The restored model should keep its seeding")
+	assert.Equal(t, 80, seedSize, "The restored model should keep its seeding")
+
+	// online learning should pick up where batch
+	// learning left off, without seeding again
+	stream := make(chan base.Datapoint, 100)
+	errors := make(chan error)
+
+	restored.Output = ioutil.Discard
+	go restored.OnlineLearn(errors, stream, func(centroids [][]float64) {})
+
+	more, _ := blobs(r, 500)
+	for _, x := range more {
+		stream <- base.Datapoint{X: x}
+	}
+	close(stream)
+
+	err, open := <-errors
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.False(t, open, "There should be no errors returned")
+
+	assertBlobsClustered(t, restored, points, labels, "Restored model")
+
+	var before, after float64
+	for c := range model.Counts {
+		before += model.Counts[c]
+		after += restored.Counts[c]
+	}
+	assert.Equal(t, before+500, after, "Online learning should keep counting from the restored counts")
+
+	env := &base.Envelope{Type: miniBatchKMeansType}
+	err = env.Encode(miniBatchKMeansHyperparameters{K: 2, Seeding: KMeansParallelSeeding}, miniBatchKMeansData{
+		Centroids: [][]float64{{1, 2}, {3, 4}},
+		Counts:    []float64{1},
+	})
+	assert.Nil(t, err, "Encoding the envelope should not return an error")
+
+	err = restored.UnmarshalEnvelope(env)
+	assert.NotNil(t, err, "Restoring a model without a count for every centroid should return an error")
+}
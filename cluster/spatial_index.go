@@ -0,0 +1,307 @@
+package cluster
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/admpub/goml/base"
+)
+
+// DefaultLeafSize is the default number of points
+// kept in a leaf of the tree indexes. Below that,
+// scanning the points is faster than splitting them.
+const DefaultLeafSize = 16
+
+// Neighbor is a point returned by a query on a
+// SpatialIndex: its index in the indexed set of points,
+// and its distance from the query point
+type Neighbor struct {
+	Index    int     `json:"index"`
+	Distance float64 `json:"distance"`
+}
+
+// SpatialIndex is a structure built over a set of
+// points which answers nearest neighbor queries
+// without comparing the query point to every point
+// in the set.
+//
+// Results are sorted nearest first, ties going to the
+// point with the lowest index.
+type SpatialIndex interface {
+	// KNearest returns the k points nearest to x
+	// (or every point if there are fewer than k)
+	KNearest(x []float64, k int) []Neighbor
+
+	// Radius returns every point within distance
+	// r of x (inclusive)
+	Radius(x []float64, r float64) []Neighbor
+
+	// Len returns the number of indexed points
+	Len() int
+}
+
+// IncrementalIndex is a SpatialIndex which points
+// can be added to after it's built
+type IncrementalIndex interface {
+	SpatialIndex
+
+	// Insert adds x to the index and returns its
+	// index (the number of points indexed before it)
+	Insert(x []float64) int
+}
+
+// RemovableIndex is an IncrementalIndex which points
+// can be removed from. Removed points are left in the
+// index as tombstones, so the other points keep their
+// index (and Len still counts removed points,) but
+// they're never returned by queries again.
+type RemovableIndex interface {
+	IncrementalIndex
+
+	// Remove removes the point with the given index
+	Remove(i int)
+}
+
+// IndexType names a kind of SpatialIndex, so models
+// like KNN can be told which one to build
+type IndexType string
+
+// Spatial indexes which can be built with NewIndex
+const (
+	// BruteForceIndex compares the query point to
+	// every point. It works with any distance measure.
+	BruteForceIndex IndexType = "brute_force"
+
+	// KDTreeIndex is a KDTree. Exact for distances
+	// where moving a point closer along one axis never
+	// takes it further away (Euclidean, Manhattan,
+	// Minkowski, Chebyshev, weighted Euclidean.)
+	KDTreeIndex IndexType = "kd_tree"
+
+	// BallTreeIndex is a BallTree. Exact for metrics
+	// (distances following the triangle inequality.)
+	BallTreeIndex IndexType = "ball_tree"
+
+	// VPTreeIndex is a VPTree. Exact for metrics
+	// (distances following the triangle inequality.)
+	VPTreeIndex IndexType = "vp_tree"
+
+	// HNSWIndex is an HNSW graph. Approximate, but
+	// fast even with many dimensions, and incremental.
+	HNSWIndex IndexType = "hnsw"
+
+	// LSHIndex is an LSH index. Approximate and
+	// incremental.
+	LSHIndex IndexType = "lsh"
+)
+
+// NewIndex builds the spatial index of the given type
+// over points with the given distance measure (and the
+// default parameters for approximate indexes.) An empty
+// type builds a BruteForce index.
+func NewIndex(indexType IndexType, points [][]float64, distance base.DistanceMeasure) (SpatialIndex, error) {
+	if distance == nil {
+		return nil, fmt.Errorf("ERROR: Attempting to build a spatial index without a distance measure!")
+	}
+
+	switch indexType {
+	case BruteForceIndex, "":
+		return NewBruteForce(points, distance), nil
+	case KDTreeIndex:
+		return NewKDTree(points, distance, DefaultLeafSize), nil
+	case BallTreeIndex:
+		return NewBallTree(points, distance, DefaultLeafSize), nil
+	case VPTreeIndex:
+		return NewVPTree(points, distance, DefaultLeafSize), nil
+	case HNSWIndex:
+		return NewHNSW(points, distance, DefaultHNSWParams()), nil
+	case LSHIndex:
+		return NewLSH(points, distance, DefaultLSHParams()), nil
+	}
+
+	return nil, fmt.Errorf("ERROR: Unknown spatial index type '%v'", indexType)
+}
+
+// BruteForce is the trivial SpatialIndex, which
+// answers queries by computing the distance from the
+// query point to every point
+type BruteForce struct {
+	Distance base.DistanceMeasure
+
+	points [][]float64
+
+	// removed marks the points removed
+	// from the index
+	removed []bool
+}
+
+// NewBruteForce returns a BruteForce index over the
+// given points
+func NewBruteForce(points [][]float64, distance base.DistanceMeasure) *BruteForce {
+	return &BruteForce{
+		Distance: distance,
+		points:   append([][]float64{}, points...),
+	}
+}
+
+// Insert adds x to the index and returns its index
+func (b *BruteForce) Insert(x []float64) int {
+	b.points = append(b.points, x)
+	if b.removed != nil {
+		b.removed = append(b.removed, false)
+	}
+
+	return len(b.points) - 1
+}
+
+// Remove removes the point with the given index, so
+// queries don't return it anymore
+func (b *BruteForce) Remove(i int) {
+	if i < 0 || i >= len(b.points) {
+		return
+	}
+
+	if b.removed == nil {
+		b.removed = make([]bool, len(b.points))
+	}
+	b.removed[i] = true
+}
+
+// isRemoved returns whether the point with the given
+// index was removed
+func (b *BruteForce) isRemoved(i int) bool {
+	return b.removed != nil && b.removed[i]
+}
+
+// KNearest returns the k points nearest to x
+func (b *BruteForce) KNearest(x []float64, k int) []Neighbor {
+	h := newNeighborHeap(k)
+	for i := range b.points {
+		if b.isRemoved(i) {
+			continue
+		}
+		h.offer(i, b.Distance(x, b.points[i]))
+	}
+
+	return h.sorted()
+}
+
+// Radius returns every point within distance r of x
+func (b *BruteForce) Radius(x []float64, r float64) []Neighbor {
+	var neighbors []Neighbor
+	for i := range b.points {
+		if b.isRemoved(i) {
+			continue
+		}
+
+		d := b.Distance(x, b.points[i])
+		if d <= r {
+			neighbors = append(neighbors, Neighbor{Index: i, Distance: d})
+		}
+	}
+
+	sortNeighbors(neighbors)
+	return neighbors
+}
+
+// Len returns the number of indexed points (removed
+// points included)
+func (b *BruteForce) Len() int {
+	return len(b.points)
+}
+
+// neighborHeap keeps the k nearest neighbors offered
+// to it in a max heap, so the furthest of them (the
+// one to drop next) is always on top
+type neighborHeap struct {
+	k         int
+	neighbors []Neighbor
+}
+
+// newNeighborHeap returns an empty heap keeping at
+// most k neighbors
+func newNeighborHeap(k int) *neighborHeap {
+	if k < 0 {
+		k = 0
+	}
+
+	return &neighborHeap{
+		k: k,
+	}
+}
+
+func (h *neighborHeap) Len() int { return len(h.neighbors) }
+func (h *neighborHeap) Less(i, j int) bool {
+	return further(h.neighbors[i], h.neighbors[j])
+}
+func (h *neighborHeap) Swap(i, j int) {
+	h.neighbors[i], h.neighbors[j] = h.neighbors[j], h.neighbors[i]
+}
+func (h *neighborHeap) Push(x interface{}) {
+	h.neighbors = append(h.neighbors, x.(Neighbor))
+}
+func (h *neighborHeap) Pop() interface{} {
+	last := h.neighbors[len(h.neighbors)-1]
+	h.neighbors = h.neighbors[:len(h.neighbors)-1]
+	return last
+}
+
+// offer adds the point to the heap if it's among the
+// k nearest seen so far
+func (h *neighborHeap) offer(index int, distance float64) {
+	n := Neighbor{Index: index, Distance: distance}
+	if len(h.neighbors) < h.k {
+		heap.Push(h, n)
+		return
+	}
+	if h.k == 0 || !further(h.neighbors[0], n) {
+		return
+	}
+
+	h.neighbors[0] = n
+	heap.Fix(h, 0)
+}
+
+// bound returns the distance a point must be within
+// to make it into the heap: the distance of the
+// furthest neighbor if the heap is full, and +Inf
+// otherwise
+func (h *neighborHeap) bound() float64 {
+	if h.k == 0 {
+		return math.Inf(-1)
+	}
+	if len(h.neighbors) < h.k {
+		return math.Inf(1)
+	}
+
+	return h.neighbors[0].Distance
+}
+
+// sorted returns the neighbors in the heap, nearest
+// first
+func (h *neighborHeap) sorted() []Neighbor {
+	neighbors := append([]Neighbor{}, h.neighbors...)
+	sortNeighbors(neighbors)
+
+	return neighbors
+}
+
+// further returns whether a is further from the query
+// point than b, breaking ties by index
+func further(a, b Neighbor) bool {
+	if a.Distance != b.Distance {
+		return a.Distance > b.Distance
+	}
+
+	return a.Index > b.Index
+}
+
+// sortNeighbors sorts neighbors nearest first, ties
+// going to the lowest index
+func sortNeighbors(neighbors []Neighbor) {
+	sort.Slice(neighbors, func(i, j int) bool {
+		return further(neighbors[j], neighbors[i])
+	})
+}
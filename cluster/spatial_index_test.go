@@ -0,0 +1,202 @@
+package cluster
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// randomPoints returns n points with the given number
+// of dimensions, drawn from a few gaussian blobs, with
+// some exact duplicates thrown in
+func randomPoints(r *rand.Rand, n, dimensions int) [][]float64 {
+	centers := make([][]float64, 4)
+	for c := range centers {
+		centers[c] = make([]float64, dimensions)
+		for j := range centers[c] {
+			centers[c][j] = r.Float64()*20 - 10
+		}
+	}
+
+	points := make([][]float64, n)
+	for i := range points {
+		if i > 0 && r.Intn(10) == 0 {
+			points[i] = append([]float64{}, points[r.Intn(i)]...)
+			continue
+		}
+
+		c := centers[r.Intn(len(centers))]
+		points[i] = make([]float64, dimensions)
+		for j := range points[i] {
+			points[i][j] = c[j] + r.NormFloat64()
+		}
+	}
+
+	return points
+}
+
+// assertSameQueries checks that index answers the
+// same k-nearest and radius queries as a brute force
+// search over points
+func assertSameQueries(t *testing.T, index SpatialIndex, points [][]float64, distance base.DistanceMeasure, r *rand.Rand, name string) {
+	brute := NewBruteForce(points, distance)
+	assert.Equal(t, len(points), index.Len(), "%v should index every point", name)
+
+	queries := randomPoints(r, 30, len(points[0]))
+	queries = append(queries, points[0], points[len(points)/2])
+
+	for _, q := range queries {
+		for _, k := range []int{1, 5, 20} {
+			expected := brute.KNearest(q, k)
+			neighbors := index.KNearest(q, k)
+			assert.Equal(t, expected, neighbors, "%v should find the same %v nearest neighbors as a brute force search", name, k)
+		}
+
+		nearest := brute.KNearest(q, 10)
+		radius := nearest[len(nearest)-1].Distance
+
+		expected := brute.Radius(q, radius)
+		neighbors := index.Radius(q, radius)
+		assert.Equal(t, expected, neighbors, "%v should find the same neighbors within %v as a brute force search", name, radius)
+		assert.True(t, len(neighbors) >= 10, "%v should find at least the 10 nearest neighbors within their radius", name)
+	}
+}
+
+func TestSpatialIndexShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(71))
+
+	distances := map[string]base.DistanceMeasure{
+		"Euclidean": base.EuclideanDistance,
+		"Manhattan": base.ManhattanDistance,
+		"Chebyshev": base.ChebyshevDistance,
+	}
+
+	for _, dimensions := range []int{1, 3, 8} {
+		points := randomPoints(r, 600, dimensions)
+
+		for name, distance := range distances {
+			for _, indexType := range []IndexType{BruteForceIndex, KDTreeIndex, BallTreeIndex, VPTreeIndex} {
+				index, err := NewIndex(indexType, points, distance)
+				assert.Nil(t, err, "Building the index should not return an error")
+
+				assertSameQueries(t, index, points, distance, r, string(indexType)+" ("+name+")")
+			}
+		}
+	}
+}
+
+func TestSpatialIndexShouldPass2(t *testing.T) {
+	points := [][]float64{{0}, {1}, {2}}
+
+	for _, indexType := range []IndexType{BruteForceIndex, KDTreeIndex, BallTreeIndex, VPTreeIndex} {
+		index, err := NewIndex(indexType, points, base.EuclideanDistance)
+		assert.Nil(t, err, "Building the index should not return an error")
+
+		assert.Len(t, index.KNearest([]float64{0}, 10), 3, "%v should return every point when k is larger than the set", indexType)
+		assert.Len(t, index.KNearest([]float64{0}, 0), 0, "%v should return no points when k is 0", indexType)
+		assert.Len(t, index.Radius([]float64{10}, 1), 0, "%v should return no points when none are within the radius", indexType)
+
+		// ties go to the lowest index
+		assert.Equal(t, []Neighbor{{Index: 0, Distance: 0.5}, {Index: 1, Distance: 0.5}}, index.KNearest([]float64{0.5}, 2), "%v should break ties by index", indexType)
+	}
+
+	for _, indexType := range []IndexType{BruteForceIndex, KDTreeIndex, BallTreeIndex, VPTreeIndex} {
+		index, err := NewIndex(indexType, nil, base.EuclideanDistance)
+		assert.Nil(t, err, "Building an empty index should not return an error")
+		assert.Len(t, index.KNearest([]float64{0}, 3), 0, "Empty %v should return no points", indexType)
+		assert.Len(t, index.Radius([]float64{0}, 3), 0, "Empty %v should return no points", indexType)
+	}
+}
+
+func TestSpatialIndexShouldFail1(t *testing.T) {
+	_, err := NewIndex("octree", [][]float64{{0}}, base.EuclideanDistance)
+	assert.NotNil(t, err, "Building an unknown index should return an error")
+
+	_, err = NewIndex(KDTreeIndex, [][]float64{{0}}, nil)
+	assert.NotNil(t, err, "Building an index without a distance should return an error")
+}
+
+func TestRemovableIndexShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(72))
+	points := randomPoints(r, 800, 8)
+
+	indexes := map[string]RemovableIndex{
+		"BruteForce": NewBruteForce(points, base.EuclideanDistance),
+		"HNSW":       NewHNSW(points, base.EuclideanDistance, HNSWParams{Seed: 3}),
+		"LSH":        NewLSH(points, base.EuclideanDistance, LSHParams{Tables: 20, Hashes: 3, Width: 8, Seed: 3}),
+	}
+
+	// the points left once every third one is removed
+	var kept [][]float64
+	var keptIndexes []int
+	for i := range points {
+		if i%3 != 0 {
+			kept = append(kept, points[i])
+			keptIndexes = append(keptIndexes, i)
+		}
+	}
+	queries := nearPoints(r, points, 50)
+
+	for name, index := range indexes {
+		for i := 0; i < len(points); i += 3 {
+			index.Remove(i)
+		}
+		index.Remove(0)
+		index.Remove(-1)
+		index.Remove(len(points))
+		assert.Equal(t, len(points), index.Len(), "%v should keep removed points in its length", name)
+
+		for _, q := range queries {
+			for _, n := range index.KNearest(q, 10) {
+				assert.NotEqual(t, 0, n.Index%3, "%v shouldn't find removed points", name)
+			}
+			for _, n := range index.Radius(q, 2) {
+				assert.NotEqual(t, 0, n.Index%3, "%v shouldn't find removed points", name)
+			}
+		}
+
+		// the points left are still found
+		var found, total int
+		brute := NewBruteForce(kept, base.EuclideanDistance)
+		for _, q := range queries {
+			neighbors := make(map[int]bool)
+			for _, n := range index.KNearest(q, 10) {
+				neighbors[n.Index] = true
+			}
+			for _, n := range brute.KNearest(q, 10) {
+				total++
+				if neighbors[keptIndexes[n.Index]] {
+					found++
+				}
+			}
+		}
+		assert.True(t, float64(found)/float64(total) > 0.9, "%v should find most of the points left", name)
+
+		// new points can be found after removing others
+		x := []float64{100, 100, 100, 100, 100, 100, 100, 100}
+		i := index.Insert(x)
+		assert.Equal(t, len(points), i, "%v should give inserted points the next index", name)
+		assert.Equal(t, i, index.KNearest(x, 1)[0].Index, "%v should find inserted points", name)
+		index.Remove(i)
+		for _, n := range index.KNearest(x, 3) {
+			assert.NotEqual(t, i, n.Index, "%v shouldn't find removed points", name)
+		}
+	}
+
+	// exact indexes find exactly the points left
+	index := NewBruteForce(points, base.EuclideanDistance)
+	for i := 0; i < len(points); i += 3 {
+		index.Remove(i)
+	}
+	brute := NewBruteForce(kept, base.EuclideanDistance)
+	for _, q := range queries {
+		expected := brute.KNearest(q, 10)
+		for i := range expected {
+			expected[i].Index = keptIndexes[expected[i].Index]
+		}
+		assert.Equal(t, expected, index.KNearest(q, 10), "BruteForce should find the same neighbors among the points left")
+	}
+}
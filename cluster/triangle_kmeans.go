@@ -1,13 +1,10 @@
 package cluster
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math/rand"
 	"os"
-	"time"
 
 	"github.com/admpub/goml/base"
 )
@@ -148,6 +145,12 @@ type TriangleKMeans struct {
 	centroidDist    [][]float64
 	minCentroidDist []float64
 
+	// rng is the model's source of randomness
+	// for instantiating centroids. It's seeded
+	// from the current time unless the model is
+	// given a seed with UpdateSeed.
+	rng *rand.Rand
+
 	// Output is the io.Writer to write logs
 	// and output from training to
 	Output io.Writer
@@ -200,7 +203,6 @@ func NewTriangleKMeans(k, maxIterations int, trainingSet [][]float64) *TriangleK
 		}
 	}
 
-	rand.Seed(time.Now().UTC().Unix())
 	centroids := make([][]float64, k)
 	centroidDist := make([][]float64, k)
 	minCentroidDist := make([]float64, k)
@@ -220,10 +222,23 @@ func NewTriangleKMeans(k, maxIterations int, trainingSet [][]float64) *TriangleK
 		centroidDist:    centroidDist,
 		minCentroidDist: minCentroidDist,
 
+		rng:    base.NewTimeSeededRandom(),
 		Output: os.Stdout,
 	}
 }
 
+// UpdateSeed seeds the model's source of randomness
+// so learning is reproducible
+func (k *TriangleKMeans) UpdateSeed(seed int64) {
+	k.rng = base.NewRandom(seed)
+}
+
+// UpdateRandom replaces the model's source of
+// randomness
+func (k *TriangleKMeans) UpdateRandom(r *rand.Rand) {
+	k.rng = r
+}
+
 // UpdateTrainingSet takes in a new training set (variable x.)
 //
 // Will reset the hidden 'guesses' param of the KMeans model.
@@ -359,7 +374,7 @@ func (k *TriangleKMeans) recalculateCentroids() [][]float64 {
 		// reinitialize it to a random vector
 		if classCount[j] == 0 {
 			for l := range centroids[j] {
-				centroids[j][l] = 10 * (rand.Float64() - 0.5)
+				centroids[j][l] = 10 * (k.rng.Float64() - 0.5)
 			}
 			continue
 		}
@@ -408,8 +423,10 @@ func (k *TriangleKMeans) Learn() error {
 
 	/* Step 0 */
 
-	// instantiate the centroids using k-means++
-	k.Centroids[0] = k.trainingSet[rand.Intn(len(k.trainingSet))]
+	// instantiate the centroids using k-means++. The
+	// centroids are copies of the examples so updating
+	// them doesn't change the training set
+	k.Centroids[0] = append([]float64{}, k.trainingSet[k.rng.Intn(len(k.trainingSet))]...)
 
 	distances := make([]float64, len(k.trainingSet))
 	for i := 1; i < len(k.Centroids); i++ {
@@ -427,12 +444,12 @@ func (k *TriangleKMeans) Learn() error {
 			sum += distances[j]
 		}
 
-		target := rand.Float64() * sum
+		target := k.rng.Float64() * sum
 		j := 0
 		for sum = distances[0]; sum < target; sum += distances[j] {
 			j++
 		}
-		k.Centroids[i] = k.trainingSet[j]
+		k.Centroids[i] = append([]float64{}, k.trainingSet[j]...)
 	}
 
 	/* Step 0.5 */
@@ -594,56 +611,131 @@ func (k *TriangleKMeans) SaveClusteredData(filepath string) error {
 	return base.SaveDataToCSV(filepath, k.trainingSet, floatGuesses, true)
 }
 
-// PersistToFile takes in an absolute filepath and saves the
-// centroid vector to the file, which can be restored later.
-// The function will take paths from the current directory, but
-// functions
-//
-// The data is stored as JSON because it's one of the most
-// efficient storage method (you only need one comma extra
-// per feature + two brackets, total!) And it's extendable.
-func (k *TriangleKMeans) PersistToFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+// triangleKMeansType is the name TriangleKMeans models are
+// registered and persisted under
+const triangleKMeansType = "cluster.TriangleKMeans"
+
+func init() {
+	base.RegisterModel(triangleKMeansType, func() base.Persistable {
+		return NewTriangleKMeans(0, 0, nil)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// hyperparameters, wrapped in a base.Envelope. The data
+// of the envelope is the centroid vector.
+func (k *TriangleKMeans) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(k.Centroids) != 0 {
+		features = len(k.Centroids[0])
+	}
+
+	env := &base.Envelope{
+		Type: triangleKMeansType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+		Metadata: base.TrainingMetadata{
+			Examples: len(k.trainingSet),
+		},
 	}
 
-	bytes, err := json.Marshal(k.Centroids)
+	err := env.Encode(kmeansHyperparameters{
+		MaxIterations: k.maxIterations,
+		Alpha:         k.alpha,
+	}, k.Centroids)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's centroids,
+// as well as the hyperparameters if they were saved,
+// from the given base.Envelope
+func (k *TriangleKMeans) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := kmeansHyperparameters{
+		MaxIterations: k.maxIterations,
+		Alpha:         k.alpha,
 	}
 
-	err = ioutil.WriteFile(path, bytes, os.ModePerm)
+	var centroids [][]float64
+	err := env.Decode(triangleKMeansType, &hyper, &centroids)
 	if err != nil {
 		return err
 	}
 
+	k.maxIterations = hyper.MaxIterations
+	k.alpha = hyper.Alpha
+	k.Centroids = centroids
+
+	// resize the auxillary structures in case the
+	// restored model has a different number of
+	// centroids than this one was created with
+	if len(k.centroidDist) != len(centroids) {
+		k.centroidDist = make([][]float64, len(centroids))
+		for i := range k.centroidDist {
+			k.centroidDist[i] = make([]float64, len(centroids))
+		}
+		k.minCentroidDist = make([]float64, len(centroids))
+
+		for i := range k.info {
+			k.info[i].lower = make([]float64, len(centroids))
+		}
+	}
+
 	return nil
 }
 
-// RestoreFromFile takes in a path to a centroid vector
-// and assigns the model it's operating on's parameter vector
-// to that.
+// PersistToFile takes in an absolute filepath and saves the
+// centroid vector to the file, which can be restored later.
+// The function will take paths from the current directory, but
+// functions
+//
+// The model is stored as a JSON base.Envelope holding the
+// centroids as well as the hyperparameters of the model.
+func (k *TriangleKMeans) PersistToFile(path string) error {
+	return base.PersistModel(path, k)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and assigns the model it's operating on's centroids
+// and hyperparameters to those persisted.
 //
 // The path must ba an absolute path or a path from the current
 // directory
 //
+// Files holding only the centroids (as persisted by older
+// versions of goml) can also be restored.
+//
 // This would be useful in persisting data between running
 // a model on data, or for graphing a dataset with a fit in
 // another framework like Julia/Gadfly.
 func (k *TriangleKMeans) RestoreFromFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
-	}
+	return base.RestoreModel(path, k)
+}
 
-	bytes, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
-	}
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (k *TriangleKMeans) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, k)
+}
 
-	err = json.Unmarshal(bytes, &k.Centroids)
-	if err != nil {
-		return err
-	}
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (k *TriangleKMeans) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, k)
+}
 
-	return nil
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (k *TriangleKMeans) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(k)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (k *TriangleKMeans) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, k)
 }
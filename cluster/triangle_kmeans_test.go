@@ -489,3 +489,36 @@ func TestTriangleKMeansPersistToFileShouldPass1(t *testing.T) {
 	// save results to disk
 	assert.Nil(t, model.SaveClusteredData("/tmp/.goml/TriangleKMeansResults.csv"), "Save results error should be nil")
 }
+
+func TestTriangleKMeansMarshalBinaryShouldPass1(t *testing.T) {
+	model := NewTriangleKMeans(2, 15, double)
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	data, err := model.MarshalBinary()
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	restored := NewTriangleKMeans(3, 0, nil)
+	assert.Nil(t, restored.UnmarshalBinary(data), "Unmarshal error should be nil")
+	assert.Equal(t, model.Centroids, restored.Centroids, "Centroids should be restored")
+	assert.Equal(t, 15, restored.maxIterations, "Max iterations should be restored")
+	assert.Len(t, restored.centroidDist, 2, "Centroid distance matrix should be resized")
+
+	c1, err := model.Predict([]float64{-7.5, 0})
+	assert.Nil(t, err, "Prediction error should be nil")
+	c2, err := restored.Predict([]float64{-7.5, 0})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, c1, c2, "Restored model should predict like the original")
+}
+
+func TestTriangleKMeansSeedShouldPass1(t *testing.T) {
+	var _ base.Randomized = NewTriangleKMeans(4, 2, nil)
+
+	models := make([]*TriangleKMeans, 2)
+	for i := range models {
+		models[i] = NewTriangleKMeans(4, 5, copyPoints(circles))
+		models[i].UpdateSeed(42)
+		assert.Nil(t, models[i].Learn(), "Learning error should be nil")
+	}
+	assert.Equal(t, models[0].Centroids, models[1].Centroids, "Models with the same seed should find the same clusters")
+	assert.Equal(t, models[0].Guesses(), models[1].Guesses(), "Models with the same seed should find the same clusters")
+}
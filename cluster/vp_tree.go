@@ -0,0 +1,288 @@
+package cluster
+
+import (
+	"math"
+	"sort"
+
+	"github.com/admpub/goml/base"
+)
+
+// VPTree (vantage-point tree) is a SpatialIndex which
+// only ever computes distances between points, so it
+// works with any metric (any distance following the
+// triangle inequality,) even over data where means
+// make no sense. Every node picks a vantage point and
+// splits the other points by whether they're within
+// the median distance μ from it. By the triangle
+// inequality, a query point at distance d from the
+// vantage point can only have neighbors within τ inside
+// if d - τ <= μ, and outside if d + τ >= μ.
+//
+// https://en.wikipedia.org/wiki/Vantage-point_tree
+type VPTree struct {
+	Distance base.DistanceMeasure
+
+	points [][]float64
+	root   *vpNode
+
+	// nodes is the number of nodes of the tree
+	nodes int
+}
+
+// vpNode is a node of a VPTree. Leaves hold the indices
+// of their points, while inner nodes hold their vantage
+// point, with points at most threshold from it inside
+// and points at least threshold from it outside. Nodes
+// are numbered by id, in the order they're built.
+type vpNode struct {
+	id int
+
+	vantage   int
+	threshold float64
+
+	inside  *vpNode
+	outside *vpNode
+
+	indices []int
+}
+
+// NewVPTree builds a VPTree over the given points,
+// splitting nodes until they hold at most leafSize
+// points (DefaultLeafSize if leafSize < 1)
+func NewVPTree(points [][]float64, distance base.DistanceMeasure, leafSize int) *VPTree {
+	if leafSize < 1 {
+		leafSize = DefaultLeafSize
+	}
+
+	indices := make([]int, len(points))
+	for i := range indices {
+		indices[i] = i
+	}
+
+	tree := &VPTree{
+		Distance: distance,
+		points:   points,
+	}
+	if len(points) != 0 {
+		tree.root = tree.build(indices, leafSize)
+	}
+
+	return tree
+}
+
+// build returns the subtree holding the given points
+func (t *VPTree) build(indices []int, leafSize int) *vpNode {
+	id := t.nodes
+	t.nodes++
+
+	if len(indices) <= leafSize {
+		return &vpNode{id: id, indices: indices}
+	}
+
+	// use the point furthest from the first point as
+	// the vantage point: points near the edge of the
+	// data split it better than points in the middle
+	vantage := indices[0]
+	var furthestDistance float64
+	for _, i := range indices[1:] {
+		d := t.Distance(t.points[indices[0]], t.points[i])
+		if d > furthestDistance {
+			furthestDistance = d
+			vantage = i
+		}
+	}
+
+	rest := make([]Neighbor, 0, len(indices)-1)
+	for _, i := range indices {
+		if i != vantage {
+			rest = append(rest, Neighbor{Index: i, Distance: t.Distance(t.points[vantage], t.points[i])})
+		}
+	}
+	sort.Slice(rest, func(a, b int) bool {
+		return rest[a].Distance < rest[b].Distance
+	})
+
+	// split at the median, points at the median
+	// distance going either way so the split stays
+	// balanced when many distances are equal
+	median := len(rest) / 2
+	threshold := rest[median].Distance
+
+	inside := make([]int, 0, median)
+	outside := make([]int, 0, len(rest)-median)
+	for s, n := range rest {
+		if s < median {
+			inside = append(inside, n.Index)
+		} else {
+			outside = append(outside, n.Index)
+		}
+	}
+
+	node := &vpNode{
+		id:        id,
+		vantage:   vantage,
+		threshold: threshold,
+	}
+	if len(inside) != 0 {
+		node.inside = t.build(inside, leafSize)
+	}
+	if len(outside) != 0 {
+		node.outside = t.build(outside, leafSize)
+	}
+
+	return node
+}
+
+// KNearest returns the k points nearest to x
+func (t *VPTree) KNearest(x []float64, k int) []Neighbor {
+	h := newNeighborHeap(k)
+	if t.root != nil && k > 0 {
+		t.kNearest(t.root, x, h)
+	}
+
+	return h.sorted()
+}
+
+func (t *VPTree) kNearest(node *vpNode, x []float64, h *neighborHeap) {
+	if node == nil {
+		return
+	}
+
+	if node.indices != nil {
+		for _, i := range node.indices {
+			h.offer(i, t.Distance(x, t.points[i]))
+		}
+		return
+	}
+
+	d := t.Distance(x, t.points[node.vantage])
+	h.offer(node.vantage, d)
+
+	// search the side x is on first, then the other
+	// side if it could still hold a neighbor
+	if d <= node.threshold {
+		t.kNearest(node.inside, x, h)
+		if d+h.bound() >= node.threshold {
+			t.kNearest(node.outside, x, h)
+		}
+	} else {
+		t.kNearest(node.outside, x, h)
+		if d-h.bound() <= node.threshold {
+			t.kNearest(node.inside, x, h)
+		}
+	}
+}
+
+// Radius returns every point within distance r of x
+func (t *VPTree) Radius(x []float64, r float64) []Neighbor {
+	var neighbors []Neighbor
+	if t.root != nil {
+		neighbors = t.radius(t.root, x, r, neighbors)
+	}
+
+	sortNeighbors(neighbors)
+	return neighbors
+}
+
+func (t *VPTree) radius(node *vpNode, x []float64, r float64, neighbors []Neighbor) []Neighbor {
+	if node == nil {
+		return neighbors
+	}
+
+	if node.indices != nil {
+		for _, i := range node.indices {
+			d := t.Distance(x, t.points[i])
+			if d <= r {
+				neighbors = append(neighbors, Neighbor{Index: i, Distance: d})
+			}
+		}
+		return neighbors
+	}
+
+	d := t.Distance(x, t.points[node.vantage])
+	if d <= r {
+		neighbors = append(neighbors, Neighbor{Index: node.vantage, Distance: d})
+	}
+
+	if d-r <= node.threshold {
+		neighbors = t.radius(node.inside, x, r, neighbors)
+	}
+	if d+r >= node.threshold {
+		neighbors = t.radius(node.outside, x, r, neighbors)
+	}
+
+	return neighbors
+}
+
+// Len returns the number of indexed points
+func (t *VPTree) Len() int {
+	return len(t.points)
+}
+
+// labelNodes labels every node of the tree for the
+// searches of Borůvka's algorithm (see componentIndex)
+func (t *VPTree) labelNodes(s *componentSearch) {
+	s.resizeNodes(t.nodes)
+	if t.root != nil {
+		t.label(t.root, s)
+	}
+}
+
+func (t *VPTree) label(node *vpNode, s *componentSearch) {
+	s.startNode(node.id)
+	if node.indices != nil {
+		for _, i := range node.indices {
+			s.addPoint(node.id, i)
+		}
+		return
+	}
+
+	s.addPoint(node.id, node.vantage)
+	for _, child := range []*vpNode{node.inside, node.outside} {
+		if child != nil {
+			t.label(child, s)
+			s.addChild(node.id, child.id)
+		}
+	}
+}
+
+// nearestOutside searches for the lightest edge from x
+// out of its component (see componentIndex)
+func (t *VPTree) nearestOutside(x []float64, s *componentSearch) {
+	if t.root != nil {
+		t.outside(t.root, x, 0, s)
+	}
+}
+
+// outside searches the subtree at node, given the
+// smallest distance its points could be from x
+func (t *VPTree) outside(node *vpNode, x []float64, lowerBound float64, s *componentSearch) {
+	if node == nil || s.prune(node.id, lowerBound) {
+		return
+	}
+
+	if node.indices != nil {
+		for _, i := range node.indices {
+			if s.candidate(i) {
+				s.offer(i, t.Distance(x, t.points[i]))
+			}
+		}
+		return
+	}
+
+	d := t.Distance(x, t.points[node.vantage])
+	s.offer(node.vantage, d)
+
+	// points inside are at least d - threshold from
+	// x, and points outside at least threshold - d,
+	// so search the side x is on first
+	inside := math.Max(lowerBound, d-node.threshold)
+	outside := math.Max(lowerBound, node.threshold-d)
+	if d <= node.threshold {
+		t.outside(node.inside, x, inside, s)
+		t.outside(node.outside, x, outside, s)
+	} else {
+		t.outside(node.outside, x, outside, s)
+		t.outside(node.inside, x, inside, s)
+	}
+}
@@ -0,0 +1,40 @@
+package cluster
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVPTreeShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(89))
+	points := randomPoints(r, 1000, 6)
+
+	for _, leafSize := range []int{0, 1, 5, 50} {
+		tree := NewVPTree(points, base.EuclideanDistance, leafSize)
+		assertSameQueries(t, tree, points, base.EuclideanDistance, r, "VP-tree")
+	}
+}
+
+func TestVPTreeShouldPass2(t *testing.T) {
+	// the VP-tree only needs a metric, so it works
+	// over binary vectors with the Hamming distance
+	r := rand.New(rand.NewSource(97))
+
+	points := make([][]float64, 500)
+	for i := range points {
+		points[i] = make([]float64, 16)
+		for j := range points[i] {
+			points[i][j] = float64(r.Intn(2))
+		}
+	}
+
+	tree := NewVPTree(points, base.HammingDistance, 8)
+	assertSameQueries(t, tree, points, base.HammingDistance, r, "VP-tree (Hamming)")
+
+	neighbors := tree.KNearest(points[42], 1)
+	assert.Equal(t, 0.0, neighbors[0].Distance, "A point should be its own nearest neighbor")
+}
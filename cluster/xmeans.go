@@ -0,0 +1,501 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+
+	"github.com/admpub/goml/base"
+)
+
+/*
+XMeans implements the X-means clustering algorithm,
+which finds the number of clusters along with the
+clusters themselves. Starting from K-Means with minK
+clusters, every cluster is split in two (with 2-means
+run on its examples) whenever the split improves the
+Bayesian Information Criterion (BIC) of the cluster,
+until no split helps or there are maxK clusters.
+After every round of splits, K-Means runs on the whole
+training set from the centroids found so far.
+
+The BIC scores how likely the examples are if every
+cluster is a spherical Gaussian (sharing one variance,)
+penalized by the number of parameters of the model,
+so a cluster is only split if the two halves describe
+it much better than one. Every split is judged on its
+own, so clusters laid out symmetrically (like blobs on
+the corners of a square) may never be found starting
+from a single cluster, as no split of the square into
+two halves is better than the whole. Start from a
+larger minK for such data.
+
+Paper: http://www.cs.cmu.edu/~dpelleg/download/xmeans.pdf
+
+Example X-Means Model Usage:
+
+	model := NewXMeans(1, 20, 25, data)
+	model.UpdateSeed(42)
+
+	if model.Learn() != nil {
+		panic("Oh NO!!! There was an error learning!!")
+	}
+
+	// the number of clusters found
+	k := len(model.Centroids)
+
+	guess, err := model.Predict([]float64{-3, 6})
+	if err != nil {
+		panic("prediction error")
+	}
+*/
+type XMeans struct {
+	// minK and maxK bound the number of
+	// clusters, and maxIterations caps every
+	// run of K-Means
+	minK, maxK    int
+	maxIterations int
+
+	// trainingSet and guesses are the
+	// 'x', and 'y' of the data. The guesses
+	// are set while learning.
+	trainingSet [][]float64
+	guesses     []int
+
+	Centroids [][]float64 `json:"centroids"`
+
+	// rng is the model's source of randomness
+	// for instantiating centroids. It's seeded
+	// from the current time unless the model is
+	// given a seed with UpdateSeed.
+	rng *rand.Rand
+
+	// Output is the io.Writer to write
+	// logging to. Defaults to os.Stdout
+	// but can be changed to any io.Writer
+	Output io.Writer
+}
+
+// NewXMeans returns a pointer to an X-means model
+// finding between minK and maxK clusters (both
+// included) in the training set, running K-Means for
+// at most maxIterations iterations at a time
+func NewXMeans(minK, maxK, maxIterations int, trainingSet [][]float64) *XMeans {
+	return &XMeans{
+		minK:          minK,
+		maxK:          maxK,
+		maxIterations: maxIterations,
+
+		trainingSet: trainingSet,
+		guesses:     make([]int, len(trainingSet)),
+
+		rng:    base.NewTimeSeededRandom(),
+		Output: os.Stdout,
+	}
+}
+
+// UpdateTrainingSet takes in a new training set (variable x.)
+//
+// Will reset the hidden 'guesses' param of the model.
+func (k *XMeans) UpdateTrainingSet(trainingSet [][]float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("ERROR: length of given training set is 0! Need data!")
+	}
+
+	k.trainingSet = trainingSet
+	k.guesses = make([]int, len(trainingSet))
+
+	return nil
+}
+
+// UpdateSeed seeds the model's source of randomness
+// so learning is reproducible
+func (k *XMeans) UpdateSeed(seed int64) {
+	k.rng = base.NewRandom(seed)
+}
+
+// UpdateRandom replaces the model's source of
+// randomness
+func (k *XMeans) UpdateRandom(r *rand.Rand) {
+	k.rng = r
+}
+
+// Examples returns the number of training examples (m)
+// that the model currently is training from.
+func (k *XMeans) Examples() int {
+	return len(k.trainingSet)
+}
+
+// MaxIterations returns the maximum number of iterations
+// of every run of K-Means
+func (k *XMeans) MaxIterations() int {
+	return k.maxIterations
+}
+
+// validate checks the bounds on the number of
+// clusters and the training set
+func (k *XMeans) validate() error {
+	if k.minK < 1 || k.maxK < k.minK {
+		return fmt.Errorf("ERROR: k must range from at least 1 up - given %v to %v", k.minK, k.maxK)
+	}
+
+	if len(k.trainingSet) == 0 || len(k.trainingSet[0]) == 0 {
+		return fmt.Errorf("ERROR: Attempting to learn with no training examples!")
+	}
+
+	if k.minK > len(k.trainingSet) {
+		return fmt.Errorf("ERROR: minimum k (%v) is more than the number of training examples (%v)", k.minK, len(k.trainingSet))
+	}
+
+	for i := range k.trainingSet {
+		if len(k.trainingSet[i]) != len(k.trainingSet[0]) {
+			return fmt.Errorf("ERROR: training example %v has %v features - expected %v", i, len(k.trainingSet[i]), len(k.trainingSet[0]))
+		}
+	}
+
+	return nil
+}
+
+// lloyd runs K-Means (Lloyd's algorithm) on the points
+// from the given centroids, which are updated in place,
+// until no point changes cluster or for maxIterations
+// iterations. Centroids without points stay where they
+// are. The guesses of every point are returned.
+func lloyd(points [][]float64, centroids [][]float64, maxIterations int) []int {
+	guesses := make([]int, len(points))
+	for i, x := range points {
+		guesses[i], _ = nearest(x, centroids)
+	}
+
+	for iter := 0; iter < maxIterations; iter++ {
+		means, counts := centers(points, guesses, len(centroids))
+		for c := range centroids {
+			if counts[c] > 0 {
+				centroids[c] = means[c]
+			}
+		}
+
+		changed := false
+		for i, x := range points {
+			c, _ := nearest(x, centroids)
+			if c != guesses[i] {
+				guesses[i] = c
+				changed = true
+			}
+		}
+
+		if !changed {
+			break
+		}
+	}
+
+	return guesses
+}
+
+// bic returns the Bayesian Information Criterion of
+// the clustering of the points, modelling every cluster
+// as a spherical Gaussian with the same variance (the
+// maximum likelihood estimate, corrected for the number
+// of centroids.) Higher is better. The BIC is -Inf if
+// there are no more points than centroids, and +Inf if
+// every point is on its centroid.
+func bic(points [][]float64, centroids [][]float64, guesses []int) float64 {
+	r := float64(len(points))
+	k := float64(len(centroids))
+	m := float64(len(points[0]))
+	if r <= k {
+		return math.Inf(-1)
+	}
+
+	counts := make([]float64, len(centroids))
+	var distortion float64
+	for i, x := range points {
+		counts[guesses[i]]++
+		distortion += diff(x, centroids[guesses[i]])
+	}
+	if distortion == 0 {
+		return math.Inf(1)
+	}
+
+	variance := distortion / (m * (r - k))
+
+	likelihood := -r*m/2*math.Log(2*math.Pi*variance) - m*(r-k)/2
+	for _, count := range counts {
+		if count > 0 {
+			likelihood += count * math.Log(count/r)
+		}
+	}
+
+	parameters := (k - 1) + k*m + 1
+
+	return likelihood - parameters/2*math.Log(r)
+}
+
+// split runs 2-means on the points of a cluster and
+// returns the two centroids found, along with how much
+// they improve the BIC of the cluster (which isn't
+// positive if the cluster shouldn't be split)
+func (k *XMeans) split(points [][]float64, centroid []float64) ([][]float64, float64) {
+	if len(points) < 3 {
+		return nil, math.Inf(-1)
+	}
+
+	parent := bic(points, [][]float64{centroid}, make([]int, len(points)))
+
+	weights := make([]float64, len(points))
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	children := seedPlusPlus(points, weights, 2, k.rng)
+	guesses := lloyd(points, children, k.maxIterations)
+
+	return children, bic(points, children, guesses) - parent
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns the number of the cluster nearest to it
+//
+// if normalize is given as true, then the input will
+// first be normalized to unit length. Only use this if
+// you trained off of normalized inputs and are feeding
+// an un-normalized input
+func (k *XMeans) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if len(k.Centroids) == 0 {
+		return nil, fmt.Errorf("ERROR: the model has no centroids! Learn before predicting")
+	}
+
+	if len(x) != len(k.Centroids[0]) {
+		return nil, fmt.Errorf("ERROR: Centroid vector should be the same length as input vector!\n\tLength of x given: %v\n\tLength of centroid: %v\n", len(x), len(k.Centroids[0]))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	c, _ := nearest(x, k.Centroids)
+
+	return []float64{float64(c)}, nil
+}
+
+// Learn clusters the training set, finding the number
+// of clusters by splitting clusters while the splits
+// improve the BIC
+func (k *XMeans) Learn() error {
+	err := k.validate()
+	if err != nil {
+		fmt.Fprintf(k.Output, err.Error()+"\n")
+		return err
+	}
+
+	examples := len(k.trainingSet)
+	features := len(k.trainingSet[0])
+
+	fmt.Fprintf(k.Output, "Training:\n\tModel: X-Means Classification\n\tTraining Examples: %v\n\tFeatures: %v\n\tClasses: %v to %v\n...\n\n", examples, features, k.minK, k.maxK)
+
+	weights := make([]float64, examples)
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	k.Centroids = seedPlusPlus(k.trainingSet, weights, k.minK, k.rng)
+	k.guesses = lloyd(k.trainingSet, k.Centroids, k.maxIterations)
+
+	rounds := 0
+	for len(k.Centroids) < k.maxK {
+		members := make([][][]float64, len(k.Centroids))
+		for i, x := range k.trainingSet {
+			members[k.guesses[i]] = append(members[k.guesses[i]], x)
+		}
+
+		type candidate struct {
+			cluster     int
+			children    [][]float64
+			improvement float64
+		}
+
+		var splits []candidate
+		for c := range k.Centroids {
+			children, improvement := k.split(members[c], k.Centroids[c])
+			if improvement > 0 {
+				splits = append(splits, candidate{c, children, improvement})
+			}
+		}
+
+		if len(splits) == 0 {
+			break
+		}
+
+		// with more splits than room for clusters,
+		// the splits improving the BIC most win
+		sort.SliceStable(splits, func(i, j int) bool {
+			return splits[i].improvement > splits[j].improvement
+		})
+		if room := k.maxK - len(k.Centroids); len(splits) > room {
+			splits = splits[:room]
+		}
+
+		for _, s := range splits {
+			k.Centroids[s.cluster] = s.children[0]
+			k.Centroids = append(k.Centroids, s.children[1])
+		}
+
+		k.guesses = lloyd(k.trainingSet, k.Centroids, k.maxIterations)
+		rounds++
+	}
+
+	fmt.Fprintf(k.Output, "Training Completed in %v rounds of splits.\n%v\n", rounds, k)
+
+	return nil
+}
+
+// String implements the fmt interface for clean printing. Here
+// we're using it to print the model as the equation h(θ)=...
+// where h is the k-means hypothesis model
+func (k *XMeans) String() string {
+	return fmt.Sprintf("h(θ,x) = argmin_j | x[i] - μ[j] |^2\n\tμ ∊ θ, j = 0,...,%v", len(k.Centroids)-1)
+}
+
+// Guesses returns the hidden parameter for the
+// unsupervised classification assigned during
+// learning.
+//
+//    model.Guesses[i] = E[k.trainingSet[i]]
+func (k *XMeans) Guesses() []int {
+	return k.guesses
+}
+
+// Distortion returns the distortion of the clustering
+// currently given by the k-means model. This is the
+// function the learning algorithm tries to minimize.
+//
+// Distortion() = Σ |x[i] - μ[c[i]]|^2
+// over all training examples
+func (k *XMeans) Distortion() float64 {
+	var sum float64
+	for i := range k.trainingSet {
+		sum += diff(k.trainingSet[i], k.Centroids[k.guesses[i]])
+	}
+
+	return sum
+}
+
+// BIC returns the Bayesian Information Criterion of the
+// clustering of the training set found while learning
+func (k *XMeans) BIC() float64 {
+	return bic(k.trainingSet, k.Centroids, k.guesses)
+}
+
+// xmeansHyperparameters holds the hyperparameters
+// of XMeans models as saved in their envelopes
+type xmeansHyperparameters struct {
+	MinK          int `json:"min_k"`
+	MaxK          int `json:"max_k"`
+	MaxIterations int `json:"max_iterations"`
+}
+
+// xmeansType is the name XMeans models are
+// registered and persisted under
+const xmeansType = "cluster.XMeans"
+
+func init() {
+	base.RegisterModel(xmeansType, func() base.Persistable {
+		return NewXMeans(0, 0, 0, nil)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// hyperparameters, wrapped in a base.Envelope. The data
+// of the envelope is the centroid vector.
+func (k *XMeans) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(k.Centroids) != 0 {
+		features = len(k.Centroids[0])
+	}
+
+	env := &base.Envelope{
+		Type: xmeansType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+		Metadata: base.TrainingMetadata{
+			Examples: len(k.trainingSet),
+		},
+	}
+
+	err := env.Encode(xmeansHyperparameters{
+		MinK:          k.minK,
+		MaxK:          k.maxK,
+		MaxIterations: k.maxIterations,
+	}, k.Centroids)
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's centroids and
+// hyperparameters from the given base.Envelope
+func (k *XMeans) UnmarshalEnvelope(env *base.Envelope) error {
+	var hyper xmeansHyperparameters
+	var centroids [][]float64
+	err := env.Decode(xmeansType, &hyper, &centroids)
+	if err != nil {
+		return err
+	}
+
+	for i := range centroids {
+		if len(centroids[i]) != len(centroids[0]) {
+			return fmt.Errorf("ERROR: centroid %v has %v features - expected %v", i, len(centroids[i]), len(centroids[0]))
+		}
+	}
+
+	k.minK = hyper.MinK
+	k.maxK = hyper.MaxK
+	k.maxIterations = hyper.MaxIterations
+	k.Centroids = centroids
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// centroids and hyperparameters of the model to the file,
+// which can be restored later
+func (k *XMeans) PersistToFile(path string) error {
+	return base.PersistModel(path, k)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and assigns the model it's operating on's centroids
+// and hyperparameters to those persisted
+func (k *XMeans) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, k)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (k *XMeans) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, k)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (k *XMeans) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, k)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (k *XMeans) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(k)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (k *XMeans) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, k)
+}
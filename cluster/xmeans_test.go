@@ -0,0 +1,157 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXMeansShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(31))
+	points, labels := blobs(r, 800)
+
+	for _, minK := range []int{2, 3} {
+		model := NewXMeans(minK, 20, 30, points)
+		model.Output = ioutil.Discard
+		model.UpdateSeed(42)
+
+		err := model.Learn()
+		assert.Nil(t, err, "Learning error should be nil")
+		assert.Len(t, model.Centroids, 4, "X-means should find the 4 blobs starting from %v clusters", minK)
+		assertSameClustering(t, labels, model.Guesses())
+
+		for i, x := range points {
+			guess, err := model.Predict(x)
+			assert.Nil(t, err, "Prediction error should be nil")
+			assert.Equal(t, float64(model.Guesses()[i]), guess[0], "Guesses should match predictions")
+		}
+
+		assert.True(t, model.Distortion()/float64(len(points)) < 2*2*20*20, "X-means should find the centers of the blobs")
+	}
+
+	// splitting a blob shouldn't improve the BIC
+	split := NewKMeans(5, 30, copyPoints(points))
+	split.Output = ioutil.Discard
+	split.UpdateSeed(1)
+	assert.Nil(t, split.Learn(), "Learning error should be nil")
+
+	model := NewXMeans(2, 20, 30, points)
+	model.Output = ioutil.Discard
+	model.UpdateSeed(42)
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	guesses := make([]int, len(points))
+	for i, x := range points {
+		guesses[i], _ = nearest(x, split.Centroids)
+	}
+	assert.True(t, model.BIC() > bic(points, split.Centroids, guesses), "4 clusters should have a better BIC than 5")
+}
+
+func TestXMeansShouldPass2(t *testing.T) {
+	r := rand.New(rand.NewSource(32))
+	points, _ := blobs(r, 400)
+
+	// maxK caps the number of clusters
+	model := NewXMeans(2, 3, 30, points)
+	model.Output = ioutil.Discard
+	model.UpdateSeed(42)
+
+	err := model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.Len(t, model.Centroids, 3, "X-means shouldn't find more than maxK clusters")
+
+	// one gaussian shouldn't be split at all
+	gaussian := make([][]float64, 500)
+	for i := range gaussian {
+		gaussian[i] = []float64{r.NormFloat64(), r.NormFloat64()}
+	}
+
+	model = NewXMeans(1, 10, 30, gaussian)
+	model.Output = ioutil.Discard
+	model.UpdateSeed(42)
+
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.Len(t, model.Centroids, 1, "X-means shouldn't split a single gaussian")
+}
+
+func TestXMeansShouldFail1(t *testing.T) {
+	points := [][]float64{{0}, {1}, {4}, {5}}
+
+	invalid := []*XMeans{
+		NewXMeans(0, 2, 10, points),
+		NewXMeans(3, 2, 10, points),
+		NewXMeans(5, 6, 10, points),
+		NewXMeans(1, 2, 10, nil),
+		NewXMeans(1, 2, 10, [][]float64{{0}, {1, 2}, {4}, {5}}),
+	}
+
+	for i, model := range invalid {
+		model.Output = ioutil.Discard
+		assert.NotNil(t, model.Learn(), "Learning with invalid model %v should return an error", i)
+	}
+
+	_, err := NewXMeans(1, 2, 10, points).Predict([]float64{1})
+	assert.NotNil(t, err, "Predicting without centroids should return an error")
+}
+
+func TestPersistXMeansShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(33))
+	points, _ := blobs(r, 400)
+
+	model := NewXMeans(2, 10, 30, points)
+	model.Output = ioutil.Discard
+	model.UpdateSeed(42)
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	err := model.PersistToFile("/tmp/.goml/XMeans.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/XMeans.json")
+	assert.Nil(t, err, "Loading the model should not return an error")
+
+	restored, ok := loaded.(*XMeans)
+	assert.True(t, ok, "The loaded model should be an XMeans model")
+	assert.Equal(t, model.Centroids, restored.Centroids, "The restored model should keep its centroids")
+	assert.Equal(t, 30, restored.MaxIterations(), "The restored model should keep its hyperparameters")
+
+	for _, x := range points {
+		g1, _ := model.Predict(x)
+		g2, err := restored.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, g1, g2, "The restored model should predict like the original")
+	}
+
+	env := &base.Envelope{Type: xmeansType}
+	err = env.Encode(xmeansHyperparameters{MinK: 1, MaxK: 2}, [][]float64{{1, 2}, {3}})
+	assert.Nil(t, err, "Encoding the envelope should not return an error")
+	assert.NotNil(t, restored.UnmarshalEnvelope(env), "Restoring ragged centroids should return an error")
+}
+
+func TestXMeansShouldPass3(t *testing.T) {
+	r := rand.New(rand.NewSource(34))
+
+	// blobs in a row can be found starting from
+	// one cluster, as the first split separates
+	// them into two groups of blobs
+	var points [][]float64
+	var labels []int
+	for i := 0; i < 600; i++ {
+		c := r.Intn(3)
+		points = append(points, []float64{float64(c)*200 + r.NormFloat64()*5, r.NormFloat64() * 5})
+		labels = append(labels, c)
+	}
+
+	model := NewXMeans(1, 10, 30, points)
+	model.Output = ioutil.Discard
+	model.UpdateSeed(42)
+
+	err := model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.Len(t, model.Centroids, 3, "X-means should find the 3 blobs starting from one cluster")
+	assertSameClustering(t, labels, model.Guesses())
+}
@@ -0,0 +1,192 @@
+// Package export translates trained goml models to and
+// from formats understood by other machine learning
+// tooling, so a model trained with goml can be served
+// by (for example) a JVM PMML evaluator or an ONNX
+// runtime, and models trained elsewhere can be used
+// within goml.
+//
+// The supported models are linear.LeastSquares,
+// linear.Logistic, linear.Softmax, cluster.KMeans and
+// perceptron.Perceptron. Exporters work off of a model's
+// base.Envelope, and importers return a base.Persistable
+// just like base.Load does, so the package holding the
+// model has to be imported for importing to work:
+//
+//     import (
+//         "github.com/admpub/goml/export"
+//         "github.com/admpub/goml/linear"
+//     )
+//
+//     // write the model as PMML
+//     err := export.WritePMML(file, model)
+//
+//     // and read it back
+//     imported, err := export.ReadPMML(file)
+//     logistic := imported.(*linear.Logistic)
+//
+// Both formats record the goml model type and the
+// model's hyperparameters (as extensions/metadata) so
+// models exported by goml round-trip completely. Files
+// written by other tools are imported as long as they
+// use the same structure the exporters write.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/admpub/goml/base"
+)
+
+// Names of the model types which can be exported.
+// These match the names the models are registered
+// under with base.RegisterModel.
+const (
+	LeastSquaresType = "linear.LeastSquares"
+	LogisticType     = "linear.Logistic"
+	SoftmaxType      = "linear.Softmax"
+	KMeansType       = "cluster.KMeans"
+	PerceptronType   = "perceptron.Perceptron"
+)
+
+// model is the format independent description of
+// an exportable model
+type model struct {
+	Type            string
+	Hyperparameters json.RawMessage
+
+	// Names holds the name of every input feature
+	Names []string
+
+	// Rows holds one parameter vector per output of
+	// the model, with the constant term first (as in
+	// θ) for linear models, and the centroids for
+	// KMeans models
+	Rows [][]float64
+}
+
+// fromModel returns the description of the given
+// goml model
+func fromModel(p base.Persistable) (*model, error) {
+	env, err := p.MarshalEnvelope()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &model{
+		Type:            env.Type,
+		Hyperparameters: env.Hyperparameters,
+	}
+
+	switch env.Type {
+	case LeastSquaresType, LogisticType, PerceptronType:
+		var theta []float64
+		err = json.Unmarshal(env.Data, &theta)
+		m.Rows = [][]float64{theta}
+
+	case SoftmaxType, KMeansType:
+		err = json.Unmarshal(env.Data, &m.Rows)
+
+	default:
+		return nil, fmt.Errorf("ERROR: %v models can't be exported", env.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	m.Names = env.Schema.Names
+	if len(m.Names) != m.features() {
+		m.Names = make([]string, m.features())
+		for i := range m.Names {
+			m.Names[i] = fmt.Sprintf("x%v", i+1)
+		}
+	}
+
+	return m, nil
+}
+
+// linear returns whether the model's rows are
+// parameter vectors which include a constant term
+func (m *model) linear() bool {
+	return m.Type != KMeansType
+}
+
+// features returns the number of input features
+// of the model
+func (m *model) features() int {
+	if m.linear() {
+		return len(m.Rows[0]) - 1
+	}
+
+	return len(m.Rows[0])
+}
+
+// validate checks that the model has parameters and
+// that they have a consistent shape
+func (m *model) validate() error {
+	if len(m.Rows) == 0 || len(m.Rows[0]) == 0 {
+		return fmt.Errorf("ERROR: %v model has no parameters to export", m.Type)
+	}
+
+	for i := range m.Rows {
+		if len(m.Rows[i]) != len(m.Rows[0]) {
+			return fmt.Errorf("ERROR: %v model parameter vectors have different lengths (%v and %v)", m.Type, len(m.Rows[0]), len(m.Rows[i]))
+		}
+	}
+
+	if m.linear() && len(m.Rows[0]) < 2 {
+		return fmt.Errorf("ERROR: %v model has no features", m.Type)
+	}
+
+	switch m.Type {
+	case LeastSquaresType, LogisticType, PerceptronType:
+		if len(m.Rows) != 1 {
+			return fmt.Errorf("ERROR: %v model should have one parameter vector - found %v", m.Type, len(m.Rows))
+		}
+	}
+
+	return nil
+}
+
+// persistable returns a new goml model built from
+// the description
+func (m *model) persistable() (base.Persistable, error) {
+	err := m.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var data interface{} = m.Rows
+	switch m.Type {
+	case LeastSquaresType, LogisticType, PerceptronType:
+		data = m.Rows[0]
+	}
+
+	var hyper interface{}
+	if len(m.Hyperparameters) != 0 {
+		hyper = m.Hyperparameters
+	} else if m.Type == SoftmaxType {
+		// Softmax models need to know how many
+		// classes they have
+		hyper = map[string]int{"k": len(m.Rows)}
+	}
+
+	env := &base.Envelope{
+		Type: m.Type,
+		Schema: base.FeatureSchema{
+			Features: m.features(),
+		},
+	}
+
+	err = env.Encode(hyper, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return base.LoadEnvelope(env)
+}
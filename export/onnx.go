@@ -0,0 +1,734 @@
+package export
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/admpub/goml/base"
+)
+
+// ONNX versions written by WriteONNX. IR version 7
+// and opset 13 are understood by every maintained
+// ONNX runtime.
+const (
+	ONNXIRVersion    = 7
+	ONNXOpsetVersion = 13
+)
+
+// keys of the ONNX model metadata holding goml
+// specific information
+const (
+	onnxTypeKey            = "goml.type"
+	onnxHyperparametersKey = "goml.hyperparameters"
+)
+
+// ONNX tensor element types
+const (
+	onnxFloat  = 1
+	onnxInt64  = 7
+	onnxDouble = 11
+)
+
+// ONNX attribute types
+const (
+	onnxAttributeFloat = 1
+	onnxAttributeInt   = 2
+)
+
+type onnxModel struct {
+	IRVersion int64
+	Opset     int64
+	Producer  string
+	Graph     onnxGraph
+
+	// Metadata holds the metadata_props of the
+	// model, as key/value pairs
+	Metadata [][2]string
+}
+
+type onnxGraph struct {
+	Name         string
+	Nodes        []onnxNode
+	Initializers []onnxTensor
+	Inputs       []onnxValueInfo
+	Outputs      []onnxValueInfo
+}
+
+type onnxNode struct {
+	Inputs     []string
+	Outputs    []string
+	Name       string
+	OpType     string
+	Attributes []onnxAttribute
+}
+
+type onnxAttribute struct {
+	Name string
+	Type int64
+	F    float64
+	I    int64
+}
+
+type onnxTensor struct {
+	Name     string
+	Dims     []int64
+	DataType int64
+	Values   []float64
+}
+
+// onnxValueInfo describes a graph input or output
+// tensor. A dimension of -1 is a symbolic (batch)
+// dimension.
+type onnxValueInfo struct {
+	Name     string
+	ElemType int64
+	Dims     []int64
+}
+
+// MarshalONNX returns the given model as a serialized
+// ONNX ModelProto. The graph takes a double tensor
+// "X" of shape [N, features] and returns "Y":
+//
+//     LeastSquares: Y = Gemm(X, W, B)               [N, 1]
+//     Logistic:     Y = Sigmoid(Gemm(X, W, B))      [N, 1]
+//     Softmax:      Y = Softmax(Gemm(X, W, B))      [N, k]
+//     Perceptron:   Y = Where(Gemm(X, W, B) > 0, 1, -1) [N, 1]
+//     KMeans:       Y = ArgMin(-2 X·Cᵀ + |C|²)      [N, 1] (int64)
+//
+// where W holds one row of coefficients per output,
+// B the constant terms and C the centroids. All
+// parameters are stored as doubles, so models round-trip
+// exactly. The protobuf encoding is written by hand so
+// no code generation or dependencies are needed.
+func MarshalONNX(p base.Persistable) ([]byte, error) {
+	m, err := fromModel(p)
+	if err != nil {
+		return nil, err
+	}
+
+	n := int64(m.features())
+	outputs := int64(len(m.Rows))
+
+	graph := onnxGraph{
+		Name: m.Type,
+		Inputs: []onnxValueInfo{
+			{Name: "X", ElemType: onnxDouble, Dims: []int64{-1, n}},
+		},
+	}
+
+	transB := onnxAttribute{Name: "transB", Type: onnxAttributeInt, I: 1}
+
+	if m.Type == KMeansType {
+		// argmin |x-c|² = argmin -2x·c + |c|², and the
+		// last term is the Gemm bias
+		norms := make([]float64, len(m.Rows))
+		var centroids []float64
+		for i, centroid := range m.Rows {
+			for _, c := range centroid {
+				norms[i] += c * c
+			}
+			centroids = append(centroids, centroid...)
+		}
+
+		graph.Initializers = []onnxTensor{
+			{Name: "C", Dims: []int64{outputs, n}, DataType: onnxDouble, Values: centroids},
+			{Name: "C_norm", Dims: []int64{outputs}, DataType: onnxDouble, Values: norms},
+		}
+		graph.Nodes = []onnxNode{
+			{
+				Inputs:  []string{"X", "C", "C_norm"},
+				Outputs: []string{"D"},
+				Name:    "distance",
+				OpType:  "Gemm",
+				Attributes: []onnxAttribute{
+					{Name: "alpha", Type: onnxAttributeFloat, F: -2},
+					transB,
+				},
+			},
+			{
+				Inputs:  []string{"D"},
+				Outputs: []string{"Y"},
+				Name:    "cluster",
+				OpType:  "ArgMin",
+				Attributes: []onnxAttribute{
+					{Name: "axis", Type: onnxAttributeInt, I: 1},
+					{Name: "keepdims", Type: onnxAttributeInt, I: 1},
+				},
+			},
+		}
+		graph.Outputs = []onnxValueInfo{
+			{Name: "Y", ElemType: onnxInt64, Dims: []int64{-1, 1}},
+		}
+	} else {
+		var weights, bias []float64
+		for _, theta := range m.Rows {
+			bias = append(bias, theta[0])
+			weights = append(weights, theta[1:]...)
+		}
+
+		graph.Initializers = []onnxTensor{
+			{Name: "W", Dims: []int64{outputs, n}, DataType: onnxDouble, Values: weights},
+			{Name: "B", Dims: []int64{outputs}, DataType: onnxDouble, Values: bias},
+		}
+
+		gemm := onnxNode{
+			Inputs:     []string{"X", "W", "B"},
+			Outputs:    []string{"Z"},
+			Name:       "linear",
+			OpType:     "Gemm",
+			Attributes: []onnxAttribute{transB},
+		}
+
+		switch m.Type {
+		case LeastSquaresType:
+			gemm.Outputs = []string{"Y"}
+			graph.Nodes = []onnxNode{gemm}
+
+		case LogisticType:
+			graph.Nodes = []onnxNode{gemm, {
+				Inputs:  []string{"Z"},
+				Outputs: []string{"Y"},
+				Name:    "sigmoid",
+				OpType:  "Sigmoid",
+			}}
+
+		case SoftmaxType:
+			graph.Nodes = []onnxNode{gemm, {
+				Inputs:  []string{"Z"},
+				Outputs: []string{"Y"},
+				Name:    "softmax",
+				OpType:  "Softmax",
+				Attributes: []onnxAttribute{
+					{Name: "axis", Type: onnxAttributeInt, I: 1},
+				},
+			}}
+
+		case PerceptronType:
+			graph.Initializers = append(graph.Initializers,
+				onnxTensor{Name: "zero", DataType: onnxDouble, Values: []float64{0}},
+				onnxTensor{Name: "one", DataType: onnxDouble, Values: []float64{1}},
+				onnxTensor{Name: "minus_one", DataType: onnxDouble, Values: []float64{-1}},
+			)
+			graph.Nodes = []onnxNode{gemm, {
+				Inputs:  []string{"Z", "zero"},
+				Outputs: []string{"positive"},
+				Name:    "step",
+				OpType:  "Greater",
+			}, {
+				Inputs:  []string{"positive", "one", "minus_one"},
+				Outputs: []string{"Y"},
+				Name:    "sign",
+				OpType:  "Where",
+			}}
+		}
+
+		graph.Outputs = []onnxValueInfo{
+			{Name: "Y", ElemType: onnxDouble, Dims: []int64{-1, outputs}},
+		}
+	}
+
+	proto := onnxModel{
+		IRVersion: ONNXIRVersion,
+		Opset:     ONNXOpsetVersion,
+		Producer:  "goml",
+		Graph:     graph,
+		Metadata: [][2]string{
+			{onnxTypeKey, m.Type},
+		},
+	}
+	if len(m.Hyperparameters) != 0 {
+		proto.Metadata = append(proto.Metadata, [2]string{onnxHyperparametersKey, string(m.Hyperparameters)})
+	}
+
+	return proto.marshal(), nil
+}
+
+// WriteONNX writes the given model as a serialized
+// ONNX ModelProto to w (see MarshalONNX)
+func WriteONNX(w io.Writer, p base.Persistable) error {
+	model, err := MarshalONNX(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(model)
+	return err
+}
+
+// UnmarshalONNX parses a serialized ONNX ModelProto
+// and returns the goml model it describes. Models
+// written by goml record the model type (and the
+// hyperparameters) in their metadata. For other models
+// the type is inferred from the operators of the graph
+// (ArgMin -> KMeans, Where -> Perceptron, Softmax ->
+// Softmax, Sigmoid -> Logistic, otherwise LeastSquares)
+// and the parameters are read from the initializers of
+// the Gemm node, which should be the same as the graphs
+// written by MarshalONNX. Both float and double
+// initializers are supported.
+func UnmarshalONNX(data []byte) (base.Persistable, error) {
+	proto, err := parseONNXModel(data)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &model{}
+	for _, prop := range proto.Metadata {
+		switch prop[0] {
+		case onnxTypeKey:
+			m.Type = prop[1]
+		case onnxHyperparametersKey:
+			m.Hyperparameters = []byte(prop[1])
+		}
+	}
+
+	var gemm *onnxNode
+	ops := map[string]bool{}
+	for i := range proto.Graph.Nodes {
+		node := &proto.Graph.Nodes[i]
+		ops[node.OpType] = true
+		if node.OpType == "Gemm" && gemm == nil {
+			gemm = node
+		}
+	}
+	if gemm == nil {
+		return nil, fmt.Errorf("ERROR: ONNX graph has no Gemm node holding the model's parameters")
+	}
+
+	if m.Type == "" {
+		switch {
+		case ops["ArgMin"]:
+			m.Type = KMeansType
+		case ops["Where"]:
+			m.Type = PerceptronType
+		case ops["Softmax"]:
+			m.Type = SoftmaxType
+		case ops["Sigmoid"]:
+			m.Type = LogisticType
+		default:
+			m.Type = LeastSquaresType
+		}
+	}
+
+	weights, bias, err := proto.Graph.gemmParameters(gemm)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Type == KMeansType {
+		alpha := gemm.attribute("alpha", 1)
+		if alpha != -2 {
+			return nil, fmt.Errorf("ERROR: ONNX KMeans graph should compute -2 X·Cᵀ with its Gemm node (alpha = -2) - found alpha = %v", alpha)
+		}
+
+		// weights were scaled by alpha
+		for i := range weights {
+			for j := range weights[i] {
+				weights[i][j] /= alpha
+			}
+		}
+		m.Rows = weights
+	} else {
+		for i := range weights {
+			m.Rows = append(m.Rows, append([]float64{bias[i]}, weights[i]...))
+		}
+	}
+
+	return m.persistable()
+}
+
+// ReadONNX reads a serialized ONNX ModelProto from r
+// (until EOF) and returns the goml model it describes
+// (see UnmarshalONNX)
+func ReadONNX(r io.Reader) (base.Persistable, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return UnmarshalONNX(data)
+}
+
+// attribute returns the value of the node's float
+// or int attribute, or def if it isn't set
+func (n *onnxNode) attribute(name string, def float64) float64 {
+	for _, attr := range n.Attributes {
+		if attr.Name != name {
+			continue
+		}
+
+		if attr.Type == onnxAttributeInt {
+			return float64(attr.I)
+		}
+		return attr.F
+	}
+
+	return def
+}
+
+// initializer returns the float or double
+// initializer with the given name
+func (g *onnxGraph) initializer(name string) (*onnxTensor, error) {
+	for i := range g.Initializers {
+		t := &g.Initializers[i]
+		if t.Name != name {
+			continue
+		}
+
+		if t.DataType != onnxDouble && t.DataType != onnxFloat {
+			return nil, fmt.Errorf("ERROR: ONNX initializer %v has data type %v but only float and double tensors are supported", name, t.DataType)
+		}
+		return t, nil
+	}
+
+	return nil, fmt.Errorf("ERROR: ONNX Gemm input %v is not an initializer", name)
+}
+
+// gemmParameters returns the weights (one row per
+// output, scaled by alpha) and bias (one per output,
+// scaled by beta) of the given Gemm node
+func (g *onnxGraph) gemmParameters(gemm *onnxNode) ([][]float64, []float64, error) {
+	if len(gemm.Inputs) < 2 {
+		return nil, nil, fmt.Errorf("ERROR: ONNX Gemm node should have at least 2 inputs")
+	}
+	if gemm.attribute("transA", 0) != 0 {
+		return nil, nil, fmt.Errorf("ERROR: ONNX Gemm node with transA set can't be imported")
+	}
+
+	w, err := g.initializer(gemm.Inputs[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(w.Dims) != 2 || int64(len(w.Values)) != w.Dims[0]*w.Dims[1] {
+		return nil, nil, fmt.Errorf("ERROR: ONNX Gemm weights %v should be a matrix - found dims %v with %v values", w.Name, w.Dims, len(w.Values))
+	}
+
+	alpha := gemm.attribute("alpha", 1)
+	rows, cols := int(w.Dims[0]), int(w.Dims[1])
+
+	// W should have one row per output, so
+	// transpose it if it has one column per output
+	outputs, features := rows, cols
+	if gemm.attribute("transB", 0) == 0 {
+		outputs, features = cols, rows
+	}
+
+	weights := make([][]float64, outputs)
+	for i := range weights {
+		weights[i] = make([]float64, features)
+		for j := range weights[i] {
+			if outputs == rows {
+				weights[i][j] = alpha * w.Values[i*cols+j]
+			} else {
+				weights[i][j] = alpha * w.Values[j*cols+i]
+			}
+		}
+	}
+
+	bias := make([]float64, outputs)
+	if len(gemm.Inputs) > 2 && gemm.Inputs[2] != "" {
+		b, err := g.initializer(gemm.Inputs[2])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		beta := gemm.attribute("beta", 1)
+		for i := range bias {
+			switch len(b.Values) {
+			case 1:
+				bias[i] = beta * b.Values[0]
+			case outputs:
+				bias[i] = beta * b.Values[i]
+			default:
+				return nil, nil, fmt.Errorf("ERROR: ONNX Gemm bias %v should have 1 or %v values - found %v", b.Name, outputs, len(b.Values))
+			}
+		}
+	}
+
+	return weights, bias, nil
+}
+
+func (m *onnxModel) marshal() []byte {
+	var w protoWriter
+
+	// ModelProto
+	w.int64(1, m.IRVersion)
+	w.string(2, m.Producer)
+	w.string(3, "1")
+
+	var graph protoWriter
+	m.Graph.marshal(&graph)
+	w.message(7, &graph)
+
+	var opset protoWriter
+	opset.string(1, "")
+	opset.int64(2, m.Opset)
+	w.message(8, &opset)
+
+	for _, prop := range m.Metadata {
+		var entry protoWriter
+		entry.string(1, prop[0])
+		entry.string(2, prop[1])
+		w.message(14, &entry)
+	}
+
+	return w.buf.Bytes()
+}
+
+func (g *onnxGraph) marshal(w *protoWriter) {
+	// GraphProto
+	for _, node := range g.Nodes {
+		var n protoWriter
+		for _, input := range node.Inputs {
+			n.string(1, input)
+		}
+		for _, output := range node.Outputs {
+			n.string(2, output)
+		}
+		n.string(3, node.Name)
+		n.string(4, node.OpType)
+		for _, attr := range node.Attributes {
+			var a protoWriter
+			a.string(1, attr.Name)
+			if attr.Type == onnxAttributeFloat {
+				a.float32(2, float32(attr.F))
+			} else {
+				a.int64(3, attr.I)
+			}
+			a.int64(20, attr.Type)
+			n.message(5, &a)
+		}
+		w.message(1, &n)
+	}
+
+	w.string(2, g.Name)
+
+	for _, tensor := range g.Initializers {
+		var t protoWriter
+		if len(tensor.Dims) != 0 {
+			t.packedInt64s(1, tensor.Dims)
+		}
+		t.int64(2, tensor.DataType)
+		t.string(8, tensor.Name)
+
+		raw := make([]byte, 8*len(tensor.Values))
+		for i, v := range tensor.Values {
+			binary.LittleEndian.PutUint64(raw[i*8:], math.Float64bits(v))
+		}
+		t.bytes(9, raw)
+
+		w.message(5, &t)
+	}
+
+	for _, info := range g.Inputs {
+		var v protoWriter
+		info.marshal(&v)
+		w.message(11, &v)
+	}
+	for _, info := range g.Outputs {
+		var v protoWriter
+		info.marshal(&v)
+		w.message(12, &v)
+	}
+}
+
+func (v onnxValueInfo) marshal(w *protoWriter) {
+	// ValueInfoProto -> TypeProto -> Tensor -> TensorShapeProto
+	var shape protoWriter
+	for _, dim := range v.Dims {
+		var d protoWriter
+		if dim < 0 {
+			d.string(2, "N")
+		} else {
+			d.int64(1, dim)
+		}
+		shape.message(1, &d)
+	}
+
+	var tensor protoWriter
+	tensor.int64(1, v.ElemType)
+	tensor.message(2, &shape)
+
+	var typ protoWriter
+	typ.message(1, &tensor)
+
+	w.string(1, v.Name)
+	w.message(2, &typ)
+}
+
+// parseONNXModel parses the parts of a ModelProto
+// needed to import goml models
+func parseONNXModel(data []byte) (*onnxModel, error) {
+	fields, err := parseProto(data)
+	if err != nil {
+		return nil, err
+	}
+
+	model := &onnxModel{}
+	hasGraph := false
+	for _, field := range fields {
+		switch field.Number {
+		case 1:
+			model.IRVersion = int64(field.Varint)
+		case 2:
+			model.Producer = string(field.Bytes)
+		case 7:
+			hasGraph = true
+			err = model.Graph.unmarshal(field.Bytes)
+		case 8:
+			var opset []protoField
+			opset, err = parseProto(field.Bytes)
+			for _, f := range opset {
+				if f.Number == 2 {
+					model.Opset = int64(f.Varint)
+				}
+			}
+		case 14:
+			var entry []protoField
+			entry, err = parseProto(field.Bytes)
+			var prop [2]string
+			for _, f := range entry {
+				if f.Number == 1 || f.Number == 2 {
+					prop[f.Number-1] = string(f.Bytes)
+				}
+			}
+			model.Metadata = append(model.Metadata, prop)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !hasGraph {
+		return nil, fmt.Errorf("ERROR: ONNX model has no graph")
+	}
+
+	return model, nil
+}
+
+func (g *onnxGraph) unmarshal(data []byte) error {
+	fields, err := parseProto(data)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		switch field.Number {
+		case 1:
+			var node onnxNode
+			err = node.unmarshal(field.Bytes)
+			g.Nodes = append(g.Nodes, node)
+		case 2:
+			g.Name = string(field.Bytes)
+		case 5:
+			var tensor onnxTensor
+			err = tensor.unmarshal(field.Bytes)
+			g.Initializers = append(g.Initializers, tensor)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *onnxNode) unmarshal(data []byte) error {
+	fields, err := parseProto(data)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		switch field.Number {
+		case 1:
+			n.Inputs = append(n.Inputs, string(field.Bytes))
+		case 2:
+			n.Outputs = append(n.Outputs, string(field.Bytes))
+		case 3:
+			n.Name = string(field.Bytes)
+		case 4:
+			n.OpType = string(field.Bytes)
+		case 5:
+			var attrFields []protoField
+			attrFields, err = parseProto(field.Bytes)
+			if err != nil {
+				return err
+			}
+
+			var attr onnxAttribute
+			for _, f := range attrFields {
+				switch f.Number {
+				case 1:
+					attr.Name = string(f.Bytes)
+				case 2:
+					attr.F = float64(math.Float32frombits(uint32(f.Varint)))
+				case 3:
+					attr.I = int64(f.Varint)
+				case 20:
+					attr.Type = int64(f.Varint)
+				}
+			}
+			n.Attributes = append(n.Attributes, attr)
+		}
+	}
+
+	return nil
+}
+
+func (t *onnxTensor) unmarshal(data []byte) error {
+	fields, err := parseProto(data)
+	if err != nil {
+		return err
+	}
+
+	var raw []byte
+	var values []float64
+	for _, field := range fields {
+		var parsed []float64
+		switch field.Number {
+		case 1:
+			var dims []int64
+			dims, err = field.int64s()
+			t.Dims = append(t.Dims, dims...)
+		case 2:
+			t.DataType = int64(field.Varint)
+		case 4:
+			parsed, err = field.float32s()
+			values = append(values, parsed...)
+		case 8:
+			t.Name = string(field.Bytes)
+		case 9:
+			raw = field.Bytes
+		case 10:
+			parsed, err = field.float64s()
+			values = append(values, parsed...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// other tensors (shapes, indices, etc.) aren't
+	// needed to import models
+	if t.DataType != onnxDouble && t.DataType != onnxFloat {
+		return nil
+	}
+
+	if raw != nil {
+		size := 8
+		if t.DataType == onnxFloat {
+			size = 4
+		}
+		if len(raw)%size != 0 {
+			return fmt.Errorf("ERROR: ONNX initializer %v raw data has an invalid length %v", t.Name, len(raw))
+		}
+		values = littleEndianFloats(raw, size)
+	}
+	t.Values = values
+
+	return nil
+}
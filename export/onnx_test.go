@@ -0,0 +1,125 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/admpub/goml/linear"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtoWriterShouldPass1(t *testing.T) {
+	// examples from the protocol buffer
+	// encoding documentation
+	var w protoWriter
+	w.int64(1, 150)
+	assert.Equal(t, []byte{0x08, 0x96, 0x01}, w.buf.Bytes(), "Varint field should be encoded like protobuf")
+
+	w = protoWriter{}
+	w.string(2, "testing")
+	assert.Equal(t, []byte{0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}, w.buf.Bytes(), "String field should be encoded like protobuf")
+
+	w = protoWriter{}
+	w.packedInt64s(4, []int64{3, 270, 86942})
+	assert.Equal(t, []byte{0x22, 0x06, 0x03, 0x8e, 0x02, 0x9e, 0xa7, 0x05}, w.buf.Bytes(), "Packed field should be encoded like protobuf")
+
+	fields, err := parseProto(w.buf.Bytes())
+	assert.Nil(t, err, "Parse error should be nil")
+	assert.Len(t, fields, 1, "There should be one field")
+
+	values, err := fields[0].int64s()
+	assert.Nil(t, err, "Parse error should be nil")
+	assert.Equal(t, []int64{3, 270, 86942}, values, "Packed values should be parsed")
+}
+
+func TestONNXRoundTripShouldPass1(t *testing.T) {
+	ops := [][]string{
+		{"Gemm"},
+		{"Gemm", "Sigmoid"},
+		{"Gemm", "Softmax"},
+		{"Gemm", "ArgMin"},
+		{"Gemm", "Greater", "Where"},
+	}
+
+	for i, model := range exportableModels() {
+		var buf bytes.Buffer
+		err := WriteONNX(&buf, model)
+		assert.Nil(t, err, "Export error should be nil")
+
+		proto, err := parseONNXModel(buf.Bytes())
+		assert.Nil(t, err, "Parse error should be nil")
+		assert.EqualValues(t, ONNXIRVersion, proto.IRVersion, "IR version should be set")
+		assert.EqualValues(t, ONNXOpsetVersion, proto.Opset, "Opset version should be set")
+
+		var graphOps []string
+		for _, node := range proto.Graph.Nodes {
+			graphOps = append(graphOps, node.OpType)
+		}
+		assert.Equal(t, ops[i], graphOps, "Graph should use the expected operators")
+
+		imported, err := ReadONNX(&buf)
+		assert.Nil(t, err, "Import error should be nil")
+
+		assertSameModel(t, model, imported)
+	}
+}
+
+func TestONNXImportShouldPass1(t *testing.T) {
+	// a logistic regression graph without goml
+	// metadata, with W given as a column (transB = 0)
+	// and a scaled bias
+	proto := onnxModel{
+		IRVersion: ONNXIRVersion,
+		Opset:     ONNXOpsetVersion,
+		Graph: onnxGraph{
+			Nodes: []onnxNode{
+				{
+					Inputs:  []string{"input", "weights", "bias"},
+					Outputs: []string{"logits"},
+					OpType:  "Gemm",
+					Attributes: []onnxAttribute{
+						{Name: "beta", Type: onnxAttributeFloat, F: 2},
+					},
+				},
+				{
+					Inputs:  []string{"logits"},
+					Outputs: []string{"probability"},
+					OpType:  "Sigmoid",
+				},
+			},
+			Initializers: []onnxTensor{
+				{Name: "weights", Dims: []int64{3, 1}, DataType: onnxDouble, Values: []float64{1, -2, 0.5}},
+				{Name: "bias", Dims: []int64{1}, DataType: onnxDouble, Values: []float64{0.25}},
+			},
+		},
+	}
+
+	imported, err := UnmarshalONNX(proto.marshal())
+	assert.Nil(t, err, "Import error should be nil")
+
+	logistic, ok := imported.(*linear.Logistic)
+	assert.True(t, ok, "Imported model should be a *linear.Logistic")
+	assert.Equal(t, []float64{0.5, 1, -2, 0.5}, logistic.Parameters, "Parameters should be read from the Gemm node")
+}
+
+func TestONNXShouldFail1(t *testing.T) {
+	_, err := UnmarshalONNX([]byte{0xff, 0xff})
+	assert.NotNil(t, err, "Importing invalid protobuf should return an error")
+
+	proto := onnxModel{
+		Graph: onnxGraph{
+			Nodes: []onnxNode{
+				{Inputs: []string{"X"}, Outputs: []string{"Y"}, OpType: "Relu"},
+			},
+		},
+	}
+	_, err = UnmarshalONNX(proto.marshal())
+	assert.NotNil(t, err, "Importing a graph without a Gemm node should return an error")
+
+	model, err := MarshalONNX(exportableModels()[0])
+	assert.Nil(t, err, "Export error should be nil")
+
+	_, err = UnmarshalONNX(model[:len(model)-3])
+	assert.NotNil(t, err, "Importing a truncated model should return an error")
+}
@@ -0,0 +1,658 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/admpub/goml/base"
+)
+
+// PMMLVersion is the version of PMML documents
+// written by WritePMML
+const PMMLVersion = "4.4"
+
+// pmmlNamespace is the XML namespace of PMML 4.4
+const pmmlNamespace = "http://www.dmg.org/PMML-4_4"
+
+// pmmlExtender is the extender of the extensions
+// holding goml specific information
+const pmmlExtender = "goml"
+
+// pmmlTarget is the name of the target field of
+// exported regression models
+const pmmlTarget = "y"
+
+type pmmlDocument struct {
+	XMLName         xml.Name             `xml:"PMML"`
+	Namespace       string               `xml:"xmlns,attr,omitempty"`
+	Version         string               `xml:"version,attr"`
+	Header          pmmlHeader           `xml:"Header"`
+	DataDictionary  pmmlDataDictionary   `xml:"DataDictionary"`
+	RegressionModel *pmmlRegressionModel `xml:"RegressionModel,omitempty"`
+	ClusteringModel *pmmlClusteringModel `xml:"ClusteringModel,omitempty"`
+}
+
+type pmmlHeader struct {
+	Description string          `xml:"description,attr,omitempty"`
+	Application pmmlApplication `xml:"Application"`
+}
+
+type pmmlApplication struct {
+	Name string `xml:"name,attr"`
+}
+
+type pmmlExtension struct {
+	Extender string `xml:"extender,attr,omitempty"`
+	Name     string `xml:"name,attr"`
+	Value    string `xml:"value,attr"`
+}
+
+type pmmlDataDictionary struct {
+	NumberOfFields int             `xml:"numberOfFields,attr"`
+	DataFields     []pmmlDataField `xml:"DataField"`
+}
+
+type pmmlDataField struct {
+	Name     string      `xml:"name,attr"`
+	OpType   string      `xml:"optype,attr"`
+	DataType string      `xml:"dataType,attr"`
+	Values   []pmmlValue `xml:"Value"`
+}
+
+type pmmlValue struct {
+	Value string `xml:"value,attr"`
+}
+
+type pmmlMiningSchema struct {
+	MiningFields []pmmlMiningField `xml:"MiningField"`
+}
+
+type pmmlMiningField struct {
+	Name      string `xml:"name,attr"`
+	UsageType string `xml:"usageType,attr,omitempty"`
+}
+
+type pmmlRegressionModel struct {
+	ModelName           string                `xml:"modelName,attr,omitempty"`
+	FunctionName        string                `xml:"functionName,attr"`
+	NormalizationMethod string                `xml:"normalizationMethod,attr,omitempty"`
+	Extensions          []pmmlExtension       `xml:"Extension"`
+	MiningSchema        pmmlMiningSchema      `xml:"MiningSchema"`
+	RegressionTables    []pmmlRegressionTable `xml:"RegressionTable"`
+}
+
+type pmmlRegressionTable struct {
+	Intercept         string                 `xml:"intercept,attr"`
+	TargetCategory    string                 `xml:"targetCategory,attr,omitempty"`
+	NumericPredictors []pmmlNumericPredictor `xml:"NumericPredictor"`
+}
+
+type pmmlNumericPredictor struct {
+	Name        string `xml:"name,attr"`
+	Exponent    string `xml:"exponent,attr,omitempty"`
+	Coefficient string `xml:"coefficient,attr"`
+}
+
+type pmmlClusteringModel struct {
+	ModelName         string                `xml:"modelName,attr,omitempty"`
+	FunctionName      string                `xml:"functionName,attr"`
+	ModelClass        string                `xml:"modelClass,attr"`
+	NumberOfClusters  int                   `xml:"numberOfClusters,attr"`
+	Extensions        []pmmlExtension       `xml:"Extension"`
+	MiningSchema      pmmlMiningSchema      `xml:"MiningSchema"`
+	ComparisonMeasure pmmlComparisonMeasure `xml:"ComparisonMeasure"`
+	ClusteringFields  []pmmlClusteringField `xml:"ClusteringField"`
+	Clusters          []pmmlCluster         `xml:"Cluster"`
+}
+
+type pmmlComparisonMeasure struct {
+	Kind             string    `xml:"kind,attr"`
+	SquaredEuclidean *struct{} `xml:"squaredEuclidean"`
+	Euclidean        *struct{} `xml:"euclidean"`
+}
+
+type pmmlClusteringField struct {
+	Field           string `xml:"field,attr"`
+	CompareFunction string `xml:"compareFunction,attr,omitempty"`
+}
+
+type pmmlCluster struct {
+	ID    string    `xml:"id,attr,omitempty"`
+	Name  string    `xml:"name,attr,omitempty"`
+	Array pmmlArray `xml:"Array"`
+}
+
+type pmmlArray struct {
+	N     int    `xml:"n,attr"`
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// formatFloat formats f with the fewest digits that
+// parse back to exactly f
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// parseFloat parses a float attribute, where an
+// empty attribute means 0
+func parseFloat(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+// MarshalPMML returns the given model as a PMML 4.4
+// document. LeastSquares models are written as
+// regression RegressionModels, Logistic, Softmax and
+// Perceptron models as classification RegressionModels
+// (with logit, softmax and no normalization,) and KMeans
+// models as center based ClusteringModels.
+func MarshalPMML(p base.Persistable) ([]byte, error) {
+	m, err := fromModel(p)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := pmmlDocument{
+		Namespace: pmmlNamespace,
+		Version:   PMMLVersion,
+		Header: pmmlHeader{
+			Description: m.Type + " model exported by goml",
+			Application: pmmlApplication{
+				Name: "goml",
+			},
+		},
+	}
+
+	extensions := []pmmlExtension{
+		{Extender: pmmlExtender, Name: "type", Value: m.Type},
+	}
+	if len(m.Hyperparameters) != 0 {
+		extensions = append(extensions, pmmlExtension{
+			Extender: pmmlExtender,
+			Name:     "hyperparameters",
+			Value:    string(m.Hyperparameters),
+		})
+	}
+
+	var schema pmmlMiningSchema
+	for _, name := range m.Names {
+		doc.DataDictionary.DataFields = append(doc.DataDictionary.DataFields, pmmlDataField{
+			Name:     name,
+			OpType:   "continuous",
+			DataType: "double",
+		})
+		schema.MiningFields = append(schema.MiningFields, pmmlMiningField{
+			Name: name,
+		})
+	}
+
+	if m.Type == KMeansType {
+		clustering := &pmmlClusteringModel{
+			ModelName:        m.Type,
+			FunctionName:     "clustering",
+			ModelClass:       "centerBased",
+			NumberOfClusters: len(m.Rows),
+			Extensions:       extensions,
+			MiningSchema:     schema,
+			ComparisonMeasure: pmmlComparisonMeasure{
+				Kind:             "distance",
+				SquaredEuclidean: &struct{}{},
+			},
+		}
+
+		for _, name := range m.Names {
+			clustering.ClusteringFields = append(clustering.ClusteringFields, pmmlClusteringField{
+				Field:           name,
+				CompareFunction: "absDiff",
+			})
+		}
+
+		for i, centroid := range m.Rows {
+			values := make([]string, len(centroid))
+			for j := range centroid {
+				values[j] = formatFloat(centroid[j])
+			}
+
+			clustering.Clusters = append(clustering.Clusters, pmmlCluster{
+				ID:   strconv.Itoa(i),
+				Name: strconv.Itoa(i),
+				Array: pmmlArray{
+					N:     len(centroid),
+					Type:  "real",
+					Value: strings.Join(values, " "),
+				},
+			})
+		}
+
+		doc.ClusteringModel = clustering
+		doc.DataDictionary.NumberOfFields = len(doc.DataDictionary.DataFields)
+
+		return marshalPMMLDocument(doc)
+	}
+
+	regression := &pmmlRegressionModel{
+		ModelName:    m.Type,
+		FunctionName: "classification",
+		Extensions:   extensions,
+	}
+
+	target := pmmlDataField{
+		Name:     pmmlTarget,
+		OpType:   "categorical",
+		DataType: "integer",
+	}
+
+	switch m.Type {
+	case LeastSquaresType:
+		regression.FunctionName = "regression"
+		target.OpType = "continuous"
+		target.DataType = "double"
+		regression.RegressionTables = []pmmlRegressionTable{
+			pmmlTable(m.Rows[0], m.Names, ""),
+		}
+
+	case LogisticType:
+		// the probability of the first category is the
+		// logit of the first table, and the last category
+		// gets the rest
+		regression.NormalizationMethod = "logit"
+		regression.RegressionTables = []pmmlRegressionTable{
+			pmmlTable(m.Rows[0], m.Names, "1"),
+			pmmlTable(nil, nil, "0"),
+		}
+
+	case SoftmaxType:
+		regression.NormalizationMethod = "softmax"
+		for i := range m.Rows {
+			regression.RegressionTables = append(regression.RegressionTables, pmmlTable(m.Rows[i], m.Names, strconv.Itoa(i)))
+		}
+
+	case PerceptronType:
+		// the category with the highest score wins, and
+		// ties go to the first table (like the Perceptron,
+		// which predicts -1 when θx is 0)
+		regression.NormalizationMethod = "none"
+		regression.RegressionTables = []pmmlRegressionTable{
+			pmmlTable(nil, nil, "-1"),
+			pmmlTable(m.Rows[0], m.Names, "1"),
+		}
+	}
+
+	if regression.FunctionName == "classification" {
+		for _, table := range regression.RegressionTables {
+			target.Values = append(target.Values, pmmlValue{Value: table.TargetCategory})
+		}
+	}
+
+	doc.DataDictionary.DataFields = append(doc.DataDictionary.DataFields, target)
+	doc.DataDictionary.NumberOfFields = len(doc.DataDictionary.DataFields)
+
+	regression.MiningSchema = schema
+	regression.MiningSchema.MiningFields = append(regression.MiningSchema.MiningFields, pmmlMiningField{
+		Name:      pmmlTarget,
+		UsageType: "target",
+	})
+
+	doc.RegressionModel = regression
+
+	return marshalPMMLDocument(doc)
+}
+
+// pmmlTable returns a RegressionTable for the given
+// parameter vector θ (constant term first.) A nil θ
+// returns a table which always scores 0.
+func pmmlTable(theta []float64, names []string, category string) pmmlRegressionTable {
+	table := pmmlRegressionTable{
+		Intercept:      "0",
+		TargetCategory: category,
+	}
+	if len(theta) == 0 {
+		return table
+	}
+
+	table.Intercept = formatFloat(theta[0])
+	for i, name := range names {
+		table.NumericPredictors = append(table.NumericPredictors, pmmlNumericPredictor{
+			Name:        name,
+			Coefficient: formatFloat(theta[i+1]),
+		})
+	}
+
+	return table
+}
+
+func marshalPMMLDocument(doc pmmlDocument) ([]byte, error) {
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+// WritePMML writes the given model as a PMML document
+// to w (see MarshalPMML)
+func WritePMML(w io.Writer, p base.Persistable) error {
+	doc, err := MarshalPMML(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(doc)
+	return err
+}
+
+// UnmarshalPMML parses a PMML document and returns the
+// goml model it describes. Documents written by goml
+// record the model type (and hyperparameters) in
+// extensions. For other documents the type is inferred
+// from the structure of the model:
+//
+//     regression RegressionModel                  -> linear.LeastSquares
+//     regression RegressionModel (logit)          -> linear.Logistic
+//     classification RegressionModel (logit)      -> linear.Logistic (categories 0 and 1)
+//     classification RegressionModel (softmax)    -> linear.Softmax (categories 0 to k-1)
+//     classification RegressionModel (none)       -> perceptron.Perceptron (categories -1 and 1)
+//     centerBased ClusteringModel                 -> cluster.KMeans
+func UnmarshalPMML(data []byte) (base.Persistable, error) {
+	var doc pmmlDocument
+	err := xml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var m *model
+	switch {
+	case doc.RegressionModel != nil:
+		m, err = pmmlRegression(doc.RegressionModel)
+	case doc.ClusteringModel != nil:
+		m, err = pmmlClustering(doc.ClusteringModel)
+	default:
+		return nil, fmt.Errorf("ERROR: PMML document holds no RegressionModel or ClusteringModel")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m.persistable()
+}
+
+// ReadPMML reads a PMML document from r (until EOF)
+// and returns the goml model it describes (see
+// UnmarshalPMML)
+func ReadPMML(r io.Reader) (base.Persistable, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return UnmarshalPMML(data)
+}
+
+// pmmlExtensions returns the goml type and
+// hyperparameters held in the extensions
+func pmmlExtensions(extensions []pmmlExtension) (string, []byte) {
+	var modelType string
+	var hyper []byte
+	for _, ext := range extensions {
+		if ext.Extender != pmmlExtender {
+			continue
+		}
+
+		switch ext.Name {
+		case "type":
+			modelType = ext.Value
+		case "hyperparameters":
+			hyper = []byte(ext.Value)
+		}
+	}
+
+	return modelType, hyper
+}
+
+// pmmlActiveFields returns the names of the input
+// fields of the mining schema, in order
+func pmmlActiveFields(schema pmmlMiningSchema) []string {
+	var names []string
+	for _, field := range schema.MiningFields {
+		switch field.UsageType {
+		case "", "active":
+			names = append(names, field.Name)
+		}
+	}
+
+	return names
+}
+
+// pmmlTheta returns the parameter vector θ (constant
+// term first) of the given table
+func pmmlTheta(table pmmlRegressionTable, names []string) ([]float64, error) {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+
+	theta := make([]float64, len(names)+1)
+
+	var err error
+	theta[0], err = parseFloat(table.Intercept)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, predictor := range table.NumericPredictors {
+		i, ok := index[predictor.Name]
+		if !ok {
+			return nil, fmt.Errorf("ERROR: PMML predictor %v is not an active field of the mining schema", predictor.Name)
+		}
+		if predictor.Exponent != "" && predictor.Exponent != "1" {
+			return nil, fmt.Errorf("ERROR: PMML predictor %v has exponent %v but only linear predictors are supported", predictor.Name, predictor.Exponent)
+		}
+
+		theta[i+1], err = parseFloat(predictor.Coefficient)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return theta, nil
+}
+
+// pmmlCategory returns the table of the given
+// target category
+func pmmlCategory(tables []pmmlRegressionTable, category string) (int, bool) {
+	for i := range tables {
+		if strings.TrimSpace(tables[i].TargetCategory) == category {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+func pmmlRegression(regression *pmmlRegressionModel) (*model, error) {
+	modelType, hyper := pmmlExtensions(regression.Extensions)
+	names := pmmlActiveFields(regression.MiningSchema)
+	tables := regression.RegressionTables
+
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("ERROR: PMML RegressionModel has no RegressionTable")
+	}
+
+	normalization := regression.NormalizationMethod
+	if normalization == "" {
+		normalization = "none"
+	}
+
+	if modelType == "" {
+		switch {
+		case regression.FunctionName == "regression" && normalization == "none":
+			modelType = LeastSquaresType
+		case normalization == "logit":
+			modelType = LogisticType
+		case regression.FunctionName == "classification" && normalization == "softmax":
+			modelType = SoftmaxType
+		case regression.FunctionName == "classification" && normalization == "none":
+			modelType = PerceptronType
+		default:
+			return nil, fmt.Errorf("ERROR: PMML %v RegressionModel with %v normalization can't be imported", regression.FunctionName, normalization)
+		}
+	}
+
+	thetas := make([][]float64, len(tables))
+	for i := range tables {
+		theta, err := pmmlTheta(tables[i], names)
+		if err != nil {
+			return nil, err
+		}
+		thetas[i] = theta
+	}
+
+	m := &model{
+		Type:            modelType,
+		Hyperparameters: hyper,
+		Names:           names,
+	}
+
+	switch modelType {
+	case LeastSquaresType:
+		if len(tables) != 1 {
+			return nil, fmt.Errorf("ERROR: PMML regression should have one RegressionTable - found %v", len(tables))
+		}
+		m.Rows = thetas
+
+	case LogisticType:
+		if regression.FunctionName == "regression" {
+			m.Rows = thetas[:1]
+			break
+		}
+		if len(tables) != 2 {
+			return nil, fmt.Errorf("ERROR: PMML logistic classification should have two RegressionTables - found %v", len(tables))
+		}
+
+		first := strings.TrimSpace(tables[0].TargetCategory)
+		if first == "1" {
+			m.Rows = thetas[:1]
+			break
+		}
+		if first != "0" || strings.TrimSpace(tables[1].TargetCategory) != "1" {
+			return nil, fmt.Errorf("ERROR: PMML logistic classification target categories should be 0 and 1")
+		}
+
+		// P(1) = 1 - logit(θ0·x) = logit(-θ0·x)
+		theta := thetas[0]
+		for i := range theta {
+			theta[i] = -theta[i]
+		}
+		m.Rows = [][]float64{theta}
+
+	case SoftmaxType:
+		m.Rows = make([][]float64, len(tables))
+		for i := range m.Rows {
+			j, ok := pmmlCategory(tables, strconv.Itoa(i))
+			if !ok {
+				return nil, fmt.Errorf("ERROR: PMML softmax classification target categories should be 0 to %v", len(tables)-1)
+			}
+			m.Rows[i] = thetas[j]
+		}
+
+	case PerceptronType:
+		positive, okPositive := pmmlCategory(tables, "1")
+		negative, okNegative := pmmlCategory(tables, "-1")
+		if len(tables) != 2 || !okPositive || !okNegative {
+			return nil, fmt.Errorf("ERROR: PMML perceptron classification target categories should be -1 and 1")
+		}
+
+		theta := make([]float64, len(names)+1)
+		for i := range theta {
+			theta[i] = thetas[positive][i] - thetas[negative][i]
+		}
+		m.Rows = [][]float64{theta}
+
+	default:
+		return nil, fmt.Errorf("ERROR: %v models can't be imported from a PMML RegressionModel", modelType)
+	}
+
+	return m, nil
+}
+
+func pmmlClustering(clustering *pmmlClusteringModel) (*model, error) {
+	modelType, hyper := pmmlExtensions(clustering.Extensions)
+	if modelType == "" {
+		modelType = KMeansType
+	}
+	if modelType != KMeansType {
+		return nil, fmt.Errorf("ERROR: %v models can't be imported from a PMML ClusteringModel", modelType)
+	}
+
+	if clustering.ModelClass != "centerBased" {
+		return nil, fmt.Errorf("ERROR: PMML ClusteringModel should be centerBased - found %v", clustering.ModelClass)
+	}
+
+	measure := clustering.ComparisonMeasure
+	if measure.Kind != "distance" || (measure.SquaredEuclidean == nil && measure.Euclidean == nil) {
+		return nil, fmt.Errorf("ERROR: PMML ClusteringModel should use (squared) euclidean distance")
+	}
+
+	names := pmmlActiveFields(clustering.MiningSchema)
+
+	// centroid coordinates are ordered by the
+	// clustering fields, which can differ from the
+	// order of the mining schema
+	order := make([]int, len(names))
+	for i := range order {
+		order[i] = i
+	}
+	if len(clustering.ClusteringFields) != 0 {
+		index := make(map[string]int, len(names))
+		for i, name := range names {
+			index[name] = i
+		}
+
+		if len(clustering.ClusteringFields) != len(names) {
+			return nil, fmt.Errorf("ERROR: PMML ClusteringModel has %v clustering fields but %v active fields", len(clustering.ClusteringFields), len(names))
+		}
+		for i, field := range clustering.ClusteringFields {
+			j, ok := index[field.Field]
+			if !ok {
+				return nil, fmt.Errorf("ERROR: PMML clustering field %v is not an active field of the mining schema", field.Field)
+			}
+			order[i] = j
+		}
+	}
+
+	m := &model{
+		Type:            modelType,
+		Hyperparameters: hyper,
+		Names:           names,
+	}
+
+	for _, cluster := range clustering.Clusters {
+		values := strings.Fields(cluster.Array.Value)
+		if len(values) != len(names) {
+			return nil, fmt.Errorf("ERROR: PMML cluster %v has %v values but there are %v fields", cluster.ID, len(values), len(names))
+		}
+
+		centroid := make([]float64, len(names))
+		for i, value := range values {
+			f, err := parseFloat(strings.Trim(value, `"`))
+			if err != nil {
+				return nil, err
+			}
+			centroid[order[i]] = f
+		}
+
+		m.Rows = append(m.Rows, centroid)
+	}
+
+	return m, nil
+}
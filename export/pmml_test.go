@@ -0,0 +1,178 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/admpub/goml/base"
+	"github.com/admpub/goml/cluster"
+	"github.com/admpub/goml/linear"
+	"github.com/admpub/goml/perceptron"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// predictor is implemented by every exportable model
+type predictor interface {
+	base.Persistable
+	Predict([]float64, ...bool) ([]float64, error)
+}
+
+// exportableModels returns one trained-looking model
+// of every type which can be exported
+func exportableModels() []predictor {
+	leastSquares := linear.NewLeastSquares(base.BatchGA, 1e-4, 6, 800, nil, nil, 2)
+	leastSquares.Parameters = []float64{0.5, -1.25, 3}
+
+	logistic := linear.NewLogistic(base.StochasticGA, 1e-3, 0.5, 100, nil, nil, 2)
+	logistic.Parameters = []float64{-0.3, 2.5, -1.75}
+
+	softmax := linear.NewSoftmax(base.BatchGA, 1e-5, 0, 3, 10, nil, nil, 2)
+	softmax.Parameters = [][]float64{
+		{0.1, 1, -1},
+		{-0.2, 0.5, 2},
+		{0.3, -2, 0.25},
+	}
+
+	kmeans := cluster.NewKMeans(3, 10, nil, cluster.OnlineParams{Features: 2, Alpha: 0.3})
+	kmeans.Centroids = [][]float64{
+		{-5, -5},
+		{0, 1.5},
+		{4.25, -3},
+	}
+
+	p := perceptron.NewPerceptron(0.1, 2)
+	p.Parameters = []float64{1, -2, 0.5}
+
+	return []predictor{leastSquares, logistic, softmax, kmeans, p}
+}
+
+// inputs used to compare predictions
+var testInputs = [][]float64{
+	{0, 0},
+	{1, 2},
+	{-3, 0.5},
+	{4, -2},
+	{-4.5, -6},
+}
+
+// assertSameModel asserts that the imported model is
+// of the same type, with the same hyperparameters and
+// predictions, as the original one
+func assertSameModel(t *testing.T, original predictor, imported base.Persistable) {
+	want, err := original.MarshalEnvelope()
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	got, err := imported.MarshalEnvelope()
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	assert.Equal(t, want.Type, got.Type, "Imported model should have the same type")
+	assert.JSONEq(t, string(want.Hyperparameters), string(got.Hyperparameters), "Imported %v should have the same hyperparameters", want.Type)
+	assert.JSONEq(t, string(want.Data), string(got.Data), "Imported %v should have the same parameters", want.Type)
+
+	model, ok := imported.(predictor)
+	assert.True(t, ok, "Imported model should be able to predict")
+
+	for _, x := range testInputs {
+		expected, err := original.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		guess, err := model.Predict(x)
+		assert.Nil(t, err, "Prediction error of the imported model should be nil")
+		assert.Equal(t, expected, guess, "Imported %v should predict like the original", want.Type)
+	}
+}
+
+func TestPMMLRoundTripShouldPass1(t *testing.T) {
+	for _, model := range exportableModels() {
+		var buf bytes.Buffer
+		err := WritePMML(&buf, model)
+		assert.Nil(t, err, "Export error should be nil")
+		assert.Contains(t, buf.String(), `<PMML xmlns="http://www.dmg.org/PMML-4_4" version="4.4">`, "Document should be PMML 4.4")
+
+		imported, err := ReadPMML(&buf)
+		assert.Nil(t, err, "Import error should be nil")
+
+		assertSameModel(t, model, imported)
+	}
+}
+
+func TestPMMLImportShouldPass1(t *testing.T) {
+	// a logistic regression (without goml extensions)
+	// where the first category is 0
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<PMML xmlns="http://www.dmg.org/PMML-4_4" version="4.4">
+  <Header/>
+  <DataDictionary numberOfFields="3">
+    <DataField name="age" optype="continuous" dataType="double"/>
+    <DataField name="income" optype="continuous" dataType="double"/>
+    <DataField name="churn" optype="categorical" dataType="integer"/>
+  </DataDictionary>
+  <RegressionModel functionName="classification" normalizationMethod="logit">
+    <MiningSchema>
+      <MiningField name="churn" usageType="target"/>
+      <MiningField name="age"/>
+      <MiningField name="income"/>
+    </MiningSchema>
+    <RegressionTable intercept="0.5" targetCategory="0">
+      <NumericPredictor name="income" coefficient="-2"/>
+      <NumericPredictor name="age" coefficient="1"/>
+    </RegressionTable>
+    <RegressionTable intercept="0" targetCategory="1"/>
+  </RegressionModel>
+</PMML>`
+
+	imported, err := UnmarshalPMML([]byte(doc))
+	assert.Nil(t, err, "Import error should be nil")
+
+	logistic, ok := imported.(*linear.Logistic)
+	assert.True(t, ok, "Imported model should be a *linear.Logistic")
+	assert.Equal(t, []float64{-0.5, -1, 2}, logistic.Parameters, "Parameters should be the negated parameters of category 0")
+
+	// a clustering model with reordered fields
+	doc = `<PMML version="4.4">
+  <DataDictionary numberOfFields="2">
+    <DataField name="a" optype="continuous" dataType="double"/>
+    <DataField name="b" optype="continuous" dataType="double"/>
+  </DataDictionary>
+  <ClusteringModel functionName="clustering" modelClass="centerBased" numberOfClusters="2">
+    <MiningSchema>
+      <MiningField name="a"/>
+      <MiningField name="b"/>
+    </MiningSchema>
+    <ComparisonMeasure kind="distance"><euclidean/></ComparisonMeasure>
+    <ClusteringField field="b"/>
+    <ClusteringField field="a"/>
+    <Cluster id="1"><Array n="2" type="real">1 2</Array></Cluster>
+    <Cluster id="2"><Array n="2" type="real">-3 4.5</Array></Cluster>
+  </ClusteringModel>
+</PMML>`
+
+	imported, err = UnmarshalPMML([]byte(doc))
+	assert.Nil(t, err, "Import error should be nil")
+
+	kmeans, ok := imported.(*cluster.KMeans)
+	assert.True(t, ok, "Imported model should be a *cluster.KMeans")
+	assert.Equal(t, [][]float64{{2, 1}, {4.5, -3}}, kmeans.Centroids, "Centroids should follow the mining schema order")
+}
+
+func TestPMMLShouldFail1(t *testing.T) {
+	_, err := MarshalPMML(perceptron.NewKernelPerceptron(base.LinearKernel()))
+	assert.NotNil(t, err, "Exporting an unsupported model should return an error")
+
+	_, err = MarshalPMML(linear.NewLeastSquares(base.BatchGA, 1e-4, 0, 10, nil, nil))
+	assert.NotNil(t, err, "Exporting a model without features should return an error")
+
+	_, err = UnmarshalPMML([]byte(`<PMML version="4.4"><DataDictionary/></PMML>`))
+	assert.NotNil(t, err, "Importing a document without a model should return an error")
+
+	model, err := MarshalPMML(exportableModels()[0])
+	assert.Nil(t, err, "Export error should be nil")
+
+	_, err = UnmarshalPMML([]byte(strings.Replace(string(model), `name="x2"`, `name="x3"`, -1)[:len(model)/2]))
+	assert.NotNil(t, err, "Importing a truncated document should return an error")
+
+	_, err = UnmarshalPMML([]byte(strings.Replace(string(model), `NumericPredictor name="x2"`, `NumericPredictor name="unknown"`, 1)))
+	assert.NotNil(t, err, "Importing a predictor which isn't a field should return an error")
+}
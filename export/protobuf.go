@@ -0,0 +1,205 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// wire types of the protocol buffer encoding
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoWriter writes protocol buffer messages. It
+// only implements what's needed to write ONNX models
+// so goml doesn't need a protobuf dependency.
+type protoWriter struct {
+	buf     bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (w *protoWriter) rawVarint(v uint64) {
+	w.buf.Write(w.scratch[:binary.PutUvarint(w.scratch[:], v)])
+}
+
+func (w *protoWriter) tag(field, wire int) {
+	w.rawVarint(uint64(field)<<3 | uint64(wire))
+}
+
+// int64 writes an int64 (or int32, or enum) field.
+// Negative values take 10 bytes, as in protobuf.
+func (w *protoWriter) int64(field int, v int64) {
+	w.tag(field, wireVarint)
+	w.rawVarint(uint64(v))
+}
+
+func (w *protoWriter) float32(field int, f float32) {
+	w.tag(field, wireFixed32)
+	binary.LittleEndian.PutUint32(w.scratch[:4], math.Float32bits(f))
+	w.buf.Write(w.scratch[:4])
+}
+
+func (w *protoWriter) bytes(field int, b []byte) {
+	w.tag(field, wireBytes)
+	w.rawVarint(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *protoWriter) string(field int, s string) {
+	w.bytes(field, []byte(s))
+}
+
+func (w *protoWriter) message(field int, m *protoWriter) {
+	w.bytes(field, m.buf.Bytes())
+}
+
+// packedInt64s writes a packed repeated int64 field
+func (w *protoWriter) packedInt64s(field int, values []int64) {
+	var packed protoWriter
+	for _, v := range values {
+		packed.rawVarint(uint64(v))
+	}
+	w.bytes(field, packed.buf.Bytes())
+}
+
+// protoField is a single field read from a
+// protocol buffer message
+type protoField struct {
+	Number int
+	Wire   int
+
+	// Varint holds the value of varint, fixed32
+	// and fixed64 fields
+	Varint uint64
+
+	// Bytes holds the value of length delimited
+	// fields
+	Bytes []byte
+}
+
+// parseProto splits a protocol buffer message into
+// its fields, in order
+func parseProto(data []byte) ([]protoField, error) {
+	var fields []protoField
+
+	for len(data) != 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("ERROR: invalid protobuf field key")
+		}
+		data = data[n:]
+
+		field := protoField{
+			Number: int(key >> 3),
+			Wire:   int(key & 7),
+		}
+
+		switch field.Wire {
+		case wireVarint:
+			field.Varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("ERROR: invalid protobuf varint in field %v", field.Number)
+			}
+			data = data[n:]
+
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, fmt.Errorf("ERROR: truncated protobuf fixed64 in field %v", field.Number)
+			}
+			field.Varint = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+
+		case wireFixed32:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("ERROR: truncated protobuf fixed32 in field %v", field.Number)
+			}
+			field.Varint = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return nil, fmt.Errorf("ERROR: truncated protobuf bytes in field %v", field.Number)
+			}
+			field.Bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+
+		default:
+			return nil, fmt.Errorf("ERROR: unsupported protobuf wire type %v in field %v", field.Wire, field.Number)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// int64s returns the values of a repeated int64
+// field, which can be either packed or not
+func (f protoField) int64s() ([]int64, error) {
+	if f.Wire == wireVarint {
+		return []int64{int64(f.Varint)}, nil
+	}
+	if f.Wire != wireBytes {
+		return nil, fmt.Errorf("ERROR: protobuf field %v is not a repeated int64", f.Number)
+	}
+
+	var values []int64
+	data := f.Bytes
+	for len(data) != 0 {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("ERROR: invalid packed protobuf varint in field %v", f.Number)
+		}
+		values = append(values, int64(v))
+		data = data[n:]
+	}
+
+	return values, nil
+}
+
+// float32s returns the values of a repeated float
+// field, which can be either packed or not
+func (f protoField) float32s() ([]float64, error) {
+	if f.Wire == wireFixed32 {
+		return []float64{float64(math.Float32frombits(uint32(f.Varint)))}, nil
+	}
+	if f.Wire != wireBytes || len(f.Bytes)%4 != 0 {
+		return nil, fmt.Errorf("ERROR: protobuf field %v is not a repeated float", f.Number)
+	}
+
+	return littleEndianFloats(f.Bytes, 4), nil
+}
+
+// float64s returns the values of a repeated double
+// field, which can be either packed or not
+func (f protoField) float64s() ([]float64, error) {
+	if f.Wire == wireFixed64 {
+		return []float64{math.Float64frombits(f.Varint)}, nil
+	}
+	if f.Wire != wireBytes || len(f.Bytes)%8 != 0 {
+		return nil, fmt.Errorf("ERROR: protobuf field %v is not a repeated double", f.Number)
+	}
+
+	return littleEndianFloats(f.Bytes, 8), nil
+}
+
+// littleEndianFloats decodes little-endian float32s
+// (size 4) or float64s (size 8)
+func littleEndianFloats(data []byte, size int) []float64 {
+	values := make([]float64, len(data)/size)
+	for i := range values {
+		if size == 4 {
+			values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:])))
+		} else {
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[i*8:]))
+		}
+	}
+
+	return values
+}
@@ -51,10 +51,8 @@ package linear
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math"
 	"os"
 
@@ -588,56 +586,134 @@ func (l *LeastSquares) Theta() []float64 {
 	return l.Parameters
 }
 
-// PersistToFile takes in an absolute filepath and saves the
-// parameter vector θ to the file, which can be restored later.
-// The function will take paths from the current directory, but
-// functions
-//
-// The data is stored as JSON because it's one of the most
-// efficient storage method (you only need one comma extra
-// per feature + two brackets, total!) And it's extendable.
-func (l *LeastSquares) PersistToFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+// linearHyperparameters holds the hyperparameters
+// of the gradient based linear models (LeastSquares
+// and Logistic) as saved in their envelopes
+type linearHyperparameters struct {
+	Alpha          float64                 `json:"alpha"`
+	Regularization float64                 `json:"regularization"`
+	MaxIterations  int                     `json:"max_iterations"`
+	Method         base.OptimizationMethod `json:"method"`
+}
+
+// leastSquaresType is the name LeastSquares models
+// are registered and persisted under
+const leastSquaresType = "linear.LeastSquares"
+
+func init() {
+	base.RegisterModel(leastSquaresType, func() base.Persistable {
+		return NewLeastSquares(base.BatchGA, 0, 0, 0, nil, nil)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// hyperparameters, wrapped in a base.Envelope. The data
+// of the envelope is the parameter vector θ.
+func (l *LeastSquares) MarshalEnvelope() (*base.Envelope, error) {
+	features := len(l.Parameters) - 1
+	if features < 0 {
+		features = 0
 	}
 
-	bytes, err := json.Marshal(l.Parameters)
+	env := &base.Envelope{
+		Type: leastSquaresType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+		Metadata: base.TrainingMetadata{
+			Examples: len(l.trainingSet),
+		},
+	}
+
+	err := env.Encode(linearHyperparameters{
+		Alpha:          l.alpha,
+		Regularization: l.regularization,
+		MaxIterations:  l.maxIterations,
+		Method:         l.method,
+	}, l.Parameters)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's parameter
+// vector θ, as well as the hyperparameters if they
+// were saved, from the given base.Envelope
+func (l *LeastSquares) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := linearHyperparameters{
+		Alpha:          l.alpha,
+		Regularization: l.regularization,
+		MaxIterations:  l.maxIterations,
+		Method:         l.method,
 	}
 
-	err = ioutil.WriteFile(path, bytes, os.ModePerm)
+	var params []float64
+	err := env.Decode(leastSquaresType, &hyper, &params)
 	if err != nil {
 		return err
 	}
 
+	l.alpha = hyper.Alpha
+	l.regularization = hyper.Regularization
+	l.maxIterations = hyper.MaxIterations
+	l.method = hyper.Method
+	l.Parameters = params
+
 	return nil
 }
 
-// RestoreFromFile takes in a path to a parameter vector theta
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later. The
+// function will take paths from the current directory, but
+// functions
+//
+// The model is stored as a JSON base.Envelope holding the
+// parameter vector θ as well as the hyperparameters of the
+// model (learning rate, regularization, etc.) so a restored
+// model can keep on training.
+func (l *LeastSquares) PersistToFile(path string) error {
+	return base.PersistModel(path, l)
+}
+
+// RestoreFromFile takes in a path to a persisted model
 // and assigns the model it's operating on's parameter vector
-// to that.
+// and hyperparameters to those persisted.
 //
 // The path must ba an absolute path or a path from the current
 // directory
 //
+// Files holding only the parameter vector θ (as persisted by
+// older versions of goml) can also be restored.
+//
 // This would be useful in persisting data between running
 // a model on data, or for graphing a dataset with a fit in
 // another framework like Julia/Gadfly.
 func (l *LeastSquares) RestoreFromFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
-	}
+	return base.RestoreModel(path, l)
+}
 
-	bytes, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
-	}
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (l *LeastSquares) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, l)
+}
 
-	err = json.Unmarshal(bytes, &l.Parameters)
-	if err != nil {
-		return err
-	}
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (l *LeastSquares) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, l)
+}
 
-	return nil
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (l *LeastSquares) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(l)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (l *LeastSquares) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, l)
 }
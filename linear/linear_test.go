@@ -610,3 +610,33 @@ func TestPersistLeastSquaresShouldPass1(t *testing.T) {
 		assert.Nil(t, err, "Prediction error should be nil")
 	}
 }
+
+// test that the hyperparameters are persisted and that
+// base.Load returns a LeastSquares model
+func TestLoadLeastSquaresShouldPass1(t *testing.T) {
+	var err error
+
+	model := NewLeastSquares(base.StochasticGA, 1e-9, 6, 75, noisyX, noisyY)
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	err = model.PersistToFile("/tmp/.goml/LeastSquaresEnvelope.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/LeastSquaresEnvelope.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*LeastSquares)
+	assert.True(t, ok, "Loaded model should be a *LeastSquares")
+	assert.Equal(t, model.Parameters, restored.Parameters, "Parameters should be restored")
+	assert.Equal(t, 1e-9, restored.alpha, "Learning rate should be restored")
+	assert.Equal(t, 6.0, restored.regularization, "Regularization should be restored")
+	assert.Equal(t, 75, restored.maxIterations, "Max iterations should be restored")
+	assert.EqualValues(t, base.StochasticGA, restored.method, "Optimization method should be restored")
+
+	// a LeastSquares file can't be restored into
+	// another type of model
+	logistic := NewLogistic(base.BatchGA, 1e-4, 0, 0, nil, nil, 1)
+	err = logistic.RestoreFromFile("/tmp/.goml/LeastSquaresEnvelope.json")
+	assert.NotNil(t, err, "Restoring a LeastSquares model into a Logistic model should return an error")
+}
@@ -1,6 +1,7 @@
 package linear
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"os"
@@ -868,3 +869,31 @@ func TestPersistLogisticShouldPass1(t *testing.T) {
 		}
 	}
 }
+
+// test persisting to an io.Writer and restoring
+// from an io.Reader and from bytes
+func TestWriteToLogisticShouldPass1(t *testing.T) {
+	model := NewLogistic(base.StochasticGA, 1e-4, 2, 100, nil, nil, 3)
+	model.Parameters = []float64{0.5, -1, 2, 3}
+
+	var buf bytes.Buffer
+	n, err := model.WriteTo(&buf)
+	assert.Nil(t, err, "Write error should be nil")
+	assert.EqualValues(t, buf.Len(), n, "Written byte count should match the buffer length")
+
+	restored := NewLogistic(base.BatchGA, 0, 0, 0, nil, nil, 3)
+	_, err = restored.ReadFrom(&buf)
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, model.Parameters, restored.Parameters, "Parameters should be restored")
+	assert.Equal(t, 1e-4, restored.alpha, "Learning rate should be restored")
+	assert.EqualValues(t, base.StochasticGA, restored.method, "Optimization method should be restored")
+
+	data, err := model.MarshalBinary()
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	restored = NewLogistic(base.BatchGA, 0, 0, 0, nil, nil, 3)
+	assert.Nil(t, restored.UnmarshalBinary(data), "Unmarshal error should be nil")
+	assert.Equal(t, model.Parameters, restored.Parameters, "Parameters should be restored")
+
+	assert.NotNil(t, restored.UnmarshalBinary([]byte("{garbage")), "Unmarshalling garbage should return an error")
+}
@@ -2,10 +2,8 @@ package linear
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math"
 	"os"
 
@@ -660,56 +658,146 @@ func (s *Softmax) Theta() [][]float64 {
 	return s.Parameters
 }
 
-// PersistToFile takes in an absolute filepath and saves the
-// parameter vector θ to the file, which can be restored later.
-// The function will take paths from the current directory, but
-// functions
-//
-// The data is stored as JSON because it's one of the most
-// efficient storage method (you only need one comma extra
-// per feature + two brackets, total!) And it's extendable.
-func (s *Softmax) PersistToFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
-	}
+// softmaxHyperparameters holds the hyperparameters
+// of a Softmax model as saved in its envelope
+type softmaxHyperparameters struct {
+	Alpha          float64                 `json:"alpha"`
+	Regularization float64                 `json:"regularization"`
+	MaxIterations  int                     `json:"max_iterations"`
+	Method         base.OptimizationMethod `json:"method"`
+	K              int                     `json:"k"`
+}
+
+// softmaxType is the name Softmax models are
+// registered and persisted under
+const softmaxType = "linear.Softmax"
 
-	bytes, err := json.Marshal(s.Parameters)
+func init() {
+	base.RegisterModel(softmaxType, func() base.Persistable {
+		return NewSoftmax(base.BatchGA, 0, 0, 0, 0, nil, nil)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// hyperparameters, wrapped in a base.Envelope. The data
+// of the envelope is the parameter matrix θ.
+func (s *Softmax) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(s.Parameters) != 0 && len(s.Parameters[0]) != 0 {
+		features = len(s.Parameters[0]) - 1
+	}
+
+	env := &base.Envelope{
+		Type: softmaxType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+		Metadata: base.TrainingMetadata{
+			Examples: len(s.trainingSet),
+		},
+	}
+
+	err := env.Encode(softmaxHyperparameters{
+		Alpha:          s.alpha,
+		Regularization: s.regularization,
+		MaxIterations:  s.maxIterations,
+		Method:         s.method,
+		K:              s.k,
+	}, s.Parameters)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = ioutil.WriteFile(path, bytes, os.ModePerm)
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's parameter
+// matrix θ, as well as the hyperparameters if they
+// were saved, from the given base.Envelope
+func (s *Softmax) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := softmaxHyperparameters{
+		Alpha:          s.alpha,
+		Regularization: s.regularization,
+		MaxIterations:  s.maxIterations,
+		Method:         s.method,
+		K:              s.k,
+	}
+
+	var params [][]float64
+	err := env.Decode(softmaxType, &hyper, &params)
 	if err != nil {
 		return err
 	}
 
+	// legacy files don't record k, but it's
+	// always the number of parameter vectors
+	if env.Legacy() {
+		hyper.K = len(params)
+	}
+	if hyper.K != len(params) {
+		return fmt.Errorf("ERROR: Softmax envelope has %v parameter vectors but k = %v", len(params), hyper.K)
+	}
+
+	s.alpha = hyper.Alpha
+	s.regularization = hyper.Regularization
+	s.maxIterations = hyper.MaxIterations
+	s.method = hyper.Method
+	s.k = hyper.K
+	s.Parameters = params
+
 	return nil
 }
 
-// RestoreFromFile takes in a path to a parameter vector theta
-// and assigns the model it's operating on's parameter vector
-// to that.
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later. The
+// function will take paths from the current directory, but
+// functions
+//
+// The model is stored as a JSON base.Envelope holding the
+// parameter matrix θ as well as the hyperparameters of the
+// model (learning rate, regularization, k, etc.) so a restored
+// model can keep on training.
+func (s *Softmax) PersistToFile(path string) error {
+	return base.PersistModel(path, s)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and assigns the model it's operating on's parameter matrix
+// and hyperparameters to those persisted.
 //
 // The path must ba an absolute path or a path from the current
 // directory
 //
+// Files holding only the parameter matrix θ (as persisted by
+// older versions of goml) can also be restored.
+//
 // This would be useful in persisting data between running
 // a model on data, or for graphing a dataset with a fit in
 // another framework like Julia/Gadfly.
 func (s *Softmax) RestoreFromFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
-	}
+	return base.RestoreModel(path, s)
+}
 
-	bytes, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
-	}
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (s *Softmax) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, s)
+}
 
-	err = json.Unmarshal(bytes, &s.Parameters)
-	if err != nil {
-		return err
-	}
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (s *Softmax) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, s)
+}
 
-	return nil
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (s *Softmax) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(s)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (s *Softmax) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, s)
 }
@@ -989,3 +989,54 @@ func TestPersistSoftmaxShouldPass1(t *testing.T) {
 	fmt.Printf("Predictions: %v\n\tIncorrect: %v\n\tAccuracy Rate: %v percent\n", count, incorrect, 100*(1.0-float64(incorrect)/float64(count)))
 	assert.True(t, float64(incorrect)/float64(count) < 0.14, "Accuracy should be greater than 86%")
 }
+
+// test that the hyperparameters (including k) are
+// persisted and that base.Load returns a Softmax model
+func TestLoadSoftmaxShouldPass1(t *testing.T) {
+	model := NewSoftmax(base.BatchGA, 1e-5, 3, 3, 15, nil, nil, 2)
+	model.Parameters[1][2] = 4.2
+
+	err := model.PersistToFile("/tmp/.goml/SoftmaxEnvelope.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/SoftmaxEnvelope.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*Softmax)
+	assert.True(t, ok, "Loaded model should be a *Softmax")
+	assert.Equal(t, model.Parameters, restored.Parameters, "Parameters should be restored")
+	assert.Equal(t, 3, restored.k, "k should be restored")
+	assert.Equal(t, 1e-5, restored.alpha, "Learning rate should be restored")
+	assert.Equal(t, 3.0, restored.regularization, "Regularization should be restored")
+	assert.Equal(t, 15, restored.maxIterations, "Max iterations should be restored")
+
+	guess, err := restored.Predict([]float64{1, 1})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Len(t, guess, 3, "Guess should have one probability per class")
+}
+
+func TestCompactSoftmaxShouldPass1(t *testing.T) {
+	model := NewSoftmax(base.BatchGA, 1e-5, 3, 4, 15, nil, nil, 5)
+	for i := range model.Parameters {
+		for j := range model.Parameters[i] {
+			model.Parameters[i][j] = float64(i*7-j) / 3
+		}
+	}
+
+	err := base.PersistModelCompact("/tmp/.goml/SoftmaxCompact.goml", model, base.CompactOptions{
+		Float32:  true,
+		Compress: true,
+	})
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	restored := NewSoftmax(base.BatchGA, 1, 0, 4, 1, nil, nil, 5)
+	err = restored.RestoreFromFile("/tmp/.goml/SoftmaxCompact.goml")
+	assert.Nil(t, err, "Restore error should be nil")
+	assert.Equal(t, 1e-5, restored.alpha, "Learning rate should be restored")
+
+	for i := range model.Parameters {
+		for j := range model.Parameters[i] {
+			assert.InDelta(t, model.Parameters[i][j], restored.Parameters[i][j], 1e-5, "Parameters should be restored within float32 precision")
+		}
+	}
+}
@@ -0,0 +1,662 @@
+package perceptron
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+
+	"github.com/admpub/goml/base"
+)
+
+// BudgetPolicy is the way a BudgetKernelPerceptron
+// keeps its number of support vectors within its
+// budget
+type BudgetPolicy string
+
+// Budget policies you can use with a
+// BudgetKernelPerceptron
+const (
+	// Forgetron removes the oldest support vector
+	// whenever the budget is exceeded, after shrinking
+	// the weight of every support vector so the removed
+	// one matters as little as possible. This is the
+	// self-tuned Forgetron of Dekel, Shalev-Shwartz and
+	// Singer.
+	//
+	// http://www.cs.huji.ac.il/~shais/papers/DekelShSi07.pdf
+	Forgetron BudgetPolicy = "forgetron"
+
+	// RandomBudget removes a support vector chosen
+	// uniformly at random whenever the budget is
+	// exceeded (the Randomized Budget Perceptron of
+	// Cavallanti, Cesa-Bianchi and Gentile.)
+	RandomBudget BudgetPolicy = "random"
+
+	// Projectron doesn't remove support vectors, but
+	// projects (merges) new mistakes onto the span of
+	// the current support vectors, updating their
+	// weights instead of adding a new one. New support
+	// vectors are only added while the budget isn't
+	// full and the projection error is greater than
+	// the projection threshold (see UpdateThreshold.)
+	// This is the Projectron of Orabona, Keshet and
+	// Caputo.
+	//
+	// http://www.jmlr.org/papers/volume10/orabona09a/orabona09a.pdf
+	Projectron BudgetPolicy = "projectron"
+)
+
+// BudgetKernelPerceptron is a KernelPerceptron with a
+// maximum number of support vectors (its budget.) The
+// regular KernelPerceptron adds a support vector for
+// every mistake forever, so on a long running stream
+// both memory use and prediction time grow without
+// bound. The BudgetKernelPerceptron keeps both bounded
+// using one of the policies above.
+//
+// Because the Forgetron and Projectron policies change
+// the weight of support vectors, each support vector
+// has its own weight, and the hypothesis is:
+//      sgn(Σ w[i] * K(x[i], x))
+//
+// Learning works the same as with the KernelPerceptron,
+// using OnlineLearn on a channel of datapoints whose
+// results are either -1 or 1.
+type BudgetKernelPerceptron struct {
+	// SV stores the model's support vectors and
+	// Weights the (signed) weight of each one
+	SV      []base.Datapoint `json:"support_vectors,omitempty"`
+	Weights []float64        `json:"weights,omitempty"`
+
+	Kernel func([]float64, []float64) float64
+
+	// KernelSpec describes the kernel of the model
+	// when one was given with UpdateKernel or
+	// NewBudgetKernelPerceptronFromSpec, so a restored
+	// model can rebuild its kernel
+	KernelSpec *base.KernelSpec `json:"kernel,omitempty"`
+
+	// rng is the model's source of randomness for
+	// picking the support vectors to remove under
+	// the random budget policy. It's seeded from the
+	// current time unless the model is given a seed
+	// with UpdateSeed.
+	rng *rand.Rand
+
+	// Output is the io.Writer used for logging
+	// and printing. Defaults to os.Stdout.
+	Output io.Writer
+
+	budget    int
+	policy    BudgetPolicy
+	threshold float64
+
+	// mistakes and forgotten (Q) are the state of
+	// the self-tuned Forgetron
+	mistakes  int
+	forgotten float64
+
+	// inverse is the inverse of the Gram matrix of
+	// the support vectors, used by the Projectron
+	inverse [][]float64
+}
+
+// NewBudgetKernelPerceptron takes in a kernel, the
+// maximum number of support vectors the model keeps
+// and the policy used to keep them within the budget
+// and returns a new model. An empty policy defaults to
+// Forgetron.
+func NewBudgetKernelPerceptron(kernel func([]float64, []float64) float64, budget int, policy BudgetPolicy) *BudgetKernelPerceptron {
+	if policy == "" {
+		policy = Forgetron
+	}
+
+	return &BudgetKernelPerceptron{
+		Kernel: kernel,
+		rng:    base.NewTimeSeededRandom(),
+		Output: os.Stdout,
+
+		budget: budget,
+		policy: policy,
+	}
+}
+
+// UpdateSeed seeds the model's source of randomness
+// so learning is reproducible
+func (p *BudgetKernelPerceptron) UpdateSeed(seed int64) {
+	p.rng = base.NewRandom(seed)
+}
+
+// UpdateRandom replaces the model's source of
+// randomness
+func (p *BudgetKernelPerceptron) UpdateRandom(rng *rand.Rand) {
+	p.rng = rng
+}
+
+// NewBudgetKernelPerceptronFromSpec returns a new model
+// using the kernel described by the given spec, which is
+// persisted along with the model
+func NewBudgetKernelPerceptronFromSpec(spec base.KernelSpec, budget int, policy BudgetPolicy) (*BudgetKernelPerceptron, error) {
+	kernel, err := spec.Kernel()
+	if err != nil {
+		return nil, err
+	}
+
+	model := NewBudgetKernelPerceptron(kernel, budget, policy)
+	model.KernelSpec = &spec
+
+	return model, nil
+}
+
+// UpdateKernel sets the kernel of the model to the one
+// described by the given spec
+func (p *BudgetKernelPerceptron) UpdateKernel(spec base.KernelSpec) error {
+	kernel, err := spec.Kernel()
+	if err != nil {
+		return err
+	}
+
+	p.Kernel = kernel
+	p.KernelSpec = &spec
+	p.inverse = nil
+
+	return nil
+}
+
+// UpdateBudget sets the maximum number of support
+// vectors of the model. If the model already has
+// more, the extra ones are removed on the next
+// mistake.
+func (p *BudgetKernelPerceptron) UpdateBudget(budget int) {
+	p.budget = budget
+}
+
+// UpdateThreshold sets the projection threshold (η) of
+// the Projectron policy. A mistake whose projection
+// error onto the current support vectors is at most η
+// is merged into them instead of being added as a new
+// support vector, even when the budget isn't full. The
+// default of 0 only merges mistakes that the support
+// vectors can represent exactly.
+func (p *BudgetKernelPerceptron) UpdateThreshold(threshold float64) {
+	p.threshold = threshold
+}
+
+// Budget returns the maximum number of support
+// vectors of the model
+func (p *BudgetKernelPerceptron) Budget() int {
+	return p.budget
+}
+
+// Policy returns the policy the model uses to
+// stay within its budget
+func (p *BudgetKernelPerceptron) Policy() BudgetPolicy {
+	return p.policy
+}
+
+// score returns Σ w[i] * K(x[i], x)
+func (p *BudgetKernelPerceptron) score(x []float64) float64 {
+	var sum float64
+	for i := range p.SV {
+		sum += p.Weights[i] * p.Kernel(p.SV[i].X, x)
+	}
+
+	return sum
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// finds the value of the hypothesis function given the
+// current support vectors and their weights
+func (p *BudgetKernelPerceptron) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if p.Kernel == nil {
+		return nil, fmt.Errorf("ERROR: BudgetKernelPerceptron has no kernel! If you restored the model, it was persisted without a KernelSpec so you need to set the Kernel again")
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	result := -1.0
+	if p.score(x) > 0 {
+		result = 1
+	}
+
+	return []float64{result}, nil
+}
+
+// OnlineLearn runs off of the given datastream exactly
+// like KernelPerceptron.OnlineLearn, except that the
+// number of support vectors never exceeds the budget
+// of the model. onUpdate is called (in a new goroutine)
+// with the misclassified point, with its result appended,
+// whenever the model makes a mistake and updates.
+//
+// The errors channel will be closed when learning is
+// completed. If the model has no kernel, an invalid
+// budget (less than 1) or an unknown policy an error
+// is sent and learning stops immediately.
+func (p *BudgetKernelPerceptron) OnlineLearn(errors chan error, dataset chan base.Datapoint, onUpdate func([][]float64), normalize ...bool) {
+	if errors == nil {
+		errors = make(chan error)
+	}
+	if dataset == nil {
+		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
+		close(errors)
+		return
+	}
+	if p.Kernel == nil {
+		errors <- fmt.Errorf("ERROR: Attempting to learn without a kernel!\n")
+		close(errors)
+		return
+	}
+	if p.budget < 1 {
+		errors <- fmt.Errorf("ERROR: The budget of a BudgetKernelPerceptron must be at least 1 - given %v\n", p.budget)
+		close(errors)
+		return
+	}
+	if p.policy != Forgetron && p.policy != RandomBudget && p.policy != Projectron {
+		errors <- fmt.Errorf("ERROR: Unknown budget policy %q\n", p.policy)
+		close(errors)
+		return
+	}
+
+	fmt.Fprintf(p.Output, "Training:\n\tModel: Budget Kernel Perceptron Classifier\n\tOptimization Method: Online Kernel Perceptron (%v)\n\tBudget: %v\n...\n\n", p.policy, p.budget)
+
+	norm := len(normalize) != 0 && normalize[0]
+
+	var point base.Datapoint
+	var more bool
+
+	for {
+		point, more = <-dataset
+
+		if more {
+			if norm {
+				base.NormalizePoint(point.X)
+			}
+
+			if len(point.Y) != 1 {
+				errors <- fmt.Errorf("The binary perceptron model requires that the data results (y) have length 1 - given %v", len(point.Y))
+				continue
+			}
+
+			if len(p.SV) != 0 && len(point.X) != len(p.SV[0].X) {
+				errors <- fmt.Errorf("The budget kernel perceptron requires that the length of input data (currently %v) match the length of its support vectors (%v)", len(point.X), len(p.SV[0].X))
+				continue
+			}
+
+			score := p.score(point.X)
+			guess := -1.0
+			if score > 0 {
+				guess = 1
+			}
+
+			// update the support vectors if the
+			// guess is wrong
+			if guess != point.Y[0] {
+				p.update(point)
+
+				// call the OnUpdate callback with the point
+				// appended to a blank slice so the vector is
+				// passed by value and not by reference
+				go onUpdate([][]float64{append(append([]float64{}, point.X...), point.Y...)})
+			}
+
+		} else {
+			fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+			close(errors)
+			return
+		}
+	}
+}
+
+// update adds the misclassified point to the model
+// according to the model's policy
+func (p *BudgetKernelPerceptron) update(point base.Datapoint) {
+	p.mistakes++
+
+	switch p.policy {
+	case Projectron:
+		p.project(point)
+		return
+
+	case RandomBudget:
+		for len(p.SV) >= p.budget {
+			p.remove(p.rng.Intn(len(p.SV)))
+		}
+		p.add(point, point.Y[0])
+
+	case Forgetron:
+		p.add(point, point.Y[0])
+		for len(p.SV) > p.budget {
+			p.forget()
+		}
+	}
+}
+
+// add appends a support vector with the given weight
+func (p *BudgetKernelPerceptron) add(point base.Datapoint, weight float64) {
+	p.SV = append(p.SV, point)
+	p.Weights = append(p.Weights, weight)
+}
+
+// remove removes the i-th support vector
+func (p *BudgetKernelPerceptron) remove(i int) {
+	p.SV = append(p.SV[:i], p.SV[i+1:]...)
+	p.Weights = append(p.Weights[:i], p.Weights[i+1:]...)
+}
+
+// forget shrinks every weight and removes the oldest
+// support vector, as in the self-tuned Forgetron. The
+// shrinking coefficient φ is the largest one (at most 1)
+// keeping the total damage done by removals (Q) within
+// 15/32 of the number of mistakes, which is what keeps
+// the Forgetron's mistake bound.
+func (p *BudgetKernelPerceptron) forget() {
+	// σ is the weight of the oldest support vector
+	// (without its sign) and μ its margin under the
+	// current hypothesis
+	sigma := p.Weights[0] * p.SV[0].Y[0]
+	mu := p.SV[0].Y[0] * p.score(p.SV[0].X)
+
+	// damage done by shrinking with φ and then
+	// removing the oldest support vector
+	damage := func(phi float64) float64 {
+		return phi*phi*sigma*sigma + 2*phi*sigma - 2*phi*phi*sigma*mu
+	}
+
+	limit := 15.0 / 32 * float64(p.mistakes)
+
+	phi := 1.0
+	if p.forgotten+damage(phi) > limit {
+		// the damage is 0 at φ = 0 and Q is within
+		// the limit, so there's a crossing in (0, 1)
+		low, high := 0.0, 1.0
+		for iter := 0; iter < 50; iter++ {
+			mid := (low + high) / 2
+			if p.forgotten+damage(mid) <= limit {
+				low = mid
+			} else {
+				high = mid
+			}
+		}
+		phi = low
+	}
+
+	p.forgotten += damage(phi)
+
+	for i := range p.Weights {
+		p.Weights[i] *= phi
+	}
+
+	p.remove(0)
+}
+
+// project merges the misclassified point into the
+// current support vectors if it's close enough to
+// their span (or the budget is full,) and adds it as
+// a new support vector otherwise
+func (p *BudgetKernelPerceptron) project(point base.Datapoint) {
+	if len(p.SV) > p.budget {
+		// the budget was lowered, so fall back to
+		// forgetting the oldest support vectors
+		for len(p.SV) > p.budget {
+			p.remove(0)
+		}
+		p.inverse = nil
+	}
+	if p.inverse == nil {
+		p.rebuildInverse()
+	}
+
+	// d = K⁻¹k is the projection of the point onto
+	// the span of the support vectors, and δ² the
+	// squared distance between the point and it (in
+	// the feature space of the kernel)
+	k := make([]float64, len(p.SV))
+	for i := range p.SV {
+		k[i] = p.Kernel(p.SV[i].X, point.X)
+	}
+	d := make([]float64, len(p.SV))
+	for i := range p.inverse {
+		for j := range k {
+			d[i] += p.inverse[i][j] * k[j]
+		}
+	}
+
+	delta := p.Kernel(point.X, point.X)
+	for i := range k {
+		delta -= k[i] * d[i]
+	}
+
+	if len(p.SV) != 0 && (delta <= p.threshold || len(p.SV) >= p.budget) {
+		for i := range p.Weights {
+			p.Weights[i] += point.Y[0] * d[i]
+		}
+		return
+	}
+
+	if delta <= 1e-12 {
+		// the point is (numerically) in the span of
+		// the support vectors, which is only possible
+		// here when there are none and K(x, x) is 0
+		return
+	}
+
+	p.extendInverse(d, delta)
+	p.add(point, point.Y[0])
+}
+
+// extendInverse updates the inverse Gram matrix for a
+// new support vector whose projection is d and whose
+// projection error is δ², using the block inverse
+//
+//     [ K⁻¹ + ddᵀ/δ²   -d/δ² ]
+//     [ -dᵀ/δ²          1/δ² ]
+func (p *BudgetKernelPerceptron) extendInverse(d []float64, delta float64) {
+	n := len(d)
+
+	inverse := make([][]float64, n+1)
+	for i := range inverse {
+		inverse[i] = make([]float64, n+1)
+	}
+
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			inverse[i][j] = p.inverse[i][j] + d[i]*d[j]/delta
+		}
+		inverse[i][n] = -d[i] / delta
+		inverse[n][i] = -d[i] / delta
+	}
+	inverse[n][n] = 1 / delta
+
+	p.inverse = inverse
+}
+
+// rebuildInverse computes the inverse Gram matrix of
+// the support vectors (after restoring the model, for
+// example) by adding them back one at a time. Support
+// vectors which are in the span of the previous ones
+// are merged into them.
+func (p *BudgetKernelPerceptron) rebuildInverse() {
+	sv, weights := p.SV, p.Weights
+
+	p.SV, p.Weights = nil, nil
+	p.inverse = [][]float64{}
+
+	for s := range sv {
+		k := make([]float64, len(p.SV))
+		for i := range p.SV {
+			k[i] = p.Kernel(p.SV[i].X, sv[s].X)
+		}
+		d := make([]float64, len(p.SV))
+		for i := range p.inverse {
+			for j := range k {
+				d[i] += p.inverse[i][j] * k[j]
+			}
+		}
+
+		delta := p.Kernel(sv[s].X, sv[s].X)
+		for i := range k {
+			delta -= k[i] * d[i]
+		}
+
+		if delta <= 1e-12 {
+			for i := range p.Weights {
+				p.Weights[i] += weights[s] * d[i]
+			}
+			continue
+		}
+
+		p.extendInverse(d, delta)
+		p.add(sv[s], weights[s])
+	}
+}
+
+// String implements the fmt interface for clean printing
+func (p *BudgetKernelPerceptron) String() string {
+	return fmt.Sprintf("h(θ,x) = Σ w[i]*K(x[i], x`) > 0 ? 1 : -1\n\tTotal Support Vectors: %v\n\tBudget: %v (%v)\n", len(p.SV), p.budget, p.policy)
+}
+
+// budgetKernelPerceptronHyperparameters holds the
+// hyperparameters of a BudgetKernelPerceptron as
+// saved in its envelope
+type budgetKernelPerceptronHyperparameters struct {
+	Kernel    *base.KernelSpec `json:"kernel,omitempty"`
+	Budget    int              `json:"budget"`
+	Policy    BudgetPolicy     `json:"policy"`
+	Threshold float64          `json:"threshold,omitempty"`
+}
+
+// budgetKernelPerceptronData is the data of a
+// BudgetKernelPerceptron envelope, including the
+// state needed to keep on learning
+type budgetKernelPerceptronData struct {
+	SV        []base.Datapoint `json:"support_vectors"`
+	Weights   []float64        `json:"weights"`
+	Mistakes  int              `json:"mistakes,omitempty"`
+	Forgotten float64          `json:"forgotten,omitempty"`
+}
+
+// budgetKernelPerceptronType is the name
+// BudgetKernelPerceptron models are registered
+// and persisted under
+const budgetKernelPerceptronType = "perceptron.BudgetKernelPerceptron"
+
+func init() {
+	base.RegisterModel(budgetKernelPerceptronType, func() base.Persistable {
+		return NewBudgetKernelPerceptron(nil, 0, "")
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// budget, policy and the spec of its kernel, wrapped
+// in a base.Envelope. The data of the envelope is the
+// weighted support vectors of the model.
+func (p *BudgetKernelPerceptron) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(p.SV) != 0 {
+		features = len(p.SV[0].X)
+	}
+
+	env := &base.Envelope{
+		Type: budgetKernelPerceptronType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+	}
+
+	err := env.Encode(budgetKernelPerceptronHyperparameters{
+		Kernel:    p.KernelSpec,
+		Budget:    p.budget,
+		Policy:    p.policy,
+		Threshold: p.threshold,
+	}, budgetKernelPerceptronData{
+		SV:        p.SV,
+		Weights:   p.Weights,
+		Mistakes:  p.mistakes,
+		Forgotten: p.forgotten,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model from the given
+// base.Envelope. If the kernel spec was saved, the
+// kernel is rebuilt from it. Otherwise the current
+// kernel is kept.
+func (p *BudgetKernelPerceptron) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := budgetKernelPerceptronHyperparameters{
+		Budget:    p.budget,
+		Policy:    p.policy,
+		Threshold: p.threshold,
+	}
+
+	var data budgetKernelPerceptronData
+	err := env.Decode(budgetKernelPerceptronType, &hyper, &data)
+	if err != nil {
+		return err
+	}
+
+	if len(data.SV) != len(data.Weights) {
+		return fmt.Errorf("ERROR: BudgetKernelPerceptron has %v support vectors but %v weights", len(data.SV), len(data.Weights))
+	}
+
+	if hyper.Kernel != nil {
+		err = p.UpdateKernel(*hyper.Kernel)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.budget = hyper.Budget
+	p.policy = hyper.Policy
+	p.threshold = hyper.Threshold
+	p.SV = data.SV
+	p.Weights = data.Weights
+	p.mistakes = data.Mistakes
+	p.forgotten = data.Forgotten
+	p.inverse = nil
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later.
+func (p *BudgetKernelPerceptron) PersistToFile(path string) error {
+	return base.PersistModel(path, p)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores the model from it.
+func (p *BudgetKernelPerceptron) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, p)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (p *BudgetKernelPerceptron) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, p)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (p *BudgetKernelPerceptron) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, p)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (p *BudgetKernelPerceptron) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(p)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (p *BudgetKernelPerceptron) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, p)
+}
@@ -0,0 +1,182 @@
+package perceptron
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// circle returns a point in [-2, 2]² labeled 1 if
+// it's within the unit circle and -1 otherwise
+func circle(r *rand.Rand) base.Datapoint {
+	x := []float64{r.Float64()*4 - 2, r.Float64()*4 - 2}
+
+	y := -1.0
+	if x[0]*x[0]+x[1]*x[1] < 1 {
+		y = 1
+	}
+
+	return base.Datapoint{
+		X: x,
+		Y: []float64{y},
+	}
+}
+
+func TestBudgetKernelPerceptronShouldPass1(t *testing.T) {
+	for _, policy := range []BudgetPolicy{Forgetron, RandomBudget, Projectron} {
+		r := rand.New(rand.NewSource(7))
+
+		stream := make(chan base.Datapoint, 100)
+		errors := make(chan error)
+
+		model := NewBudgetKernelPerceptron(base.GaussianKernel(0.5), 40, policy)
+		assert.Equal(t, policy, model.Policy(), "Model should use the given policy")
+		assert.Equal(t, 40, model.Budget(), "Model should have the given budget")
+
+		go model.OnlineLearn(errors, stream, func(supportVector [][]float64) {})
+
+		go func() {
+			for i := 0; i < 3000; i++ {
+				stream <- circle(r)
+			}
+
+			close(stream)
+		}()
+
+		err, more := <-errors
+		assert.Nil(t, err, "Learning error should be nil")
+		assert.False(t, more, "There should be no errors returned")
+
+		assert.True(t, len(model.SV) <= 40, "%v model should stay within its budget - has %v support vectors", policy, len(model.SV))
+		assert.Equal(t, len(model.SV), len(model.Weights), "Every support vector should have a weight")
+
+		var mistakes int
+		for i := 0; i < 500; i++ {
+			point := circle(r)
+
+			guess, err := model.Predict(point.X)
+			assert.Nil(t, err, "Prediction error should be nil")
+			if guess[0] != point.Y[0] {
+				mistakes++
+			}
+		}
+
+		assert.True(t, mistakes < 100, "%v model should mostly separate the circle - made %v mistakes out of 500", policy, mistakes)
+	}
+}
+
+func TestBudgetKernelPerceptronXORShouldPass1(t *testing.T) {
+	for _, policy := range []BudgetPolicy{Forgetron, RandomBudget, Projectron} {
+		stream := make(chan base.Datapoint, 100)
+		errors := make(chan error)
+
+		model := NewBudgetKernelPerceptron(base.GaussianKernel(1), 4, policy)
+
+		go model.OnlineLearn(errors, stream, func(supportVector [][]float64) {})
+
+		go func() {
+			for i := 0; i < 10; i++ {
+				stream <- base.Datapoint{X: []float64{0, 0}, Y: []float64{-1}}
+				stream <- base.Datapoint{X: []float64{0, 1}, Y: []float64{1}}
+				stream <- base.Datapoint{X: []float64{1, 0}, Y: []float64{1}}
+				stream <- base.Datapoint{X: []float64{1, 1}, Y: []float64{-1}}
+			}
+
+			close(stream)
+		}()
+
+		err, more := <-errors
+		assert.Nil(t, err, "Learning error should be nil")
+		assert.False(t, more, "There should be no errors returned")
+		assert.True(t, len(model.SV) <= 4, "Model should stay within its budget")
+
+		for i := 0; i < 2; i++ {
+			for j := 0; j < 2; j++ {
+				guess, err := model.Predict([]float64{float64(i), float64(j)})
+				assert.Nil(t, err, "Prediction error should be nil")
+
+				expected := 1.0
+				if i^j == 0 {
+					expected = -1.0
+				}
+				assert.Equal(t, expected, guess[0], "%v model should learn i^j (%v^%v = %v)", policy, i, j, i^j)
+			}
+		}
+	}
+}
+
+func TestBudgetKernelPerceptronShouldFail1(t *testing.T) {
+	invalid := []*BudgetKernelPerceptron{
+		NewBudgetKernelPerceptron(nil, 10, Forgetron),
+		NewBudgetKernelPerceptron(base.GaussianKernel(1), 0, Forgetron),
+		NewBudgetKernelPerceptron(base.GaussianKernel(1), 10, BudgetPolicy("lru")),
+	}
+
+	for _, model := range invalid {
+		stream := make(chan base.Datapoint, 1)
+		errors := make(chan error, 1)
+
+		go model.OnlineLearn(errors, stream, func(supportVector [][]float64) {})
+
+		err := <-errors
+		assert.NotNil(t, err, "Learning with an invalid model should return an error")
+
+		_, more := <-errors
+		assert.False(t, more, "Errors channel should be closed")
+	}
+
+	_, err := NewBudgetKernelPerceptron(nil, 10, Forgetron).Predict([]float64{1})
+	assert.NotNil(t, err, "Predicting without a kernel should return an error")
+}
+
+func TestLoadBudgetKernelPerceptronShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+
+	model, err := NewBudgetKernelPerceptronFromSpec(base.GaussianKernelSpec(0.5), 15, Projectron)
+	assert.Nil(t, err, "Creating the model should not return an error")
+	model.UpdateThreshold(0.1)
+
+	stream := make(chan base.Datapoint, 100)
+	errors := make(chan error)
+
+	go model.OnlineLearn(errors, stream, func(supportVector [][]float64) {})
+
+	go func() {
+		for i := 0; i < 500; i++ {
+			stream <- circle(r)
+		}
+
+		close(stream)
+	}()
+
+	err, more := <-errors
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.False(t, more, "There should be no errors returned")
+
+	err = model.PersistToFile("/tmp/.goml/BudgetKernelPerceptron.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/BudgetKernelPerceptron.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*BudgetKernelPerceptron)
+	assert.True(t, ok, "Loaded model should be a *BudgetKernelPerceptron")
+	assert.Equal(t, 15, restored.Budget(), "Budget should be restored")
+	assert.Equal(t, Projectron, restored.Policy(), "Policy should be restored")
+	assert.Equal(t, 0.1, restored.threshold, "Threshold should be restored")
+	assert.Equal(t, model.Weights, restored.Weights, "Weights should be restored")
+
+	for i := 0; i < 100; i++ {
+		point := circle(r)
+
+		expected, err := model.Predict(point.X)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		guess, err := restored.Predict(point.X)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, guess, "Restored model should predict the same")
+	}
+}
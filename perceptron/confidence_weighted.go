@@ -0,0 +1,475 @@
+package perceptron
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/admpub/goml/base"
+)
+
+// CWVariant is the algorithm used to update a
+// ConfidenceWeighted model
+type CWVariant string
+
+// Confidence-weighted variants
+const (
+	// CW is confidence-weighted learning (the
+	// variance version, with the exact closed form
+	// update,) which updates whenever an example isn't
+	// classified correctly with probability η
+	//
+	// http://www.cs.jhu.edu/~mdredze/publications/icml_variance.pdf
+	CW CWVariant = "CW"
+
+	// AROW (Adaptive Regularization of Weights) is
+	// a softer version of CW that's much more robust
+	// to label noise, trading off how much it changes
+	// the weights against the margin with r
+	//
+	// http://www.alexkulesza.com/pubs/arow_nips09.pdf
+	AROW CWVariant = "AROW"
+
+	// SCWI and SCWII are the Soft Confidence-Weighted
+	// learners, which add an aggressiveness parameter
+	// C to CW (like PA-I and PA-II add one to PA) so
+	// they can cope with noisy examples while keeping
+	// CW's fast, confidence based updates
+	//
+	// https://arxiv.org/abs/1206.4612
+	SCWI  CWVariant = "SCW-I"
+	SCWII CWVariant = "SCW-II"
+)
+
+// ConfidenceWeighted represents the family of online
+// binary classifiers which keep a Gaussian distribution
+// over the parameter vector θ instead of a single θ: a
+// mean μ and a (diagonal) variance Σ, one per feature.
+// Features the model has seen a lot have a low variance
+// (the model is confident in their weight) and change
+// less on each update, while rare features keep a high
+// variance and change faster. This makes them learn
+// faster than the Perceptron and react much less to a
+// single mislabeled point.
+//
+// Predictions use the mean:
+//     sgn(μx)
+//
+// On each example with margin m = yμx and variance
+// v = xΣx, the update is:
+//     μ := μ + αyΣx
+//     Σ := Σ - βΣxxᵀΣ (keeping only the diagonal)
+// where α and β depend on the variant.
+//
+// Like the Perceptron, the first value of μ (and Σ) is
+// the constant term and data results are expected to be
+// either -1 or 1.
+type ConfidenceWeighted struct {
+	variant CWVariant
+
+	// eta is the confidence η used by CW and SCW,
+	// r the regularization of AROW and c the
+	// aggressiveness parameter C of SCW
+	eta float64
+	r   float64
+	c   float64
+
+	// Parameters holds the mean μ of θ and Variance
+	// the diagonal of its covariance Σ
+	Parameters []float64 `json:"theta"`
+	Variance   []float64 `json:"variance"`
+
+	// Output is the io.Writer used for logging
+	// and printing. Defaults to os.Stdout.
+	Output io.Writer
+}
+
+// NewConfidenceWeighted takes in the variant of the
+// model and the number of features (not including the
+// constant term) being evaluated by the model and
+// returns a new model with a mean of 0 and a variance
+// of 1 for every feature. An empty variant defaults to
+// AROW.
+//
+// The confidence η defaults to 0.9, the AROW
+// regularization r to 1 and the SCW aggressiveness
+// C to 1. Change them with the Update* methods.
+func NewConfidenceWeighted(variant CWVariant, features int) *ConfidenceWeighted {
+	if variant == "" {
+		variant = AROW
+	}
+
+	variance := make([]float64, features+1)
+	for i := range variance {
+		variance[i] = 1
+	}
+
+	return &ConfidenceWeighted{
+		variant: variant,
+
+		eta: 0.9,
+		r:   1,
+		c:   1,
+
+		Parameters: make([]float64, features+1),
+		Variance:   variance,
+		Output:     os.Stdout,
+	}
+}
+
+// UpdateConfidence sets the confidence η of the CW
+// and SCW variants, the probability (between 0.5 and
+// 1) with which the model tries to classify each
+// example correctly
+func (p *ConfidenceWeighted) UpdateConfidence(eta float64) {
+	p.eta = eta
+}
+
+// UpdateRegularization sets the regularization r of
+// the AROW variant. Larger r makes smaller updates.
+func (p *ConfidenceWeighted) UpdateRegularization(r float64) {
+	p.r = r
+}
+
+// UpdateAggressiveness sets the aggressiveness
+// parameter C of the SCW variants. Smaller C makes
+// the model less sensitive to noisy examples.
+func (p *ConfidenceWeighted) UpdateAggressiveness(c float64) {
+	p.c = c
+}
+
+// Variant returns the variant of the model
+func (p *ConfidenceWeighted) Variant() CWVariant {
+	return p.variant
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns sgn(μx), either -1 or 1
+func (p *ConfidenceWeighted) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if len(x)+1 != len(p.Parameters) {
+		return nil, fmt.Errorf("Error: Parameter vector should be 1 longer than input vector!\n\tLength of x given: %v\n\tLength of parameters: %v\n", len(x), len(p.Parameters))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	return []float64{sign(dot(p.Parameters, x))}, nil
+}
+
+// validate checks the variant and its hyperparameters
+func (p *ConfidenceWeighted) validate() error {
+	if len(p.Variance) != len(p.Parameters) {
+		return fmt.Errorf("ERROR: Variance should have the same length as the parameter vector (%v) - has %v\n", len(p.Parameters), len(p.Variance))
+	}
+
+	switch p.variant {
+	case AROW:
+		if p.r <= 0 {
+			return fmt.Errorf("ERROR: The regularization r of AROW must be greater than 0 - given %v\n", p.r)
+		}
+		return nil
+
+	case CW, SCWI, SCWII:
+		if p.eta <= 0.5 || p.eta >= 1 {
+			return fmt.Errorf("ERROR: The confidence η of %v must be between 0.5 and 1 - given %v\n", p.variant, p.eta)
+		}
+		if p.variant != CW && p.c <= 0 {
+			return fmt.Errorf("ERROR: The aggressiveness parameter C of %v must be greater than 0 - given %v\n", p.variant, p.c)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("ERROR: Unknown confidence-weighted variant %q\n", p.variant)
+}
+
+// OnlineLearn runs off of the given datastream like
+// Perceptron.OnlineLearn. Whenever the model isn't
+// confident enough in its prediction of a point, the
+// mean μ and variance Σ are updated and onUpdate is
+// called (in a new goroutine) with copies of μ and Σ,
+// in that order. Learning will stop when the data
+// channel is closed and all remaining datapoints within
+// the channel have been read, after which the errors
+// channel is closed.
+//
+// NOTE that there is an optional last parameter which,
+// when true, will normalize all data given on the
+// stream.
+func (p *ConfidenceWeighted) OnlineLearn(errors chan error, dataset chan base.Datapoint, onUpdate func([][]float64), normalize ...bool) {
+	if errors == nil {
+		errors = make(chan error)
+	}
+	if dataset == nil {
+		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
+		close(errors)
+		return
+	}
+
+	err := p.validate()
+	if err != nil {
+		errors <- err
+		close(errors)
+		return
+	}
+
+	fmt.Fprintf(p.Output, "Training:\n\tModel: Confidence-Weighted Classifier\n\tOptimization Method: Online %v\n\tFeatures: %v\n\tConfidence η: %v\n\tRegularization r: %v\n\tAggressiveness C: %v\n...\n\n", p.variant, len(p.Parameters)-1, p.eta, p.r, p.c)
+
+	// φ = Φ⁻¹(η), the inverse of the normal
+	// distribution function
+	phi := math.Sqrt2 * math.Erfinv(2*p.eta-1)
+
+	norm := len(normalize) != 0 && normalize[0]
+
+	var point base.Datapoint
+	var more bool
+
+	for {
+		point, more = <-dataset
+
+		if more {
+			if norm {
+				base.NormalizePoint(point.X)
+			}
+
+			if len(point.Y) != 1 || (point.Y[0] != -1 && point.Y[0] != 1) {
+				errors <- fmt.Errorf("The confidence-weighted classifier requires that the data results (y) be either [-1] or [1] - given %v", point.Y)
+				continue
+			}
+
+			if len(point.X) != len(p.Parameters)-1 {
+				errors <- fmt.Errorf("The confidence-weighted classifier requires that the length of input data (currently %v) be one less than the length of the parameter vector (%v)", len(point.X), len(p.Parameters))
+				continue
+			}
+
+			if p.update(point.X, point.Y[0], phi) {
+				go onUpdate([][]float64{
+					append([]float64{}, p.Parameters...),
+					append([]float64{}, p.Variance...),
+				})
+			}
+
+		} else {
+			fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+			close(errors)
+			return
+		}
+	}
+}
+
+// update updates μ and Σ with the given example,
+// returning whether anything changed
+func (p *ConfidenceWeighted) update(x []float64, y, phi float64) bool {
+	// m is the margin and v the variance of
+	// the margin, with the constant term
+	m := y * dot(p.Parameters, x)
+	v := p.Variance[0]
+	for i := range x {
+		v += p.Variance[i+1] * x[i] * x[i]
+	}
+
+	var alpha, beta float64
+
+	switch p.variant {
+	case AROW:
+		if m >= 1 {
+			return false
+		}
+		beta = 1 / (v + p.r)
+		alpha = (1 - m) * beta
+
+	case CW:
+		if m >= phi*math.Sqrt(v) {
+			return false
+		}
+		b := 1 + 2*phi*m
+		alpha = (-b + math.Sqrt(b*b-8*phi*(m-phi*v))) / (4 * phi * v)
+		if alpha <= 0 {
+			return false
+		}
+
+		// Σ⁻¹ := Σ⁻¹ + 2αφ diag(x²)
+		p.step(x, y*alpha)
+		p.Variance[0] = 1 / (1/p.Variance[0] + 2*alpha*phi)
+		for i := range x {
+			p.Variance[i+1] = 1 / (1/p.Variance[i+1] + 2*alpha*phi*x[i]*x[i])
+		}
+		return true
+
+	case SCWI, SCWII:
+		if phi*math.Sqrt(v)-m <= 0 {
+			return false
+		}
+
+		psi := 1 + phi*phi/2
+		zeta := 1 + phi*phi
+
+		if p.variant == SCWI {
+			alpha = (-m*psi + math.Sqrt(m*m*phi*phi*phi*phi/4+v*phi*phi*zeta)) / (v * zeta)
+			alpha = math.Min(p.c, math.Max(0, alpha))
+		} else {
+			n := v + 1/(2*p.c)
+			gamma := phi * math.Sqrt(phi*phi*m*m*v*v+4*n*v*(n+v*phi*phi))
+			alpha = math.Max(0, (-(2*m*n+phi*phi*m*v)+gamma)/(2*(n*n+n*v*phi*phi)))
+		}
+		if alpha <= 0 {
+			return false
+		}
+
+		u := -alpha*v*phi + math.Sqrt(alpha*alpha*v*v*phi*phi+4*v)
+		u = u * u / 4
+		beta = alpha * phi / (math.Sqrt(u) + v*alpha*phi)
+	}
+
+	p.step(x, y*alpha)
+
+	// Σ := Σ - βΣxxᵀΣ, diagonal only
+	p.Variance[0] -= beta * p.Variance[0] * p.Variance[0]
+	for i := range x {
+		p.Variance[i+1] -= beta * p.Variance[i+1] * p.Variance[i+1] * x[i] * x[i]
+	}
+
+	return true
+}
+
+// step adds sΣx to μ, including the constant term
+func (p *ConfidenceWeighted) step(x []float64, s float64) {
+	p.Parameters[0] += s * p.Variance[0]
+	for i := range x {
+		p.Parameters[i+1] += s * p.Variance[i+1] * x[i]
+	}
+}
+
+// String implements the fmt interface for clean printing
+func (p *ConfidenceWeighted) String() string {
+	return fmt.Sprintf("h(μ,x) = μx > 0 ? 1 : -1\n%v", linearString(p.Parameters))
+}
+
+// confidenceWeightedHyperparameters holds the
+// hyperparameters of a ConfidenceWeighted model as
+// saved in its envelope
+type confidenceWeightedHyperparameters struct {
+	Variant CWVariant `json:"variant"`
+	Eta     float64   `json:"eta"`
+	R       float64   `json:"r"`
+	C       float64   `json:"c"`
+}
+
+// confidenceWeightedData is the data of a
+// ConfidenceWeighted envelope
+type confidenceWeightedData struct {
+	Parameters []float64 `json:"theta"`
+	Variance   []float64 `json:"variance"`
+}
+
+// confidenceWeightedType is the name ConfidenceWeighted
+// models are registered and persisted under
+const confidenceWeightedType = "perceptron.ConfidenceWeighted"
+
+func init() {
+	base.RegisterModel(confidenceWeightedType, func() base.Persistable {
+		return NewConfidenceWeighted("", 0)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// variant and hyperparameters, wrapped in a
+// base.Envelope. The data of the envelope is the mean
+// μ and the variance Σ, so a restored model can keep
+// on learning.
+func (p *ConfidenceWeighted) MarshalEnvelope() (*base.Envelope, error) {
+	features := len(p.Parameters) - 1
+	if features < 0 {
+		features = 0
+	}
+
+	env := &base.Envelope{
+		Type: confidenceWeightedType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+	}
+
+	err := env.Encode(confidenceWeightedHyperparameters{
+		Variant: p.variant,
+		Eta:     p.eta,
+		R:       p.r,
+		C:       p.c,
+	}, confidenceWeightedData{
+		Parameters: p.Parameters,
+		Variance:   p.Variance,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's mean,
+// variance, variant and hyperparameters from the
+// given base.Envelope
+func (p *ConfidenceWeighted) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := confidenceWeightedHyperparameters{
+		Variant: p.variant,
+		Eta:     p.eta,
+		R:       p.r,
+		C:       p.c,
+	}
+
+	var data confidenceWeightedData
+	err := env.Decode(confidenceWeightedType, &hyper, &data)
+	if err != nil {
+		return err
+	}
+
+	if len(data.Parameters) != len(data.Variance) {
+		return fmt.Errorf("ERROR: ConfidenceWeighted model has %v parameters but %v variances", len(data.Parameters), len(data.Variance))
+	}
+
+	p.variant = hyper.Variant
+	p.eta = hyper.Eta
+	p.r = hyper.R
+	p.c = hyper.C
+	p.Parameters = data.Parameters
+	p.Variance = data.Variance
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later.
+func (p *ConfidenceWeighted) PersistToFile(path string) error {
+	return base.PersistModel(path, p)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores the model from it.
+func (p *ConfidenceWeighted) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, p)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (p *ConfidenceWeighted) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, p)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (p *ConfidenceWeighted) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, p)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (p *ConfidenceWeighted) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(p)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (p *ConfidenceWeighted) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, p)
+}
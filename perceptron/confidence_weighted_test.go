@@ -0,0 +1,125 @@
+package perceptron
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// noisyLine returns a point in [-5, 5]² labeled by
+// which side of a line it's on, with the label
+// flipped with the given probability
+func noisyLine(r *rand.Rand, noise float64) base.Datapoint {
+	x := []float64{r.Float64()*10 - 5, r.Float64()*10 - 5}
+
+	y := -1.0
+	if x[0]+2*x[1]-1 > 0 {
+		y = 1
+	}
+	if r.Float64() < noise {
+		y *= -1
+	}
+
+	return base.Datapoint{X: x, Y: []float64{y}}
+}
+
+func TestConfidenceWeightedShouldPass1(t *testing.T) {
+	for _, variant := range []CWVariant{CW, AROW, SCWI, SCWII} {
+		r := rand.New(rand.NewSource(23))
+
+		var points []base.Datapoint
+		for i := 0; i < 2000; i++ {
+			points = append(points, noisyLine(r, 0.1))
+		}
+
+		model := NewConfidenceWeighted(variant, 2)
+		assert.Equal(t, variant, model.Variant(), "Model should use the given variant")
+
+		err := learnStream(model, points)
+		assert.Nil(t, err, "Learning error should be nil")
+
+		for i := range model.Variance {
+			assert.True(t, model.Variance[i] > 0 && model.Variance[i] < 1, "%v variance should shrink but stay positive - σ[%v] = %v", variant, i, model.Variance[i])
+		}
+
+		var mistakes int
+		for i := 0; i < 500; i++ {
+			point := noisyLine(r, 0)
+
+			guess, err := model.Predict(point.X)
+			assert.Nil(t, err, "Prediction error should be nil")
+			if guess[0] != point.Y[0] {
+				mistakes++
+			}
+		}
+
+		assert.True(t, mistakes < 50, "%v should learn the boundary despite the noise - made %v mistakes out of 500", variant, mistakes)
+	}
+}
+
+func TestConfidenceWeightedShouldFail1(t *testing.T) {
+	model := NewConfidenceWeighted(AROW, 2)
+	model.UpdateRegularization(0)
+	assert.NotNil(t, learnStream(model, nil), "AROW without a positive r should return an error")
+
+	model = NewConfidenceWeighted(CW, 2)
+	model.UpdateConfidence(0.3)
+	assert.NotNil(t, learnStream(model, nil), "CW with η below 0.5 should return an error")
+
+	model = NewConfidenceWeighted(SCWII, 2)
+	model.UpdateAggressiveness(-1)
+	assert.NotNil(t, learnStream(model, nil), "SCW without a positive C should return an error")
+
+	model = NewConfidenceWeighted(CWVariant("NHERD"), 2)
+	assert.NotNil(t, learnStream(model, nil), "Unknown variants should return an error")
+
+	model = NewConfidenceWeighted(AROW, 2)
+	err := learnStream(model, []base.Datapoint{
+		{X: []float64{1, 2}, Y: []float64{0}},
+	})
+	assert.NotNil(t, err, "Results other than -1 and 1 should return an error")
+
+	err = learnStream(model, []base.Datapoint{
+		{X: []float64{1, 2, 3}, Y: []float64{1}},
+	})
+	assert.NotNil(t, err, "Wrong dimensions should return an error")
+}
+
+func TestLoadConfidenceWeightedShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(29))
+
+	var points []base.Datapoint
+	for i := 0; i < 200; i++ {
+		points = append(points, noisyLine(r, 0.05))
+	}
+
+	model := NewConfidenceWeighted(SCWI, 2)
+	model.UpdateAggressiveness(0.5)
+	model.UpdateConfidence(0.8)
+
+	err := learnStream(model, points)
+	assert.Nil(t, err, "Learning error should be nil")
+
+	err = model.PersistToFile("/tmp/.goml/ConfidenceWeighted.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/ConfidenceWeighted.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*ConfidenceWeighted)
+	assert.True(t, ok, "Loaded model should be a *ConfidenceWeighted")
+	assert.Equal(t, SCWI, restored.Variant(), "Variant should be restored")
+	assert.Equal(t, 0.5, restored.c, "C should be restored")
+	assert.Equal(t, 0.8, restored.eta, "η should be restored")
+	assert.Equal(t, model.Parameters, restored.Parameters, "Mean should be restored")
+	assert.Equal(t, model.Variance, restored.Variance, "Variance should be restored")
+
+	// both should keep on learning the same way
+	more := points[:50]
+	assert.Nil(t, learnStream(model, more), "Learning error should be nil")
+	assert.Nil(t, learnStream(restored, more), "Learning error should be nil")
+	assert.Equal(t, model.Parameters, restored.Parameters, "Restored model should keep on learning like the original")
+}
@@ -0,0 +1,348 @@
+package perceptron
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/admpub/goml/base"
+)
+
+// KernelMulticlassPerceptron is the kernelized version
+// of the (native) MulticlassPerceptron. Every mistake
+// is kept as a support vector with one coefficient per
+// class: +1 for the correct class and -1 for the class
+// which was wrongly predicted. Predictions are the class
+// with the highest score:
+//     argmax_c Σ α[i][c] * K(x[i], x)
+//
+// Like the KernelPerceptron, this lets the model fit
+// non-linear boundaries between classes, and its memory
+// use grows with the number of mistakes.
+//
+// Data results in this multiclass model are expected
+// to be integer class labels in [0, k), and Predict
+// returns the predicted class label.
+type KernelMulticlassPerceptron struct {
+	// SV stores the model's support vectors and
+	// Coefficients the coefficient of each support
+	// vector for every class
+	SV           []base.Datapoint `json:"support_vectors,omitempty"`
+	Coefficients [][]float64      `json:"coefficients,omitempty"`
+
+	Kernel func([]float64, []float64) float64
+
+	// KernelSpec describes the kernel of the model when
+	// it was created with NewKernelMulticlassPerceptronFromSpec,
+	// so a restored model can rebuild its kernel
+	KernelSpec *base.KernelSpec `json:"kernel,omitempty"`
+
+	// Output is the io.Writer used for logging
+	// and printing. Defaults to os.Stdout.
+	Output io.Writer
+
+	// k is the number of classes
+	k int
+}
+
+// NewKernelMulticlassPerceptron takes in a kernel and
+// the number of classes k and returns a new model
+func NewKernelMulticlassPerceptron(kernel func([]float64, []float64) float64, k int) *KernelMulticlassPerceptron {
+	return &KernelMulticlassPerceptron{
+		Kernel: kernel,
+		Output: os.Stdout,
+
+		k: k,
+	}
+}
+
+// NewKernelMulticlassPerceptronFromSpec returns a new
+// model using the kernel described by the given spec,
+// which is persisted along with the model
+func NewKernelMulticlassPerceptronFromSpec(spec base.KernelSpec, k int) (*KernelMulticlassPerceptron, error) {
+	kernel, err := spec.Kernel()
+	if err != nil {
+		return nil, err
+	}
+
+	model := NewKernelMulticlassPerceptron(kernel, k)
+	model.KernelSpec = &spec
+
+	return model, nil
+}
+
+// UpdateKernel sets the kernel of the model to the one
+// described by the given spec
+func (p *KernelMulticlassPerceptron) UpdateKernel(spec base.KernelSpec) error {
+	kernel, err := spec.Kernel()
+	if err != nil {
+		return err
+	}
+
+	p.Kernel = kernel
+	p.KernelSpec = &spec
+
+	return nil
+}
+
+// Classes returns the number of classes (k) of the
+// model
+func (p *KernelMulticlassPerceptron) Classes() int {
+	return p.k
+}
+
+// Scores returns Σ α[i][c] * K(x[i], x) for every
+// class c
+func (p *KernelMulticlassPerceptron) Scores(x []float64, normalize ...bool) ([]float64, error) {
+	if p.Kernel == nil {
+		return nil, fmt.Errorf("ERROR: KernelMulticlassPerceptron has no kernel! If you restored the model, it was persisted without a KernelSpec so you need to set the Kernel again")
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	scores := make([]float64, p.k)
+	for i := range p.SV {
+		k := p.Kernel(p.SV[i].X, x)
+		for c := range scores {
+			scores[c] += p.Coefficients[i][c] * k
+		}
+	}
+
+	return scores, nil
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns the predicted class label (ties going to the
+// lowest label)
+func (p *KernelMulticlassPerceptron) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	scores, err := p.Scores(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("ERROR: KernelMulticlassPerceptron has no classes!")
+	}
+
+	return []float64{float64(argmax(scores))}, nil
+}
+
+// OnlineLearn runs off of the given datastream like
+// KernelPerceptron.OnlineLearn. Whenever the model
+// predicts the wrong class, the point is added as a
+// support vector and onUpdate is called (in a new
+// goroutine) with the point, its result appended.
+//
+// The errors channel will be closed when learning is
+// completed.
+func (p *KernelMulticlassPerceptron) OnlineLearn(errors chan error, dataset chan base.Datapoint, onUpdate func([][]float64), normalize ...bool) {
+	if errors == nil {
+		errors = make(chan error)
+	}
+	if dataset == nil {
+		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
+		close(errors)
+		return
+	}
+	if p.Kernel == nil {
+		errors <- fmt.Errorf("ERROR: Attempting to learn without a kernel!\n")
+		close(errors)
+		return
+	}
+	if p.k < 2 {
+		errors <- fmt.Errorf("ERROR: The multiclass perceptron model needs at least 2 classes - given %v\n", p.k)
+		close(errors)
+		return
+	}
+
+	fmt.Fprintf(p.Output, "Training:\n\tModel: Kernel Multiclass Perceptron Classifier (%v classes)\n\tOptimization Method: Online Kernel Perceptron\n...\n\n", p.k)
+
+	norm := len(normalize) != 0 && normalize[0]
+
+	var point base.Datapoint
+	var more bool
+
+	for {
+		point, more = <-dataset
+
+		if more {
+			if norm {
+				base.NormalizePoint(point.X)
+			}
+
+			label, err := classLabel(point.Y, p.k)
+			if err != nil {
+				errors <- err
+				continue
+			}
+
+			if len(p.SV) != 0 && len(point.X) != len(p.SV[0].X) {
+				errors <- fmt.Errorf("The kernel multiclass perceptron requires that the length of input data (currently %v) match the length of its support vectors (%v)", len(point.X), len(p.SV[0].X))
+				continue
+			}
+
+			scores, err := p.Scores(point.X)
+			if err != nil {
+				errors <- err
+				continue
+			}
+
+			guess := argmax(scores)
+			if guess != label {
+				coefficients := make([]float64, p.k)
+				coefficients[label] = 1
+				coefficients[guess] = -1
+
+				p.SV = append(p.SV, point)
+				p.Coefficients = append(p.Coefficients, coefficients)
+
+				// call the OnUpdate callback with the new vector
+				// appended to a blank slice so the vector is
+				// passed by value and not by reference
+				go onUpdate([][]float64{append(append([]float64{}, point.X...), point.Y...)})
+			}
+
+		} else {
+			fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+			close(errors)
+			return
+		}
+	}
+}
+
+// String implements the fmt interface for clean printing
+func (p *KernelMulticlassPerceptron) String() string {
+	return fmt.Sprintf("h(θ,x) = argmax_c Σ α[i][c]*K(x[i], x`)\n\tClasses: %v\n\tTotal Support Vectors: %v\n", p.k, len(p.SV))
+}
+
+// kernelMulticlassPerceptronHyperparameters holds the
+// hyperparameters of a KernelMulticlassPerceptron as
+// saved in its envelope
+type kernelMulticlassPerceptronHyperparameters struct {
+	Kernel *base.KernelSpec `json:"kernel,omitempty"`
+	K      int              `json:"k"`
+}
+
+// kernelMulticlassPerceptronData is the data of a
+// KernelMulticlassPerceptron envelope
+type kernelMulticlassPerceptronData struct {
+	SV           []base.Datapoint `json:"support_vectors"`
+	Coefficients [][]float64      `json:"coefficients"`
+}
+
+// kernelMulticlassPerceptronType is the name
+// KernelMulticlassPerceptron models are registered
+// and persisted under
+const kernelMulticlassPerceptronType = "perceptron.KernelMulticlassPerceptron"
+
+func init() {
+	base.RegisterModel(kernelMulticlassPerceptronType, func() base.Persistable {
+		return NewKernelMulticlassPerceptron(nil, 0)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// number of classes and the spec of its kernel, wrapped
+// in a base.Envelope. The data of the envelope is the
+// support vectors and their coefficients.
+func (p *KernelMulticlassPerceptron) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(p.SV) != 0 {
+		features = len(p.SV[0].X)
+	}
+
+	env := &base.Envelope{
+		Type: kernelMulticlassPerceptronType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+	}
+
+	err := env.Encode(kernelMulticlassPerceptronHyperparameters{
+		Kernel: p.KernelSpec,
+		K:      p.k,
+	}, kernelMulticlassPerceptronData{
+		SV:           p.SV,
+		Coefficients: p.Coefficients,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model from the given
+// base.Envelope. If the kernel spec was saved, the
+// kernel is rebuilt from it. Otherwise the current
+// kernel is kept.
+func (p *KernelMulticlassPerceptron) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := kernelMulticlassPerceptronHyperparameters{
+		K: p.k,
+	}
+
+	var data kernelMulticlassPerceptronData
+	err := env.Decode(kernelMulticlassPerceptronType, &hyper, &data)
+	if err != nil {
+		return err
+	}
+
+	if len(data.SV) != len(data.Coefficients) {
+		return fmt.Errorf("ERROR: KernelMulticlassPerceptron has %v support vectors but %v coefficient vectors", len(data.SV), len(data.Coefficients))
+	}
+	for i := range data.Coefficients {
+		if len(data.Coefficients[i]) != hyper.K {
+			return fmt.Errorf("ERROR: KernelMulticlassPerceptron has %v classes but support vector %v has %v coefficients", hyper.K, i, len(data.Coefficients[i]))
+		}
+	}
+
+	if hyper.Kernel != nil {
+		err = p.UpdateKernel(*hyper.Kernel)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.k = hyper.K
+	p.SV = data.SV
+	p.Coefficients = data.Coefficients
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later.
+func (p *KernelMulticlassPerceptron) PersistToFile(path string) error {
+	return base.PersistModel(path, p)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores the model from it.
+func (p *KernelMulticlassPerceptron) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, p)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (p *KernelMulticlassPerceptron) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, p)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (p *KernelMulticlassPerceptron) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, p)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (p *KernelMulticlassPerceptron) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(p)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (p *KernelMulticlassPerceptron) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, p)
+}
@@ -0,0 +1,134 @@
+package perceptron
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ring returns a point labeled by which of three
+// rings around the origin it's in, which no linear
+// model can separate
+func ring(r *rand.Rand) base.Datapoint {
+	label := r.Intn(3)
+	radius := float64(label) + 0.2 + r.Float64()*0.6
+	angle := r.Float64() * 2 * math.Pi
+
+	return base.Datapoint{
+		X: []float64{radius * math.Cos(angle), radius * math.Sin(angle)},
+		Y: []float64{float64(label)},
+	}
+}
+
+func TestKernelMulticlassPerceptronShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+
+	stream := make(chan base.Datapoint, 100)
+	errors := make(chan error)
+
+	model := NewKernelMulticlassPerceptron(base.GaussianKernel(0.5), 3)
+	assert.Equal(t, 3, model.Classes(), "Model should have 3 classes")
+
+	go model.OnlineLearn(errors, stream, func(supportVector [][]float64) {})
+
+	go func() {
+		for i := 0; i < 2000; i++ {
+			stream <- ring(r)
+		}
+
+		close(stream)
+	}()
+
+	err, more := <-errors
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.False(t, more, "There should be no errors returned")
+	assert.Equal(t, len(model.SV), len(model.Coefficients), "Every support vector should have coefficients")
+
+	var mistakes int
+	for i := 0; i < 300; i++ {
+		point := ring(r)
+
+		guess, err := model.Predict(point.X)
+		assert.Nil(t, err, "Prediction error should be nil")
+		if guess[0] != point.Y[0] {
+			mistakes++
+		}
+	}
+
+	assert.True(t, mistakes < 30, "Model should classify the rings - made %v mistakes out of 300", mistakes)
+}
+
+func TestKernelMulticlassPerceptronShouldFail1(t *testing.T) {
+	_, err := NewKernelMulticlassPerceptron(nil, 3).Predict([]float64{1, 2})
+	assert.NotNil(t, err, "Predicting without a kernel should return an error")
+
+	errors := make(chan error, 1)
+	go NewKernelMulticlassPerceptron(nil, 3).OnlineLearn(errors, make(chan base.Datapoint), func(supportVector [][]float64) {})
+
+	err = <-errors
+	assert.NotNil(t, err, "Learning without a kernel should return an error")
+
+	stream := make(chan base.Datapoint, 100)
+	errors = make(chan error, 100)
+
+	go NewKernelMulticlassPerceptron(base.GaussianKernel(1), 3).OnlineLearn(errors, stream, func(supportVector [][]float64) {})
+
+	stream <- base.Datapoint{X: []float64{1, 2}, Y: []float64{1.5}}
+	stream <- base.Datapoint{X: []float64{1, 2}, Y: []float64{5}}
+	close(stream)
+
+	var count int
+	for err := range errors {
+		assert.NotNil(t, err, "Errors sent should not be nil")
+		count++
+	}
+	assert.Equal(t, 2, count, "Every invalid datapoint should return an error")
+}
+
+func TestLoadKernelMulticlassPerceptronShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+
+	model, err := NewKernelMulticlassPerceptronFromSpec(base.GaussianKernelSpec(0.5), 3)
+	assert.Nil(t, err, "Creating the model should not return an error")
+
+	stream := make(chan base.Datapoint, 100)
+	errors := make(chan error)
+
+	go model.OnlineLearn(errors, stream, func(supportVector [][]float64) {})
+
+	go func() {
+		for i := 0; i < 300; i++ {
+			stream <- ring(r)
+		}
+
+		close(stream)
+	}()
+
+	<-errors
+
+	err = model.PersistToFile("/tmp/.goml/KernelMulticlassPerceptron.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/KernelMulticlassPerceptron.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*KernelMulticlassPerceptron)
+	assert.True(t, ok, "Loaded model should be a *KernelMulticlassPerceptron")
+	assert.Equal(t, 3, restored.Classes(), "Number of classes should be restored")
+	assert.Equal(t, model.Coefficients, restored.Coefficients, "Coefficients should be restored")
+
+	for i := 0; i < 100; i++ {
+		point := ring(r)
+
+		expected, err := model.Predict(point.X)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		guess, err := restored.Predict(point.X)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, guess, "Restored model should predict the same")
+	}
+}
@@ -1,10 +1,9 @@
 package perceptron
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"math/rand"
 	"os"
 
 	"github.com/admpub/goml/base"
@@ -54,9 +53,36 @@ type KernelPerceptron struct {
 
 	Kernel func([]float64, []float64) float64
 
+	// KernelSpec describes the kernel of the model when
+	// it was created with NewKernelPerceptronFromSpec. It
+	// is persisted along with the model so a restored
+	// model can rebuild its kernel. It is nil when the
+	// model was created from a bare kernel function.
+	KernelSpec *base.KernelSpec `json:"kernel,omitempty"`
+
+	// rng is the model's source of randomness for
+	// shuffling the training set every epoch. It's
+	// seeded from the current time unless the model
+	// is given a seed with UpdateSeed.
+	rng *rand.Rand
+
 	// Output is the io.Writer used for logging
 	// and printing. Defaults to os.Stdout.
 	Output io.Writer
+
+	// trainingSet and expectedResults are used
+	// by Learn (batch training)
+	trainingSet     [][]float64
+	expectedResults []float64
+
+	// cacheRows is the number of kernel rows Learn
+	// keeps in memory. 0 means the whole Gram matrix
+	// is precomputed.
+	cacheRows int
+
+	// maxEpochs is the most passes Learn makes
+	// over the training set
+	maxEpochs int
 }
 
 // NewKernelPerceptron takes in a learning rate alpha, the
@@ -79,14 +105,199 @@ type KernelPerceptron struct {
 func NewKernelPerceptron(kernel func([]float64, []float64) float64) *KernelPerceptron {
 	return &KernelPerceptron{
 		Kernel: kernel,
+		rng:    base.NewTimeSeededRandom(),
 		Output: os.Stdout,
+
+		maxEpochs: DefaultMaxEpochs,
+	}
+}
+
+// UpdateSeed seeds the model's source of randomness
+// so learning is reproducible
+func (p *KernelPerceptron) UpdateSeed(seed int64) {
+	p.rng = base.NewRandom(seed)
+}
+
+// UpdateRandom replaces the model's source of
+// randomness
+func (p *KernelPerceptron) UpdateRandom(rng *rand.Rand) {
+	p.rng = rng
+}
+
+// NewKernelPerceptronFromSpec returns a new model using
+// the kernel described by the given spec. Unlike models
+// created with NewKernelPerceptron, the kernel of these
+// models is persisted with the model, so you don't have
+// to set it again after restoring the model.
+//
+//     model, err := NewKernelPerceptronFromSpec(base.GaussianKernelSpec(50))
+//
+// An error is returned if the spec doesn't describe a
+// valid kernel.
+func NewKernelPerceptronFromSpec(spec base.KernelSpec) (*KernelPerceptron, error) {
+	kernel, err := spec.Kernel()
+	if err != nil {
+		return nil, err
+	}
+
+	model := NewKernelPerceptron(kernel)
+	model.KernelSpec = &spec
+
+	return model, nil
+}
+
+// UpdateKernel sets the kernel of the model to the one
+// described by the given spec
+func (p *KernelPerceptron) UpdateKernel(spec base.KernelSpec) error {
+	kernel, err := spec.Kernel()
+	if err != nil {
+		return err
+	}
+
+	p.Kernel = kernel
+	p.KernelSpec = &spec
+
+	return nil
+}
+
+// UpdateTrainingSet sets the examples (and their
+// expected results, each either -1 or 1) used by
+// Learn to train the model in batch
+func (p *KernelPerceptron) UpdateTrainingSet(trainingSet [][]float64, expectedResults []float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("Error: length of given training set is 0! Need data!")
+	}
+	if len(expectedResults) == 0 {
+		return fmt.Errorf("Error: length of given result data set is 0! Need expected results!")
+	}
+
+	p.trainingSet = trainingSet
+	p.expectedResults = expectedResults
+
+	return nil
+}
+
+// UpdateCacheSize sets the number of rows of the kernel
+// matrix Learn keeps in memory (see base.KernelCache.)
+// If rows is 0 (the default,) the whole Gram matrix of
+// the training set is precomputed, which is fastest but
+// needs memory for n² floats.
+func (p *KernelPerceptron) UpdateCacheSize(rows int) {
+	p.cacheRows = rows
+}
+
+// UpdateMaxEpochs sets the most passes Learn makes
+// over the training set. Learning stops earlier if
+// a whole pass is made without a mistake.
+func (p *KernelPerceptron) UpdateMaxEpochs(epochs int) {
+	p.maxEpochs = epochs
+}
+
+// Examples returns the number of training examples
+// that the model currently is training from.
+func (p *KernelPerceptron) Examples() int {
+	return len(p.trainingSet)
+}
+
+// Learn trains the model in batch on the training set
+// given with UpdateTrainingSet. Any support vectors the
+// model had before are discarded, then the model makes
+// passes (epochs) over the training set, shuffled each
+// time, adding an example as a support vector whenever
+// it's misclassified, as in OnlineLearn. Learning stops
+// after an epoch without mistakes or after the max
+// number of epochs (see UpdateMaxEpochs.)
+//
+// Kernel values between training examples are computed
+// through a base.KernelMatrix, so the kernel is only
+// evaluated once for every pair of examples (or once
+// per cached row, see UpdateCacheSize) instead of once
+// per support vector per prediction.
+//
+// An example misclassified in more than one epoch is
+// added as a support vector once per mistake.
+func (p *KernelPerceptron) Learn() error {
+	if p.Kernel == nil {
+		err := fmt.Errorf("ERROR: Attempting to learn without a kernel!\n")
+		fmt.Fprintf(p.Output, err.Error())
+		return err
+	}
+
+	examples := len(p.trainingSet)
+	if examples == 0 || len(p.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(p.Output, err.Error())
+		return err
+	}
+
+	err := validateBinaryResults(p.trainingSet, p.expectedResults)
+	if err != nil {
+		fmt.Fprintf(p.Output, err.Error())
+		return err
+	}
+
+	fmt.Fprintf(p.Output, "Training:\n\tModel: Kernel Perceptron Classifier\n\tOptimization Method: Batch Kernel Perceptron\n\tTraining Examples: %v\n\tFeatures: %v\n\tMax Epochs: %v\n...\n\n", examples, len(p.trainingSet[0]), p.maxEpochs)
+
+	gram := base.NewKernelMatrix(p.Kernel, p.trainingSet, p.cacheRows)
+
+	// mistakes[i] is the number of times example
+	// i was misclassified (the dual coefficient α)
+	// and sv holds the indices of examples with
+	// α > 0, so a KernelCache keeps their rows
+	mistakes := make([]int, examples)
+	var sv []int
+
+	for epoch := 0; epoch < p.maxEpochs; epoch++ {
+		var epochMistakes int
+
+		for _, i := range p.rng.Perm(examples) {
+			var sum float64
+			for _, j := range sv {
+				sum += float64(mistakes[j]) * p.expectedResults[j] * gram.At(j, i)
+			}
+
+			guess := -1.0
+			if sum > 0 {
+				guess = 1
+			}
+
+			if guess != p.expectedResults[i] {
+				if mistakes[i] == 0 {
+					sv = append(sv, i)
+				}
+				mistakes[i]++
+				epochMistakes++
+			}
+		}
+
+		if epochMistakes == 0 {
+			break
+		}
 	}
+
+	p.SV = nil
+	for _, i := range sv {
+		for m := 0; m < mistakes[i]; m++ {
+			p.SV = append(p.SV, base.Datapoint{
+				X: p.trainingSet[i],
+				Y: []float64{p.expectedResults[i]},
+			})
+		}
+	}
+
+	fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+
+	return nil
 }
 
 // Predict takes in a variable x (an array of floats,) and
 // finds the value of the hypothesis function given the
 // current parameter vector θ
 func (p *KernelPerceptron) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if p.Kernel == nil {
+		return nil, fmt.Errorf("ERROR: KernelPerceptron has no kernel! If you restored the model, it was persisted without a KernelSpec so you need to set the Kernel again")
+	}
+
 	if len(normalize) != 0 && normalize[0] {
 		base.NormalizePoint(x)
 	}
@@ -286,56 +497,133 @@ func (p *KernelPerceptron) String() string {
 	return fmt.Sprintf("h(θ,x) = Σ y[i]*K(x[i], x`) > 0 ? 1 : 0\n\tTotal Support Vectors: %v\n", len(p.SV))
 }
 
-// PersistToFile takes in an absolute filepath and saves the
-// parameter vector θ to the file, which can be restored later.
-// The function will take paths from the current directory, but
-// functions
+// kernelPerceptronHyperparameters holds the
+// hyperparameters of a KernelPerceptron as saved
+// in its envelope
+type kernelPerceptronHyperparameters struct {
+	Kernel    *base.KernelSpec `json:"kernel,omitempty"`
+	MaxEpochs int              `json:"max_epochs,omitempty"`
+}
+
+// kernelPerceptronType is the name KernelPerceptron
+// models are registered and persisted under
+const kernelPerceptronType = "perceptron.KernelPerceptron"
+
+func init() {
+	base.RegisterModel(kernelPerceptronType, func() base.Persistable {
+		return NewKernelPerceptron(nil)
+	})
+}
+
+// MarshalEnvelope returns the model, along with the
+// spec of its kernel, wrapped in a base.Envelope. The
+// data of the envelope is the support vectors of the
+// model.
 //
-// The data is stored as JSON because it's one of the most
-// efficient storage method (you only need one comma extra
-// per feature + two brackets, total!) And it's extendable.
-func (p *KernelPerceptron) PersistToFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+// Note that a kernel function can't be saved on its
+// own, so if the model was created with a bare kernel
+// function (and not a base.KernelSpec) you'll have to
+// set the Kernel of a restored model before predicting
+// with it.
+func (p *KernelPerceptron) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(p.SV) != 0 {
+		features = len(p.SV[0].X)
+	}
+
+	env := &base.Envelope{
+		Type: kernelPerceptronType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
 	}
 
-	bytes, err := json.Marshal(p.SV)
+	err := env.Encode(kernelPerceptronHyperparameters{
+		Kernel:    p.KernelSpec,
+		MaxEpochs: p.maxEpochs,
+	}, p.SV)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = ioutil.WriteFile(path, bytes, os.ModePerm)
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's support
+// vectors from the given base.Envelope. If the kernel
+// spec was saved, the kernel is rebuilt from it.
+// Otherwise the current kernel is kept.
+func (p *KernelPerceptron) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := kernelPerceptronHyperparameters{
+		MaxEpochs: p.maxEpochs,
+	}
+	var sv []base.Datapoint
+	err := env.Decode(kernelPerceptronType, &hyper, &sv)
 	if err != nil {
 		return err
 	}
 
+	if hyper.Kernel != nil {
+		err = p.UpdateKernel(*hyper.Kernel)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.maxEpochs = hyper.MaxEpochs
+	p.SV = sv
+
 	return nil
 }
 
-// RestoreFromFile takes in a path to a parameter vector theta
-// and assigns the model it's operating on's parameter vector
-// to that.
+// PersistToFile takes in an absolute filepath and saves the
+// support vectors (and kernel spec, if the model has one) of
+// the model to the file, which can be restored later. The
+// function will take paths from the current directory, but
+// functions
+//
+// The model is stored as a JSON base.Envelope.
+func (p *KernelPerceptron) PersistToFile(path string) error {
+	return base.PersistModel(path, p)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and assigns the model it's operating on's support vectors
+// to those persisted.
 //
 // The path must ba an absolute path or a path from the current
 // directory
 //
+// Files holding only the support vectors (as persisted by
+// older versions of goml) can also be restored.
+//
 // This would be useful in persisting data between running
 // a model on data, or for graphing a dataset with a fit in
 // another framework like Julia/Gadfly.
 func (p *KernelPerceptron) RestoreFromFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
-	}
+	return base.RestoreModel(path, p)
+}
 
-	bytes, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
-	}
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (p *KernelPerceptron) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, p)
+}
 
-	err = json.Unmarshal(bytes, &p.SV)
-	if err != nil {
-		return err
-	}
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (p *KernelPerceptron) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, p)
+}
 
-	return nil
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (p *KernelPerceptron) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(p)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (p *KernelPerceptron) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, p)
 }
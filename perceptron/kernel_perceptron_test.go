@@ -780,3 +780,116 @@ func TestGaussianKernelPersistPerceptronShouldPass1(t *testing.T) {
 	assert.True(t, accuracy > 95, "There should be greater than 95 percent accuracy (currently %v)", accuracy)
 	fmt.Printf("Accuracy: %v\n\tPoints Tested: %v\n\tMisclassifications: %v\n", accuracy, count, wrong)
 }
+
+func TestLoadKernelPerceptronShouldPass1(t *testing.T) {
+	model, err := NewKernelPerceptronFromSpec(base.GaussianKernelSpec(50))
+	assert.Nil(t, err, "Model error should be nil")
+
+	model.SV = []base.Datapoint{
+		{X: []float64{1, 1}, Y: []float64{1}},
+		{X: []float64{-1, -1}, Y: []float64{-1}},
+	}
+
+	err = model.PersistToFile("/tmp/.goml/KernelPerceptronSpec.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/KernelPerceptronSpec.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*KernelPerceptron)
+	assert.True(t, ok, "Loaded model should be a *KernelPerceptron")
+	assert.Equal(t, model.SV, restored.SV, "Support vectors should be restored")
+	assert.Equal(t, model.KernelSpec, restored.KernelSpec, "Kernel spec should be restored")
+
+	for _, x := range [][]float64{{2, 3}, {-4, -1}, {0.5, -0.2}} {
+		expected, err := model.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		guess, err := restored.Predict(x)
+		assert.Nil(t, err, "Prediction error of the restored model should be nil")
+		assert.Equal(t, expected, guess, "Restored model should predict like the original")
+	}
+}
+
+func TestLoadKernelPerceptronShouldFail1(t *testing.T) {
+	_, err := NewKernelPerceptronFromSpec(base.KernelSpec{Name: "not registered"})
+	assert.NotNil(t, err, "Creating a model from an unregistered kernel should return an error")
+
+	// models created from bare kernel functions
+	// can't restore their kernel
+	model := NewKernelPerceptron(base.LinearKernel())
+	model.SV = []base.Datapoint{
+		{X: []float64{1}, Y: []float64{1}},
+	}
+
+	err = model.PersistToFile("/tmp/.goml/KernelPerceptronNoSpec.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/KernelPerceptronNoSpec.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	_, err = loaded.(*KernelPerceptron).Predict([]float64{1})
+	assert.NotNil(t, err, "Predicting without a kernel should return an error")
+}
+
+func TestGaussianKernelXORLearnShouldPass1(t *testing.T) {
+	var x [][]float64
+	var y []float64
+	for i := 0; i < 3; i++ {
+		x = append(x, []float64{0, 0}, []float64{0, 1}, []float64{1, 0}, []float64{1, 1})
+		y = append(y, -1, 1, 1, -1)
+	}
+
+	// learn once with the whole Gram matrix and
+	// once with a cache smaller than the dataset
+	for _, rows := range []int{0, 3} {
+		model := NewKernelPerceptron(base.GaussianKernel(1))
+		model.UpdateCacheSize(rows)
+
+		err := model.UpdateTrainingSet(x, y)
+		assert.Nil(t, err, "Updating the training set should not return an error")
+		assert.Equal(t, len(x), model.Examples(), "Model should have all training examples")
+
+		err = model.Learn()
+		assert.Nil(t, err, "Learning error should be nil")
+		assert.NotEmpty(t, model.SV, "Model should have support vectors")
+
+		for i := 0; i < 2; i++ {
+			for j := 0; j < 2; j++ {
+				guess, err := model.Predict([]float64{float64(i), float64(j)})
+				assert.Nil(t, err, "Prediction error should be nil")
+
+				expected := 1.0
+				if i^j == 0 {
+					expected = -1.0
+				}
+				assert.Equal(t, expected, guess[0], "Guess should equal i^j (%v^%v = %v)", i, j, i^j)
+			}
+		}
+	}
+}
+
+func TestKernelPerceptronLearnShouldFail1(t *testing.T) {
+	model := NewKernelPerceptron(base.GaussianKernel(1))
+
+	err := model.Learn()
+	assert.NotNil(t, err, "Learning without a training set should return an error")
+
+	err = model.UpdateTrainingSet([][]float64{{0, 0}, {1, 1}}, []float64{0, 1})
+	assert.Nil(t, err, "Updating the training set should not return an error")
+
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning with results other than -1 and 1 should return an error")
+
+	err = model.UpdateTrainingSet([][]float64{{0, 0}, {1, 1}}, []float64{-1})
+	assert.Nil(t, err, "Updating the training set should not return an error")
+
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning with mismatched results should return an error")
+
+	model = NewKernelPerceptron(nil)
+	model.UpdateTrainingSet([][]float64{{0, 0}, {1, 1}}, []float64{-1, 1})
+
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning without a kernel should return an error")
+}
@@ -0,0 +1,400 @@
+package perceptron
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/admpub/goml/base"
+)
+
+// MulticlassPerceptron represents the multiclass
+// perceptron online learning model. It keeps one
+// parameter vector θ[c] per class c, and predicts
+// the class whose parameter vector scores the input
+// highest:
+//     argmax_c θ[c]x
+//
+// By default it's trained natively: whenever it
+// predicts the wrong class, the parameter vector of
+// the correct class is moved toward the input and the
+// one of the wrongly predicted class away from it:
+//     θ[y] := θ[y] + αx
+//     θ[ŷ] := θ[ŷ] - αx
+//
+// It can also be trained one-vs-rest (see
+// UpdateOneVsRest,) where each parameter vector is
+// a binary Perceptron learning to tell its class
+// apart from all others.
+//
+// https://en.wikipedia.org/wiki/Perceptron#Multiclass_perceptron
+//
+// Data results in this multiclass model are expected
+// to be integer class labels in [0, k), the same as
+// linear.Softmax (ie. the base.Datapoint's you pass,
+// called point, should have point.Y be [0], [1], ...
+// [k-1].) Predict returns the predicted class label.
+type MulticlassPerceptron struct {
+	// alpha is the learning rate of the perceptron
+	// algorithm
+	alpha float64
+
+	// k is the number of classes
+	k int
+
+	// oneVsRest tells OnlineLearn to update every
+	// parameter vector as its own binary perceptron
+	oneVsRest bool
+
+	Parameters [][]float64 `json:"theta"`
+
+	// Output is the io.Writer used for logging
+	// and printing. Defaults to os.Stdout.
+	Output io.Writer
+}
+
+// NewMulticlassPerceptron takes in a learning rate
+// alpha, the number of classes k and the number of
+// features (not including the constant term) being
+// evaluated by the model and returns a new model
+func NewMulticlassPerceptron(alpha float64, k, features int) *MulticlassPerceptron {
+	params := make([][]float64, k)
+	for i := range params {
+		params[i] = make([]float64, features+1)
+	}
+
+	return &MulticlassPerceptron{
+		alpha: alpha,
+		k:     k,
+
+		// initialize θ as the zero vector for
+		// every class
+		Parameters: params,
+		Output:     os.Stdout,
+	}
+}
+
+// UpdateLearningRate set's the learning rate of the model
+// to the given float64.
+func (p *MulticlassPerceptron) UpdateLearningRate(a float64) {
+	p.alpha = a
+}
+
+// UpdateOneVsRest sets whether the model is trained
+// one-vs-rest instead of natively
+func (p *MulticlassPerceptron) UpdateOneVsRest(oneVsRest bool) {
+	p.oneVsRest = oneVsRest
+}
+
+// Classes returns the number of classes (k) of the
+// model
+func (p *MulticlassPerceptron) Classes() int {
+	return p.k
+}
+
+// Scores returns θ[c]x for every class c, including
+// the constant term
+func (p *MulticlassPerceptron) Scores(x []float64, normalize ...bool) ([]float64, error) {
+	if len(p.Parameters) == 0 {
+		return nil, fmt.Errorf("ERROR: MulticlassPerceptron has no classes!")
+	}
+	if len(x)+1 != len(p.Parameters[0]) {
+		return nil, fmt.Errorf("Error: Parameter vector should be 1 longer than input vector!\n\tLength of x given: %v\n\tLength of parameters: %v\n", len(x), len(p.Parameters[0]))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	scores := make([]float64, len(p.Parameters))
+	for c := range p.Parameters {
+		scores[c] = dot(p.Parameters[c], x)
+	}
+
+	return scores, nil
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns the predicted class label (the class whose
+// parameter vector scores x highest, ties going to the
+// lowest label)
+func (p *MulticlassPerceptron) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	scores, err := p.Scores(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	return []float64{float64(argmax(scores))}, nil
+}
+
+// argmax returns the index of the largest value,
+// the first one if there are ties
+func argmax(values []float64) int {
+	var best int
+	for i := range values {
+		if values[i] > values[best] {
+			best = i
+		}
+	}
+
+	return best
+}
+
+// classLabel checks that y holds a single integer
+// class label in [0, k) and returns it
+func classLabel(y []float64, k int) (int, error) {
+	if len(y) != 1 {
+		return 0, fmt.Errorf("The multiclass perceptron model requires that the data results (y) have length 1 - given %v", len(y))
+	}
+
+	label := int(y[0])
+	if float64(label) != y[0] || label < 0 || label >= k {
+		return 0, fmt.Errorf("The multiclass perceptron model requires that the data results (y) be integer class labels in [0, %v) - given %v", k, y[0])
+	}
+
+	return label, nil
+}
+
+// OnlineLearn runs off of the given datastream like
+// Perceptron.OnlineLearn. Whenever the model predicts
+// the wrong class the parameter vectors are updated,
+// as discussed in the documentation for the
+// MulticlassPerceptron struct, and onUpdate is called
+// (in a new goroutine) with the parameter vectors.
+// Learning will stop when the data channel is closed
+// and all remaining datapoints within the channel have
+// been read.
+//
+// The errors channel will be closed when learning is
+// completed.
+//
+// NOTE that there is an optional last parameter which,
+// when true, will normalize all data given on the
+// stream.
+func (p *MulticlassPerceptron) OnlineLearn(errors chan error, dataset chan base.Datapoint, onUpdate func([][]float64), normalize ...bool) {
+	if errors == nil {
+		errors = make(chan error)
+	}
+	if dataset == nil {
+		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
+		close(errors)
+		return
+	}
+	if p.k < 2 {
+		errors <- fmt.Errorf("ERROR: The multiclass perceptron model needs at least 2 classes - given %v\n", p.k)
+		close(errors)
+		return
+	}
+
+	method := "Online Multiclass Perceptron"
+	if p.oneVsRest {
+		method = "Online One-vs-Rest Perceptron"
+	}
+	fmt.Fprintf(p.Output, "Training:\n\tModel: Multiclass Perceptron Classifier (%v classes)\n\tOptimization Method: %v\n\tFeatures: %v\n\tLearning Rate α: %v\n...\n\n", p.k, method, len(p.Parameters[0]), p.alpha)
+
+	norm := len(normalize) != 0 && normalize[0]
+
+	var point base.Datapoint
+	var more bool
+
+	for {
+		point, more = <-dataset
+
+		if more {
+			if norm {
+				base.NormalizePoint(point.X)
+			}
+
+			// Scores also checks if the point is of
+			// the correct dimensions
+			scores, err := p.Scores(point.X)
+			if err != nil {
+				errors <- err
+				continue
+			}
+
+			label, err := classLabel(point.Y, p.k)
+			if err != nil {
+				errors <- err
+				continue
+			}
+
+			var updated bool
+			if p.oneVsRest {
+				for c := range p.Parameters {
+					y := -1.0
+					if c == label {
+						y = 1
+					}
+
+					if sign(scores[c]) != y {
+						p.step(c, point.X, y)
+						updated = true
+					}
+				}
+			} else {
+				guess := argmax(scores)
+				if guess != label {
+					p.step(label, point.X, 1)
+					p.step(guess, point.X, -1)
+					updated = true
+				}
+			}
+
+			if updated {
+				// pass a copy of the parameter vectors
+				// so they're not modified while the
+				// callback uses them
+				theta := make([][]float64, len(p.Parameters))
+				for c := range p.Parameters {
+					theta[c] = append([]float64{}, p.Parameters[c]...)
+				}
+
+				go onUpdate(theta)
+			}
+
+		} else {
+			fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+			close(errors)
+			return
+		}
+	}
+}
+
+// step moves the parameter vector of class c
+// toward (direction 1) or away from (direction -1)
+// the input x
+func (p *MulticlassPerceptron) step(c int, x []float64, direction float64) {
+	p.Parameters[c][0] += p.alpha * direction
+	for i := 1; i < len(p.Parameters[c]); i++ {
+		p.Parameters[c][i] += p.alpha * direction * x[i-1]
+	}
+}
+
+// String implements the fmt interface for clean printing. Here
+// we're using it to print the model as the equation h(θ)=...
+// where h is the multiclass perceptron hypothesis model.
+func (p *MulticlassPerceptron) String() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("h(θ,x) = argmax_c θ[c]x\n")
+	for c := range p.Parameters {
+		buffer.WriteString(fmt.Sprintf("\tθ[%v] = %.5f\n", c, p.Parameters[c]))
+	}
+
+	return buffer.String()
+}
+
+// multiclassPerceptronHyperparameters holds the
+// hyperparameters of a MulticlassPerceptron as
+// saved in its envelope
+type multiclassPerceptronHyperparameters struct {
+	Alpha     float64 `json:"alpha"`
+	K         int     `json:"k"`
+	OneVsRest bool    `json:"one_vs_rest,omitempty"`
+}
+
+// multiclassPerceptronType is the name
+// MulticlassPerceptron models are registered
+// and persisted under
+const multiclassPerceptronType = "perceptron.MulticlassPerceptron"
+
+func init() {
+	base.RegisterModel(multiclassPerceptronType, func() base.Persistable {
+		return NewMulticlassPerceptron(0, 0, 0)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// learning rate and number of classes, wrapped in a
+// base.Envelope. The data of the envelope is the
+// parameter vectors θ.
+func (p *MulticlassPerceptron) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(p.Parameters) != 0 && len(p.Parameters[0]) != 0 {
+		features = len(p.Parameters[0]) - 1
+	}
+
+	env := &base.Envelope{
+		Type: multiclassPerceptronType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+	}
+
+	err := env.Encode(multiclassPerceptronHyperparameters{
+		Alpha:     p.alpha,
+		K:         p.k,
+		OneVsRest: p.oneVsRest,
+	}, p.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's parameter
+// vectors, learning rate and number of classes from
+// the given base.Envelope
+func (p *MulticlassPerceptron) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := multiclassPerceptronHyperparameters{
+		Alpha:     p.alpha,
+		K:         p.k,
+		OneVsRest: p.oneVsRest,
+	}
+
+	var params [][]float64
+	err := env.Decode(multiclassPerceptronType, &hyper, &params)
+	if err != nil {
+		return err
+	}
+
+	if hyper.K != len(params) {
+		return fmt.Errorf("ERROR: MulticlassPerceptron has %v classes but %v parameter vectors", hyper.K, len(params))
+	}
+
+	p.alpha = hyper.Alpha
+	p.k = hyper.K
+	p.oneVsRest = hyper.OneVsRest
+	p.Parameters = params
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later.
+func (p *MulticlassPerceptron) PersistToFile(path string) error {
+	return base.PersistModel(path, p)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores the model from it.
+func (p *MulticlassPerceptron) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, p)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (p *MulticlassPerceptron) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, p)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (p *MulticlassPerceptron) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, p)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (p *MulticlassPerceptron) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(p)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (p *MulticlassPerceptron) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, p)
+}
@@ -0,0 +1,113 @@
+package perceptron
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blob returns a point around one of three centers,
+// labeled with the index of its center
+func blob(r *rand.Rand) base.Datapoint {
+	centers := [][]float64{{-5, 0}, {5, 5}, {5, -5}}
+
+	label := r.Intn(len(centers))
+
+	return base.Datapoint{
+		X: []float64{centers[label][0] + r.NormFloat64(), centers[label][1] + r.NormFloat64()},
+		Y: []float64{float64(label)},
+	}
+}
+
+func TestMulticlassPerceptronShouldPass1(t *testing.T) {
+	for _, oneVsRest := range []bool{false, true} {
+		r := rand.New(rand.NewSource(11))
+
+		stream := make(chan base.Datapoint, 100)
+		errors := make(chan error)
+
+		model := NewMulticlassPerceptron(0.1, 3, 2)
+		model.UpdateOneVsRest(oneVsRest)
+		assert.Equal(t, 3, model.Classes(), "Model should have 3 classes")
+
+		go model.OnlineLearn(errors, stream, func(theta [][]float64) {})
+
+		go func() {
+			for i := 0; i < 2000; i++ {
+				stream <- blob(r)
+			}
+
+			close(stream)
+		}()
+
+		err, more := <-errors
+		assert.Nil(t, err, "Learning error should be nil")
+		assert.False(t, more, "There should be no errors returned")
+
+		var mistakes int
+		for i := 0; i < 300; i++ {
+			point := blob(r)
+
+			guess, err := model.Predict(point.X)
+			assert.Nil(t, err, "Prediction error should be nil")
+			assert.Len(t, guess, 1, "Guess should have length 1")
+			if guess[0] != point.Y[0] {
+				mistakes++
+			}
+		}
+
+		assert.True(t, mistakes < 15, "Model (one-vs-rest: %v) should classify the blobs - made %v mistakes out of 300", oneVsRest, mistakes)
+	}
+}
+
+func TestMulticlassPerceptronShouldFail1(t *testing.T) {
+	stream := make(chan base.Datapoint, 100)
+	errors := make(chan error, 100)
+
+	model := NewMulticlassPerceptron(0.1, 3, 2)
+
+	go model.OnlineLearn(errors, stream, func(theta [][]float64) {})
+
+	// wrong dimensions, non-integer label and
+	// labels out of range
+	stream <- base.Datapoint{X: []float64{1}, Y: []float64{0}}
+	stream <- base.Datapoint{X: []float64{1, 2}, Y: []float64{0.5}}
+	stream <- base.Datapoint{X: []float64{1, 2}, Y: []float64{3}}
+	stream <- base.Datapoint{X: []float64{1, 2}, Y: []float64{-1}}
+	close(stream)
+
+	var count int
+	for err := range errors {
+		assert.NotNil(t, err, "Errors sent should not be nil")
+		count++
+	}
+	assert.Equal(t, 4, count, "Every invalid datapoint should return an error")
+
+	errors = make(chan error, 1)
+	go NewMulticlassPerceptron(0.1, 1, 2).OnlineLearn(errors, make(chan base.Datapoint), func(theta [][]float64) {})
+
+	err := <-errors
+	assert.NotNil(t, err, "Learning with less than 2 classes should return an error")
+}
+
+func TestLoadMulticlassPerceptronShouldPass1(t *testing.T) {
+	model := NewMulticlassPerceptron(0.3, 3, 2)
+	model.UpdateOneVsRest(true)
+	model.Parameters = [][]float64{{1, -2, 0.5}, {0, 1, 1}, {-1, 0, 2}}
+
+	err := model.PersistToFile("/tmp/.goml/MulticlassPerceptron.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/MulticlassPerceptron.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*MulticlassPerceptron)
+	assert.True(t, ok, "Loaded model should be a *MulticlassPerceptron")
+	assert.Equal(t, model.Parameters, restored.Parameters, "Parameters should be restored")
+	assert.Equal(t, 3, restored.Classes(), "Number of classes should be restored")
+	assert.True(t, restored.oneVsRest, "One-vs-rest training should be restored")
+	assert.Equal(t, 0.3, restored.alpha, "Learning rate should be restored")
+}
@@ -0,0 +1,596 @@
+package perceptron
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/admpub/goml/base"
+)
+
+// PAVariant is the variant of the Passive-Aggressive
+// algorithm used by a PassiveAggressive model, which
+// determines how aggressively it updates
+type PAVariant string
+
+// Passive-Aggressive variants
+//
+// http://jmlr.csail.mit.edu/papers/volume7/crammer06a/crammer06a.pdf
+const (
+	// PA makes the smallest update which gets the
+	// current example right with a margin of 1 (or
+	// within ε, for regression.) It's the most
+	// aggressive variant and doesn't use C.
+	PA PAVariant = "PA"
+
+	// PAI caps the step size at the aggressiveness
+	// parameter C
+	PAI PAVariant = "PA-I"
+
+	// PAII shrinks the step size smoothly, the more
+	// so the smaller the aggressiveness parameter C
+	PAII PAVariant = "PA-II"
+)
+
+// stepSize returns the step size τ of an update
+// given the loss, the squared norm of the input and
+// the aggressiveness parameter C
+func (v PAVariant) stepSize(loss, norm, c float64) float64 {
+	switch v {
+	case PAI:
+		return math.Min(c, loss/norm)
+	case PAII:
+		return loss / (norm + 1/(2*c))
+	default:
+		return loss / norm
+	}
+}
+
+// validate checks the variant and the aggressiveness
+// parameter C
+func (v PAVariant) validate(c float64) error {
+	switch v {
+	case PA:
+		return nil
+	case PAI, PAII:
+		if c <= 0 {
+			return fmt.Errorf("ERROR: The aggressiveness parameter C of %v must be greater than 0 - given %v\n", v, c)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("ERROR: Unknown Passive-Aggressive variant %q\n", v)
+}
+
+// PassiveAggressive represents the Passive-Aggressive
+// online binary classifier of Crammer et al. Like the
+// Perceptron it keeps a parameter vector θ and predicts
+// sgn(θx), but it updates whenever the margin of an
+// example is less than 1 (not only on mistakes,) and
+// with a step size based on how wrong it was:
+//     loss = max(0, 1 - yθx)
+//     θ := θ + τyx
+// where the step size τ depends on the variant (PA,
+// PA-I or PA-II) and the aggressiveness parameter C.
+// The update is "passive" when the loss is 0 and
+// "aggressive" otherwise, making the smallest change
+// which gets the example right.
+//
+// Like the Perceptron, θ[0] is the constant term and
+// data results are expected to be either -1 or 1.
+type PassiveAggressive struct {
+	variant PAVariant
+
+	// c is the aggressiveness parameter C
+	c float64
+
+	Parameters []float64 `json:"theta"`
+
+	// Output is the io.Writer used for logging
+	// and printing. Defaults to os.Stdout.
+	Output io.Writer
+}
+
+// NewPassiveAggressive takes in the Passive-Aggressive
+// variant, the aggressiveness parameter C (ignored by
+// PA) and the number of features (not including the
+// constant term) being evaluated by the model and
+// returns a new model. An empty variant defaults to PA-I.
+//
+// Smaller C makes the model less sensitive to noisy
+// or mislabeled examples. C = 1 is a reasonable start.
+func NewPassiveAggressive(variant PAVariant, c float64, features int) *PassiveAggressive {
+	if variant == "" {
+		variant = PAI
+	}
+
+	return &PassiveAggressive{
+		variant: variant,
+		c:       c,
+
+		Parameters: make([]float64, features+1),
+		Output:     os.Stdout,
+	}
+}
+
+// UpdateAggressiveness sets the aggressiveness
+// parameter C of the model
+func (p *PassiveAggressive) UpdateAggressiveness(c float64) {
+	p.c = c
+}
+
+// Variant returns the Passive-Aggressive variant
+// of the model
+func (p *PassiveAggressive) Variant() PAVariant {
+	return p.variant
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// finds the value of the hypothesis function given the
+// current parameter vector θ, either -1 or 1
+func (p *PassiveAggressive) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if len(x)+1 != len(p.Parameters) {
+		return nil, fmt.Errorf("Error: Parameter vector should be 1 longer than input vector!\n\tLength of x given: %v\n\tLength of parameters: %v\n", len(x), len(p.Parameters))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	return []float64{sign(dot(p.Parameters, x))}, nil
+}
+
+// OnlineLearn runs off of the given datastream like
+// Perceptron.OnlineLearn. Whenever the margin of a
+// point is less than 1 the parameter vector θ is updated
+// and onUpdate is called (in a new goroutine) with a
+// copy of θ. Learning will stop when the data channel is
+// closed and all remaining datapoints within the channel
+// have been read, after which the errors channel is
+// closed.
+//
+// NOTE that there is an optional last parameter which,
+// when true, will normalize all data given on the
+// stream.
+func (p *PassiveAggressive) OnlineLearn(errors chan error, dataset chan base.Datapoint, onUpdate func([][]float64), normalize ...bool) {
+	if errors == nil {
+		errors = make(chan error)
+	}
+	if dataset == nil {
+		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
+		close(errors)
+		return
+	}
+
+	err := p.variant.validate(p.c)
+	if err != nil {
+		errors <- err
+		close(errors)
+		return
+	}
+
+	fmt.Fprintf(p.Output, "Training:\n\tModel: Passive-Aggressive Classifier\n\tOptimization Method: Online %v\n\tFeatures: %v\n\tAggressiveness C: %v\n...\n\n", p.variant, len(p.Parameters)-1, p.c)
+
+	norm := len(normalize) != 0 && normalize[0]
+
+	var point base.Datapoint
+	var more bool
+
+	for {
+		point, more = <-dataset
+
+		if more {
+			if norm {
+				base.NormalizePoint(point.X)
+			}
+
+			if len(point.Y) != 1 || (point.Y[0] != -1 && point.Y[0] != 1) {
+				errors <- fmt.Errorf("The Passive-Aggressive classifier requires that the data results (y) be either [-1] or [1] - given %v", point.Y)
+				continue
+			}
+
+			if len(point.X) != len(p.Parameters)-1 {
+				errors <- fmt.Errorf("The Passive-Aggressive classifier requires that the length of input data (currently %v) be one less than the length of the parameter vector (%v)", len(point.X), len(p.Parameters))
+				continue
+			}
+
+			y := point.Y[0]
+			loss := 1 - y*dot(p.Parameters, point.X)
+			if loss > 0 {
+				tau := p.variant.stepSize(loss, squaredNorm(point.X), p.c)
+				step(p.Parameters, point.X, tau*y)
+
+				go onUpdate([][]float64{append([]float64{}, p.Parameters...)})
+			}
+
+		} else {
+			fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+			close(errors)
+			return
+		}
+	}
+}
+
+// squaredNorm returns |x|² + 1, the squared norm of
+// x with the constant term included
+func squaredNorm(x []float64) float64 {
+	norm := 1.0
+	for i := range x {
+		norm += x[i] * x[i]
+	}
+
+	return norm
+}
+
+// step adds s*x to θ, including the constant term
+func step(theta, x []float64, s float64) {
+	theta[0] += s
+	for i := range x {
+		theta[i+1] += s * x[i]
+	}
+}
+
+// String implements the fmt interface for clean printing
+func (p *PassiveAggressive) String() string {
+	return fmt.Sprintf("h(θ,x) = θx > 0 ? 1 : -1\n%v", linearString(p.Parameters))
+}
+
+// linearString prints θx, where θ[0] is the constant
+// term
+func linearString(theta []float64) string {
+	if len(theta) == 0 {
+		return "θx = 0"
+	}
+
+	var buffer bytes.Buffer
+
+	buffer.WriteString(fmt.Sprintf("θx = %.3f", theta[0]))
+	for i := 1; i < len(theta); i++ {
+		buffer.WriteString(fmt.Sprintf(" + %.5f(x[%d])", theta[i], i))
+	}
+
+	return buffer.String()
+}
+
+// PassiveAggressiveRegressor represents the
+// Passive-Aggressive online regression model. It
+// predicts θx, and updates whenever its prediction
+// is further than ε from the expected result (the
+// ε-insensitive loss):
+//     loss = max(0, |θx - y| - ε)
+//     θ := θ + τ * sgn(y - θx) * x
+// where the step size τ depends on the variant (PA,
+// PA-I or PA-II) and the aggressiveness parameter C.
+type PassiveAggressiveRegressor struct {
+	variant PAVariant
+
+	// c is the aggressiveness parameter C and
+	// epsilon the insensitivity ε
+	c       float64
+	epsilon float64
+
+	Parameters []float64 `json:"theta"`
+
+	// Output is the io.Writer used for logging
+	// and printing. Defaults to os.Stdout.
+	Output io.Writer
+}
+
+// NewPassiveAggressiveRegressor takes in the
+// Passive-Aggressive variant, the aggressiveness
+// parameter C (ignored by PA,) the insensitivity ε and
+// the number of features (not including the constant
+// term) being evaluated by the model and returns a new
+// model. An empty variant defaults to PA-I.
+//
+// Errors within ε of the expected result don't cause
+// updates, so ε should be about the noise of the data.
+func NewPassiveAggressiveRegressor(variant PAVariant, c, epsilon float64, features int) *PassiveAggressiveRegressor {
+	if variant == "" {
+		variant = PAI
+	}
+
+	return &PassiveAggressiveRegressor{
+		variant: variant,
+		c:       c,
+		epsilon: epsilon,
+
+		Parameters: make([]float64, features+1),
+		Output:     os.Stdout,
+	}
+}
+
+// UpdateAggressiveness sets the aggressiveness
+// parameter C of the model
+func (p *PassiveAggressiveRegressor) UpdateAggressiveness(c float64) {
+	p.c = c
+}
+
+// UpdateEpsilon sets the insensitivity ε of the model
+func (p *PassiveAggressiveRegressor) UpdateEpsilon(epsilon float64) {
+	p.epsilon = epsilon
+}
+
+// Variant returns the Passive-Aggressive variant
+// of the model
+func (p *PassiveAggressiveRegressor) Variant() PAVariant {
+	return p.variant
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns θx
+func (p *PassiveAggressiveRegressor) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if len(x)+1 != len(p.Parameters) {
+		return nil, fmt.Errorf("Error: Parameter vector should be 1 longer than input vector!\n\tLength of x given: %v\n\tLength of parameters: %v\n", len(x), len(p.Parameters))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	return []float64{dot(p.Parameters, x)}, nil
+}
+
+// OnlineLearn runs off of the given datastream like
+// PassiveAggressive.OnlineLearn, updating θ whenever
+// a prediction is further than ε from the expected
+// result and calling onUpdate (in a new goroutine)
+// with a copy of θ.
+func (p *PassiveAggressiveRegressor) OnlineLearn(errors chan error, dataset chan base.Datapoint, onUpdate func([][]float64), normalize ...bool) {
+	if errors == nil {
+		errors = make(chan error)
+	}
+	if dataset == nil {
+		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
+		close(errors)
+		return
+	}
+
+	err := p.variant.validate(p.c)
+	if err == nil && p.epsilon < 0 {
+		err = fmt.Errorf("ERROR: The insensitivity ε must not be negative - given %v\n", p.epsilon)
+	}
+	if err != nil {
+		errors <- err
+		close(errors)
+		return
+	}
+
+	fmt.Fprintf(p.Output, "Training:\n\tModel: Passive-Aggressive Regression\n\tOptimization Method: Online %v\n\tFeatures: %v\n\tAggressiveness C: %v\n\tInsensitivity ε: %v\n...\n\n", p.variant, len(p.Parameters)-1, p.c, p.epsilon)
+
+	norm := len(normalize) != 0 && normalize[0]
+
+	var point base.Datapoint
+	var more bool
+
+	for {
+		point, more = <-dataset
+
+		if more {
+			if norm {
+				base.NormalizePoint(point.X)
+			}
+
+			if len(point.Y) != 1 {
+				errors <- fmt.Errorf("The Passive-Aggressive regressor requires that the data results (y) have length 1 - given %v", len(point.Y))
+				continue
+			}
+
+			if len(point.X) != len(p.Parameters)-1 {
+				errors <- fmt.Errorf("The Passive-Aggressive regressor requires that the length of input data (currently %v) be one less than the length of the parameter vector (%v)", len(point.X), len(p.Parameters))
+				continue
+			}
+
+			diff := point.Y[0] - dot(p.Parameters, point.X)
+			loss := math.Abs(diff) - p.epsilon
+			if loss > 0 {
+				tau := p.variant.stepSize(loss, squaredNorm(point.X), p.c)
+				if diff < 0 {
+					tau = -tau
+				}
+				step(p.Parameters, point.X, tau)
+
+				go onUpdate([][]float64{append([]float64{}, p.Parameters...)})
+			}
+
+		} else {
+			fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+			close(errors)
+			return
+		}
+	}
+}
+
+// String implements the fmt interface for clean printing
+func (p *PassiveAggressiveRegressor) String() string {
+	return fmt.Sprintf("h(θ,x) = θx\n%v", linearString(p.Parameters))
+}
+
+// passiveAggressiveHyperparameters holds the
+// hyperparameters of both Passive-Aggressive models
+// as saved in their envelopes
+type passiveAggressiveHyperparameters struct {
+	Variant PAVariant `json:"variant"`
+	C       float64   `json:"c"`
+	Epsilon float64   `json:"epsilon,omitempty"`
+}
+
+// names the Passive-Aggressive models are registered
+// and persisted under
+const (
+	passiveAggressiveType          = "perceptron.PassiveAggressive"
+	passiveAggressiveRegressorType = "perceptron.PassiveAggressiveRegressor"
+)
+
+func init() {
+	base.RegisterModel(passiveAggressiveType, func() base.Persistable {
+		return NewPassiveAggressive("", 0, 0)
+	})
+	base.RegisterModel(passiveAggressiveRegressorType, func() base.Persistable {
+		return NewPassiveAggressiveRegressor("", 0, 0, 0)
+	})
+}
+
+// marshalLinearEnvelope wraps a parameter vector θ
+// (whose first value is the constant term) and the
+// given hyperparameters in a base.Envelope
+func marshalLinearEnvelope(modelType string, hyper interface{}, theta []float64) (*base.Envelope, error) {
+	features := len(theta) - 1
+	if features < 0 {
+		features = 0
+	}
+
+	env := &base.Envelope{
+		Type: modelType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+	}
+
+	err := env.Encode(hyper, theta)
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// MarshalEnvelope returns the model, along with its
+// variant and C, wrapped in a base.Envelope. The data
+// of the envelope is the parameter vector θ.
+func (p *PassiveAggressive) MarshalEnvelope() (*base.Envelope, error) {
+	return marshalLinearEnvelope(passiveAggressiveType, passiveAggressiveHyperparameters{
+		Variant: p.variant,
+		C:       p.c,
+	}, p.Parameters)
+}
+
+// UnmarshalEnvelope restores the model's parameter
+// vector θ, variant and C from the given base.Envelope
+func (p *PassiveAggressive) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := passiveAggressiveHyperparameters{
+		Variant: p.variant,
+		C:       p.c,
+	}
+
+	var params []float64
+	err := env.Decode(passiveAggressiveType, &hyper, &params)
+	if err != nil {
+		return err
+	}
+
+	p.variant = hyper.Variant
+	p.c = hyper.C
+	p.Parameters = params
+
+	return nil
+}
+
+// MarshalEnvelope returns the model, along with its
+// variant, C and ε, wrapped in a base.Envelope. The
+// data of the envelope is the parameter vector θ.
+func (p *PassiveAggressiveRegressor) MarshalEnvelope() (*base.Envelope, error) {
+	return marshalLinearEnvelope(passiveAggressiveRegressorType, passiveAggressiveHyperparameters{
+		Variant: p.variant,
+		C:       p.c,
+		Epsilon: p.epsilon,
+	}, p.Parameters)
+}
+
+// UnmarshalEnvelope restores the model's parameter
+// vector θ, variant, C and ε from the given
+// base.Envelope
+func (p *PassiveAggressiveRegressor) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := passiveAggressiveHyperparameters{
+		Variant: p.variant,
+		C:       p.c,
+		Epsilon: p.epsilon,
+	}
+
+	var params []float64
+	err := env.Decode(passiveAggressiveRegressorType, &hyper, &params)
+	if err != nil {
+		return err
+	}
+
+	p.variant = hyper.Variant
+	p.c = hyper.C
+	p.epsilon = hyper.Epsilon
+	p.Parameters = params
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later.
+func (p *PassiveAggressive) PersistToFile(path string) error {
+	return base.PersistModel(path, p)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores the model from it.
+func (p *PassiveAggressive) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, p)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (p *PassiveAggressive) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, p)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (p *PassiveAggressive) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, p)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (p *PassiveAggressive) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(p)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (p *PassiveAggressive) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, p)
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later.
+func (p *PassiveAggressiveRegressor) PersistToFile(path string) error {
+	return base.PersistModel(path, p)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores the model from it.
+func (p *PassiveAggressiveRegressor) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, p)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (p *PassiveAggressiveRegressor) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, p)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (p *PassiveAggressiveRegressor) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, p)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (p *PassiveAggressiveRegressor) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(p)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (p *PassiveAggressiveRegressor) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, p)
+}
@@ -0,0 +1,170 @@
+package perceptron
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// learnStream runs OnlineLearn on the given datapoints
+// and returns the first error sent, if any
+func learnStream(model interface {
+	OnlineLearn(chan error, chan base.Datapoint, func([][]float64), ...bool)
+}, points []base.Datapoint) error {
+	stream := make(chan base.Datapoint, 100)
+	errors := make(chan error)
+
+	go model.OnlineLearn(errors, stream, func(theta [][]float64) {})
+
+	go func() {
+		for _, point := range points {
+			stream <- point
+		}
+
+		close(stream)
+	}()
+
+	var first error
+	for err := range errors {
+		if first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+func TestPassiveAggressiveShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(13))
+
+	// 5% of the labels are flipped
+	var points []base.Datapoint
+	for i := 0; i < 3000; i++ {
+		x := []float64{r.Float64()*10 - 5, r.Float64()*10 - 5}
+		y := -1.0
+		if 2*x[0]-x[1]+1 > 0 {
+			y = 1
+		}
+		if r.Float64() < 0.05 {
+			y *= -1
+		}
+
+		points = append(points, base.Datapoint{X: x, Y: []float64{y}})
+	}
+
+	for _, variant := range []PAVariant{PA, PAI, PAII} {
+		model := NewPassiveAggressive(variant, 0.1, 2)
+		assert.Equal(t, variant, model.Variant(), "Model should use the given variant")
+
+		err := learnStream(model, points)
+		assert.Nil(t, err, "Learning error should be nil")
+
+		var mistakes int
+		for i := 0; i < 500; i++ {
+			x := []float64{r.Float64()*10 - 5, r.Float64()*10 - 5}
+			y := -1.0
+			if 2*x[0]-x[1]+1 > 0 {
+				y = 1
+			}
+
+			guess, err := model.Predict(x)
+			assert.Nil(t, err, "Prediction error should be nil")
+			if guess[0] != y {
+				mistakes++
+			}
+		}
+
+		// PA has no C to damp the flipped labels
+		limit := 50
+		if variant == PA {
+			limit = 100
+		}
+		assert.True(t, mistakes < limit, "%v should learn the boundary - made %v mistakes out of 500", variant, mistakes)
+	}
+}
+
+func TestPassiveAggressiveRegressorShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(17))
+
+	var points []base.Datapoint
+	for i := 0; i < 3000; i++ {
+		x := []float64{r.Float64()*4 - 2, r.Float64()*4 - 2}
+		points = append(points, base.Datapoint{
+			X: x,
+			Y: []float64{3*x[0] - 2*x[1] + 1 + r.NormFloat64()*0.05},
+		})
+	}
+
+	for _, variant := range []PAVariant{PA, PAI, PAII} {
+		model := NewPassiveAggressiveRegressor(variant, 0.5, 0.05, 2)
+
+		err := learnStream(model, points)
+		assert.Nil(t, err, "Learning error should be nil")
+
+		assert.InDelta(t, 1, model.Parameters[0], 0.1, "%v should learn the constant term", variant)
+		assert.InDelta(t, 3, model.Parameters[1], 0.1, "%v should learn θ[1]", variant)
+		assert.InDelta(t, -2, model.Parameters[2], 0.1, "%v should learn θ[2]", variant)
+
+		guess, err := model.Predict([]float64{1, 1})
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.True(t, math.Abs(guess[0]-2) < 0.2, "%v should predict h(1, 1) ≈ 2 - predicted %v", variant, guess[0])
+	}
+}
+
+func TestPassiveAggressiveShouldFail1(t *testing.T) {
+	err := learnStream(NewPassiveAggressive(PAI, 0, 2), nil)
+	assert.NotNil(t, err, "PA-I without a positive C should return an error")
+
+	err = learnStream(NewPassiveAggressive(PAVariant("PA-III"), 1, 2), nil)
+	assert.NotNil(t, err, "Unknown variants should return an error")
+
+	err = learnStream(NewPassiveAggressiveRegressor(PA, 1, -1, 2), nil)
+	assert.NotNil(t, err, "Negative ε should return an error")
+
+	err = learnStream(NewPassiveAggressive(PA, 1, 2), []base.Datapoint{
+		{X: []float64{1, 2}, Y: []float64{0}},
+	})
+	assert.NotNil(t, err, "Results other than -1 and 1 should return an error")
+
+	err = learnStream(NewPassiveAggressiveRegressor(PA, 1, 0, 2), []base.Datapoint{
+		{X: []float64{1}, Y: []float64{0}},
+	})
+	assert.NotNil(t, err, "Wrong dimensions should return an error")
+
+	_, err = NewPassiveAggressive(PA, 1, 2).Predict([]float64{1})
+	assert.NotNil(t, err, "Predicting with the wrong dimensions should return an error")
+}
+
+func TestLoadPassiveAggressiveShouldPass1(t *testing.T) {
+	model := NewPassiveAggressiveRegressor(PAII, 0.5, 0.1, 2)
+	model.Parameters = []float64{1, -2, 0.5}
+
+	err := model.PersistToFile("/tmp/.goml/PassiveAggressiveRegressor.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/PassiveAggressiveRegressor.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*PassiveAggressiveRegressor)
+	assert.True(t, ok, "Loaded model should be a *PassiveAggressiveRegressor")
+	assert.Equal(t, model.Parameters, restored.Parameters, "Parameters should be restored")
+	assert.Equal(t, PAII, restored.Variant(), "Variant should be restored")
+	assert.Equal(t, 0.5, restored.c, "C should be restored")
+	assert.Equal(t, 0.1, restored.epsilon, "ε should be restored")
+
+	classifier := NewPassiveAggressive(PA, 0, 2)
+	classifier.Parameters = []float64{0.5, 1, -1}
+
+	data, err := classifier.MarshalBinary()
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	restoredClassifier := NewPassiveAggressive("", 0, 0)
+	err = restoredClassifier.UnmarshalBinary(data)
+	assert.Nil(t, err, "Unmarshal error should be nil")
+	assert.Equal(t, classifier.Parameters, restoredClassifier.Parameters, "Parameters should be restored")
+	assert.Equal(t, PA, restoredClassifier.Variant(), "Variant should be restored")
+}
@@ -92,10 +92,9 @@ package perceptron
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"math/rand"
 	"os"
 
 	"github.com/admpub/goml/base"
@@ -144,11 +143,34 @@ type Perceptron struct {
 
 	Parameters []float64 `json:"theta"`
 
+	// rng is the model's source of randomness for
+	// shuffling the training set every epoch. It's
+	// seeded from the current time unless the model
+	// is given a seed with UpdateSeed.
+	rng *rand.Rand
+
 	// Output is the io.Writer used for logging
 	// and printing. Defaults to os.Stdout.
 	Output io.Writer
+
+	// trainingSet and expectedResults are used
+	// by Learn (batch training)
+	trainingSet     [][]float64
+	expectedResults []float64
+
+	// maxEpochs is the most passes Learn makes over
+	// the training set, and averaged tells Learn to
+	// average the parameter vector over every step
+	maxEpochs int
+	averaged  bool
 }
 
+// DefaultMaxEpochs is the most passes over the
+// training set batch perceptron training makes
+// (unless changed with UpdateMaxEpochs) when the
+// training set isn't linearly separable
+const DefaultMaxEpochs = 100
+
 // NewPerceptron takes in a learning rate alpha, the
 // number of features (not including the constant
 // term) being evaluated by the model, the update
@@ -173,16 +195,185 @@ func NewPerceptron(alpha float64, features int) *Perceptron {
 		// initialize θ as the zero vector (that is,
 		// the vector of all zeros)
 		Parameters: params,
+		rng:        base.NewTimeSeededRandom(),
 		Output:     os.Stdout,
+
+		maxEpochs: DefaultMaxEpochs,
 	}
 }
 
+// UpdateSeed seeds the model's source of randomness
+// so learning is reproducible
+func (p *Perceptron) UpdateSeed(seed int64) {
+	p.rng = base.NewRandom(seed)
+}
+
+// UpdateRandom replaces the model's source of
+// randomness
+func (p *Perceptron) UpdateRandom(rng *rand.Rand) {
+	p.rng = rng
+}
+
 // UpdateLearningRate set's the learning rate of the model
 // to the given float64.
 func (p *Perceptron) UpdateLearningRate(a float64) {
 	p.alpha = a
 }
 
+// UpdateTrainingSet sets the examples (and their
+// expected results, each either -1 or 1) used by
+// Learn to train the model in batch
+func (p *Perceptron) UpdateTrainingSet(trainingSet [][]float64, expectedResults []float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("Error: length of given training set is 0! Need data!")
+	}
+	if len(expectedResults) == 0 {
+		return fmt.Errorf("Error: length of given result data set is 0! Need expected results!")
+	}
+
+	p.trainingSet = trainingSet
+	p.expectedResults = expectedResults
+
+	return nil
+}
+
+// UpdateMaxEpochs sets the most passes Learn makes
+// over the training set. Learning stops earlier if
+// a whole pass is made without a mistake.
+func (p *Perceptron) UpdateMaxEpochs(epochs int) {
+	p.maxEpochs = epochs
+}
+
+// UpdateAveraged sets whether Learn trains an averaged
+// perceptron, where the final parameter vector θ is
+// the average of θ after every training example. This
+// generalizes much better than the last θ when the data
+// isn't linearly separable, because the last θ depends
+// heavily on the last few mistakes.
+//
+// http://www.cs.columbia.edu/~mcollins/papers/tagperc.pdf
+func (p *Perceptron) UpdateAveraged(averaged bool) {
+	p.averaged = averaged
+}
+
+// Examples returns the number of training examples
+// that the model currently is training from.
+func (p *Perceptron) Examples() int {
+	return len(p.trainingSet)
+}
+
+// MaxEpochs returns the most passes Learn makes over
+// the training set
+func (p *Perceptron) MaxEpochs() int {
+	return p.maxEpochs
+}
+
+// Learn trains the model in batch on the training set
+// given with UpdateTrainingSet. The parameter vector θ
+// is reset to the zero vector, then the model makes
+// passes (epochs) over the training set, shuffled each
+// time, updating θ whenever it makes a wrong guess as
+// in OnlineLearn. Learning stops after an epoch without
+// mistakes (the data is linearly separable and θ
+// separates it) or after the max number of epochs.
+//
+// If the model is averaged (see UpdateAveraged,) θ is
+// set to the average of θ over every step at the end.
+func (p *Perceptron) Learn() error {
+	examples := len(p.trainingSet)
+	if examples == 0 || len(p.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(p.Output, err.Error())
+		return err
+	}
+
+	err := validateBinaryResults(p.trainingSet, p.expectedResults)
+	if err != nil {
+		fmt.Fprintf(p.Output, err.Error())
+		return err
+	}
+
+	features := len(p.trainingSet[0])
+
+	method := "Batch Perceptron"
+	if p.averaged {
+		method = "Averaged Perceptron"
+	}
+	fmt.Fprintf(p.Output, "Training:\n\tModel: Perceptron Classifier\n\tOptimization Method: %v\n\tTraining Examples: %v\n\tFeatures: %v\n\tLearning Rate α: %v\n\tMax Epochs: %v\n...\n\n", method, examples, features, p.alpha, p.maxEpochs)
+
+	p.Parameters = make([]float64, features+1)
+
+	// sum holds the sum of θ after every step,
+	// for averaging
+	sum := make([]float64, features+1)
+	var steps int
+
+	for epoch := 0; epoch < p.maxEpochs; epoch++ {
+		var mistakes int
+
+		for _, i := range p.rng.Perm(examples) {
+			x := p.trainingSet[i]
+			y := p.expectedResults[i]
+
+			guess, err := p.Predict(x)
+			if err != nil {
+				fmt.Fprintf(p.Output, "\nERROR: Error while learning –\n\t%v\n\n", err)
+				return err
+			}
+
+			if guess[0] != y {
+				mistakes++
+
+				p.Parameters[0] += p.alpha * (y - guess[0])
+				for j := 1; j < len(p.Parameters); j++ {
+					p.Parameters[j] += p.alpha * (y - guess[0]) * x[j-1]
+				}
+			}
+
+			if p.averaged {
+				for j := range sum {
+					sum[j] += p.Parameters[j]
+				}
+				steps++
+			}
+		}
+
+		if mistakes == 0 {
+			break
+		}
+	}
+
+	if p.averaged && steps != 0 {
+		for j := range p.Parameters {
+			p.Parameters[j] = sum[j] / float64(steps)
+		}
+	}
+
+	fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+
+	return nil
+}
+
+// validateBinaryResults checks that a training set
+// has one expected result per example, each either
+// -1 or 1, and that all examples are the same length
+func validateBinaryResults(trainingSet [][]float64, expectedResults []float64) error {
+	if len(expectedResults) != len(trainingSet) {
+		return fmt.Errorf("ERROR: Number of expected results (%v) doesn't match the number of training examples (%v)!\n", len(expectedResults), len(trainingSet))
+	}
+
+	for i, y := range expectedResults {
+		if y != -1 && y != 1 {
+			return fmt.Errorf("ERROR: The binary perceptron model requires that the data results (y) be either -1 or 1 - given %v at example %v\n", y, i)
+		}
+		if len(trainingSet[i]) != len(trainingSet[0]) {
+			return fmt.Errorf("ERROR: Training example %v has length %v but the first example has length %v!\n", i, len(trainingSet[i]), len(trainingSet[0]))
+		}
+	}
+
+	return nil
+}
+
 // Predict takes in a variable x (an array of floats,) and
 // finds the value of the hypothesis function given the
 // current parameter vector θ
@@ -406,56 +597,125 @@ func (p *Perceptron) String() string {
 	return buffer.String()
 }
 
-// PersistToFile takes in an absolute filepath and saves the
-// parameter vector θ to the file, which can be restored later.
-// The function will take paths from the current directory, but
-// functions
-//
-// The data is stored as JSON because it's one of the most
-// efficient storage method (you only need one comma extra
-// per feature + two brackets, total!) And it's extendable.
-func (p *Perceptron) PersistToFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+// perceptronHyperparameters holds the hyperparameters
+// of a Perceptron as saved in its envelope
+type perceptronHyperparameters struct {
+	Alpha     float64 `json:"alpha"`
+	MaxEpochs int     `json:"max_epochs,omitempty"`
+	Averaged  bool    `json:"averaged,omitempty"`
+}
+
+// perceptronType is the name Perceptron models are
+// registered and persisted under
+const perceptronType = "perceptron.Perceptron"
+
+func init() {
+	base.RegisterModel(perceptronType, func() base.Persistable {
+		return NewPerceptron(0, 0)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// learning rate, wrapped in a base.Envelope. The data
+// of the envelope is the parameter vector θ.
+func (p *Perceptron) MarshalEnvelope() (*base.Envelope, error) {
+	features := len(p.Parameters) - 1
+	if features < 0 {
+		features = 0
+	}
+
+	env := &base.Envelope{
+		Type: perceptronType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
 	}
 
-	bytes, err := json.Marshal(p.Parameters)
+	err := env.Encode(perceptronHyperparameters{
+		Alpha:     p.alpha,
+		MaxEpochs: p.maxEpochs,
+		Averaged:  p.averaged,
+	}, p.Parameters)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = ioutil.WriteFile(path, bytes, os.ModePerm)
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's parameter
+// vector θ, as well as the learning rate if it was
+// saved, from the given base.Envelope
+func (p *Perceptron) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := perceptronHyperparameters{
+		Alpha:     p.alpha,
+		MaxEpochs: p.maxEpochs,
+		Averaged:  p.averaged,
+	}
+
+	var params []float64
+	err := env.Decode(perceptronType, &hyper, &params)
 	if err != nil {
 		return err
 	}
 
+	p.alpha = hyper.Alpha
+	p.maxEpochs = hyper.MaxEpochs
+	p.averaged = hyper.Averaged
+	p.Parameters = params
+
 	return nil
 }
 
-// RestoreFromFile takes in a path to a parameter vector theta
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later. The
+// function will take paths from the current directory, but
+// functions
+//
+// The model is stored as a JSON base.Envelope holding the
+// parameter vector θ as well as the learning rate so a
+// restored model can keep on learning.
+func (p *Perceptron) PersistToFile(path string) error {
+	return base.PersistModel(path, p)
+}
+
+// RestoreFromFile takes in a path to a persisted model
 // and assigns the model it's operating on's parameter vector
-// to that.
+// and learning rate to those persisted.
 //
 // The path must ba an absolute path or a path from the current
 // directory
 //
+// Files holding only the parameter vector θ (as persisted by
+// older versions of goml) can also be restored.
+//
 // This would be useful in persisting data between running
 // a model on data, or for graphing a dataset with a fit in
 // another framework like Julia/Gadfly.
 func (p *Perceptron) RestoreFromFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
-	}
+	return base.RestoreModel(path, p)
+}
 
-	bytes, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
-	}
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (p *Perceptron) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, p)
+}
 
-	err = json.Unmarshal(bytes, &p.Parameters)
-	if err != nil {
-		return err
-	}
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (p *Perceptron) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, p)
+}
 
-	return nil
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (p *Perceptron) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(p)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (p *Perceptron) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, p)
 }
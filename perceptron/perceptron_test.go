@@ -2,6 +2,7 @@ package perceptron
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -394,3 +395,139 @@ func TestPersistPerceptronShouldPass1(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadPerceptronShouldPass1(t *testing.T) {
+	model := NewPerceptron(0.3, 2)
+	model.Parameters = []float64{1, -2, 0.5}
+
+	err := model.PersistToFile("/tmp/.goml/PerceptronEnvelope.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/PerceptronEnvelope.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*Perceptron)
+	assert.True(t, ok, "Loaded model should be a *Perceptron")
+	assert.Equal(t, model.Parameters, restored.Parameters, "Parameters should be restored")
+	assert.Equal(t, 0.3, restored.alpha, "Learning rate should be restored")
+}
+
+func TestLearnPerceptronShouldPass1(t *testing.T) {
+	var x [][]float64
+	var y []float64
+	for i := -50.0; i < 50; i++ {
+		for j := -5.0; j < 5; j++ {
+			x = append(x, []float64{i, j})
+			if i/2+2*j+3 > 0 {
+				y = append(y, 1)
+			} else {
+				y = append(y, -1)
+			}
+		}
+	}
+
+	for _, averaged := range []bool{false, true} {
+		model := NewPerceptron(0.1, 2)
+		model.UpdateAveraged(averaged)
+		model.UpdateMaxEpochs(1000)
+
+		err := model.UpdateTrainingSet(x, y)
+		assert.Nil(t, err, "Updating the training set should not return an error")
+		assert.Equal(t, len(x), model.Examples(), "Model should have all training examples")
+
+		err = model.Learn()
+		assert.Nil(t, err, "Learning error should be nil")
+
+		var mistakes int
+		for i := range x {
+			guess, err := model.Predict(x[i])
+			assert.Nil(t, err, "Prediction error should be nil")
+			if guess[0] != y[i] {
+				mistakes++
+			}
+		}
+
+		if averaged {
+			// the average of θ doesn't have to separate
+			// the data, but should come close
+			assert.True(t, mistakes < len(x)/50, "Averaged perceptron should make few mistakes - made %v", mistakes)
+		} else {
+			assert.Equal(t, 0, mistakes, "Perceptron should separate linearly separable data")
+		}
+	}
+}
+
+func TestLearnPerceptronShouldFail1(t *testing.T) {
+	model := NewPerceptron(0.1, 2)
+
+	err := model.Learn()
+	assert.NotNil(t, err, "Learning without a training set should return an error")
+
+	err = model.UpdateTrainingSet([][]float64{{0, 0}, {1, 1}}, []float64{0, 1})
+	assert.Nil(t, err, "Updating the training set should not return an error")
+
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning with results other than -1 and 1 should return an error")
+
+	err = model.UpdateTrainingSet([][]float64{{0, 0}, {1}}, []float64{-1, 1})
+	assert.Nil(t, err, "Updating the training set should not return an error")
+
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning with examples of different lengths should return an error")
+}
+
+func TestLoadAveragedPerceptronShouldPass1(t *testing.T) {
+	model := NewPerceptron(0.3, 2)
+	model.UpdateAveraged(true)
+	model.UpdateMaxEpochs(7)
+	model.Parameters = []float64{1, -2, 0.5}
+
+	data, err := model.MarshalBinary()
+	assert.Nil(t, err, "Marshal error should be nil")
+
+	restored := NewPerceptron(0, 0)
+	err = restored.UnmarshalBinary(data)
+	assert.Nil(t, err, "Unmarshal error should be nil")
+
+	assert.True(t, restored.averaged, "Averaging should be restored")
+	assert.Equal(t, 7, restored.MaxEpochs(), "Max epochs should be restored")
+	assert.Equal(t, model.Parameters, restored.Parameters, "Parameters should be restored")
+}
+
+func TestLearnPerceptronSeedShouldPass1(t *testing.T) {
+	var _ base.Randomized = NewPerceptron(0.1, 2)
+
+	// every 7th label is flipped, so the data isn't
+	// separable and θ depends on the order of the
+	// examples in every epoch
+	var x [][]float64
+	var y []float64
+	for i := -20.0; i < 20; i++ {
+		for j := -5.0; j < 5; j++ {
+			x = append(x, []float64{i, j})
+			if (i/2+2*j+3 > 0) != (len(y)%7 == 0) {
+				y = append(y, 1)
+			} else {
+				y = append(y, -1)
+			}
+		}
+	}
+
+	models := make([]*Perceptron, 3)
+	for i := range models {
+		models[i] = NewPerceptron(0.1, 2)
+		models[i].UpdateMaxEpochs(5)
+		models[i].Output = ioutil.Discard
+		if i < 2 {
+			models[i].UpdateSeed(42)
+		} else {
+			models[i].UpdateSeed(43)
+		}
+
+		assert.Nil(t, models[i].UpdateTrainingSet(x, y), "Updating the training set should not return an error")
+		assert.Nil(t, models[i].Learn(), "Learning error should be nil")
+	}
+
+	assert.Equal(t, models[0].Parameters, models[1].Parameters, "Models with the same seed should learn the same parameters")
+	assert.NotEqual(t, models[0].Parameters, models[2].Parameters, "Models with different seeds should shuffle differently")
+}
@@ -0,0 +1,372 @@
+package perceptron
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+
+	"github.com/admpub/goml/base"
+)
+
+// VotedPerceptron represents the voted perceptron
+// of Freund and Schapire. It trains like the batch
+// Perceptron, but instead of keeping only the last
+// parameter vector θ it keeps every θ it went through
+// along with the number of examples that θ survived
+// (classified correctly) before it made a mistake.
+// Predictions are a vote between all of those vectors,
+// each weighted by its survival count:
+//      sgn(Σ c[k] * sgn(θ[k]x))
+//
+// This makes the voted perceptron much more robust
+// than the regular perceptron when the data isn't
+// linearly separable, at the cost of more memory and
+// slower predictions (one dot product per vector.)
+// If that matters, an averaged Perceptron (see
+// Perceptron.UpdateAveraged) is a good approximation
+// that only keeps one vector.
+//
+// https://cseweb.ucsd.edu/~yfreund/papers/LargeMarginsUsingPerceptron.pdf
+//
+// VotedPerceptron is trained in batch only, with
+// UpdateTrainingSet and Learn.
+//
+// Data results in this binary class model are
+// expected to be either -1 or 1
+type VotedPerceptron struct {
+	// alpha is the learning rate of the perceptron
+	// algorithm
+	alpha float64
+
+	// Parameters holds every parameter vector θ the
+	// model went through while learning, and Votes the
+	// number of examples each one survived
+	Parameters [][]float64 `json:"theta"`
+	Votes      []float64   `json:"votes"`
+
+	// rng is the model's source of randomness for
+	// shuffling the training set every epoch. It's
+	// seeded from the current time unless the model
+	// is given a seed with UpdateSeed.
+	rng *rand.Rand
+
+	// Output is the io.Writer used for logging
+	// and printing. Defaults to os.Stdout.
+	Output io.Writer
+
+	// trainingSet and expectedResults are used
+	// by Learn
+	trainingSet     [][]float64
+	expectedResults []float64
+
+	// maxEpochs is the most passes Learn makes
+	// over the training set
+	maxEpochs int
+}
+
+// NewVotedPerceptron takes in a learning rate alpha
+// and returns a model ready to be given a training
+// set with UpdateTrainingSet
+func NewVotedPerceptron(alpha float64) *VotedPerceptron {
+	return &VotedPerceptron{
+		alpha:  alpha,
+		rng:    base.NewTimeSeededRandom(),
+		Output: os.Stdout,
+
+		maxEpochs: DefaultMaxEpochs,
+	}
+}
+
+// UpdateSeed seeds the model's source of randomness
+// so learning is reproducible
+func (p *VotedPerceptron) UpdateSeed(seed int64) {
+	p.rng = base.NewRandom(seed)
+}
+
+// UpdateRandom replaces the model's source of
+// randomness
+func (p *VotedPerceptron) UpdateRandom(rng *rand.Rand) {
+	p.rng = rng
+}
+
+// UpdateLearningRate set's the learning rate of the model
+// to the given float64.
+func (p *VotedPerceptron) UpdateLearningRate(a float64) {
+	p.alpha = a
+}
+
+// UpdateTrainingSet sets the examples (and their
+// expected results, each either -1 or 1) used by
+// Learn to train the model
+func (p *VotedPerceptron) UpdateTrainingSet(trainingSet [][]float64, expectedResults []float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("Error: length of given training set is 0! Need data!")
+	}
+	if len(expectedResults) == 0 {
+		return fmt.Errorf("Error: length of given result data set is 0! Need expected results!")
+	}
+
+	p.trainingSet = trainingSet
+	p.expectedResults = expectedResults
+
+	return nil
+}
+
+// UpdateMaxEpochs sets the most passes Learn makes
+// over the training set. Learning stops earlier if
+// a whole pass is made without a mistake.
+func (p *VotedPerceptron) UpdateMaxEpochs(epochs int) {
+	p.maxEpochs = epochs
+}
+
+// Examples returns the number of training examples
+// that the model currently is training from.
+func (p *VotedPerceptron) Examples() int {
+	return len(p.trainingSet)
+}
+
+// Learn trains the model on the training set given
+// with UpdateTrainingSet, making shuffled passes over
+// it until a pass is made without mistakes or the
+// max number of epochs is reached. Every time the
+// model makes a mistake the current θ is saved with
+// its vote count, and a new θ is started from it.
+func (p *VotedPerceptron) Learn() error {
+	examples := len(p.trainingSet)
+	if examples == 0 || len(p.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(p.Output, err.Error())
+		return err
+	}
+
+	err := validateBinaryResults(p.trainingSet, p.expectedResults)
+	if err != nil {
+		fmt.Fprintf(p.Output, err.Error())
+		return err
+	}
+
+	features := len(p.trainingSet[0])
+
+	fmt.Fprintf(p.Output, "Training:\n\tModel: Voted Perceptron Classifier\n\tOptimization Method: Voted Perceptron\n\tTraining Examples: %v\n\tFeatures: %v\n\tLearning Rate α: %v\n\tMax Epochs: %v\n...\n\n", examples, features, p.alpha, p.maxEpochs)
+
+	p.Parameters = nil
+	p.Votes = nil
+
+	theta := make([]float64, features+1)
+	var votes float64
+
+	for epoch := 0; epoch < p.maxEpochs; epoch++ {
+		var mistakes int
+
+		for _, i := range p.rng.Perm(examples) {
+			x := p.trainingSet[i]
+			y := p.expectedResults[i]
+
+			guess := sign(dot(theta, x))
+			if guess == y {
+				votes++
+				continue
+			}
+
+			mistakes++
+
+			if votes != 0 {
+				p.Parameters = append(p.Parameters, theta)
+				p.Votes = append(p.Votes, votes)
+			}
+
+			next := make([]float64, len(theta))
+			next[0] = theta[0] + p.alpha*(y-guess)
+			for j := 1; j < len(next); j++ {
+				next[j] = theta[j] + p.alpha*(y-guess)*x[j-1]
+			}
+
+			theta = next
+			votes = 1
+		}
+
+		if mistakes == 0 {
+			break
+		}
+	}
+
+	p.Parameters = append(p.Parameters, theta)
+	p.Votes = append(p.Votes, votes)
+
+	fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+
+	return nil
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns the weighted vote of every parameter vector θ
+// of the model, either -1 or 1
+func (p *VotedPerceptron) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if len(p.Parameters) == 0 {
+		return nil, fmt.Errorf("ERROR: VotedPerceptron has no parameter vectors! Train first!")
+	}
+	if len(x)+1 != len(p.Parameters[0]) {
+		return nil, fmt.Errorf("Error: Parameter vector should be 1 longer than input vector!\n\tLength of x given: %v\n\tLength of parameters: %v\n", len(x), len(p.Parameters[0]))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	var vote float64
+	for k := range p.Parameters {
+		vote += p.Votes[k] * sign(dot(p.Parameters[k], x))
+	}
+
+	return []float64{sign(vote)}, nil
+}
+
+// dot returns θx, including the constant term θ[0]
+func dot(theta, x []float64) float64 {
+	sum := theta[0]
+	for i := range x {
+		sum += x[i] * theta[i+1]
+	}
+
+	return sum
+}
+
+// sign returns 1 if x > 0 and -1 otherwise, like
+// the perceptron's step function
+func sign(x float64) float64 {
+	if x > 0 {
+		return 1
+	}
+
+	return -1
+}
+
+// String implements the fmt interface for clean printing
+func (p *VotedPerceptron) String() string {
+	var votes float64
+	for _, v := range p.Votes {
+		votes += v
+	}
+
+	return fmt.Sprintf("h(θ,x) = Σ c[k]*(θ[k]x > 0 ? 1 : -1) > 0 ? 1 : -1\n\tTotal Parameter Vectors: %v\n\tTotal Votes: %v\n", len(p.Parameters), votes)
+}
+
+// votedPerceptronHyperparameters holds the
+// hyperparameters of a VotedPerceptron as saved
+// in its envelope
+type votedPerceptronHyperparameters struct {
+	Alpha     float64 `json:"alpha"`
+	MaxEpochs int     `json:"max_epochs,omitempty"`
+}
+
+// votedPerceptronData is the data of a VotedPerceptron
+// envelope
+type votedPerceptronData struct {
+	Parameters [][]float64 `json:"theta"`
+	Votes      []float64   `json:"votes"`
+}
+
+// votedPerceptronType is the name VotedPerceptron
+// models are registered and persisted under
+const votedPerceptronType = "perceptron.VotedPerceptron"
+
+func init() {
+	base.RegisterModel(votedPerceptronType, func() base.Persistable {
+		return NewVotedPerceptron(0)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// learning rate, wrapped in a base.Envelope. The data
+// of the envelope is the parameter vectors and votes.
+func (p *VotedPerceptron) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(p.Parameters) != 0 && len(p.Parameters[0]) != 0 {
+		features = len(p.Parameters[0]) - 1
+	}
+
+	env := &base.Envelope{
+		Type: votedPerceptronType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+	}
+
+	err := env.Encode(votedPerceptronHyperparameters{
+		Alpha:     p.alpha,
+		MaxEpochs: p.maxEpochs,
+	}, votedPerceptronData{
+		Parameters: p.Parameters,
+		Votes:      p.Votes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's parameter
+// vectors and votes, as well as the learning rate,
+// from the given base.Envelope
+func (p *VotedPerceptron) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := votedPerceptronHyperparameters{
+		Alpha:     p.alpha,
+		MaxEpochs: p.maxEpochs,
+	}
+
+	var data votedPerceptronData
+	err := env.Decode(votedPerceptronType, &hyper, &data)
+	if err != nil {
+		return err
+	}
+
+	if len(data.Parameters) != len(data.Votes) {
+		return fmt.Errorf("ERROR: VotedPerceptron has %v parameter vectors but %v votes", len(data.Parameters), len(data.Votes))
+	}
+
+	p.alpha = hyper.Alpha
+	p.maxEpochs = hyper.MaxEpochs
+	p.Parameters = data.Parameters
+	p.Votes = data.Votes
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later.
+func (p *VotedPerceptron) PersistToFile(path string) error {
+	return base.PersistModel(path, p)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores the model's parameter vectors, votes and
+// learning rate from it.
+func (p *VotedPerceptron) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, p)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (p *VotedPerceptron) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, p)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (p *VotedPerceptron) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, p)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (p *VotedPerceptron) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(p)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (p *VotedPerceptron) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, p)
+}
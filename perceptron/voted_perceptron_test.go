@@ -0,0 +1,145 @@
+package perceptron
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVotedPerceptronShouldPass1(t *testing.T) {
+	var x [][]float64
+	var y []float64
+	for i := -50.0; i < 50; i++ {
+		for j := -5.0; j < 5; j++ {
+			x = append(x, []float64{i, j})
+			if i/2+2*j+3 > 0 {
+				y = append(y, 1)
+			} else {
+				y = append(y, -1)
+			}
+		}
+	}
+
+	model := NewVotedPerceptron(0.1)
+	model.UpdateMaxEpochs(1000)
+
+	err := model.UpdateTrainingSet(x, y)
+	assert.Nil(t, err, "Updating the training set should not return an error")
+	assert.Equal(t, len(x), model.Examples(), "Model should have all training examples")
+
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.Equal(t, len(model.Parameters), len(model.Votes), "Every parameter vector should have a vote")
+
+	var mistakes int
+	for i := range x {
+		guess, err := model.Predict(x[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+		if guess[0] != y[i] {
+			mistakes++
+		}
+	}
+
+	assert.True(t, mistakes < len(x)/50, "Voted perceptron should make few mistakes - made %v", mistakes)
+}
+
+func TestVotedPerceptronNoisyShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+
+	// flip 5% of the labels, so the data
+	// isn't linearly separable
+	var x [][]float64
+	var y []float64
+	for i := 0; i < 400; i++ {
+		point := []float64{r.Float64()*20 - 10, r.Float64()*20 - 10}
+		label := -1.0
+		if point[0]-point[1]+1 > 0 {
+			label = 1
+		}
+		if r.Float64() < 0.05 {
+			label *= -1
+		}
+
+		x = append(x, point)
+		y = append(y, label)
+	}
+
+	model := NewVotedPerceptron(0.1)
+	model.UpdateMaxEpochs(20)
+
+	err := model.UpdateTrainingSet(x, y)
+	assert.Nil(t, err, "Updating the training set should not return an error")
+
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	// check against the true boundary
+	var mistakes int
+	for i := 0; i < 400; i++ {
+		point := []float64{r.Float64()*20 - 10, r.Float64()*20 - 10}
+		label := -1.0
+		if point[0]-point[1]+1 > 0 {
+			label = 1
+		}
+
+		guess, err := model.Predict(point)
+		assert.Nil(t, err, "Prediction error should be nil")
+		if guess[0] != label {
+			mistakes++
+		}
+	}
+
+	assert.True(t, mistakes < 40, "Voted perceptron should generalize on noisy data - made %v mistakes out of 400", mistakes)
+}
+
+func TestVotedPerceptronShouldFail1(t *testing.T) {
+	model := NewVotedPerceptron(0.1)
+
+	_, err := model.Predict([]float64{1, 2})
+	assert.NotNil(t, err, "Predicting before training should return an error")
+
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning without a training set should return an error")
+
+	err = model.UpdateTrainingSet([][]float64{{0, 0}, {1, 1}}, []float64{0, 1})
+	assert.Nil(t, err, "Updating the training set should not return an error")
+
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning with results other than -1 and 1 should return an error")
+
+	model.Parameters = [][]float64{{0, 1, 1}}
+	model.Votes = []float64{1}
+
+	_, err = model.Predict([]float64{1})
+	assert.NotNil(t, err, "Predicting with the wrong dimensions should return an error")
+}
+
+func TestLoadVotedPerceptronShouldPass1(t *testing.T) {
+	model := NewVotedPerceptron(0.3)
+	model.Parameters = [][]float64{{1, -2, 0.5}, {0.5, -1, 1}}
+	model.Votes = []float64{3, 12}
+
+	err := model.PersistToFile("/tmp/.goml/VotedPerceptron.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/VotedPerceptron.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*VotedPerceptron)
+	assert.True(t, ok, "Loaded model should be a *VotedPerceptron")
+	assert.Equal(t, model.Parameters, restored.Parameters, "Parameters should be restored")
+	assert.Equal(t, model.Votes, restored.Votes, "Votes should be restored")
+	assert.Equal(t, 0.3, restored.alpha, "Learning rate should be restored")
+
+	for _, x := range [][]float64{{1, 1}, {-3, 2}, {4, -1}} {
+		expected, err := model.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		guess, err := restored.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, guess, "Restored model should predict the same")
+	}
+}
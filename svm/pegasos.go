@@ -0,0 +1,612 @@
+package svm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/admpub/goml/base"
+)
+
+// Pegasos is a linear support vector machine trained
+// with Pegasos (Primal Estimated sub-GrAdient SOlver
+// for SVM,) which runs stochastic sub-gradient descent
+// on the primal, hinge loss objective
+//
+//     λ/2 ||θ||² + 1/m Σ max(0, 1 - y[i](θx[i]))
+//
+// with a step size of 1/(λt) at step t. Every step only
+// looks at one example, so unlike the SVC it scales to
+// large training sets and can learn from a stream of
+// data, but it can only fit linear boundaries.
+//
+// https://home.ttic.edu/~nati/Publications/PegasosMPB.pdf
+//
+// The constant term θ[0] is treated as the weight of a
+// feature which is always 1, so it's regularized along
+// with the rest of θ. Without that, the early (large)
+// steps leave it out of scale with the rest of θ.
+//
+// The parameter vector θ is laid out exactly like the
+// linear.Logistic model's (with θ[0] the constant term,)
+// and so are the expected results: 1 for the positive
+// class and 0 for the negative class (-1 is also
+// accepted.) Predict returns 1 or 0, so the model can be
+// swapped in for a Logistic model thresholded at 0.5.
+type Pegasos struct {
+	// lambda is the regularization parameter λ. The
+	// larger λ, the wider the margin and the less the
+	// model tries to fit every example.
+	//
+	// maxIterations is the number of passes (epochs)
+	// batch learning makes over the training set
+	lambda        float64
+	maxIterations int
+
+	// projection, if true, projects θ back onto the
+	// ball of radius 1/√λ after every step, which the
+	// optimal θ is known to be within
+	projection bool
+
+	// step is the number of steps taken so far (t,)
+	// which sets the step size. Keeping it lets the
+	// model keep on learning from where it stopped.
+	step int
+
+	// trainingSet and expectedResults are the
+	// 'x', and 'y' of the data, expressed as
+	// vectors, that the model can optimize from
+	trainingSet     [][]float64
+	expectedResults []float64
+
+	Parameters []float64 `json:"theta"`
+
+	// rng is the model's source of randomness for
+	// shuffling the training set every epoch. It's
+	// seeded from the current time unless the model
+	// is given a seed with UpdateSeed.
+	rng *rand.Rand
+
+	// Output is the io.Writer used for logging
+	// and printing. Defaults to os.Stdout.
+	Output io.Writer
+}
+
+// NewPegasos takes in the regularization parameter λ,
+// the number of passes over the data batch learning
+// makes, as well as a training set and expected results
+// for that training set.
+//
+// if you're passing in no training set directly because you want
+// to learn using the online method then just declare the number of
+// features (it's an integer) as an extra arg after the rest
+// of the arguments
+//
+// Example Linear SVM (Batch):
+//
+//     // λ: 1e-3
+//     // Passes over the data: 20
+//     model := NewPegasos(1e-3, 20, trainingSet, expectedResults)
+//
+//     err := model.Learn()
+//     if err != nil {
+//         panic("SOME ERROR!! RUN!")
+//     }
+//
+//     guess, err = model.Predict([]float64{10000,6})
+func NewPegasos(lambda float64, maxIterations int, trainingSet [][]float64, expectedResults []float64, features ...int) *Pegasos {
+	var params []float64
+	if len(features) != 0 {
+		params = make([]float64, features[0]+1)
+	} else if trainingSet == nil || len(trainingSet) == 0 {
+		params = []float64{}
+	} else {
+		params = make([]float64, len(trainingSet[0])+1)
+	}
+
+	return &Pegasos{
+		lambda:        lambda,
+		maxIterations: maxIterations,
+
+		trainingSet:     trainingSet,
+		expectedResults: expectedResults,
+
+		// initialize θ as the zero vector (that is,
+		// the vector of all zeros)
+		Parameters: params,
+
+		rng:    base.NewTimeSeededRandom(),
+		Output: os.Stdout,
+	}
+}
+
+// UpdateSeed seeds the model's source of randomness
+// so learning is reproducible
+func (p *Pegasos) UpdateSeed(seed int64) {
+	p.rng = base.NewRandom(seed)
+}
+
+// UpdateRandom replaces the model's source of
+// randomness
+func (p *Pegasos) UpdateRandom(rng *rand.Rand) {
+	p.rng = rng
+}
+
+// UpdateTrainingSet takes in a new training set (variable x)
+// as well as a new result set (y). This could be useful if
+// you want to retrain a model starting with the parameter
+// vector of a previous training session, but most of the time
+// wouldn't be used.
+func (p *Pegasos) UpdateTrainingSet(trainingSet [][]float64, expectedResults []float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("Error: length of given training set is 0! Need data!")
+	}
+	if len(expectedResults) == 0 {
+		return fmt.Errorf("Error: length of given result data set is 0! Need expected results!")
+	}
+
+	p.trainingSet = trainingSet
+	p.expectedResults = expectedResults
+
+	return nil
+}
+
+// UpdateLambda sets the regularization parameter λ
+// of the model
+func (p *Pegasos) UpdateLambda(lambda float64) {
+	p.lambda = lambda
+}
+
+// UpdateMaxIterations sets the number of passes
+// over the training set batch learning makes
+func (p *Pegasos) UpdateMaxIterations(iterations int) {
+	p.maxIterations = iterations
+}
+
+// UpdateProjection sets whether θ is projected back
+// onto the ball of radius 1/√λ after every step
+func (p *Pegasos) UpdateProjection(projection bool) {
+	p.projection = projection
+}
+
+// Lambda returns the regularization parameter λ of
+// the model
+func (p *Pegasos) Lambda() float64 {
+	return p.lambda
+}
+
+// Examples returns the number of training examples (m)
+// that the model currently is training from.
+func (p *Pegasos) Examples() int {
+	return len(p.trainingSet)
+}
+
+// MaxIterations returns the number of passes over
+// the training set batch learning makes
+func (p *Pegasos) MaxIterations() int {
+	return p.maxIterations
+}
+
+// Steps returns the number of (stochastic) steps the
+// model has taken while learning
+func (p *Pegasos) Steps() int {
+	return p.step
+}
+
+// Theta returns the parameter vector θ of the model
+func (p *Pegasos) Theta() []float64 {
+	return p.Parameters
+}
+
+// DecisionFunction returns θx, whose sign is the
+// predicted class and whose magnitude is how far x is
+// from the boundary (relative to the margin)
+func (p *Pegasos) DecisionFunction(x []float64, normalize ...bool) ([]float64, error) {
+	if len(x)+1 != len(p.Parameters) {
+		return nil, fmt.Errorf("Error: Parameter vector should be 1 longer than input vector!\n\tLength of x given: %v\n\tLength of parameters: %v\n", len(x), len(p.Parameters))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	// include constant term in sum
+	sum := p.Parameters[0]
+
+	for i := range x {
+		sum += x[i] * p.Parameters[i+1]
+	}
+
+	return []float64{sum}, nil
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns 1 if x is on the positive side of the boundary,
+// and 0 otherwise
+//
+// if normalize is given as true, then the input will
+// first be normalized to unit length. Only use this if
+// you trained off of normalized inputs and are feeding
+// an un-normalized input
+func (p *Pegasos) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	f, err := p.DecisionFunction(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	if f[0] > 0 {
+		return []float64{1}, nil
+	}
+
+	return []float64{0}, nil
+}
+
+// label maps an expected result to -1 or 1
+func (p *Pegasos) label(y float64) (float64, error) {
+	switch y {
+	case 1:
+		return 1, nil
+	case 0, -1:
+		return -1, nil
+	}
+
+	return 0, fmt.Errorf("ERROR: The Pegasos model requires that the data results (y) be either 0 (or -1) or 1 - given %v\n", y)
+}
+
+// update takes a single Pegasos step on the example x
+// with label y (either -1 or 1)
+func (p *Pegasos) update(x []float64, y float64) {
+	p.step++
+	eta := 1 / (p.lambda * float64(p.step))
+
+	f, _ := p.DecisionFunction(x)
+
+	// shrink θ, then step towards the example if
+	// it's within the margin
+	for j := range p.Parameters {
+		p.Parameters[j] *= 1 - eta*p.lambda
+	}
+
+	if y*f[0] < 1 {
+		p.Parameters[0] += eta * y
+		for j := 1; j < len(p.Parameters); j++ {
+			p.Parameters[j] += eta * y * x[j-1]
+		}
+	}
+
+	if p.projection {
+		var norm float64
+		for j := range p.Parameters {
+			norm += p.Parameters[j] * p.Parameters[j]
+		}
+		norm = math.Sqrt(norm)
+
+		radius := 1 / math.Sqrt(p.lambda)
+		if norm > radius {
+			for j := range p.Parameters {
+				p.Parameters[j] *= radius / norm
+			}
+		}
+	}
+}
+
+// Learn takes the struct's dataset and expected results and
+// makes maxIterations shuffled passes over them, taking a
+// Pegasos step on every example. Learning starts over from
+// θ = 0.
+func (p *Pegasos) Learn() error {
+	examples := len(p.trainingSet)
+	if examples == 0 || len(p.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(p.Output, err.Error())
+		return err
+	}
+	if len(p.expectedResults) != examples {
+		err := fmt.Errorf("ERROR: Number of expected results (%v) doesn't match the number of training examples (%v)!\n", len(p.expectedResults), examples)
+		fmt.Fprintf(p.Output, err.Error())
+		return err
+	}
+	if p.lambda <= 0 {
+		err := fmt.Errorf("ERROR: λ must be positive - given %v\n", p.lambda)
+		fmt.Fprintf(p.Output, err.Error())
+		return err
+	}
+
+	features := len(p.trainingSet[0])
+
+	labels := make([]float64, examples)
+	for i := range p.trainingSet {
+		y, err := p.label(p.expectedResults[i])
+		if err != nil {
+			fmt.Fprintf(p.Output, err.Error())
+			return err
+		}
+		if len(p.trainingSet[i]) != features {
+			err = fmt.Errorf("ERROR: Training example %v has length %v but the first example has length %v!\n", i, len(p.trainingSet[i]), features)
+			fmt.Fprintf(p.Output, err.Error())
+			return err
+		}
+
+		labels[i] = y
+	}
+
+	fmt.Fprintf(p.Output, "Training:\n\tModel: Linear Support Vector Machine\n\tOptimization Method: Pegasos\n\tTraining Examples: %v\n\tFeatures: %v\n\tRegularization Parameter λ: %v\n\tPasses Over The Data: %v\n...\n\n", examples, features, p.lambda, p.maxIterations)
+
+	p.Parameters = make([]float64, features+1)
+	p.step = 0
+
+	for iter := 0; iter < p.maxIterations; iter++ {
+		for _, i := range p.rng.Perm(examples) {
+			p.update(p.trainingSet[i], labels[i])
+		}
+	}
+
+	for j := range p.Parameters {
+		if math.IsInf(p.Parameters[j], 0) || math.IsNaN(p.Parameters[j]) {
+			err := fmt.Errorf("Sorry! Learning diverged. Some value of the parameter vector theta is ±Inf or NaN")
+			fmt.Fprintf(p.Output, "\nERROR: Error while learning –\n\t%v\n\n", err)
+			return err
+		}
+	}
+
+	fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+	return nil
+}
+
+// OnlineLearn runs off of the datastream, taking a
+// Pegasos step on every point passed through the
+// channel, and returns errors through a channel. The
+// step count carries on from previous training, so the
+// step size keeps decreasing over the stream.
+//
+// The onUpdate callback is called (in a new goroutine)
+// with the parameter vector θ after every step, so you
+// are able to persist the model with the most up to date
+// vector at all times.
+//
+// The model needs to know the number of features, so
+// create it with NewPegasos(λ, 0, nil, nil, features) if
+// it wasn't trained before.
+//
+// The errors channel will be closed when learning is
+// completed.
+//
+// Example Online Linear SVM:
+//
+//     // create the channel of data and errors
+//     stream := make(chan base.Datapoint, 100)
+//     errors := make(chan error)
+//
+//     model := NewPegasos(1e-4, 0, nil, nil, 2)
+//
+//     go model.OnlineLearn(errors, stream, func(theta [][]float64) {
+//         // do something with the new theta (persist
+//         // to database?) in here.
+//     })
+//
+//     go func() {
+//         for i := 0; i < 10000; i++ {
+//             x := []float64{rand.Float64(), rand.Float64()}
+//             y := 0.0
+//             if x[0]+x[1] > 1 {
+//                 y = 1.0
+//             }
+//             stream <- base.Datapoint{X: x, Y: []float64{y}}
+//         }
+//
+//         // close the dataset to tell the model
+//         // to stop learning when it finishes reading
+//         // what's left in the channel
+//         close(stream)
+//     }()
+//
+//     // this will block until the error
+//     // channel is closed in the learning
+//     // function (it will, don't worry!)
+//     for {
+//         err, more := <-errors
+//         if err != nil {
+//             panic("THERE WAS AN ERROR!!! RUN!!!!")
+//         }
+//         if !more {
+//             break
+//         }
+//     }
+func (p *Pegasos) OnlineLearn(errors chan error, dataset chan base.Datapoint, onUpdate func([][]float64), normalize ...bool) {
+	if errors == nil {
+		errors = make(chan error)
+	}
+	if dataset == nil {
+		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
+		close(errors)
+		return
+	}
+	if p.lambda <= 0 {
+		errors <- fmt.Errorf("ERROR: λ must be positive - given %v\n", p.lambda)
+		close(errors)
+		return
+	}
+
+	fmt.Fprintf(p.Output, "Training:\n\tModel: Linear Support Vector Machine\n\tOptimization Method: Online Pegasos\n\tFeatures: %v\n\tRegularization Parameter λ: %v\n...\n\n", len(p.Parameters)-1, p.lambda)
+
+	norm := len(normalize) != 0 && normalize[0]
+
+	var point base.Datapoint
+	var more bool
+
+	for {
+		point, more = <-dataset
+
+		if more {
+			if len(point.Y) != 1 {
+				errors <- fmt.Errorf("ERROR: point.Y must have a length of 1. Point: %v", point)
+				continue
+			}
+			if len(point.X)+1 != len(p.Parameters) {
+				errors <- fmt.Errorf("ERROR: The Pegasos model requires that the length of input data (currently %v) be 1 less than the length of the parameter vector (%v)", len(point.X), len(p.Parameters))
+				continue
+			}
+
+			y, err := p.label(point.Y[0])
+			if err != nil {
+				errors <- err
+				continue
+			}
+
+			if norm {
+				base.NormalizePoint(point.X)
+			}
+
+			p.update(point.X, y)
+
+			// call the OnUpdate callback with the new theta
+			// appended to a blank slice so the vector is
+			// passed by value and not by reference
+			go onUpdate([][]float64{append([]float64{}, p.Parameters...)})
+
+		} else {
+			fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+			close(errors)
+			return
+		}
+	}
+}
+
+// String implements the fmt interface for clean printing. Here
+// we're using it to print the model as the equation h(θ)=...
+// where h is the linear SVM's hypothesis
+func (p *Pegasos) String() string {
+	if len(p.Parameters) == 0 {
+		return "h(θ,x) = [θx > 0]\nθ is empty! Train first!"
+	}
+
+	var buffer bytes.Buffer
+
+	buffer.WriteString(fmt.Sprintf("h(θ,x) = [θx > 0]\nθx = %.3f", p.Parameters[0]))
+	for i := 1; i < len(p.Parameters); i++ {
+		buffer.WriteString(fmt.Sprintf(" + %.5f(x[%d])", p.Parameters[i], i))
+	}
+
+	return buffer.String()
+}
+
+// pegasosHyperparameters holds the hyperparameters
+// of a Pegasos model as saved in its envelope
+type pegasosHyperparameters struct {
+	Lambda        float64 `json:"lambda"`
+	MaxIterations int     `json:"max_iterations"`
+	Projection    bool    `json:"projection,omitempty"`
+	Step          int     `json:"step"`
+}
+
+// pegasosType is the name Pegasos models are
+// registered and persisted under
+const pegasosType = "svm.Pegasos"
+
+func init() {
+	base.RegisterModel(pegasosType, func() base.Persistable {
+		return NewPegasos(0, 0, nil, nil)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// hyperparameters and step count, wrapped in a
+// base.Envelope. The data of the envelope is the
+// parameter vector θ, as with linear.Logistic.
+func (p *Pegasos) MarshalEnvelope() (*base.Envelope, error) {
+	features := len(p.Parameters) - 1
+	if features < 0 {
+		features = 0
+	}
+
+	env := &base.Envelope{
+		Type: pegasosType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+		Metadata: base.TrainingMetadata{
+			Examples: len(p.trainingSet),
+		},
+	}
+
+	err := env.Encode(pegasosHyperparameters{
+		Lambda:        p.lambda,
+		MaxIterations: p.maxIterations,
+		Projection:    p.projection,
+		Step:          p.step,
+	}, p.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model's parameter
+// vector θ, as well as the hyperparameters if they
+// were saved, from the given base.Envelope
+func (p *Pegasos) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := pegasosHyperparameters{
+		Lambda:        p.lambda,
+		MaxIterations: p.maxIterations,
+		Projection:    p.projection,
+		Step:          p.step,
+	}
+
+	var params []float64
+	err := env.Decode(pegasosType, &hyper, &params)
+	if err != nil {
+		return err
+	}
+
+	if hyper.Step < 0 {
+		return fmt.Errorf("ERROR: Pegasos step count must not be negative - given %v", hyper.Step)
+	}
+
+	p.lambda = hyper.Lambda
+	p.maxIterations = hyper.MaxIterations
+	p.projection = hyper.Projection
+	p.step = hyper.Step
+	p.Parameters = params
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later.
+func (p *Pegasos) PersistToFile(path string) error {
+	return base.PersistModel(path, p)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores the model from it.
+func (p *Pegasos) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, p)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (p *Pegasos) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, p)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (p *Pegasos) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, p)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (p *Pegasos) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(p)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (p *Pegasos) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, p)
+}
@@ -0,0 +1,241 @@
+package svm
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+	"github.com/admpub/goml/linear"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// halfPlane returns n points in [-10, 10]² labeled
+// 1 if they're above the line y = x/2 + 1 and 0 if
+// they're below it, leaving out points within gap of
+// the line
+func halfPlane(r *rand.Rand, n int, gap float64) ([][]float64, []float64) {
+	var x [][]float64
+	var y []float64
+	for len(x) < n {
+		point := []float64{r.Float64()*20 - 10, r.Float64()*20 - 10}
+		d := point[1] - point[0]/2 - 1
+		if d < gap && d > -gap {
+			continue
+		}
+
+		label := 0.0
+		if d > 0 {
+			label = 1
+		}
+		x = append(x, point)
+		y = append(y, label)
+	}
+
+	return x, y
+}
+
+func TestPegasosShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(43))
+	x, y := halfPlane(r, 500, 0.5)
+
+	model := NewPegasos(1e-4, 20, x, y)
+	err := model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.Len(t, model.Parameters, 3, "θ should hold the constant term and 2 features")
+	assert.Equal(t, 20*500, model.Steps(), "Model should take a step for every example on every pass")
+
+	testX, testY := halfPlane(r, 500, 0.5)
+
+	var mistakes int
+	for i := range testX {
+		guess, err := model.Predict(testX[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+		if guess[0] != testY[i] {
+			mistakes++
+		}
+	}
+	assert.True(t, mistakes < 10, "Model should separate the half planes - made %v mistakes out of 500", mistakes)
+
+	f, err := model.DecisionFunction([]float64{0, 8})
+	assert.Nil(t, err, "Decision function error should be nil")
+	assert.True(t, f[0] > 1, "Points far above the line should be past the margin - θx was %v", f[0])
+
+	// -1 labels should give the same boundary
+	// as 0 labels
+	negatives := make([]float64, len(y))
+	for i := range y {
+		negatives[i] = 2*y[i] - 1
+	}
+	model.UpdateTrainingSet(x, negatives)
+	model.UpdateProjection(true)
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	mistakes = 0
+	for i := range testX {
+		guess, err := model.Predict(testX[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+		if guess[0] != testY[i] {
+			mistakes++
+		}
+	}
+	assert.True(t, mistakes < 10, "Projected model should separate the half planes - made %v mistakes out of 500", mistakes)
+}
+
+func TestPegasosOnlineShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(47))
+	x, y := halfPlane(r, 20000, 0.5)
+
+	stream := make(chan base.Datapoint, 100)
+	errors := make(chan error)
+
+	model := NewPegasos(1e-3, 0, nil, nil, 2)
+	model.UpdateProjection(true)
+
+	go model.OnlineLearn(errors, stream, func(theta [][]float64) {})
+
+	go func() {
+		for i := range x {
+			stream <- base.Datapoint{
+				X: x[i],
+				Y: []float64{y[i]},
+			}
+		}
+
+		close(stream)
+	}()
+
+	for {
+		err, more := <-errors
+		assert.Nil(t, err, "Learning error should be nil")
+		if !more {
+			break
+		}
+	}
+
+	assert.Equal(t, 20000, model.Steps(), "Model should take a step for every point")
+
+	testX, testY := halfPlane(r, 500, 0.5)
+
+	var mistakes int
+	for i := range testX {
+		guess, err := model.Predict(testX[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+		if guess[0] != testY[i] {
+			mistakes++
+		}
+	}
+	assert.True(t, mistakes < 15, "Model should separate the half planes - made %v mistakes out of 500", mistakes)
+}
+
+func TestPegasosShouldFail1(t *testing.T) {
+	model := NewPegasos(1e-3, 10, nil, nil)
+	err := model.Learn()
+	assert.NotNil(t, err, "Learning without a training set should return an error")
+
+	model.UpdateTrainingSet([][]float64{{0}, {1}}, []float64{0, 2})
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning with a result which isn't 0, -1 or 1 should return an error")
+
+	model.UpdateTrainingSet([][]float64{{0}, {1}}, []float64{0, 1})
+	model.UpdateLambda(0)
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning with λ = 0 should return an error")
+
+	stream := make(chan base.Datapoint, 3)
+	errors := make(chan error, 3)
+
+	model = NewPegasos(1e-3, 0, nil, nil, 2)
+	stream <- base.Datapoint{X: []float64{1}, Y: []float64{1}}
+	stream <- base.Datapoint{X: []float64{1, 2}, Y: []float64{0.5}}
+	stream <- base.Datapoint{X: []float64{1, 2}, Y: []float64{1}}
+	close(stream)
+
+	go model.OnlineLearn(errors, stream, func(theta [][]float64) {})
+
+	var count int
+	for {
+		err, more := <-errors
+		if !more {
+			break
+		}
+		assert.NotNil(t, err, "Only errors should be sent")
+		count++
+	}
+	assert.Equal(t, 2, count, "Bad points should each return an error")
+	assert.Equal(t, 1, model.Steps(), "Only the good point should be learned from")
+}
+
+func TestPegasosLogisticLayoutShouldPass1(t *testing.T) {
+	model := NewPegasos(1e-2, 5, [][]float64{{1, 2}, {-1, -2}}, []float64{1, 0})
+	err := model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	bytes, err := json.Marshal(model)
+	assert.Nil(t, err, "Marshalling error should be nil")
+
+	// a Logistic model should be able to read θ
+	// straight from the Pegasos model
+	logistic := linear.NewLogistic(base.BatchGA, 0, 0, 0, nil, nil)
+	err = json.Unmarshal(bytes, logistic)
+	assert.Nil(t, err, "Unmarshalling error should be nil")
+	assert.Equal(t, model.Parameters, logistic.Parameters, "Logistic model should read the same θ")
+
+	for _, x := range [][]float64{{1, 2}, {-1, -2}, {3, 0}} {
+		guess, err := model.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		probability, err := logistic.Predict(x)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		expected := 0.0
+		if probability[0] > 0.5 {
+			expected = 1
+		}
+		assert.Equal(t, expected, guess[0], "Thresholded Logistic model should predict the same")
+	}
+}
+
+func TestLoadPegasosShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(53))
+	x, y := halfPlane(r, 200, 0.5)
+
+	model := NewPegasos(1e-3, 10, x, y)
+	model.UpdateProjection(true)
+	err := model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	err = model.PersistToFile("/tmp/.goml/Pegasos.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/Pegasos.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*Pegasos)
+	assert.True(t, ok, "Loaded model should be a *Pegasos")
+	assert.Equal(t, model.Parameters, restored.Parameters, "θ should be restored")
+	assert.Equal(t, model.Steps(), restored.Steps(), "Step count should be restored")
+	assert.Equal(t, model.Lambda(), restored.Lambda(), "λ should be restored")
+	assert.True(t, restored.projection, "Projection should be restored")
+}
+
+func TestPegasosSeedShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(47))
+	x, y := halfPlane(r, 200, 0)
+
+	var _ base.Randomized = NewPegasos(1e-4, 5, x, y)
+
+	models := make([]*Pegasos, 3)
+	for i := range models {
+		models[i] = NewPegasos(1e-4, 5, x, y)
+		models[i].Output = ioutil.Discard
+		models[i].UpdateSeed(int64(42 + i/2))
+		assert.Nil(t, models[i].Learn(), "Learning error should be nil")
+	}
+
+	assert.Equal(t, models[0].Parameters, models[1].Parameters, "Models with the same seed should learn the same parameters")
+	assert.NotEqual(t, models[0].Parameters, models[2].Parameters, "Models with different seeds should shuffle differently")
+}
@@ -0,0 +1,317 @@
+// Package svm holds support vector machines:
+// maximum-margin models which only keep the training
+// examples closest to their decision boundary (the
+// support vectors.) Like the perceptron package's
+// kernel models, they work with any kernel from the
+// base package, but they're trained in batch by
+// solving their (dual) optimization problem exactly
+// with Sequential Minimal Optimization (SMO,) the
+// same algorithm LIBSVM uses.
+//
+// https://www.csie.ntu.edu.tw/~cjlin/papers/libsvm.pdf
+package svm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/admpub/goml/base"
+)
+
+// tau is the smallest curvature used when the
+// kernel matrix isn't positive definite
+const tau = 1e-12
+
+// Defaults for the SMO solver
+const (
+	// DefaultTolerance is the default stopping
+	// tolerance of the SMO solver (on the KKT
+	// conditions)
+	DefaultTolerance = 1e-3
+
+	// DefaultMaxIterations is the default number
+	// of SMO iterations after which training stops
+	// even if the solution isn't optimal
+	DefaultMaxIterations = 1000000
+)
+
+// smoProblem is the dual problem solved by SMO:
+//
+//     min ½αᵀQα + pᵀα
+//     s.t. yᵀα = Δ, 0 ≤ α[t] ≤ C
+//
+// where Q[s][t] = y[s]y[t]K(x[index[s]], x[index[t]])
+// and every y[t] is either -1 or 1. Variables refer to
+// examples of the kernel matrix through index, so one
+// kernel matrix can be shared between problems over
+// different subsets of the training set (one-vs-one,
+// cross validation,) or with more variables than
+// examples (regression.)
+type smoProblem struct {
+	kernel base.KernelMatrix
+	index  []int
+
+	y []float64
+	p []float64
+
+	// alpha is the initial α, which must satisfy the
+	// constraints. If nil, α starts at 0.
+	alpha []float64
+
+	c             float64
+	tolerance     float64
+	maxIterations int
+}
+
+// smoSolution holds the optimal α, along with ρ (the
+// negative of the bias of the decision function) and
+// the number of iterations it took
+type smoSolution struct {
+	alpha      []float64
+	rho        float64
+	iterations int
+}
+
+// solve runs SMO with second order working set
+// selection (WSS 2 of Fan, Chen and Lin) on the
+// problem. An error is returned if the solver hits
+// its max iterations before converging, along with
+// the (approximate) solution found.
+func (prob *smoProblem) solve() (*smoSolution, error) {
+	n := len(prob.index)
+
+	alpha := make([]float64, n)
+	if prob.alpha != nil {
+		copy(alpha, prob.alpha)
+	}
+
+	// q returns the row of Q for variable s
+	q := func(s int) []float64 {
+		row := prob.kernel.Row(prob.index[s])
+		qs := make([]float64, n)
+		for t := range qs {
+			qs[t] = prob.y[s] * prob.y[t] * row[prob.index[t]]
+		}
+		return qs
+	}
+
+	diagonal := make([]float64, n)
+	for t := range diagonal {
+		diagonal[t] = prob.kernel.At(prob.index[t], prob.index[t])
+	}
+
+	// the gradient of the objective, Qα + p
+	gradient := append([]float64{}, prob.p...)
+	for s := range alpha {
+		if alpha[s] != 0 {
+			qs := q(s)
+			for t := range gradient {
+				gradient[t] += qs[t] * alpha[s]
+			}
+		}
+	}
+
+	upper := func(t int) bool { return alpha[t] >= prob.c }
+	lower := func(t int) bool { return alpha[t] <= 0 }
+
+	var iterations int
+	var err error
+
+	for {
+		// select i, the variable which violates the
+		// optimality conditions the most
+		i := -1
+		gMax := math.Inf(-1)
+		for t := 0; t < n; t++ {
+			if prob.y[t] == 1 {
+				if !upper(t) && -gradient[t] >= gMax {
+					gMax = -gradient[t]
+					i = t
+				}
+			} else if !lower(t) && gradient[t] >= gMax {
+				gMax = gradient[t]
+				i = t
+			}
+		}
+
+		// select j, the variable which decreases the
+		// objective the most together with i
+		j := -1
+		gMax2 := math.Inf(-1)
+		minObjective := math.Inf(1)
+
+		var qi []float64
+		if i != -1 {
+			qi = q(i)
+		}
+
+		for t := 0; t < n && i != -1; t++ {
+			var diff, curvature float64
+			if prob.y[t] == 1 {
+				if lower(t) {
+					continue
+				}
+				if gradient[t] >= gMax2 {
+					gMax2 = gradient[t]
+				}
+				diff = gMax + gradient[t]
+				curvature = diagonal[i] + diagonal[t] - 2*prob.y[i]*qi[t]
+			} else {
+				if upper(t) {
+					continue
+				}
+				if -gradient[t] >= gMax2 {
+					gMax2 = -gradient[t]
+				}
+				diff = gMax - gradient[t]
+				curvature = diagonal[i] + diagonal[t] + 2*prob.y[i]*qi[t]
+			}
+
+			if diff > 0 {
+				if curvature <= 0 {
+					curvature = tau
+				}
+				objective := -diff * diff / curvature
+				if objective <= minObjective {
+					minObjective = objective
+					j = t
+				}
+			}
+		}
+
+		if i == -1 || j == -1 || gMax+gMax2 < prob.tolerance {
+			break
+		}
+
+		if iterations >= prob.maxIterations {
+			err = fmt.Errorf("ERROR: SMO reached the max number of iterations (%v) before converging! The solution may not be optimal", prob.maxIterations)
+			break
+		}
+		iterations++
+
+		qj := q(j)
+
+		// solve the problem for α[i] and α[j] with
+		// every other variable fixed, then clip the
+		// solution to the box constraints
+		oldI, oldJ := alpha[i], alpha[j]
+		c := prob.c
+
+		if prob.y[i] != prob.y[j] {
+			curvature := diagonal[i] + diagonal[j] + 2*qi[j]
+			if curvature <= 0 {
+				curvature = tau
+			}
+			delta := (-gradient[i] - gradient[j]) / curvature
+			diff := alpha[i] - alpha[j]
+			alpha[i] += delta
+			alpha[j] += delta
+
+			if diff > 0 {
+				if alpha[j] < 0 {
+					alpha[j] = 0
+					alpha[i] = diff
+				}
+			} else if alpha[i] < 0 {
+				alpha[i] = 0
+				alpha[j] = -diff
+			}
+			if diff > 0 {
+				if alpha[i] > c {
+					alpha[i] = c
+					alpha[j] = c - diff
+				}
+			} else if alpha[j] > c {
+				alpha[j] = c
+				alpha[i] = c + diff
+			}
+		} else {
+			curvature := diagonal[i] + diagonal[j] - 2*qi[j]
+			if curvature <= 0 {
+				curvature = tau
+			}
+			delta := (gradient[i] - gradient[j]) / curvature
+			sum := alpha[i] + alpha[j]
+			alpha[i] -= delta
+			alpha[j] += delta
+
+			if sum > c {
+				if alpha[i] > c {
+					alpha[i] = c
+					alpha[j] = sum - c
+				}
+				if alpha[j] > c {
+					alpha[j] = c
+					alpha[i] = sum - c
+				}
+			} else {
+				if alpha[j] < 0 {
+					alpha[j] = 0
+					alpha[i] = sum
+				}
+				if alpha[i] < 0 {
+					alpha[i] = 0
+					alpha[j] = sum
+				}
+			}
+		}
+
+		deltaI := alpha[i] - oldI
+		deltaJ := alpha[j] - oldJ
+		for t := range gradient {
+			gradient[t] += qi[t]*deltaI + qj[t]*deltaJ
+		}
+	}
+
+	return &smoSolution{
+		alpha:      alpha,
+		rho:        prob.rho(alpha, gradient),
+		iterations: iterations,
+	}, err
+}
+
+// rho returns ρ given the optimal α and the gradient
+// at α. It's the average of y[t]G[t] over free
+// variables (0 < α[t] < C,) or the middle of the
+// feasible range if there are none.
+func (prob *smoProblem) rho(alpha, gradient []float64) float64 {
+	upperBound := math.Inf(1)
+	lowerBound := math.Inf(-1)
+
+	var free int
+	var sum float64
+
+	for t := range alpha {
+		yg := prob.y[t] * gradient[t]
+
+		switch {
+		case alpha[t] >= prob.c:
+			if prob.y[t] == -1 {
+				upperBound = math.Min(upperBound, yg)
+			} else {
+				lowerBound = math.Max(lowerBound, yg)
+			}
+		case alpha[t] <= 0:
+			if prob.y[t] == 1 {
+				upperBound = math.Min(upperBound, yg)
+			} else {
+				lowerBound = math.Max(lowerBound, yg)
+			}
+		default:
+			free++
+			sum += yg
+		}
+	}
+
+	if free > 0 {
+		return sum / float64(free)
+	}
+	if math.IsInf(upperBound, 1) {
+		return lowerBound
+	}
+	if math.IsInf(lowerBound, -1) {
+		return upperBound
+	}
+
+	return (upperBound + lowerBound) / 2
+}
@@ -0,0 +1,83 @@
+package svm
+
+import (
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMOShouldPass1(t *testing.T) {
+	// two points, one per class, with a linear kernel:
+	// the maximum margin boundary is x = 0 with the
+	// points on the margin, so α = 2/|x1 - x2|² = 0.5
+	// and b = 0
+	data := [][]float64{{1}, {-1}}
+
+	problem := &smoProblem{
+		kernel:        base.NewGramMatrix(base.LinearKernel(), data),
+		index:         []int{0, 1},
+		y:             []float64{1, -1},
+		p:             []float64{-1, -1},
+		c:             10,
+		tolerance:     1e-6,
+		maxIterations: 1000,
+	}
+
+	solution, err := problem.solve()
+	assert.Nil(t, err, "Solver error should be nil")
+	assert.InDelta(t, 0.5, solution.alpha[0], 1e-6, "α[0] should be 0.5")
+	assert.InDelta(t, 0.5, solution.alpha[1], 1e-6, "α[1] should be 0.5")
+	assert.InDelta(t, 0, solution.rho, 1e-6, "ρ should be 0")
+
+	// with C smaller than the optimal α both
+	// variables stay at the bound
+	problem.c = 0.1
+	solution, err = problem.solve()
+	assert.Nil(t, err, "Solver error should be nil")
+	assert.InDelta(t, 0.1, solution.alpha[0], 1e-9, "α[0] should be C")
+	assert.InDelta(t, 0.1, solution.alpha[1], 1e-9, "α[1] should be C")
+}
+
+func TestSMOShouldPass2(t *testing.T) {
+	// only the points closest to the boundary should
+	// be support vectors
+	data := [][]float64{{2, 2}, {3, 3}, {4, 1}, {-2, -2}, {-3, -1}, {-1, -4}}
+	y := []float64{1, 1, 1, -1, -1, -1}
+
+	problem := &smoProblem{
+		kernel:        base.NewKernelMatrix(base.LinearKernel(), data, 2),
+		index:         []int{0, 1, 2, 3, 4, 5},
+		y:             y,
+		p:             []float64{-1, -1, -1, -1, -1, -1},
+		c:             100,
+		tolerance:     1e-6,
+		maxIterations: 1000,
+	}
+
+	solution, err := problem.solve()
+	assert.Nil(t, err, "Solver error should be nil")
+
+	var sum float64
+	for s := range solution.alpha {
+		assert.True(t, solution.alpha[s] >= 0 && solution.alpha[s] <= problem.c, "α[%v] should be within [0, C]", s)
+		sum += y[s] * solution.alpha[s]
+	}
+	assert.InDelta(t, 0, sum, 1e-9, "Σ y[i]α[i] should stay 0")
+
+	assert.InDelta(t, 0, solution.alpha[1], 1e-9, "(3, 3) is far from the boundary and shouldn't be a support vector")
+
+	// every example should be on or outside the margin
+	for s := range data {
+		f := -solution.rho
+		for t := range data {
+			f += solution.alpha[t] * y[t] * (data[s][0]*data[t][0] + data[s][1]*data[t][1])
+		}
+		assert.True(t, y[s]*f >= 1-1e-4, "Example %v should be outside the margin (yf = %v)", s, y[s]*f)
+	}
+
+	problem.maxIterations = 0
+	_, err = problem.solve()
+	assert.NotNil(t, err, "Hitting the max iterations should return an error")
+}
@@ -0,0 +1,882 @@
+package svm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+
+	"github.com/admpub/goml/base"
+)
+
+// SVC represents the C-Support Vector Classifier, the
+// classic (soft margin) kernel support vector machine.
+// For two classes it finds the boundary with the largest
+// margin between the classes in the feature space of its
+// kernel, allowing some examples to be within the margin
+// (or misclassified) at a cost controlled by C:
+//
+//     min ½|w|² + CΣξ[i]
+//     s.t. y[i](w·φ(x[i]) + b) ≥ 1 - ξ[i], ξ[i] ≥ 0
+//
+// which is solved in its dual form with SMO. Only the
+// examples with non-zero dual coefficients (the support
+// vectors) are needed to predict:
+//
+//     f(x) = Σ α[i]y[i]K(x[i], x) + b
+//
+// https://en.wikipedia.org/wiki/Support_vector_machine
+//
+// With more than two classes, one binary machine is
+// trained for every pair of classes (one-vs-one) and
+// predictions are a vote between all machines.
+//
+// Class labels can be any float64 values (like -1 and
+// 1, or integer class labels like linear.Softmax uses.)
+// Predict returns the predicted label.
+//
+// If probability estimates are turned on (see
+// UpdateProbability,) each machine is calibrated with
+// Platt scaling and PredictProbability returns the
+// probability of every class.
+type SVC struct {
+	Kernel func([]float64, []float64) float64
+
+	// KernelSpec describes the kernel of the model when
+	// it was created with NewSVCFromSpec, so a restored
+	// model can rebuild its kernel
+	KernelSpec *base.KernelSpec `json:"kernel,omitempty"`
+
+	// Labels holds the class labels, sorted, and
+	// Machines the binary machine of every pair of
+	// classes (a, b) with a < b, in order
+	Labels   []float64        `json:"labels"`
+	Machines []*BinaryMachine `json:"machines"`
+
+	// rng is the model's source of randomness for
+	// splitting the cross validation folds used to
+	// calibrate probabilities. It's seeded from the
+	// current time unless the model is given a seed
+	// with UpdateSeed.
+	rng *rand.Rand
+
+	// Output is the io.Writer used for logging
+	// and printing. Defaults to os.Stdout.
+	Output io.Writer
+
+	c             float64
+	tolerance     float64
+	maxIterations int
+	cacheRows     int
+	probability   bool
+
+	// calibrated is whether the machines were last
+	// learned with probability estimates turned on
+	calibrated bool
+
+	trainingSet     [][]float64
+	expectedResults []float64
+}
+
+// BinaryMachine is a trained two class support
+// vector machine, separating class Positive from
+// class Negative (both indices into the labels of
+// the SVC.) Its decision function is
+//
+//     f(x) = Σ Coefficients[i]K(SV[i], x) + Bias
+//
+// where each coefficient is α[i]y[i]. f(x) > 0 votes
+// for the positive class. If the machine is calibrated,
+// the probability of the positive class is
+//
+//     P(positive|x) = 1 / (1 + exp(A*f(x) + B))
+type BinaryMachine struct {
+	Positive int `json:"positive"`
+	Negative int `json:"negative"`
+
+	SV           [][]float64 `json:"support_vectors"`
+	Coefficients []float64   `json:"coefficients"`
+	Bias         float64     `json:"bias"`
+
+	// A and B are the Platt scaling parameters
+	A float64 `json:"a,omitempty"`
+	B float64 `json:"b,omitempty"`
+}
+
+// decision returns f(x) for the machine
+func (m *BinaryMachine) decision(kernel func([]float64, []float64) float64, x []float64) float64 {
+	sum := m.Bias
+	for i := range m.SV {
+		sum += m.Coefficients[i] * kernel(m.SV[i], x)
+	}
+
+	return sum
+}
+
+// NewSVC takes in a kernel and the cost parameter C
+// (which must be greater than 0) and returns a new
+// model. Larger C fits the training set more closely
+// (a harder margin,) smaller C gives a smoother
+// boundary that ignores more outliers. C = 1 is a
+// reasonable start.
+func NewSVC(kernel func([]float64, []float64) float64, c float64) *SVC {
+	return &SVC{
+		Kernel: kernel,
+		rng:    base.NewTimeSeededRandom(),
+		Output: os.Stdout,
+
+		c:             c,
+		tolerance:     DefaultTolerance,
+		maxIterations: DefaultMaxIterations,
+	}
+}
+
+// UpdateSeed seeds the model's source of randomness
+// so learning is reproducible
+func (s *SVC) UpdateSeed(seed int64) {
+	s.rng = base.NewRandom(seed)
+}
+
+// UpdateRandom replaces the model's source of
+// randomness
+func (s *SVC) UpdateRandom(rng *rand.Rand) {
+	s.rng = rng
+}
+
+// NewSVCFromSpec returns a new model using the kernel
+// described by the given spec, which is persisted along
+// with the model
+func NewSVCFromSpec(spec base.KernelSpec, c float64) (*SVC, error) {
+	kernel, err := spec.Kernel()
+	if err != nil {
+		return nil, err
+	}
+
+	model := NewSVC(kernel, c)
+	model.KernelSpec = &spec
+
+	return model, nil
+}
+
+// UpdateKernel sets the kernel of the model to the one
+// described by the given spec
+func (s *SVC) UpdateKernel(spec base.KernelSpec) error {
+	kernel, err := spec.Kernel()
+	if err != nil {
+		return err
+	}
+
+	s.Kernel = kernel
+	s.KernelSpec = &spec
+
+	return nil
+}
+
+// UpdateTrainingSet sets the examples (and their
+// expected class labels) used by Learn
+func (s *SVC) UpdateTrainingSet(trainingSet [][]float64, expectedResults []float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("Error: length of given training set is 0! Need data!")
+	}
+	if len(expectedResults) == 0 {
+		return fmt.Errorf("Error: length of given result data set is 0! Need expected results!")
+	}
+
+	s.trainingSet = trainingSet
+	s.expectedResults = expectedResults
+
+	return nil
+}
+
+// UpdateCost sets the cost parameter C of the model
+func (s *SVC) UpdateCost(c float64) {
+	s.c = c
+}
+
+// UpdateTolerance sets the stopping tolerance of the
+// SMO solver. Defaults to DefaultTolerance.
+func (s *SVC) UpdateTolerance(tolerance float64) {
+	s.tolerance = tolerance
+}
+
+// UpdateMaxIterations sets the most iterations the
+// SMO solver makes for each machine. Defaults to
+// DefaultMaxIterations.
+func (s *SVC) UpdateMaxIterations(iterations int) {
+	s.maxIterations = iterations
+}
+
+// UpdateCacheSize sets the number of rows of the kernel
+// matrix kept in memory while training (see
+// base.KernelCache.) If rows is 0 (the default,) the
+// whole Gram matrix of the training set is precomputed.
+func (s *SVC) UpdateCacheSize(rows int) {
+	s.cacheRows = rows
+}
+
+// UpdateProbability sets whether Learn calibrates the
+// model for probability estimates with Platt scaling.
+// Calibrating uses 5-fold cross validation, so it makes
+// training about 5 times slower. Turning it on only
+// takes effect the next time the model learns.
+func (s *SVC) UpdateProbability(probability bool) {
+	s.probability = probability
+}
+
+// Examples returns the number of training examples
+// that the model currently is training from.
+func (s *SVC) Examples() int {
+	return len(s.trainingSet)
+}
+
+// Learn trains the model on the training set given with
+// UpdateTrainingSet, training one binary machine for
+// every pair of classes.
+//
+// If SMO hits the max number of iterations for a machine
+// the (possibly suboptimal) model is still trained and an
+// error is returned.
+func (s *SVC) Learn() error {
+	if s.Kernel == nil {
+		err := fmt.Errorf("ERROR: Attempting to learn without a kernel!\n")
+		fmt.Fprintf(s.Output, err.Error())
+		return err
+	}
+
+	examples := len(s.trainingSet)
+	if examples == 0 || len(s.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(s.Output, err.Error())
+		return err
+	}
+	if len(s.expectedResults) != examples {
+		err := fmt.Errorf("ERROR: Number of expected results (%v) doesn't match the number of training examples (%v)!\n", len(s.expectedResults), examples)
+		fmt.Fprintf(s.Output, err.Error())
+		return err
+	}
+	if s.c <= 0 {
+		err := fmt.Errorf("ERROR: The cost parameter C must be greater than 0 - given %v\n", s.c)
+		fmt.Fprintf(s.Output, err.Error())
+		return err
+	}
+
+	// group the examples by class
+	byLabel := make(map[float64][]int)
+	for i, y := range s.expectedResults {
+		if len(s.trainingSet[i]) != len(s.trainingSet[0]) {
+			err := fmt.Errorf("ERROR: Training example %v has length %v but the first example has length %v!\n", i, len(s.trainingSet[i]), len(s.trainingSet[0]))
+			fmt.Fprintf(s.Output, err.Error())
+			return err
+		}
+		byLabel[y] = append(byLabel[y], i)
+	}
+
+	labels := make([]float64, 0, len(byLabel))
+	for y := range byLabel {
+		labels = append(labels, y)
+	}
+	sort.Float64s(labels)
+
+	if len(labels) < 2 {
+		err := fmt.Errorf("ERROR: The training set needs at least 2 classes - given %v\n", len(labels))
+		fmt.Fprintf(s.Output, err.Error())
+		return err
+	}
+
+	fmt.Fprintf(s.Output, "Training:\n\tModel: C-Support Vector Classifier (%v classes)\n\tOptimization Method: SMO\n\tTraining Examples: %v\n\tFeatures: %v\n\tCost C: %v\n\tProbability Estimates: %v\n...\n\n", len(labels), examples, len(s.trainingSet[0]), s.c, s.probability)
+
+	gram := base.NewKernelMatrix(s.Kernel, s.trainingSet, s.cacheRows)
+
+	var machines []*BinaryMachine
+	var learnErr error
+
+	for a := 0; a < len(labels); a++ {
+		for b := a + 1; b < len(labels); b++ {
+			index := append(append([]int{}, byLabel[labels[a]]...), byLabel[labels[b]]...)
+			y := make([]float64, len(index))
+			for t := range y {
+				y[t] = -1
+				if t < len(byLabel[labels[a]]) {
+					y[t] = 1
+				}
+			}
+
+			machine, err := s.train(gram, index, y)
+			if err != nil {
+				learnErr = err
+			}
+			machine.Positive = a
+			machine.Negative = b
+
+			if s.probability {
+				decisions, err := s.crossValidate(gram, index, y, 5)
+				if err != nil {
+					learnErr = err
+				}
+				machine.A, machine.B = plattScaling(decisions, y)
+			}
+
+			machines = append(machines, machine)
+		}
+	}
+
+	s.Labels = labels
+	s.Machines = machines
+	s.calibrated = s.probability
+
+	if learnErr != nil {
+		fmt.Fprintf(s.Output, "\nERROR: Error while learning –\n\t%v\n\n", learnErr)
+		return learnErr
+	}
+
+	fmt.Fprintf(s.Output, "Training Completed.\n%v\n\n", s)
+
+	return nil
+}
+
+// train solves the binary problem over the given
+// examples (with labels y, each -1 or 1) and returns
+// the machine made of its support vectors
+func (s *SVC) train(gram base.KernelMatrix, index []int, y []float64) (*BinaryMachine, error) {
+	p := make([]float64, len(index))
+	for t := range p {
+		p[t] = -1
+	}
+
+	problem := &smoProblem{
+		kernel:        gram,
+		index:         index,
+		y:             y,
+		p:             p,
+		c:             s.c,
+		tolerance:     s.tolerance,
+		maxIterations: s.maxIterations,
+	}
+	solution, err := problem.solve()
+
+	machine := &BinaryMachine{
+		Bias: -solution.rho,
+	}
+	for t, alpha := range solution.alpha {
+		if alpha > 0 {
+			machine.SV = append(machine.SV, s.trainingSet[index[t]])
+			machine.Coefficients = append(machine.Coefficients, alpha*y[t])
+		}
+	}
+
+	return machine, err
+}
+
+// crossValidate returns the decision value of every
+// given example from a machine trained on the other
+// folds, used to fit Platt scaling on values that
+// aren't biased by the example being trained on
+func (s *SVC) crossValidate(gram base.KernelMatrix, index []int, y []float64, folds int) ([]float64, error) {
+	decisions := make([]float64, len(index))
+
+	if len(index) < 2*folds {
+		// too few examples to cross validate, so
+		// fall back to the decision values of the
+		// machine trained on all of them
+		machine, err := s.train(gram, index, y)
+		for t := range index {
+			decisions[t] = machine.decision(s.Kernel, s.trainingSet[index[t]])
+		}
+		return decisions, err
+	}
+
+	var cvErr error
+	order := s.rng.Perm(len(index))
+
+	for fold := 0; fold < folds; fold++ {
+		var trainIndex, testIndex []int
+		var trainY []float64
+		for k, t := range order {
+			if k%folds == fold {
+				testIndex = append(testIndex, t)
+				continue
+			}
+			trainIndex = append(trainIndex, index[t])
+			trainY = append(trainY, y[t])
+		}
+
+		// a fold with only one class can't be trained,
+		// so its decisions are just the label
+		var positive, negative int
+		for _, label := range trainY {
+			if label == 1 {
+				positive++
+			} else {
+				negative++
+			}
+		}
+		if positive == 0 || negative == 0 {
+			for _, t := range testIndex {
+				decisions[t] = 1
+				if negative != 0 {
+					decisions[t] = -1
+				}
+			}
+			continue
+		}
+
+		machine, err := s.train(gram, trainIndex, trainY)
+		if err != nil {
+			cvErr = err
+		}
+		for _, t := range testIndex {
+			decisions[t] = machine.decision(s.Kernel, s.trainingSet[index[t]])
+		}
+	}
+
+	return decisions, cvErr
+}
+
+// plattScaling fits the sigmoid 1 / (1 + exp(Af + B))
+// to the probability of the positive class given the
+// decision values f, returning A and B. This is the
+// Newton method with backtracking of Lin, Lin and
+// Weng's note on Platt's probabilistic outputs.
+//
+// https://www.csie.ntu.edu.tw/~cjlin/papers/plattprob.pdf
+func plattScaling(decisions, y []float64) (float64, float64) {
+	var prior1, prior0 float64
+	for _, label := range y {
+		if label > 0 {
+			prior1++
+		} else {
+			prior0++
+		}
+	}
+
+	const (
+		maxIterations = 100
+		minStep       = 1e-10
+		sigma         = 1e-12
+		epsilon       = 1e-5
+	)
+
+	hiTarget := (prior1 + 1) / (prior1 + 2)
+	loTarget := 1 / (prior0 + 2)
+
+	targets := make([]float64, len(y))
+	for i := range y {
+		if y[i] > 0 {
+			targets[i] = hiTarget
+		} else {
+			targets[i] = loTarget
+		}
+	}
+
+	a := 0.0
+	b := math.Log((prior0 + 1) / (prior1 + 1))
+
+	objective := func(a, b float64) float64 {
+		var f float64
+		for i := range decisions {
+			fApB := decisions[i]*a + b
+			if fApB >= 0 {
+				f += targets[i]*fApB + math.Log(1+math.Exp(-fApB))
+			} else {
+				f += (targets[i]-1)*fApB + math.Log(1+math.Exp(fApB))
+			}
+		}
+		return f
+	}
+
+	fval := objective(a, b)
+
+	for iter := 0; iter < maxIterations; iter++ {
+		// gradient and hessian
+		h11, h22, h21 := sigma, sigma, 0.0
+		var g1, g2 float64
+
+		for i := range decisions {
+			fApB := decisions[i]*a + b
+
+			var p, q float64
+			if fApB >= 0 {
+				p = math.Exp(-fApB) / (1 + math.Exp(-fApB))
+				q = 1 / (1 + math.Exp(-fApB))
+			} else {
+				p = 1 / (1 + math.Exp(fApB))
+				q = math.Exp(fApB) / (1 + math.Exp(fApB))
+			}
+
+			d2 := p * q
+			h11 += decisions[i] * decisions[i] * d2
+			h22 += d2
+			h21 += decisions[i] * d2
+
+			d1 := targets[i] - p
+			g1 += decisions[i] * d1
+			g2 += d1
+		}
+
+		if math.Abs(g1) < epsilon && math.Abs(g2) < epsilon {
+			break
+		}
+
+		// Newton direction
+		det := h11*h22 - h21*h21
+		dA := -(h22*g1 - h21*g2) / det
+		dB := -(-h21*g1 + h11*g2) / det
+		gd := g1*dA + g2*dB
+
+		// line search
+		step := 1.0
+		for step >= minStep {
+			newA := a + step*dA
+			newB := b + step*dB
+			newF := objective(newA, newB)
+
+			if newF < fval+0.0001*step*gd {
+				a, b, fval = newA, newB, newF
+				break
+			}
+			step /= 2
+		}
+
+		if step < minStep {
+			break
+		}
+	}
+
+	return a, b
+}
+
+// DecisionFunction returns the value of the decision
+// function f(x) of every binary machine of the model,
+// in the order of Machines
+func (s *SVC) DecisionFunction(x []float64, normalize ...bool) ([]float64, error) {
+	if s.Kernel == nil {
+		return nil, fmt.Errorf("ERROR: SVC has no kernel! If you restored the model, it was persisted without a KernelSpec so you need to set the Kernel again")
+	}
+	if len(s.Machines) == 0 {
+		return nil, fmt.Errorf("ERROR: SVC has no machines! Train first!")
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	decisions := make([]float64, len(s.Machines))
+	for m, machine := range s.Machines {
+		decisions[m] = machine.decision(s.Kernel, x)
+	}
+
+	return decisions, nil
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns the predicted class label: the class with the
+// most votes from the binary machines, ties going to the
+// lowest label
+func (s *SVC) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	decisions, err := s.DecisionFunction(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	votes := make([]int, len(s.Labels))
+	for m, machine := range s.Machines {
+		if decisions[m] > 0 {
+			votes[machine.Positive]++
+		} else {
+			votes[machine.Negative]++
+		}
+	}
+
+	var best int
+	for c := range votes {
+		if votes[c] > votes[best] {
+			best = c
+		}
+	}
+
+	return []float64{s.Labels[best]}, nil
+}
+
+// PredictProbability takes in a variable x (an array of
+// floats,) and returns the probability of every class,
+// in the order of Labels. The model must have been
+// trained with probability estimates turned on (see
+// UpdateProbability,) turning them on afterwards isn't
+// enough.
+//
+// With more than two classes, the pairwise probabilities
+// of the machines are coupled into class probabilities
+// with the second method of Wu, Lin and Weng.
+//
+// http://www.jmlr.org/papers/volume5/wu04a/wu04a.pdf
+func (s *SVC) PredictProbability(x []float64, normalize ...bool) ([]float64, error) {
+	if !s.calibrated {
+		return nil, fmt.Errorf("ERROR: SVC wasn't trained with probability estimates! Call UpdateProbability(true) before Learn")
+	}
+
+	decisions, err := s.DecisionFunction(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	k := len(s.Labels)
+
+	// r[a][b] is the probability of class a
+	// given that x is either class a or b
+	r := make([][]float64, k)
+	for a := range r {
+		r[a] = make([]float64, k)
+	}
+
+	for m, machine := range s.Machines {
+		p := 1 / (1 + math.Exp(machine.A*decisions[m]+machine.B))
+
+		// keep probabilities away from 0 and 1
+		p = math.Min(math.Max(p, 1e-7), 1-1e-7)
+
+		r[machine.Positive][machine.Negative] = p
+		r[machine.Negative][machine.Positive] = 1 - p
+	}
+
+	if k == 2 {
+		return []float64{r[0][1], r[1][0]}, nil
+	}
+
+	return coupleProbabilities(r), nil
+}
+
+// coupleProbabilities returns the class probabilities
+// best matching the given pairwise probabilities, by
+// the fixed point iteration of Wu, Lin and Weng
+func coupleProbabilities(r [][]float64) []float64 {
+	k := len(r)
+
+	q := make([][]float64, k)
+	for t := range q {
+		q[t] = make([]float64, k)
+		for j := 0; j < k; j++ {
+			if j == t {
+				continue
+			}
+			q[t][t] += r[j][t] * r[j][t]
+			q[t][j] = -r[j][t] * r[t][j]
+		}
+	}
+
+	p := make([]float64, k)
+	for t := range p {
+		p[t] = 1 / float64(k)
+	}
+
+	qp := make([]float64, k)
+	maxIterations := 100
+	if k > 100 {
+		maxIterations = k
+	}
+	epsilon := 0.005 / float64(k)
+
+	for iter := 0; iter < maxIterations; iter++ {
+		var pQp float64
+		for t := 0; t < k; t++ {
+			qp[t] = 0
+			for j := 0; j < k; j++ {
+				qp[t] += q[t][j] * p[j]
+			}
+			pQp += p[t] * qp[t]
+		}
+
+		var maxError float64
+		for t := 0; t < k; t++ {
+			maxError = math.Max(maxError, math.Abs(qp[t]-pQp))
+		}
+		if maxError < epsilon {
+			break
+		}
+
+		for t := 0; t < k; t++ {
+			diff := (-qp[t] + pQp) / q[t][t]
+			p[t] += diff
+			pQp = (pQp + diff*(diff*q[t][t]+2*qp[t])) / (1 + diff) / (1 + diff)
+			for j := 0; j < k; j++ {
+				qp[j] = (qp[j] + diff*q[t][j]) / (1 + diff)
+				p[j] /= 1 + diff
+			}
+		}
+	}
+
+	return p
+}
+
+// SupportVectors returns the number of support
+// vectors of every machine of the model
+func (s *SVC) SupportVectors() []int {
+	counts := make([]int, len(s.Machines))
+	for m, machine := range s.Machines {
+		counts[m] = len(machine.SV)
+	}
+
+	return counts
+}
+
+// String implements the fmt interface for clean printing
+func (s *SVC) String() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("f(x) = Σ α[i]y[i]K(x[i], x) + b\n")
+	buffer.WriteString(fmt.Sprintf("\tClasses: %v\n", s.Labels))
+	for _, machine := range s.Machines {
+		buffer.WriteString(fmt.Sprintf("\t%v vs %v: %v support vectors, b = %.5f\n", s.Labels[machine.Positive], s.Labels[machine.Negative], len(machine.SV), machine.Bias))
+	}
+
+	return buffer.String()
+}
+
+// svcHyperparameters holds the hyperparameters of an
+// SVC as saved in its envelope
+type svcHyperparameters struct {
+	Kernel        *base.KernelSpec `json:"kernel,omitempty"`
+	C             float64          `json:"c"`
+	Tolerance     float64          `json:"tolerance"`
+	MaxIterations int              `json:"max_iterations"`
+	Probability   bool             `json:"probability,omitempty"`
+}
+
+// svcData is the data of an SVC envelope
+type svcData struct {
+	Labels     []float64        `json:"labels"`
+	Machines   []*BinaryMachine `json:"machines"`
+	Calibrated bool             `json:"calibrated,omitempty"`
+}
+
+// svcType is the name SVC models are registered
+// and persisted under
+const svcType = "svm.SVC"
+
+func init() {
+	base.RegisterModel(svcType, func() base.Persistable {
+		return NewSVC(nil, 0)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// hyperparameters and the spec of its kernel, wrapped
+// in a base.Envelope. The data of the envelope is the
+// class labels and the binary machines (support
+// vectors, coefficients, biases and Platt scaling.)
+func (s *SVC) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	for _, machine := range s.Machines {
+		if len(machine.SV) != 0 {
+			features = len(machine.SV[0])
+			break
+		}
+	}
+
+	env := &base.Envelope{
+		Type: svcType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+	}
+
+	err := env.Encode(svcHyperparameters{
+		Kernel:        s.KernelSpec,
+		C:             s.c,
+		Tolerance:     s.tolerance,
+		MaxIterations: s.maxIterations,
+		Probability:   s.probability,
+	}, svcData{
+		Labels:     s.Labels,
+		Machines:   s.Machines,
+		Calibrated: s.calibrated,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model from the given
+// base.Envelope. If the kernel spec was saved, the
+// kernel is rebuilt from it. Otherwise the current
+// kernel is kept.
+func (s *SVC) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := svcHyperparameters{
+		C:             s.c,
+		Tolerance:     s.tolerance,
+		MaxIterations: s.maxIterations,
+		Probability:   s.probability,
+	}
+
+	var data svcData
+	err := env.Decode(svcType, &hyper, &data)
+	if err != nil {
+		return err
+	}
+
+	for m, machine := range data.Machines {
+		if machine == nil || len(machine.SV) != len(machine.Coefficients) {
+			return fmt.Errorf("ERROR: SVC machine %v should have one coefficient per support vector", m)
+		}
+		if machine.Positive < 0 || machine.Positive >= len(data.Labels) || machine.Negative < 0 || machine.Negative >= len(data.Labels) {
+			return fmt.Errorf("ERROR: SVC machine %v refers to classes (%v, %v) but there are %v labels", m, machine.Positive, machine.Negative, len(data.Labels))
+		}
+	}
+
+	if hyper.Kernel != nil {
+		err = s.UpdateKernel(*hyper.Kernel)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.c = hyper.C
+	s.tolerance = hyper.Tolerance
+	s.maxIterations = hyper.MaxIterations
+	s.probability = hyper.Probability
+	s.Labels = data.Labels
+	s.Machines = data.Machines
+	s.calibrated = data.Calibrated
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later.
+func (s *SVC) PersistToFile(path string) error {
+	return base.PersistModel(path, s)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores the model from it.
+func (s *SVC) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, s)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (s *SVC) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, s)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (s *SVC) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, s)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (s *SVC) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(s)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (s *SVC) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, s)
+}
@@ -0,0 +1,227 @@
+package svm
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	// create the /tmp/.goml/ dir for persistance testing
+	// if it doesn't already exist!
+	err := os.MkdirAll("/tmp/.goml", os.ModePerm)
+	if err != nil {
+		panic(fmt.Sprintf("You should be able to create the directory for goml model persistance testing.\n\tError returned: %v\n", err.Error()))
+	}
+}
+
+// rings returns n points labeled by which of k rings
+// around the origin they're in
+func rings(r *rand.Rand, n, k int) ([][]float64, []float64) {
+	var x [][]float64
+	var y []float64
+	for i := 0; i < n; i++ {
+		label := r.Intn(k)
+		radius := float64(label) + 0.2 + r.Float64()*0.6
+		angle := r.Float64() * 2 * math.Pi
+
+		x = append(x, []float64{radius * math.Cos(angle), radius * math.Sin(angle)})
+		y = append(y, float64(label))
+	}
+
+	return x, y
+}
+
+func TestSVCXORShouldPass1(t *testing.T) {
+	model := NewSVC(base.GaussianKernel(0.5), 10)
+
+	err := model.UpdateTrainingSet([][]float64{{0, 0}, {0, 1}, {1, 0}, {1, 1}}, []float64{-1, 1, 1, -1})
+	assert.Nil(t, err, "Updating the training set should not return an error")
+
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.Equal(t, []float64{-1, 1}, model.Labels, "Model should have 2 classes")
+	assert.Len(t, model.Machines, 1, "2 classes should need 1 machine")
+	assert.Equal(t, []int{4}, model.SupportVectors(), "Every XOR point should be a support vector")
+
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			guess, err := model.Predict([]float64{float64(i), float64(j)})
+			assert.Nil(t, err, "Prediction error should be nil")
+
+			expected := 1.0
+			if i^j == 0 {
+				expected = -1.0
+			}
+			assert.Equal(t, expected, guess[0], "Guess should equal i^j (%v^%v = %v)", i, j, i^j)
+		}
+	}
+}
+
+func TestSVCMulticlassShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(31))
+	x, y := rings(r, 300, 3)
+
+	model, err := NewSVCFromSpec(base.GaussianKernelSpec(0.5), 1)
+	assert.Nil(t, err, "Creating the model should not return an error")
+	model.UpdateProbability(true)
+	model.UpdateCacheSize(50)
+
+	err = model.UpdateTrainingSet(x, y)
+	assert.Nil(t, err, "Updating the training set should not return an error")
+
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.Len(t, model.Machines, 3, "3 classes should need 3 one-vs-one machines")
+
+	testX, testY := rings(r, 300, 3)
+
+	var mistakes int
+	for i := range testX {
+		guess, err := model.Predict(testX[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+		if guess[0] != testY[i] {
+			mistakes++
+		}
+
+		probabilities, err := model.PredictProbability(testX[i])
+		assert.Nil(t, err, "Probability error should be nil")
+		assert.Len(t, probabilities, 3, "There should be a probability per class")
+
+		var sum float64
+		for _, p := range probabilities {
+			assert.True(t, p >= 0 && p <= 1, "Probabilities should be within [0, 1]")
+			sum += p
+		}
+		assert.InDelta(t, 1, sum, 1e-3, "Probabilities should sum to 1")
+	}
+
+	assert.True(t, mistakes < 15, "Model should classify the rings - made %v mistakes out of 300", mistakes)
+
+	// points in the middle of a ring should
+	// be confidently classified
+	probabilities, err := model.PredictProbability([]float64{0, 1.5})
+	assert.Nil(t, err, "Probability error should be nil")
+	assert.True(t, probabilities[1] > 0.8, "P(ring 1 | (0, 1.5)) should be high - was %v", probabilities[1])
+}
+
+func TestSVCBinaryProbabilityShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(37))
+
+	var x [][]float64
+	var y []float64
+	for i := 0; i < 200; i++ {
+		point := []float64{r.NormFloat64(), r.NormFloat64()}
+		label := -1.0
+		if point[0]+point[1] > 0 {
+			label = 1
+		}
+		x = append(x, point)
+		y = append(y, label)
+	}
+
+	model := NewSVC(base.LinearKernel(), 1)
+	model.UpdateProbability(true)
+	model.UpdateTrainingSet(x, y)
+
+	err := model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	far, err := model.PredictProbability([]float64{3, 3})
+	assert.Nil(t, err, "Probability error should be nil")
+	assert.True(t, far[1] > 0.95, "P(1 | (3, 3)) should be close to 1 - was %v", far[1])
+
+	near, err := model.PredictProbability([]float64{0.01, -0.01})
+	assert.Nil(t, err, "Probability error should be nil")
+	assert.InDelta(t, 0.5, near[1], 0.2, "P(1 | boundary) should be close to 0.5")
+}
+
+func TestSVCShouldFail1(t *testing.T) {
+	model := NewSVC(base.LinearKernel(), 1)
+
+	err := model.Learn()
+	assert.NotNil(t, err, "Learning without a training set should return an error")
+
+	model.UpdateTrainingSet([][]float64{{0}, {1}}, []float64{1, 1})
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning with one class should return an error")
+
+	model.UpdateTrainingSet([][]float64{{0}, {1}}, []float64{-1, 1})
+	model.UpdateCost(0)
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning with C = 0 should return an error")
+
+	model.UpdateCost(1)
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	_, err = model.PredictProbability([]float64{0.5})
+	assert.NotNil(t, err, "Probabilities without calibration should return an error")
+
+	// the machines were learned without calibrating
+	// them, so turning probabilities on isn't enough
+	model.UpdateProbability(true)
+	_, err = model.PredictProbability([]float64{0.5})
+	assert.NotNil(t, err, "Probabilities turned on after learning should return an error")
+
+	model.UpdateTrainingSet([][]float64{{0}, {0.2}, {0.4}, {0.6}, {0.8}, {1}}, []float64{-1, -1, -1, 1, 1, 1})
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+	_, err = model.PredictProbability([]float64{0.5})
+	assert.Nil(t, err, "Probabilities should be calibrated once the model learns again")
+
+	_, err = NewSVC(base.LinearKernel(), 1).Predict([]float64{1})
+	assert.NotNil(t, err, "Predicting before training should return an error")
+
+	model = NewSVC(nil, 1)
+	model.UpdateTrainingSet([][]float64{{0}, {1}}, []float64{-1, 1})
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning without a kernel should return an error")
+}
+
+func TestLoadSVCShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(41))
+	x, y := rings(r, 120, 3)
+
+	model, err := NewSVCFromSpec(base.GaussianKernelSpec(0.5), 5)
+	assert.Nil(t, err, "Creating the model should not return an error")
+	model.UpdateProbability(true)
+	model.UpdateTrainingSet(x, y)
+
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	err = model.PersistToFile("/tmp/.goml/SVC.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/SVC.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*SVC)
+	assert.True(t, ok, "Loaded model should be a *SVC")
+	assert.Equal(t, model.Labels, restored.Labels, "Labels should be restored")
+	assert.Equal(t, 5.0, restored.c, "C should be restored")
+
+	testX, _ := rings(r, 50, 3)
+	for i := range testX {
+		expected, err := model.Predict(testX[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		guess, err := restored.Predict(testX[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, guess, "Restored model should predict the same")
+
+		expectedP, err := model.PredictProbability(testX[i])
+		assert.Nil(t, err, "Probability error should be nil")
+
+		p, err := restored.PredictProbability(testX[i])
+		assert.Nil(t, err, "Probability error should be nil")
+		assert.Equal(t, expectedP, p, "Restored model should predict the same probabilities")
+	}
+}
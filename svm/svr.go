@@ -0,0 +1,425 @@
+package svm
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/admpub/goml/base"
+)
+
+// SVR represents ε-Support Vector Regression, the
+// regression version of the support vector machine. It
+// fits a function which is as flat as possible while
+// keeping the training examples within ε of it, allowing
+// some examples further away at a cost controlled by C:
+//
+//     min ½|w|² + CΣ(ξ[i] + ξ*[i])
+//     s.t. w·φ(x[i]) + b - y[i] ≤ ε + ξ[i]
+//          y[i] - w·φ(x[i]) - b ≤ ε + ξ*[i]
+//          ξ[i], ξ*[i] ≥ 0
+//
+// Errors smaller than ε aren't penalized at all (the loss
+// is ε-insensitive,) so only examples on or outside the
+// ε-tube become support vectors. The problem is solved
+// in its dual form with SMO, and predictions only need
+// the support vectors:
+//
+//     f(x) = Σ (α[i] - α*[i])K(x[i], x) + b
+//
+// https://alex.smola.org/papers/2004/SmoSch04.pdf
+//
+// Unlike linear.LocalLinear, which fits a new model for
+// every prediction, the SVR is trained once and Predict
+// never touches the training set, so a trained model can
+// be persisted and restored without its training data.
+type SVR struct {
+	Kernel func([]float64, []float64) float64
+
+	// KernelSpec describes the kernel of the model when
+	// it was created with NewSVRFromSpec, so a restored
+	// model can rebuild its kernel
+	KernelSpec *base.KernelSpec `json:"kernel,omitempty"`
+
+	// SV stores the model's support vectors, along with
+	// their coefficients α[i] - α*[i] and the bias b of
+	// the regression function
+	SV           [][]float64 `json:"support_vectors"`
+	Coefficients []float64   `json:"coefficients"`
+	Bias         float64     `json:"bias"`
+
+	// Output is the io.Writer used for logging
+	// and printing. Defaults to os.Stdout.
+	Output io.Writer
+
+	c             float64
+	epsilon       float64
+	tolerance     float64
+	maxIterations int
+	cacheRows     int
+
+	trainingSet     [][]float64
+	expectedResults []float64
+}
+
+// NewSVR takes in a kernel, the cost parameter C (which
+// must be greater than 0) and the width ε of the tube
+// around the regression function within which errors
+// are ignored (which must not be negative,) and returns
+// a new model. ε is in the units of the expected results,
+// so it should be set relative to their scale and noise.
+func NewSVR(kernel func([]float64, []float64) float64, c, epsilon float64) *SVR {
+	return &SVR{
+		Kernel: kernel,
+		Output: os.Stdout,
+
+		c:             c,
+		epsilon:       epsilon,
+		tolerance:     DefaultTolerance,
+		maxIterations: DefaultMaxIterations,
+	}
+}
+
+// NewSVRFromSpec returns a new model using the kernel
+// described by the given spec, which is persisted along
+// with the model
+func NewSVRFromSpec(spec base.KernelSpec, c, epsilon float64) (*SVR, error) {
+	kernel, err := spec.Kernel()
+	if err != nil {
+		return nil, err
+	}
+
+	model := NewSVR(kernel, c, epsilon)
+	model.KernelSpec = &spec
+
+	return model, nil
+}
+
+// UpdateKernel sets the kernel of the model to the one
+// described by the given spec
+func (s *SVR) UpdateKernel(spec base.KernelSpec) error {
+	kernel, err := spec.Kernel()
+	if err != nil {
+		return err
+	}
+
+	s.Kernel = kernel
+	s.KernelSpec = &spec
+
+	return nil
+}
+
+// UpdateTrainingSet sets the examples (and their
+// expected results) used by Learn
+func (s *SVR) UpdateTrainingSet(trainingSet [][]float64, expectedResults []float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("Error: length of given training set is 0! Need data!")
+	}
+	if len(expectedResults) == 0 {
+		return fmt.Errorf("Error: length of given result data set is 0! Need expected results!")
+	}
+
+	s.trainingSet = trainingSet
+	s.expectedResults = expectedResults
+
+	return nil
+}
+
+// UpdateCost sets the cost parameter C of the model
+func (s *SVR) UpdateCost(c float64) {
+	s.c = c
+}
+
+// UpdateEpsilon sets the width ε of the tube within
+// which errors are ignored
+func (s *SVR) UpdateEpsilon(epsilon float64) {
+	s.epsilon = epsilon
+}
+
+// UpdateTolerance sets the stopping tolerance of the
+// SMO solver. Defaults to DefaultTolerance.
+func (s *SVR) UpdateTolerance(tolerance float64) {
+	s.tolerance = tolerance
+}
+
+// UpdateMaxIterations sets the most iterations the
+// SMO solver makes. Defaults to DefaultMaxIterations.
+func (s *SVR) UpdateMaxIterations(iterations int) {
+	s.maxIterations = iterations
+}
+
+// UpdateCacheSize sets the number of rows of the kernel
+// matrix kept in memory while training (see
+// base.KernelCache.) If rows is 0 (the default,) the
+// whole Gram matrix of the training set is precomputed.
+func (s *SVR) UpdateCacheSize(rows int) {
+	s.cacheRows = rows
+}
+
+// Examples returns the number of training examples
+// that the model currently is training from.
+func (s *SVR) Examples() int {
+	return len(s.trainingSet)
+}
+
+// Learn trains the model on the training set given with
+// UpdateTrainingSet, keeping the examples with non-zero
+// coefficients as support vectors.
+//
+// If SMO hits the max number of iterations the (possibly
+// suboptimal) model is still trained and an error is
+// returned.
+func (s *SVR) Learn() error {
+	if s.Kernel == nil {
+		err := fmt.Errorf("ERROR: Attempting to learn without a kernel!\n")
+		fmt.Fprintf(s.Output, err.Error())
+		return err
+	}
+
+	examples := len(s.trainingSet)
+	if examples == 0 || len(s.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(s.Output, err.Error())
+		return err
+	}
+	if len(s.expectedResults) != examples {
+		err := fmt.Errorf("ERROR: Number of expected results (%v) doesn't match the number of training examples (%v)!\n", len(s.expectedResults), examples)
+		fmt.Fprintf(s.Output, err.Error())
+		return err
+	}
+	if s.c <= 0 {
+		err := fmt.Errorf("ERROR: The cost parameter C must be greater than 0 - given %v\n", s.c)
+		fmt.Fprintf(s.Output, err.Error())
+		return err
+	}
+	if s.epsilon < 0 {
+		err := fmt.Errorf("ERROR: ε must not be negative - given %v\n", s.epsilon)
+		fmt.Fprintf(s.Output, err.Error())
+		return err
+	}
+	for i := range s.trainingSet {
+		if len(s.trainingSet[i]) != len(s.trainingSet[0]) {
+			err := fmt.Errorf("ERROR: Training example %v has length %v but the first example has length %v!\n", i, len(s.trainingSet[i]), len(s.trainingSet[0]))
+			fmt.Fprintf(s.Output, err.Error())
+			return err
+		}
+	}
+
+	fmt.Fprintf(s.Output, "Training:\n\tModel: ε-Support Vector Regression\n\tOptimization Method: SMO\n\tTraining Examples: %v\n\tFeatures: %v\n\tCost C: %v\n\tTube Width ε: %v\n...\n\n", examples, len(s.trainingSet[0]), s.c, s.epsilon)
+
+	// the dual has two variables per example: α[t] (with
+	// y = 1) for examples above the tube and α*[t] (with
+	// y = -1) for examples below it. Both refer to the
+	// same row of the kernel matrix.
+	index := make([]int, 2*examples)
+	y := make([]float64, 2*examples)
+	p := make([]float64, 2*examples)
+	for t := 0; t < examples; t++ {
+		index[t] = t
+		index[t+examples] = t
+
+		y[t] = 1
+		y[t+examples] = -1
+
+		p[t] = s.epsilon - s.expectedResults[t]
+		p[t+examples] = s.epsilon + s.expectedResults[t]
+	}
+
+	problem := &smoProblem{
+		kernel:        base.NewKernelMatrix(s.Kernel, s.trainingSet, s.cacheRows),
+		index:         index,
+		y:             y,
+		p:             p,
+		c:             s.c,
+		tolerance:     s.tolerance,
+		maxIterations: s.maxIterations,
+	}
+	solution, learnErr := problem.solve()
+
+	s.SV = nil
+	s.Coefficients = nil
+	s.Bias = -solution.rho
+
+	for t := 0; t < examples; t++ {
+		coefficient := solution.alpha[t] - solution.alpha[t+examples]
+		if coefficient != 0 {
+			s.SV = append(s.SV, s.trainingSet[t])
+			s.Coefficients = append(s.Coefficients, coefficient)
+		}
+	}
+
+	if learnErr != nil {
+		fmt.Fprintf(s.Output, "\nERROR: Error while learning –\n\t%v\n\n", learnErr)
+		return learnErr
+	}
+
+	fmt.Fprintf(s.Output, "Training Completed.\n%v\n\n", s)
+
+	return nil
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns the value of the regression function f(x),
+// computed from the support vectors alone
+func (s *SVR) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if s.Kernel == nil {
+		return nil, fmt.Errorf("ERROR: SVR has no kernel! If you restored the model, it was persisted without a KernelSpec so you need to set the Kernel again")
+	}
+	if len(s.SV) != 0 && len(x) != len(s.SV[0]) {
+		return nil, fmt.Errorf("ERROR: The SVR requires that the length of input data (currently %v) match the length of its support vectors (%v)", len(x), len(s.SV[0]))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		base.NormalizePoint(x)
+	}
+
+	sum := s.Bias
+	for i := range s.SV {
+		sum += s.Coefficients[i] * s.Kernel(s.SV[i], x)
+	}
+
+	return []float64{sum}, nil
+}
+
+// String implements the fmt interface for clean printing
+func (s *SVR) String() string {
+	return fmt.Sprintf("f(x) = Σ (α[i] - α*[i])K(x[i], x) + b\n\tTotal Support Vectors: %v\n\tb = %.5f\n", len(s.SV), s.Bias)
+}
+
+// svrHyperparameters holds the hyperparameters of an
+// SVR as saved in its envelope
+type svrHyperparameters struct {
+	Kernel        *base.KernelSpec `json:"kernel,omitempty"`
+	C             float64          `json:"c"`
+	Epsilon       float64          `json:"epsilon"`
+	Tolerance     float64          `json:"tolerance"`
+	MaxIterations int              `json:"max_iterations"`
+}
+
+// svrData is the data of an SVR envelope
+type svrData struct {
+	SV           [][]float64 `json:"support_vectors"`
+	Coefficients []float64   `json:"coefficients"`
+	Bias         float64     `json:"bias"`
+}
+
+// svrType is the name SVR models are registered
+// and persisted under
+const svrType = "svm.SVR"
+
+func init() {
+	base.RegisterModel(svrType, func() base.Persistable {
+		return NewSVR(nil, 0, 0)
+	})
+}
+
+// MarshalEnvelope returns the model, along with its
+// hyperparameters and the spec of its kernel, wrapped
+// in a base.Envelope. The data of the envelope is the
+// support vectors, their coefficients and the bias.
+func (s *SVR) MarshalEnvelope() (*base.Envelope, error) {
+	var features int
+	if len(s.SV) != 0 {
+		features = len(s.SV[0])
+	}
+
+	env := &base.Envelope{
+		Type: svrType,
+		Schema: base.FeatureSchema{
+			Features: features,
+		},
+	}
+
+	err := env.Encode(svrHyperparameters{
+		Kernel:        s.KernelSpec,
+		C:             s.c,
+		Epsilon:       s.epsilon,
+		Tolerance:     s.tolerance,
+		MaxIterations: s.maxIterations,
+	}, svrData{
+		SV:           s.SV,
+		Coefficients: s.Coefficients,
+		Bias:         s.Bias,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model from the given
+// base.Envelope. If the kernel spec was saved, the
+// kernel is rebuilt from it. Otherwise the current
+// kernel is kept.
+func (s *SVR) UnmarshalEnvelope(env *base.Envelope) error {
+	hyper := svrHyperparameters{
+		C:             s.c,
+		Epsilon:       s.epsilon,
+		Tolerance:     s.tolerance,
+		MaxIterations: s.maxIterations,
+	}
+
+	var data svrData
+	err := env.Decode(svrType, &hyper, &data)
+	if err != nil {
+		return err
+	}
+
+	if len(data.SV) != len(data.Coefficients) {
+		return fmt.Errorf("ERROR: SVR has %v support vectors but %v coefficients", len(data.SV), len(data.Coefficients))
+	}
+
+	if hyper.Kernel != nil {
+		err = s.UpdateKernel(*hyper.Kernel)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.c = hyper.C
+	s.epsilon = hyper.Epsilon
+	s.tolerance = hyper.Tolerance
+	s.maxIterations = hyper.MaxIterations
+	s.SV = data.SV
+	s.Coefficients = data.Coefficients
+	s.Bias = data.Bias
+
+	return nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later.
+func (s *SVR) PersistToFile(path string) error {
+	return base.PersistModel(path, s)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores the model from it.
+func (s *SVR) RestoreFromFile(path string) error {
+	return base.RestoreModel(path, s)
+}
+
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (s *SVR) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, s)
+}
+
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (s *SVR) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, s)
+}
+
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (s *SVR) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(s)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (s *SVR) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, s)
+}
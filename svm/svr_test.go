@@ -0,0 +1,140 @@
+package svm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/admpub/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sine returns n points of sin(x) over [0, 2π] with
+// uniform noise in [-noise, noise]
+func sine(r *rand.Rand, n int, noise float64) ([][]float64, []float64) {
+	x := make([][]float64, n)
+	y := make([]float64, n)
+	for i := range x {
+		x[i] = []float64{r.Float64() * 2 * math.Pi}
+		y[i] = math.Sin(x[i][0]) + (r.Float64()*2-1)*noise
+	}
+
+	return x, y
+}
+
+func TestSVRShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(59))
+	x, y := sine(r, 200, 0.05)
+
+	model, err := NewSVRFromSpec(base.GaussianKernelSpec(1), 10, 0.1)
+	assert.Nil(t, err, "Creating the model should not return an error")
+
+	err = model.UpdateTrainingSet(x, y)
+	assert.Nil(t, err, "Updating the training set should not return an error")
+
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.True(t, len(model.SV) < len(x), "Examples inside the tube shouldn't be support vectors - %v out of %v are", len(model.SV), len(x))
+
+	// with the noise smaller than ε, every training
+	// example should end up (nearly) within the tube
+	for i := range x {
+		guess, err := model.Predict(x[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.InDelta(t, y[i], guess[0], 0.1+1e-2, "Training example %v should be within ε of the prediction", i)
+	}
+
+	for _, v := range []float64{0.5, 1.5, 3, 4.5, 6} {
+		guess, err := model.Predict([]float64{v})
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.InDelta(t, math.Sin(v), guess[0], 0.15, "Prediction at %v should be close to sin(%v)", v, v)
+	}
+}
+
+func TestSVREpsilonShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(61))
+	x, y := sine(r, 100, 0.2)
+
+	var supportVectors []int
+	for _, epsilon := range []float64{0, 0.1, 0.3, 2} {
+		model := NewSVR(base.GaussianKernel(1), 1, epsilon)
+		model.UpdateCacheSize(20)
+		model.UpdateTrainingSet(x, y)
+
+		err := model.Learn()
+		assert.Nil(t, err, "Learning error should be nil")
+
+		supportVectors = append(supportVectors, len(model.SV))
+	}
+
+	for i := 1; i < len(supportVectors); i++ {
+		assert.True(t, supportVectors[i] < supportVectors[i-1], "A wider tube should need fewer support vectors - %v", supportVectors)
+	}
+	assert.Equal(t, 0, supportVectors[len(supportVectors)-1], "A tube wider than the data shouldn't need any support vectors")
+}
+
+func TestSVRShouldFail1(t *testing.T) {
+	model := NewSVR(base.LinearKernel(), 1, 0.1)
+
+	err := model.Learn()
+	assert.NotNil(t, err, "Learning without a training set should return an error")
+
+	model.UpdateTrainingSet([][]float64{{0}, {1}}, []float64{0})
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning with fewer results than examples should return an error")
+
+	model.UpdateTrainingSet([][]float64{{0}, {1}}, []float64{0, 1})
+	model.UpdateEpsilon(-1)
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning with ε < 0 should return an error")
+
+	model.UpdateEpsilon(0.1)
+	model.UpdateCost(0)
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning with C = 0 should return an error")
+
+	model.UpdateCost(1)
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	_, err = model.Predict([]float64{0, 1})
+	assert.NotNil(t, err, "Predicting with the wrong number of features should return an error")
+
+	model = NewSVR(nil, 1, 0.1)
+	model.UpdateTrainingSet([][]float64{{0}, {1}}, []float64{0, 1})
+	err = model.Learn()
+	assert.NotNil(t, err, "Learning without a kernel should return an error")
+}
+
+func TestLoadSVRShouldPass1(t *testing.T) {
+	r := rand.New(rand.NewSource(67))
+	x, y := sine(r, 100, 0.05)
+
+	model, err := NewSVRFromSpec(base.GaussianKernelSpec(1), 10, 0.1)
+	assert.Nil(t, err, "Creating the model should not return an error")
+	model.UpdateTrainingSet(x, y)
+
+	err = model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	err = model.PersistToFile("/tmp/.goml/SVR.json")
+	assert.Nil(t, err, "Persistance error should be nil")
+
+	loaded, err := base.Load("/tmp/.goml/SVR.json")
+	assert.Nil(t, err, "Load error should be nil")
+
+	restored, ok := loaded.(*SVR)
+	assert.True(t, ok, "Loaded model should be a *SVR")
+	assert.Equal(t, 0, restored.Examples(), "Restored model shouldn't have a training set")
+	assert.Equal(t, 0.1, restored.epsilon, "ε should be restored")
+
+	for _, v := range []float64{0.5, 2, 4, 5.5} {
+		expected, err := model.Predict([]float64{v})
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		guess, err := restored.Predict([]float64{v})
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, guess, "Restored model should predict the same")
+	}
+}
@@ -72,10 +72,8 @@ Example Online Naive Bayes Text Classifier (multiclass):
 package text
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math"
 	"os"
 	"strings"
@@ -476,32 +474,92 @@ func (b *NaiveBayes) String() string {
 	return fmt.Sprintf("h(θ) = argmax_c{log(P(y = c)) + Σlog(P(x|y = c))}\n\tClasses: %v\n\tDocuments evaluated in model: %v\n\tWords evaluated in model: %v\n", len(b.Count), int(b.DocumentCount), int(b.DictCount))
 }
 
-// PersistToFile takes in an absolute filepath and saves the
-// parameter vector θ to the file, which can be restored later.
-// The function will take paths from the current directory, but
-// functions
+// naiveBayesData holds the persisted fields of a
+// NaiveBayes model (the same layout the model itself
+// is marshalled to, minus the Output writer)
+type naiveBayesData struct {
+	Words         map[string]Word `json:"words"`
+	Count         []uint64        `json:"count"`
+	Probabilities []float64       `json:"probabilities"`
+	DocumentCount uint64          `json:"document_count"`
+	DictCount     uint64          `json:"vocabulary_size"`
+}
+
+// naiveBayesType is the name NaiveBayes models are
+// registered and persisted under
+const naiveBayesType = "text.NaiveBayes"
+
+func init() {
+	base.RegisterModel(naiveBayesType, func() base.Persistable {
+		return NewNaiveBayes(nil, 0, base.OnlyWordsAndNumbers)
+	})
+}
+
+// MarshalEnvelope returns the model wrapped in a
+// base.Envelope. The data of the envelope is the
+// model itself (word counts, class counts and
+// probabilities, etc.)
 //
-// The data is stored as JSON because it's one of the most
-// efficient storage method (you only need one comma extra
-// per feature + two brackets, total!) And it's extendable.
-func (b *NaiveBayes) PersistToFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+// The sanitization function can't be saved, so
+// a restored model will keep using the function
+// it was created with.
+func (b *NaiveBayes) MarshalEnvelope() (*base.Envelope, error) {
+	env := &base.Envelope{
+		Type: naiveBayesType,
+		Metadata: base.TrainingMetadata{
+			Examples: int(b.DocumentCount),
+		},
 	}
 
-	bytes, err := json.Marshal(b)
+	err := env.Encode(nil, naiveBayesData{
+		Words:         b.Words,
+		Count:         b.Count,
+		Probabilities: b.Probabilities,
+		DocumentCount: b.DocumentCount,
+		DictCount:     b.DictCount,
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = ioutil.WriteFile(path, bytes, os.ModePerm)
+	return env, nil
+}
+
+// UnmarshalEnvelope restores the model from the
+// given base.Envelope
+func (b *NaiveBayes) UnmarshalEnvelope(env *base.Envelope) error {
+	// decode into new storage so words from the
+	// current model aren't merged into those
+	// being restored
+	var restored naiveBayesData
+	err := env.Decode(naiveBayesType, nil, &restored)
 	if err != nil {
 		return err
 	}
 
+	b.Words = restored.Words
+	b.Count = restored.Count
+	b.Probabilities = restored.Probabilities
+	b.DocumentCount = restored.DocumentCount
+	b.DictCount = restored.DictCount
+
+	if b.Words == nil {
+		b.Words = make(map[string]Word)
+	}
+
 	return nil
 }
 
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later. The
+// function will take paths from the current directory, but
+// functions
+//
+// The model is stored as a JSON base.Envelope.
+func (b *NaiveBayes) PersistToFile(path string) error {
+	return base.PersistModel(path, b)
+}
+
 // Restore takes the bytes of a NaiveBayes model and
 // restores a model to it. This would be useful if
 // training a model and saving it into a project
@@ -511,37 +569,44 @@ func (b *NaiveBayes) PersistToFile(path string) error {
 // in text models vs. others because the text models
 // usually have much larger storage requirements
 func (b *NaiveBayes) Restore(bytes []byte) error {
-	err := json.Unmarshal(bytes, &b)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return base.UnmarshalModel(bytes, b)
 }
 
-// RestoreFromFile takes in a path to a parameter vector theta
-// and assigns the model it's operating on's parameter vector
-// to that.
+// RestoreFromFile takes in a path to a persisted model
+// and restores the model it's operating on from it.
 //
 // The path must ba an absolute path or a path from the current
 // directory
 //
+// Files holding the bare model (as persisted by older
+// versions of goml) can also be restored.
+//
 // This would be useful in persisting data between running
 // a model on data.
 func (b *NaiveBayes) RestoreFromFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
-	}
+	return base.RestoreModel(path, b)
+}
 
-	bytes, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
-	}
+// WriteTo writes the persisted model (the same bytes
+// PersistToFile writes) to w, implementing io.WriterTo
+func (b *NaiveBayes) WriteTo(w io.Writer) (int64, error) {
+	return base.WriteModel(w, b)
+}
 
-	err = json.Unmarshal(bytes, &b)
-	if err != nil {
-		return err
-	}
+// ReadFrom restores the model from a persisted model
+// read from r until EOF, implementing io.ReaderFrom
+func (b *NaiveBayes) ReadFrom(r io.Reader) (int64, error) {
+	return base.ReadModel(r, b)
+}
 
-	return nil
+// MarshalBinary returns the persisted model as bytes,
+// implementing encoding.BinaryMarshaler
+func (b *NaiveBayes) MarshalBinary() ([]byte, error) {
+	return base.MarshalModel(b)
+}
+
+// UnmarshalBinary restores the model from the bytes of
+// a persisted model, implementing encoding.BinaryUnmarshaler
+func (b *NaiveBayes) UnmarshalBinary(data []byte) error {
+	return base.UnmarshalModel(data, b)
 }
@@ -1,6 +1,7 @@
 package text
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -228,3 +229,83 @@ func TestPersistPerceptronShouldPass1(t *testing.T) {
 	class = model.Predict("My mother is in Los Angeles") // 0
 	assert.EqualValues(t, 1, class, "Class should be 0")
 }
+
+func TestWriteToNaiveBayesShouldPass1(t *testing.T) {
+	stream := make(chan base.TextDatapoint, 100)
+	errors := make(chan error)
+
+	model := NewNaiveBayes(stream, 2, base.OnlyWordsAndNumbers)
+
+	go model.OnlineLearn(errors)
+
+	stream <- base.TextDatapoint{
+		X: "I love the city",
+		Y: 1,
+	}
+
+	stream <- base.TextDatapoint{
+		X: "I hate Los Angeles",
+		Y: 0,
+	}
+
+	close(stream)
+
+	for {
+		_, more := <-errors
+		if !more {
+			break
+		}
+	}
+
+	var buf bytes.Buffer
+	_, err := model.WriteTo(&buf)
+	assert.Nil(t, err, "Write error should be nil")
+
+	restored := NewNaiveBayes(nil, 2, base.OnlyWordsAndNumbers)
+	restored.Words["stale"] = Word{Count: []uint64{1, 1}, Seen: 2, DocsSeen: 1}
+
+	_, err = restored.ReadFrom(&buf)
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, model.Words, restored.Words, "Words should be restored without merging old words")
+	assert.Equal(t, model.Count, restored.Count, "Counts should be restored")
+	assert.EqualValues(t, 1, restored.Predict("I love the city"), "Restored model should predict like the original")
+}
+
+func TestCompactNaiveBayesShouldPass1(t *testing.T) {
+	stream := make(chan base.TextDatapoint, 100)
+	errors := make(chan error)
+
+	model := NewNaiveBayes(stream, 2, base.OnlyWordsAndNumbers)
+
+	go model.OnlineLearn(errors)
+
+	stream <- base.TextDatapoint{
+		X: "I love the city",
+		Y: 1,
+	}
+
+	stream <- base.TextDatapoint{
+		X: "I hate Los Angeles",
+		Y: 0,
+	}
+
+	close(stream)
+
+	for {
+		_, more := <-errors
+		if !more {
+			break
+		}
+	}
+
+	var buf bytes.Buffer
+	_, err := base.WriteModelCompact(&buf, model, base.CompactOptions{Compress: true})
+	assert.Nil(t, err, "Write error should be nil")
+
+	restored := NewNaiveBayes(nil, 2, base.OnlyWordsAndNumbers)
+	_, err = restored.ReadFrom(&buf)
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, model.Words, restored.Words, "Words should be restored")
+	assert.Equal(t, model.Count, restored.Count, "Counts should be restored")
+	assert.EqualValues(t, 1, restored.Predict("I love the city"), "Restored model should predict like the original")
+}